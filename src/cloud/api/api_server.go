@@ -119,7 +119,12 @@ func main() {
 		log.WithError(err).Fatal("Failed to init Hydra + Kratos idprovider client")
 	}
 
-	env, err := apienv.New(ac, pc, oc, vk, ak, vc, at, oa, cm)
+	pl, dr, err := apienv.NewPluginServiceClients()
+	if err != nil {
+		log.WithError(err).Fatal("Failed to init plugin clients")
+	}
+
+	env, err := apienv.New(ac, pc, oc, vk, ak, vc, at, oa, cm, pl, dr)
 	if err != nil {
 		log.WithError(err).Fatal("Failed to create api environment")
 	}
@@ -263,6 +268,9 @@ func main() {
 	cs := &controllers.ConfigServiceServer{ConfigServiceClient: cm}
 	cloudpb.RegisterConfigServiceServer(s.GRPCServer(), cs)
 
+	ps := &controllers.PluginServiceServer{PluginServiceClient: pl, DataRetentionPluginServiceClient: dr}
+	cloudpb.RegisterPluginServiceServer(s.GRPCServer(), ps)
+
 	gqlEnv := controllers.GraphQLEnv{
 		ArtifactTrackerServer: artifactTrackerServer,
 		VizierClusterInfo:     cis,
@@ -272,6 +280,7 @@ func main() {
 		AutocompleteServer:    as,
 		OrgServer:             os,
 		UserServer:            us,
+		PluginServer:          ps,
 	}
 
 	mux.Handle("/api/graphql", controllers.WithAugmentedAuthMiddleware(env, controllers.NewGraphQLHandler(gqlEnv)))
@@ -29,6 +29,7 @@ import (
 	"px.dev/pixie/src/cloud/artifact_tracker/artifacttrackerpb"
 	"px.dev/pixie/src/cloud/auth/authpb"
 	"px.dev/pixie/src/cloud/config_manager/configmanagerpb"
+	"px.dev/pixie/src/cloud/plugin/pluginpb"
 	"px.dev/pixie/src/cloud/profile/profilepb"
 	"px.dev/pixie/src/cloud/vzmgr/vzmgrpb"
 	"px.dev/pixie/src/shared/services/env"
@@ -50,6 +51,8 @@ type APIEnv interface {
 	APIKeyClient() authpb.APIKeyServiceClient
 	ArtifactTrackerClient() artifacttrackerpb.ArtifactTrackerClient
 	IdentityProviderClient() IdentityProviderClient
+	PluginClient() pluginpb.PluginServiceClient
+	DataRetentionPluginClient() pluginpb.DataRetentionPluginServiceClient
 }
 
 // IdentityProviderClient is the interface for IdentityProvider clients that require endpoints.
@@ -63,30 +66,33 @@ type IdentityProviderClient interface {
 // Impl is an implementation of the APIEnv interface.
 type Impl struct {
 	*env.BaseEnv
-	cookieStore            sessions.Store
-	authClient             authpb.AuthServiceClient
-	profileClient          profilepb.ProfileServiceClient
-	orgClient              profilepb.OrgServiceClient
-	vzDeployKeyClient      vzmgrpb.VZDeploymentKeyServiceClient
-	apiKeyClient           authpb.APIKeyServiceClient
-	vzMgrClient            vzmgrpb.VZMgrServiceClient
-	artifactTrackerClient  artifacttrackerpb.ArtifactTrackerClient
-	identityProviderClient IdentityProviderClient
-	configClient           configmanagerpb.ConfigManagerServiceClient
+	cookieStore               sessions.Store
+	authClient                authpb.AuthServiceClient
+	profileClient             profilepb.ProfileServiceClient
+	orgClient                 profilepb.OrgServiceClient
+	vzDeployKeyClient         vzmgrpb.VZDeploymentKeyServiceClient
+	apiKeyClient              authpb.APIKeyServiceClient
+	vzMgrClient               vzmgrpb.VZMgrServiceClient
+	artifactTrackerClient     artifacttrackerpb.ArtifactTrackerClient
+	identityProviderClient    IdentityProviderClient
+	configClient              configmanagerpb.ConfigManagerServiceClient
+	pluginClient              pluginpb.PluginServiceClient
+	dataRetentionPluginClient pluginpb.DataRetentionPluginServiceClient
 }
 
 // New creates a new api env.
 func New(ac authpb.AuthServiceClient, pc profilepb.ProfileServiceClient, oc profilepb.OrgServiceClient,
 	vk vzmgrpb.VZDeploymentKeyServiceClient, ak authpb.APIKeyServiceClient, vc vzmgrpb.VZMgrServiceClient,
 	at artifacttrackerpb.ArtifactTrackerClient, oa IdentityProviderClient,
-	cm configmanagerpb.ConfigManagerServiceClient) (APIEnv, error) {
+	cm configmanagerpb.ConfigManagerServiceClient, pl pluginpb.PluginServiceClient,
+	dr pluginpb.DataRetentionPluginServiceClient) (APIEnv, error) {
 	sessionKey := viper.GetString("session_key")
 	if len(sessionKey) == 0 {
 		return nil, errors.New("session_key is required for cookie store")
 	}
 
 	sessionStore := sessions.NewCookieStore([]byte(sessionKey))
-	return &Impl{env.New(viper.GetString("domain_name")), sessionStore, ac, pc, oc, vk, ak, vc, at, oa, cm}, nil
+	return &Impl{env.New(viper.GetString("domain_name")), sessionStore, ac, pc, oc, vk, ak, vc, at, oa, cm, pl, dr}, nil
 }
 
 // CookieStore returns the CookieStore from the environment.
@@ -133,3 +139,13 @@ func (e *Impl) ArtifactTrackerClient() artifacttrackerpb.ArtifactTrackerClient {
 func (e *Impl) IdentityProviderClient() IdentityProviderClient {
 	return e.identityProviderClient
 }
+
+// PluginClient returns a plugin service client.
+func (e *Impl) PluginClient() pluginpb.PluginServiceClient {
+	return e.pluginClient
+}
+
+// DataRetentionPluginClient returns a data retention plugin service client.
+func (e *Impl) DataRetentionPluginClient() pluginpb.DataRetentionPluginServiceClient {
+	return e.dataRetentionPluginClient
+}
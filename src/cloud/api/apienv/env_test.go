@@ -30,7 +30,7 @@ import (
 
 func TestNew(t *testing.T) {
 	viper.Set("session_key", "a-key")
-	env, err := apienv.New(nil, nil, nil, nil, nil, nil, nil, nil, nil)
+	env, err := apienv.New(nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil)
 	require.NoError(t, err)
 	assert.NotNil(t, env)
 	assert.NotNil(t, env.CookieStore())
@@ -38,7 +38,7 @@ func TestNew(t *testing.T) {
 
 func TestNew_MissingSessionKey(t *testing.T) {
 	viper.Set("session_key", "")
-	env, err := apienv.New(nil, nil, nil, nil, nil, nil, nil, nil, nil)
+	env, err := apienv.New(nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil)
 	assert.NotNil(t, err)
 	assert.Nil(t, env)
 }
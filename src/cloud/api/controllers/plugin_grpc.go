@@ -0,0 +1,94 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+
+	"px.dev/pixie/src/api/proto/cloudpb"
+	"px.dev/pixie/src/cloud/plugin/pluginpb"
+	"px.dev/pixie/src/shared/services/authcontext"
+	"px.dev/pixie/src/utils"
+)
+
+// PluginServiceServer is the server that implements the PluginService gRPC service.
+type PluginServiceServer struct {
+	PluginServiceClient              pluginpb.PluginServiceClient
+	DataRetentionPluginServiceClient pluginpb.DataRetentionPluginServiceClient
+}
+
+// GetPlugins fetches all of the available plugins.
+func (p *PluginServiceServer) GetPlugins(ctx context.Context, req *cloudpb.GetPluginsRequest) (*cloudpb.GetPluginsResponse, error) {
+	ctx, err := contextWithAuthToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pReq := &pluginpb.GetPluginsRequest{}
+	if req.Kind == cloudpb.PK_RETENTION {
+		pReq.Kind = pluginpb.PLUGIN_KIND_RETENTION
+	}
+	pResp, err := p.PluginServiceClient.GetPlugins(ctx, pReq)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &cloudpb.GetPluginsResponse{
+		Plugins: make([]*cloudpb.Plugin, len(pResp.Plugins)),
+	}
+	for i, plugin := range pResp.Plugins {
+		resp.Plugins[i] = &cloudpb.Plugin{
+			Name:               plugin.Name,
+			ID:                 plugin.ID,
+			Description:        plugin.Description,
+			Logo:               plugin.Logo,
+			LatestVersion:      plugin.LatestVersion,
+			RetentionSupported: plugin.RetentionEnabled,
+		}
+	}
+	return resp, nil
+}
+
+// GetOrgRetentionPluginConfig gets the current org's configuration for a data retention plugin. The values are redacted,
+// since the response is returned to the browser.
+func (p *PluginServiceServer) GetOrgRetentionPluginConfig(ctx context.Context, req *cloudpb.GetOrgRetentionPluginConfigRequest) (*cloudpb.GetOrgRetentionPluginConfigResponse, error) {
+	sCtx, err := authcontext.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	orgID := utils.ProtoFromUUIDStrOrNil(sCtx.Claims.GetUserClaims().OrgID)
+
+	ctx, err = contextWithAuthToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pResp, err := p.DataRetentionPluginServiceClient.GetOrgRetentionPluginConfig(ctx, &pluginpb.GetOrgRetentionPluginConfigRequest{
+		OrgID:         orgID,
+		PluginID:      req.PluginID,
+		RedactSecrets: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &cloudpb.GetOrgRetentionPluginConfigResponse{
+		Configs: pResp.Configurations,
+	}, nil
+}
@@ -0,0 +1,103 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+	"sort"
+
+	"px.dev/pixie/src/api/proto/cloudpb"
+)
+
+var pluginKindToProtoMap = map[string]cloudpb.PluginKind{
+	"PK_UNKNOWN":   cloudpb.PK_UNKNOWN,
+	"PK_RETENTION": cloudpb.PK_RETENTION,
+}
+
+// PluginResolver resolves metadata about a plugin.
+type PluginResolver struct {
+	ID                 string
+	Name               string
+	Description        string
+	Logo               string
+	LatestVersion      string
+	RetentionSupported bool
+}
+
+type pluginsArgs struct {
+	Kind *string
+}
+
+// Plugins lists the available plugins.
+func (q *QueryResolver) Plugins(ctx context.Context, args *pluginsArgs) ([]*PluginResolver, error) {
+	req := &cloudpb.GetPluginsRequest{}
+	if args.Kind != nil {
+		req.Kind = pluginKindToProtoMap[*args.Kind]
+	}
+
+	resp, err := q.Env.PluginServer.GetPlugins(ctx, req)
+	if err != nil {
+		return nil, rpcErrorHelper(err)
+	}
+
+	resolvers := make([]*PluginResolver, len(resp.Plugins))
+	for i, p := range resp.Plugins {
+		resolvers[i] = &PluginResolver{
+			ID:                 p.ID,
+			Name:               p.Name,
+			Description:        p.Description,
+			Logo:               p.Logo,
+			LatestVersion:      p.LatestVersion,
+			RetentionSupported: p.RetentionSupported,
+		}
+	}
+	return resolvers, nil
+}
+
+// PluginConfigResolver resolves a single configuration value for a plugin.
+type PluginConfigResolver struct {
+	Name  string
+	Value string
+}
+
+type orgRetentionPluginConfigArgs struct {
+	ID string
+}
+
+// OrgRetentionPluginConfig gets the current org's configuration for a data retention plugin, ordered by name.
+func (q *QueryResolver) OrgRetentionPluginConfig(ctx context.Context, args *orgRetentionPluginConfigArgs) ([]*PluginConfigResolver, error) {
+	resp, err := q.Env.PluginServer.GetOrgRetentionPluginConfig(ctx, &cloudpb.GetOrgRetentionPluginConfigRequest{
+		PluginID: args.ID,
+	})
+	if err != nil {
+		return nil, rpcErrorHelper(err)
+	}
+
+	resolvers := make([]*PluginConfigResolver, 0, len(resp.Configs))
+	for name, value := range resp.Configs {
+		resolvers = append(resolvers, &PluginConfigResolver{
+			Name:  name,
+			Value: value,
+		})
+	}
+	sort.Slice(resolvers, func(i, j int) bool {
+		return resolvers[i].Name < resolvers[j].Name
+	})
+	return resolvers, nil
+}
@@ -0,0 +1,129 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package controllers_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/graph-gophers/graphql-go/gqltesting"
+
+	"px.dev/pixie/src/api/proto/cloudpb"
+	"px.dev/pixie/src/cloud/api/controllers/testutils"
+)
+
+func TestPluginResolver_Plugins(t *testing.T) {
+	gqlEnv, mockClients, cleanup := testutils.CreateTestGraphQLEnv(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	mockClients.MockPlugin.EXPECT().GetPlugins(gomock.Any(), &cloudpb.GetPluginsRequest{
+		Kind: cloudpb.PK_RETENTION,
+	}).Return(&cloudpb.GetPluginsResponse{
+		Plugins: []*cloudpb.Plugin{
+			{
+				Name:               "Test Plugin",
+				ID:                 "test-plugin",
+				Description:        "A test plugin",
+				Logo:               "https://example.com/logo.svg",
+				LatestVersion:      "0.0.2",
+				RetentionSupported: true,
+			},
+		},
+	}, nil)
+
+	gqlSchema := LoadSchema(gqlEnv)
+	gqltesting.RunTests(t, []*gqltesting.Test{
+		{
+			Schema:  gqlSchema,
+			Context: ctx,
+			Query: `
+				query {
+					plugins(kind: PK_RETENTION) {
+						id
+						name
+						description
+						logo
+						latestVersion
+						retentionSupported
+					}
+				}
+			`,
+			ExpectedResult: `
+				{
+					"plugins": [
+						{
+							"id": "test-plugin",
+							"name": "Test Plugin",
+							"description": "A test plugin",
+							"logo": "https://example.com/logo.svg",
+							"latestVersion": "0.0.2",
+							"retentionSupported": true
+						}
+					]
+				}
+			`,
+		},
+	})
+}
+
+func TestPluginResolver_OrgRetentionPluginConfig(t *testing.T) {
+	gqlEnv, mockClients, cleanup := testutils.CreateTestGraphQLEnv(t)
+	defer cleanup()
+	ctx := CreateTestContext()
+
+	mockClients.MockPlugin.EXPECT().GetOrgRetentionPluginConfig(gomock.Any(), &cloudpb.GetOrgRetentionPluginConfigRequest{
+		PluginID: "test-plugin",
+	}).Return(&cloudpb.GetOrgRetentionPluginConfigResponse{
+		Configs: map[string]string{
+			"API_KEY": "********",
+			"HOST":    "********",
+		},
+	}, nil)
+
+	gqlSchema := LoadSchema(gqlEnv)
+	gqltesting.RunTests(t, []*gqltesting.Test{
+		{
+			Schema:  gqlSchema,
+			Context: ctx,
+			Query: `
+				query {
+					orgRetentionPluginConfig(id: "test-plugin") {
+						name
+						value
+					}
+				}
+			`,
+			ExpectedResult: `
+				{
+					"orgRetentionPluginConfig": [
+						{
+							"name": "API_KEY",
+							"value": "********"
+						},
+						{
+							"name": "HOST",
+							"value": "********"
+						}
+					]
+				}
+			`,
+		},
+	})
+}
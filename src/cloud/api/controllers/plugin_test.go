@@ -0,0 +1,112 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package controllers_test
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"px.dev/pixie/src/api/proto/cloudpb"
+	"px.dev/pixie/src/cloud/api/controllers"
+	"px.dev/pixie/src/cloud/plugin/pluginpb"
+	mock_pluginpb "px.dev/pixie/src/cloud/plugin/pluginpb/mock"
+	"px.dev/pixie/src/utils"
+)
+
+func TestPluginServiceServer_GetPlugins(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPluginClient := mock_pluginpb.NewMockPluginServiceClient(ctrl)
+	mockDataRetentionClient := mock_pluginpb.NewMockDataRetentionPluginServiceClient(ctrl)
+	ctx := CreateTestContext()
+
+	mockPluginClient.EXPECT().GetPlugins(gomock.Any(), &pluginpb.GetPluginsRequest{
+		Kind: pluginpb.PLUGIN_KIND_RETENTION,
+	}).Return(&pluginpb.GetPluginsResponse{
+		Plugins: []*pluginpb.Plugin{
+			{
+				Name:             "Test Plugin",
+				ID:               "test-plugin",
+				Description:      "A test plugin",
+				Logo:             "https://example.com/logo.svg",
+				LatestVersion:    "0.0.2",
+				RetentionEnabled: true,
+			},
+		},
+	}, nil)
+
+	ps := &controllers.PluginServiceServer{
+		PluginServiceClient:              mockPluginClient,
+		DataRetentionPluginServiceClient: mockDataRetentionClient,
+	}
+
+	resp, err := ps.GetPlugins(ctx, &cloudpb.GetPluginsRequest{
+		Kind: cloudpb.PK_RETENTION,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &cloudpb.GetPluginsResponse{
+		Plugins: []*cloudpb.Plugin{
+			{
+				Name:               "Test Plugin",
+				ID:                 "test-plugin",
+				Description:        "A test plugin",
+				Logo:               "https://example.com/logo.svg",
+				LatestVersion:      "0.0.2",
+				RetentionSupported: true,
+			},
+		},
+	}, resp)
+}
+
+func TestPluginServiceServer_GetOrgRetentionPluginConfig(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPluginClient := mock_pluginpb.NewMockPluginServiceClient(ctrl)
+	mockDataRetentionClient := mock_pluginpb.NewMockDataRetentionPluginServiceClient(ctrl)
+	ctx := CreateTestContext()
+
+	mockDataRetentionClient.EXPECT().GetOrgRetentionPluginConfig(gomock.Any(), &pluginpb.GetOrgRetentionPluginConfigRequest{
+		OrgID:         utils.ProtoFromUUIDStrOrNil("6ba7b810-9dad-11d1-80b4-00c04fd430c8"),
+		PluginID:      "test-plugin",
+		RedactSecrets: true,
+	}).Return(&pluginpb.GetOrgRetentionPluginConfigResponse{
+		Configurations: map[string]string{
+			"API_KEY": "********",
+		},
+	}, nil)
+
+	ps := &controllers.PluginServiceServer{
+		PluginServiceClient:              mockPluginClient,
+		DataRetentionPluginServiceClient: mockDataRetentionClient,
+	}
+
+	resp, err := ps.GetOrgRetentionPluginConfig(ctx, &cloudpb.GetOrgRetentionPluginConfigRequest{
+		PluginID: "test-plugin",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &cloudpb.GetOrgRetentionPluginConfigResponse{
+		Configs: map[string]string{
+			"API_KEY": "********",
+		},
+	}, resp)
+}
@@ -0,0 +1,67 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// serverErrorCodes are the codes which indicate that an RPC failed because of the plugin service, rather than because
+// of the caller's request.
+var serverErrorCodes = map[codes.Code]bool{
+	codes.Unknown:          true,
+	codes.Internal:         true,
+	codes.Unavailable:      true,
+	codes.DataLoss:         true,
+	codes.DeadlineExceeded: true,
+}
+
+// rpcErrorFields returns the log fields for an RPC which failed with err. The org and plugin are left out if the
+// request does not specify them.
+func rpcErrorFields(method string, req interface{}, err error) log.Fields {
+	fields := log.Fields{
+		"operation": method,
+		"code":      status.Code(err).String(),
+	}
+	orgID, pluginID := requestIDs(req)
+	if orgID != "" {
+		fields["org_id"] = orgID
+	}
+	if pluginID != "" {
+		fields["plugin_id"] = pluginID
+	}
+	return fields
+}
+
+// logRPCError logs the error returned by an RPC, along with the org and plugin which the request was for. Failures
+// caused by the plugin service are logged as errors, and failures caused by the request, such as a missing plugin, are
+// logged at info level. Successful RPCs are not logged.
+func logRPCError(method string, req interface{}, err error) {
+	if err == nil {
+		return
+	}
+	entry := log.WithError(err).WithFields(rpcErrorFields(method, req, err))
+	if serverErrorCodes[status.Code(err)] {
+		entry.Error("Plugin service RPC failed")
+		return
+	}
+	entry.Info("Plugin service RPC was rejected")
+}
@@ -0,0 +1,92 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers_test
+
+import (
+	"context"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/cloud/plugin/controllers"
+	"px.dev/pixie/src/cloud/plugin/pluginpb"
+	"px.dev/pixie/src/utils"
+)
+
+func TestUnaryServerInterceptor_LogsErrors(t *testing.T) {
+	req := &pluginpb.GetOrgRetentionPluginConfigRequest{
+		OrgID:    utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
+		PluginID: "test-plugin",
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: "/px.services.internal.DataRetentionPluginService/GetOrgRetentionPluginConfig"}
+
+	tests := []struct {
+		name          string
+		err           error
+		expectedLevel log.Level
+	}{
+		{
+			name:          "server error",
+			err:           status.Error(codes.Internal, "Failed to fetch plugin"),
+			expectedLevel: log.ErrorLevel,
+		},
+		{
+			name:          "request error",
+			err:           status.Error(codes.NotFound, "plugin is not enabled"),
+			expectedLevel: log.InfoLevel,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hook := logtest.NewGlobal()
+			defer hook.Reset()
+
+			_, err := controllers.UnaryServerInterceptor()(context.Background(), req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+				return nil, test.err
+			})
+			assert.Equal(t, test.err, err)
+
+			require.Equal(t, 1, len(hook.Entries))
+			entry := hook.LastEntry()
+			assert.Equal(t, test.expectedLevel, entry.Level)
+			assert.Equal(t, info.FullMethod, entry.Data["operation"])
+			assert.Equal(t, "223e4567-e89b-12d3-a456-426655440000", entry.Data["org_id"])
+			assert.Equal(t, "test-plugin", entry.Data["plugin_id"])
+		})
+	}
+}
+
+func TestUnaryServerInterceptor_SuccessIsQuiet(t *testing.T) {
+	hook := logtest.NewGlobal()
+	defer hook.Reset()
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/px.services.internal.PluginService/GetPlugins"}
+	_, err := controllers.UnaryServerInterceptor()(context.Background(), &pluginpb.GetPluginsRequest{}, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return &pluginpb.GetPluginsResponse{}, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(hook.Entries))
+}
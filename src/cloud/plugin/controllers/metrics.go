@@ -0,0 +1,52 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var configDecryptionFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "plugin_config_decryption_failures",
+	Help: "Number of org plugin configs which could not be decrypted, or whose decrypted contents could not be parsed.",
+}, []string{"plugin_id"})
+
+func init() {
+	prometheus.MustRegister(configDecryptionFailures)
+}
+
+// isDecryptionError returns whether the error was caused by PGP_SYM_DECRYPT failing to decrypt a value, such as when
+// the wrong key is used.
+func isDecryptionError(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code.Name() == "external_routine_invocation_exception"
+}
+
+// unknownPluginID is the plugin_id label of decryption failures in queries over several plugins, where the failure can't
+// be attributed to one plugin since PGP_SYM_DECRYPT aborts the whole query.
+const unknownPluginID = "unknown"
+
+// recordDecryptionFailure counts a failure to decrypt an org's config for the plugin, if the error was caused by
+// PGP_SYM_DECRYPT.
+func recordDecryptionFailure(pluginID string, err error) {
+	if isDecryptionError(err) {
+		configDecryptionFailures.WithLabelValues(pluginID).Inc()
+	}
+}
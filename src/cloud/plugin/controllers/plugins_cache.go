@@ -0,0 +1,100 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+
+	"px.dev/pixie/src/cloud/plugin/pluginpb"
+)
+
+// defaultPluginsCacheTTL is the default duration for which GetPlugins responses are cached.
+const defaultPluginsCacheTTL = 5 * time.Second
+
+type pluginsCacheEntry struct {
+	resp      *pluginpb.GetPluginsResponse
+	expiresAt time.Time
+}
+
+// pluginsCache is an in-process TTL cache of GetPlugins responses, keyed by the request. A cache with a zero TTL
+// caches nothing.
+type pluginsCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*pluginsCacheEntry
+}
+
+func newPluginsCache(ttl time.Duration) *pluginsCache {
+	return &pluginsCache{
+		ttl:     ttl,
+		entries: make(map[string]*pluginsCacheEntry),
+	}
+}
+
+func pluginsCacheKey(req *pluginpb.GetPluginsRequest) string {
+	return fmt.Sprintf("%d/%d/%s/%t/%t/%q/%d/%t/%q", req.Kind, req.PageSize, req.PageToken, req.IncludeBeta, req.IncludeUsageStats, req.TagFilter, req.SortBy, req.SortDescending, req.Namespace)
+}
+
+// get returns a copy of the cached response for the request, or nil if there is no unexpired response.
+func (c *pluginsCache) get(req *pluginpb.GetPluginsRequest) *pluginpb.GetPluginsResponse {
+	if c.ttl <= 0 {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[pluginsCacheKey(req)]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return nil
+	}
+	return proto.Clone(entry.resp).(*pluginpb.GetPluginsResponse)
+}
+
+// set caches a copy of the response for the request, and evicts any expired responses.
+func (c *pluginsCache) set(req *pluginpb.GetPluginsRequest, resp *pluginpb.GetPluginsResponse) {
+	if c.ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for k, entry := range c.entries {
+		if now.After(entry.expiresAt) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[pluginsCacheKey(req)] = &pluginsCacheEntry{
+		resp:      proto.Clone(resp).(*pluginpb.GetPluginsResponse),
+		expiresAt: now.Add(c.ttl),
+	}
+}
+
+// invalidate evicts all cached responses. This should be called whenever the plugin catalog changes.
+func (c *pluginsCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[string]*pluginsCacheEntry)
+}
@@ -0,0 +1,105 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+const (
+	// defaultOrgConfigWritesPerMinute is the default rate at which an org may write its plugin configs.
+	defaultOrgConfigWritesPerMinute = 120
+	// defaultOrgConfigWriteBurst is the default number of config writes an org may make at once.
+	defaultOrgConfigWriteBurst = 60
+)
+
+type tokenBucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+// orgRateLimiter is an in-process token bucket rate limiter, with a bucket per org. Each org may make up to burst
+// requests at once, and its bucket refills at perMinute tokens per minute. A limiter with a zero rate allows all
+// requests.
+type orgRateLimiter struct {
+	perMinute int
+	burst     int
+	now       func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[uuid.UUID]*tokenBucket
+	lastSweep time.Time
+}
+
+func newOrgRateLimiter(perMinute int, burst int) *orgRateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &orgRateLimiter{
+		perMinute: perMinute,
+		burst:     burst,
+		now:       time.Now,
+		buckets:   make(map[uuid.UUID]*tokenBucket),
+	}
+}
+
+// refill adds the tokens the bucket has gained since it was last updated, up to the burst.
+func (l *orgRateLimiter) refill(b *tokenBucket, now time.Time) {
+	b.tokens += now.Sub(b.updatedAt).Minutes() * float64(l.perMinute)
+	if b.tokens > float64(l.burst) {
+		b.tokens = float64(l.burst)
+	}
+	b.updatedAt = now
+}
+
+// allow takes a token from the org's bucket, returning false if the bucket is empty.
+func (l *orgRateLimiter) allow(orgID uuid.UUID) bool {
+	if l.perMinute <= 0 {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	// Full buckets are the same as missing buckets, so they are evicted to bound the limiter's memory.
+	if now.Sub(l.lastSweep) > time.Minute {
+		for id, b := range l.buckets {
+			l.refill(b, now)
+			if b.tokens >= float64(l.burst) {
+				delete(l.buckets, id)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[orgID]
+	if !ok {
+		b = &tokenBucket{tokens: float64(l.burst), updatedAt: now}
+		l.buckets[orgID] = b
+	}
+	l.refill(b, now)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
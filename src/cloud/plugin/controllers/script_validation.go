@@ -0,0 +1,138 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+var (
+	// templateActionRegex matches config placeholders, such as {{ .Config.license_key }}.
+	templateActionRegex = regexp.MustCompile(`\{\{.*?\}\}`)
+	pxImportRegex       = regexp.MustCompile(`(?m)^\s*import\s+px\s*$`)
+	pxExportRegex       = regexp.MustCompile(`\bpx\.export\s*\(`)
+
+	closingBrackets = map[byte]byte{')': '(', ']': '[', '}': '{'}
+)
+
+// scriptProblem is a problem found when validating a script's contents.
+type scriptProblem struct {
+	// line is the 1-indexed line the problem is on, or 0 if the problem is with the script as a whole.
+	line    int
+	message string
+}
+
+type openBracket struct {
+	char byte
+	line int
+}
+
+// validateScriptContents performs a shallow structural validation of a PxL retention script. It checks that strings
+// and brackets are closed, that config placeholders are well-formed, and that the script imports px and exports its
+// data. It does not compile the script, so a script without problems may still fail to run.
+func validateScriptContents(contents string) []scriptProblem {
+	if strings.TrimSpace(contents) == "" {
+		return []scriptProblem{{message: "Script is empty"}}
+	}
+
+	var problems []scriptProblem
+	if strings.Contains(contents, "{{") {
+		if _, err := template.New("script").Parse(contents); err != nil {
+			problems = append(problems, scriptProblem{message: fmt.Sprintf("Invalid config placeholder: %v", err)})
+		}
+		// Placeholders are replaced so that their braces aren't mistaken for dicts.
+		contents = templateActionRegex.ReplaceAllString(contents, "_")
+	}
+
+	// code is the script with its strings and comments removed.
+	var code strings.Builder
+	var brackets []openBracket
+	line := 1
+	for i := 0; i < len(contents); i++ {
+		c := contents[i]
+		switch {
+		case c == '\n':
+			line++
+			code.WriteByte(c)
+		case c == '#':
+			for i+1 < len(contents) && contents[i+1] != '\n' {
+				i++
+			}
+		case c == '"' || c == '\'':
+			quote := string(c)
+			if strings.HasPrefix(contents[i:], strings.Repeat(quote, 3)) {
+				quote = strings.Repeat(quote, 3)
+			}
+			startLine := line
+			closed := false
+			for i += len(quote); i < len(contents); i++ {
+				if strings.HasPrefix(contents[i:], quote) {
+					i += len(quote) - 1
+					closed = true
+					break
+				}
+				if contents[i] == '\\' && i+1 < len(contents) && contents[i+1] != '\n' {
+					i++
+					continue
+				}
+				if contents[i] == '\n' {
+					if len(quote) == 1 {
+						break
+					}
+					line++
+					code.WriteByte('\n')
+				}
+			}
+			if !closed {
+				problems = append(problems, scriptProblem{line: startLine, message: "String is never closed"})
+				// Single-line strings end at the newline, which is still part of the code.
+				if i < len(contents) {
+					i--
+				}
+			}
+			code.WriteString(`""`)
+		case c == '(' || c == '[' || c == '{':
+			brackets = append(brackets, openBracket{char: c, line: line})
+			code.WriteByte(c)
+		case closingBrackets[c] != 0:
+			if len(brackets) == 0 || brackets[len(brackets)-1].char != closingBrackets[c] {
+				problems = append(problems, scriptProblem{line: line, message: fmt.Sprintf("Unexpected '%c'", c)})
+			} else {
+				brackets = brackets[:len(brackets)-1]
+			}
+			code.WriteByte(c)
+		default:
+			code.WriteByte(c)
+		}
+	}
+	for _, b := range brackets {
+		problems = append(problems, scriptProblem{line: b.line, message: fmt.Sprintf("'%c' is never closed", b.char)})
+	}
+
+	if !pxImportRegex.MatchString(code.String()) {
+		problems = append(problems, scriptProblem{message: "Script must import px"})
+	}
+	if !pxExportRegex.MatchString(code.String()) {
+		problems = append(problems, scriptProblem{message: "Script must export its data with px.export"})
+	}
+	return problems
+}
@@ -19,38 +19,267 @@
 package controllers
 
 import (
+	"archive/zip"
+	"bytes"
 	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/blang/semver"
 	"github.com/gofrs/uuid"
+	"github.com/gogo/protobuf/jsonpb"
+	"github.com/gogo/protobuf/types"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
+	"px.dev/pixie/src/api/proto/uuidpb"
 	"px.dev/pixie/src/cloud/plugin/pluginpb"
+	"px.dev/pixie/src/shared/services/authcontext"
 	"px.dev/pixie/src/utils"
 )
 
+const (
+	// defaultMaxDescriptionLength is the default maximum length of a plugin description.
+	defaultMaxDescriptionLength = 1024
+	// defaultMaxLogoLength is the default maximum length of a plugin logo.
+	defaultMaxLogoLength = 512 * 1024
+	// maxScriptFrequencyS is the longest interval, in seconds, at which a retention script may run.
+	maxScriptFrequencyS = 24 * 60 * 60
+	// defaultScriptStreamBatchSize is the number of scripts sent in each StreamRetentionScripts response, if the
+	// request doesn't specify a batch size.
+	defaultScriptStreamBatchSize = 100
+	// defaultHealthCheckTimeout is how long to wait for a plugin's health check to respond when testing an org's
+	// configuration.
+	defaultHealthCheckTimeout = 10 * time.Second
+	// defaultScriptRunHistoryLimit is the number of runs returned by GetRetentionScriptRunHistory, if the request
+	// doesn't specify a limit.
+	defaultScriptRunHistoryLimit = 20
+	// maxScriptRunHistoryLimit is the most runs which GetRetentionScriptRunHistory returns.
+	maxScriptRunHistoryLimit = 1000
+)
+
 // Server is a bridge implementation of the pluginService.
 type Server struct {
 	db    *sqlx.DB
 	dbKey string
+	// previousDBKeys are keys which org configs may have been encrypted with before dbKey. They are only used to
+	// audit which configs cannot be decrypted.
+	previousDBKeys []string
+	// pgpOptions are the pgcrypto options which configs are encrypted with, such as the cipher algorithm. If empty,
+	// pgcrypto's defaults are used.
+	pgpOptions string
+	// readDB is used for pure-read queries. It is the same as db, unless a read replica is specified.
+	readDB *sqlx.DB
+	// gitOpsHashKey is the key which config values are hashed with by GetOrgConfigForGitOps. It is separate from dbKey,
+	// so that the hashes are unaffected by rotating dbKey.
+	gitOpsHashKey string
+
+	maxDescriptionLength int
+	maxLogoLength        int
+	// decryptedConfigServices are the IDs of the services which may read decrypted org configs. If nil, all callers
+	// may read decrypted org configs.
+	decryptedConfigServices map[string]bool
+	// pluginsCacheTTL is how long GetPlugins responses are cached for. If 0, responses are not cached.
+	pluginsCacheTTL time.Duration
+	pluginsCache    *pluginsCache
+	// decryptionSlots limits how many queries which decrypt org configs may run at once. If nil, decryptions are
+	// unbounded.
+	decryptionSlots chan struct{}
+	// healthCheckClient is used to call plugins' health checks when testing org configurations.
+	healthCheckClient *http.Client
+	// orgConfigWritesPerMinute and orgConfigWriteBurst limit how often each org may write its plugin configs and
+	// scripts. If orgConfigWritesPerMinute is 0, writes are not limited.
+	orgConfigWritesPerMinute int
+	orgConfigWriteBurst      int
+	orgConfigWriteLimiter    *orgRateLimiter
 
 	done chan struct{}
 	once sync.Once
 }
 
+// Option is an option for configuring the server.
+type Option func(s *Server)
+
+// WithReadReplica routes pure-read queries to the given read replica, rather than to the primary database. A nil
+// replica leaves reads on the primary.
+func WithReadReplica(readDB *sqlx.DB) Option {
+	return func(s *Server) {
+		if readDB != nil {
+			s.readDB = readDB
+		}
+	}
+}
+
+// WithGitOpsHashKey sets the key which GetOrgConfigForGitOps hashes config values with. If unset, a key is derived
+// from the database key, so the hashes change whenever the database key is rotated.
+func WithGitOpsHashKey(key string) Option {
+	return func(s *Server) {
+		s.gitOpsHashKey = key
+	}
+}
+
+// WithMaxDescriptionLength sets the maximum length of the description for a new plugin release.
+func WithMaxDescriptionLength(length int) Option {
+	return func(s *Server) {
+		s.maxDescriptionLength = length
+	}
+}
+
+// WithMaxLogoLength sets the maximum length of the logo for a new plugin release.
+func WithMaxLogoLength(length int) Option {
+	return func(s *Server) {
+		s.maxLogoLength = length
+	}
+}
+
+// WithDecryptedConfigServices restricts reading decrypted org configs to callers authenticated as one of the given
+// services. Other callers get org configs with their values redacted.
+func WithDecryptedConfigServices(serviceIDs ...string) Option {
+	return func(s *Server) {
+		s.decryptedConfigServices = make(map[string]bool)
+		for _, id := range serviceIDs {
+			s.decryptedConfigServices[id] = true
+		}
+	}
+}
+
+// WithPreviousDBKeys sets keys which org configs may have been encrypted with before the current key, for auditing
+// which configs cannot be decrypted.
+func WithPreviousDBKeys(keys ...string) Option {
+	return func(s *Server) {
+		s.previousDBKeys = keys
+	}
+}
+
+// WithPGPOptions sets the cipher and compression algorithms which configs are encrypted with. An empty cipher
+// algorithm or a compression algorithm of 0 uses pgcrypto's default. Configs are decrypted regardless of the algorithms
+// they were encrypted with, so changing the algorithms only affects new writes. Use ValidatePGPOptions to check the
+// algorithms are supported.
+func WithPGPOptions(cipherAlgo string, compressAlgo int) Option {
+	return func(s *Server) {
+		s.pgpOptions = pgpEncryptOptions(cipherAlgo, compressAlgo)
+	}
+}
+
+// WithPluginsCacheTTL sets how long GetPlugins responses are cached for. A TTL of 0 disables the cache.
+func WithPluginsCacheTTL(ttl time.Duration) Option {
+	return func(s *Server) {
+		s.pluginsCacheTTL = ttl
+	}
+}
+
+// WithMaxConcurrentDecryptions limits how many queries which decrypt org configs may run at once. Requests beyond the
+// limit wait for a slot until their context is done. A limit of 0 leaves decryptions unbounded.
+func WithMaxConcurrentDecryptions(n int) Option {
+	return func(s *Server) {
+		s.decryptionSlots = nil
+		if n > 0 {
+			s.decryptionSlots = make(chan struct{}, n)
+		}
+	}
+}
+
+// WithHealthCheckClient sets the client used to call plugins' health checks when testing org configurations.
+func WithHealthCheckClient(client *http.Client) Option {
+	return func(s *Server) {
+		s.healthCheckClient = client
+	}
+}
+
+// WithOrgConfigWriteRateLimit limits how often each org may write its plugin configs and scripts. An org may make up to
+// burst writes at once, and then perMinute writes per minute. Writes beyond the limit fail with ResourceExhausted. A
+// rate of 0 disables the limit.
+func WithOrgConfigWriteRateLimit(perMinute int, burst int) Option {
+	return func(s *Server) {
+		s.orgConfigWritesPerMinute = perMinute
+		s.orgConfigWriteBurst = burst
+	}
+}
+
 // New creates a new server.
-func New(db *sqlx.DB, dbKey string) *Server {
-	return &Server{
-		db:    db,
-		dbKey: dbKey,
-		done:  make(chan struct{}),
+func New(db *sqlx.DB, dbKey string, options ...Option) *Server {
+	s := &Server{
+		db:                   db,
+		dbKey:                dbKey,
+		readDB:               db,
+		maxDescriptionLength: defaultMaxDescriptionLength,
+		maxLogoLength:        defaultMaxLogoLength,
+		pluginsCacheTTL:      defaultPluginsCacheTTL,
+		healthCheckClient:    &http.Client{Timeout: defaultHealthCheckTimeout},
+		done:                 make(chan struct{}),
+
+		orgConfigWritesPerMinute: defaultOrgConfigWritesPerMinute,
+		orgConfigWriteBurst:      defaultOrgConfigWriteBurst,
+	}
+
+	for _, option := range options {
+		option(s)
+	}
+	if s.gitOpsHashKey == "" {
+		s.gitOpsHashKey = deriveKey(dbKey, gitOpsHashKeyLabel)
+	}
+	s.pluginsCache = newPluginsCache(s.pluginsCacheTTL)
+	s.orgConfigWriteLimiter = newOrgRateLimiter(s.orgConfigWritesPerMinute, s.orgConfigWriteBurst)
+
+	return s
+}
+
+// canReadDecryptedConfigs returns whether the caller may read the decrypted values of org configs.
+func (s *Server) canReadDecryptedConfigs(ctx context.Context) bool {
+	if s.decryptedConfigServices == nil {
+		return true
 	}
+	sCtx, err := authcontext.FromContext(ctx)
+	if err != nil || !sCtx.ValidClaims() {
+		return false
+	}
+	serviceClaims := sCtx.Claims.GetServiceClaims()
+	return serviceClaims != nil && s.decryptedConfigServices[serviceClaims.ServiceID]
+}
+
+// acquireDecryption waits for a slot to decrypt org configs, and returns a function which releases the slot. Returns an
+// error if the context is done before a slot is available.
+func (s *Server) acquireDecryption(ctx context.Context) (func(), error) {
+	if s.decryptionSlots == nil {
+		return func() {}, nil
+	}
+	_, span := tracer.Start(ctx, "acquireDecryption")
+	select {
+	case s.decryptionSlots <- struct{}{}:
+		endSpan(span, nil)
+		return func() { <-s.decryptionSlots }, nil
+	case <-ctx.Done():
+		err := contextError(ctx, status.Error(codes.Unavailable, "Too many concurrent decryptions"))
+		endSpan(span, err)
+		return nil, err
+	}
+}
+
+// checkOrgConfigWriteRate returns an error if the org has exceeded its limit on config writes. Writes to the org's
+// retention scripts and deletions of its configs count as config writes.
+func (s *Server) checkOrgConfigWriteRate(orgID uuid.UUID) error {
+	if !s.orgConfigWriteLimiter.allow(orgID) {
+		return status.Error(codes.ResourceExhausted, "Too many config updates for the org, try again later")
+	}
+	return nil
+}
+
+// isServiceCaller returns whether the caller is an internal service.
+func isServiceCaller(ctx context.Context) bool {
+	sCtx, err := authcontext.FromContext(ctx)
+	if err != nil || !sCtx.ValidClaims() {
+		return false
+	}
+	return sCtx.Claims.GetServiceClaims() != nil
 }
 
 // Stop performs any necessary cleanup before shutdown.
@@ -70,270 +299,4000 @@ type Plugin struct {
 	Logo                 *string `db:"logo"`
 	Version              string  `db:"version"`
 	DataRetentionEnabled bool    `db:"data_retention_enabled"`
+	ReleaseChannel       string  `db:"release_channel"`
+	EnabledOrgCount      int64   `db:"enabled_org_count"`
+	// Tags are the categories the plugin belongs to.
+	Tags pq.StringArray `db:"tags"`
+	// UpdatedAt is when the plugin release was last updated.
+	UpdatedAt time.Time `db:"updated_at"`
+	// Namespace is the catalog the plugin release belongs to.
+	Namespace string `db:"namespace"`
 }
 
-// GetPlugins fetches all of the available, latest plugins.
-func (s *Server) GetPlugins(ctx context.Context, req *pluginpb.GetPluginsRequest) (*pluginpb.GetPluginsResponse, error) {
-	query := `SELECT t1.name, t1.id, t1.description, t1.logo, t1.version, t1.data_retention_enabled FROM plugin_releases t1
-		JOIN (SELECT id, MAX(version) as version FROM plugin_releases GROUP BY id) t2
-	  	ON t1.id = t2.id AND t1.version = t2.version`
+func pluginToProto(p *Plugin) *pluginpb.Plugin {
+	ppb := &pluginpb.Plugin{
+		Name:             p.Name,
+		ID:               p.ID,
+		LatestVersion:    p.Version,
+		RetentionEnabled: p.DataRetentionEnabled,
+		ReleaseChannel:   p.ReleaseChannel,
+		Kind:             pluginpb.PLUGIN_KIND_CUSTOM,
+		Tags:             p.Tags,
+	}
+	// Only retention plugins can be enabled by orgs, so the usage stats are left unset for other kinds.
+	if p.DataRetentionEnabled {
+		ppb.Kind = pluginpb.PLUGIN_KIND_RETENTION
+		ppb.EnabledOrgCount = p.EnabledOrgCount
+	}
+	if p.Description != nil {
+		ppb.Description = *p.Description
+	}
+	if p.Logo != nil {
+		ppb.Logo = *p.Logo
+	}
+	return ppb
+}
+
+// pluginKindFilter returns the condition on plugin_releases which restricts a query to plugins of the given kind. Any
+// kind is allowed if the kind is unknown.
+func pluginKindFilter(kind pluginpb.PluginKind) string {
+	switch kind {
+	case pluginpb.PLUGIN_KIND_RETENTION:
+		return "AND data_retention_enabled='true'"
+	case pluginpb.PLUGIN_KIND_CUSTOM:
+		return "AND data_retention_enabled='false'"
+	default:
+		return ""
+	}
+}
 
-	if req.Kind == pluginpb.PLUGIN_KIND_RETENTION {
-		query = fmt.Sprintf("%s %s", query, "WHERE data_retention_enabled='true'")
+// getLatestVersions gets the latest version of each plugin in a namespace, keyed by plugin ID. If a plugin ID is
+// specified, only the latest version of that plugin is fetched. Beta releases are only considered if includeBeta is set.
+func (s *Server) getLatestVersions(ctx context.Context, namespace string, pluginID string, includeBeta bool) (map[string]string, error) {
+	query := `SELECT id, version FROM plugin_releases WHERE namespace=$1`
+	args := []interface{}{namespace}
+	if pluginID != "" {
+		args = append(args, pluginID)
+		query = fmt.Sprintf("%s AND id=$%d", query, len(args))
+	}
+	if !includeBeta {
+		args = append(args, releaseChannelStable)
+		query = fmt.Sprintf("%s AND release_channel=$%d", query, len(args))
 	}
 
-	rows, err := s.db.Queryx(query)
+	rows, err := s.readDB.QueryxContext(ctx, query, args...)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return &pluginpb.GetPluginsResponse{Plugins: nil}, nil
-		}
-		return nil, status.Errorf(codes.Internal, "Failed to fetch plugins")
+		return nil, err
 	}
 	defer rows.Close()
 
-	plugins := []*pluginpb.Plugin{}
+	versions := make(map[string][]string)
 	for rows.Next() {
-		var p Plugin
-		err = rows.StructScan(&p)
+		var id, version string
+		err = rows.Scan(&id, &version)
 		if err != nil {
-			return nil, status.Error(codes.Internal, "failed to read plugins")
+			return nil, err
 		}
-		ppb := &pluginpb.Plugin{
-			Name:             p.Name,
-			ID:               p.ID,
-			LatestVersion:    p.Version,
-			RetentionEnabled: p.DataRetentionEnabled,
-		}
-		if p.Description != nil {
-			ppb.Description = *p.Description
-		}
-		if p.Logo != nil {
-			ppb.Logo = *p.Logo
-		}
-		plugins = append(plugins, ppb)
+		versions[id] = append(versions[id], version)
 	}
-	return &pluginpb.GetPluginsResponse{Plugins: plugins}, nil
-}
 
-// RetentionPlugin contains metadata about a retention plugin.
-type RetentionPlugin struct {
-	ID                   string         `db:"plugin_id"`
-	Version              string         `db:"version"`
-	Configurations       Configurations `db:"configurations"`
-	DocumentationURL     *string        `db:"documentation_url"`
-	DefaultExportURL     *string        `db:"default_export_url"`
-	AllowCustomExportURL bool           `db:"allow_custom_export_url"`
-	PresetScripts        PresetScripts  `db:"preset_scripts"`
+	latest := make(map[string]string)
+	for id, v := range versions {
+		latest[id] = latestVersion(v)
+	}
+	return latest, nil
 }
 
-// GetRetentionPluginConfig gets the config for a specific plugin release.
-func (s *Server) GetRetentionPluginConfig(ctx context.Context, req *pluginpb.GetRetentionPluginConfigRequest) (*pluginpb.GetRetentionPluginConfigResponse, error) {
-	query := `SELECT plugin_id, version, configurations, preset_scripts, documentation_url, default_export_url, allow_custom_export_url FROM data_retention_plugin_releases WHERE plugin_id=$1 AND version=$2`
-	rows, err := s.db.Queryx(query, req.ID, req.Version)
+// getStoredLatestVersions gets the latest version of each plugin in a namespace from plugin_latest_releases, keyed by
+// plugin ID. Returns false if the stored versions are stale, in which case getLatestVersions should be used instead.
+func (s *Server) getStoredLatestVersions(ctx context.Context, namespace string, includeBeta bool) (map[string]string, bool, error) {
+	// The staleness check and the read are a single statement, so that they see the same snapshot. There is always at
+	// least one row, even if there are no plugins.
+	query := `SELECT f.fresh, l.id, l.version FROM
+		(SELECT COALESCE((SELECT revision = refreshed_revision FROM plugin_latest_releases_state), false) AS fresh) AS f
+		LEFT JOIN plugin_latest_releases AS l ON f.fresh AND l.namespace=$1 AND l.include_beta=$2`
+	rows, err := s.readDB.QueryxContext(ctx, query, namespace, includeBeta)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "Failed to fetch plugin")
+		return nil, false, err
 	}
 	defer rows.Close()
 
-	if rows.Next() {
-		var plugin RetentionPlugin
-		err := rows.StructScan(&plugin)
+	latest := make(map[string]string)
+	fresh := false
+	for rows.Next() {
+		var id, version sql.NullString
+		err = rows.Scan(&fresh, &id, &version)
 		if err != nil {
-			return nil, status.Errorf(codes.Internal, "Failed to read plugin")
-		}
-		ppb := &pluginpb.GetRetentionPluginConfigResponse{
-			Configurations:       plugin.Configurations,
-			AllowCustomExportURL: plugin.AllowCustomExportURL,
-			PresetScripts:        []*pluginpb.GetRetentionPluginConfigResponse_PresetScript{},
+			return nil, false, err
 		}
-		if plugin.DocumentationURL != nil {
-			ppb.DocumentationURL = *plugin.DocumentationURL
-		}
-		if plugin.DefaultExportURL != nil {
-			ppb.DefaultExportURL = *plugin.DefaultExportURL
+		if id.Valid {
+			latest[id.String] = version.String
 		}
-		if plugin.PresetScripts != nil {
-			for _, p := range plugin.PresetScripts {
-				ppb.PresetScripts = append(ppb.PresetScripts, &pluginpb.GetRetentionPluginConfigResponse_PresetScript{
-					Name:              p.Name,
-					Description:       p.Description,
-					DefaultFrequencyS: p.DefaultFrequencyS,
-					Script:            p.Script,
-				})
-			}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+	return latest, fresh, nil
+}
+
+// lockLatestReleases serializes refreshes of the stored latest releases, so that a full refresh and a release's creation
+// don't miss each other's changes. Writes to plugin_releases update plugin_latest_releases_state, so transactions which
+// both write releases and refresh must take the lock before writing, to avoid deadlocking with each other.
+func lockLatestReleases(ctx context.Context, tx *sqlx.Tx) error {
+	_, err := tx.ExecContext(ctx, `LOCK TABLE plugin_latest_releases_state IN EXCLUSIVE MODE`)
+	return err
+}
+
+// refreshLatestReleases recomputes the stored latest releases of a plugin in every namespace, or of every plugin if no
+// plugin ID is specified. The releases are ordered in the same way as getLatestVersions.
+func refreshLatestReleases(ctx context.Context, tx *sqlx.Tx, pluginID string) error {
+	err := lockLatestReleases(ctx, tx)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `DELETE FROM plugin_latest_releases WHERE $1 = '' OR id=$1`, pluginID)
+	if err != nil {
+		return err
+	}
+	query := fmt.Sprintf(`INSERT INTO plugin_latest_releases (namespace, id, include_beta, version)
+		SELECT DISTINCT ON (namespace, id) namespace, id, $2::boolean, version FROM plugin_releases WHERE ($1 = '' OR id=$1) AND ($2::boolean OR release_channel=$3)
+		ORDER BY namespace, id, %s`, semverOrder)
+	for _, includeBeta := range []bool{false, true} {
+		_, err = tx.ExecContext(ctx, query, pluginID, includeBeta, releaseChannelStable)
+		if err != nil {
+			return err
 		}
-		return ppb, nil
 	}
-	return nil, status.Error(codes.NotFound, "plugin not found")
+
+	if pluginID != "" {
+		// Creating the release incremented the revision once. If the stored releases were already stale, they are left
+		// stale, since other plugins may be out of date.
+		_, err = tx.ExecContext(ctx, `UPDATE plugin_latest_releases_state SET refreshed_revision = refreshed_revision + 1`)
+		return err
+	}
+	query = `INSERT INTO plugin_latest_releases_state (id, revision, refreshed_revision, refreshed_at) VALUES (true, 0, 0, NOW())
+		ON CONFLICT (id) DO UPDATE SET refreshed_revision = plugin_latest_releases_state.revision, refreshed_at = EXCLUDED.refreshed_at`
+	_, err = tx.ExecContext(ctx, query)
+	return err
 }
 
-// GetRetentionPluginsForOrg gets all data retention plugins enabled by the org.
-func (s *Server) GetRetentionPluginsForOrg(ctx context.Context, req *pluginpb.GetRetentionPluginsForOrgRequest) (*pluginpb.GetRetentionPluginsForOrgResponse, error) {
-	query := `SELECT r.name, r.id, r.description, r.logo, r.version, r.data_retention_enabled from plugin_releases as r, org_data_retention_plugins as o WHERE r.id = o.plugin_id AND r.version = o.version AND org_id=$1`
-	orgID := utils.UUIDFromProtoOrNil(req.OrgID)
-	rows, err := s.db.Queryx(query, orgID)
+// GetPlugins fetches all of the available, latest plugins in the requested namespace.
+func (s *Server) GetPlugins(ctx context.Context, req *pluginpb.GetPluginsRequest) (*pluginpb.GetPluginsResponse, error) {
+	if req.PageSize < 0 {
+		return nil, status.Error(codes.InvalidArgument, "Page size must not be negative")
+	}
+	var pageToken *pluginPageToken
+	if req.PageToken != "" {
+		var err error
+		pageToken, err = decodePluginPageToken(req.PageToken)
+		if err != nil || (req.SortBy == pluginpb.PLUGIN_SORT_BY_UPDATED_AT && pageToken.UpdatedAt == nil) {
+			return nil, status.Error(codes.InvalidArgument, "Invalid page token")
+		}
+	}
+
+	if resp := s.pluginsCache.get(req); resp != nil {
+		return resp, nil
+	}
+
+	namespace := req.Namespace
+	if namespace == "" {
+		namespace = defaultPluginNamespace
+	}
+	// The stored latest releases are used if they are current, so that they don't need to be computed for every request.
+	latest, fresh, err := s.getStoredLatestVersions(ctx, namespace, req.IncludeBeta)
+	if err == nil && !fresh {
+		latest, err = s.getLatestVersions(ctx, namespace, "", req.IncludeBeta)
+	}
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "Failed to fetch plugin")
+		return nil, contextError(ctx, status.Errorf(codes.Internal, "Failed to fetch plugins"))
+	}
+
+	ids := make([]string, 0, len(latest))
+	versions := make([]string, 0, len(latest))
+	for id, version := range latest {
+		ids = append(ids, id)
+		versions = append(versions, version)
 	}
 
+	// Releases created before updated_at was recorded are sorted as the least recently updated.
+	const updatedAt = "COALESCE(updated_at, 'epoch'::timestamp)"
+	query := `SELECT name, id, description, logo, version, data_retention_enabled, release_channel, tags, ` + updatedAt + ` AS updated_at FROM plugin_releases`
+	if req.IncludeUsageStats {
+		query = `SELECT name, id, description, logo, version, data_retention_enabled, release_channel, tags, ` + updatedAt + ` AS updated_at, COALESCE(u.enabled_org_count, 0) AS enabled_org_count
+			FROM plugin_releases LEFT JOIN (SELECT plugin_id, COUNT(*) AS enabled_org_count FROM org_data_retention_plugins WHERE enabled='true' GROUP BY plugin_id) AS u
+			ON u.plugin_id = plugin_releases.id`
+	}
+	query = fmt.Sprintf("%s %s", query, "WHERE (id, version) IN (SELECT * FROM UNNEST($1::varchar[], $2::varchar[]))")
+
+	args := []interface{}{pq.StringArray(ids), pq.StringArray(versions)}
+
+	query = fmt.Sprintf("%s %s", query, pluginKindFilter(req.Kind))
+	query = fmt.Sprintf("%s AND namespace=$%d", query, len(args)+1)
+	args = append(args, namespace)
+	if len(req.TagFilter) > 0 {
+		query = fmt.Sprintf("%s AND tags @> $%d::text[]", query, len(args)+1)
+		args = append(args, pq.StringArray(req.TagFilter))
+	}
+	sortKey := "name"
+	if req.SortBy == pluginpb.PLUGIN_SORT_BY_UPDATED_AT {
+		sortKey = updatedAt
+	}
+	cmp, direction := ">", ""
+	if req.SortDescending {
+		cmp, direction = "<", " DESC"
+	}
+	// Paginate with a (sort key, id) cursor rather than an offset, so that plugins created between page fetches do not
+	// cause other plugins to be skipped or returned twice.
+	if pageToken != nil {
+		query = fmt.Sprintf("%s AND (%s, id) %s ($%d, $%d)", query, sortKey, cmp, len(args)+1, len(args)+2)
+		if req.SortBy == pluginpb.PLUGIN_SORT_BY_UPDATED_AT {
+			args = append(args, *pageToken.UpdatedAt, pageToken.ID)
+		} else {
+			args = append(args, pageToken.Name, pageToken.ID)
+		}
+	}
+	query = fmt.Sprintf("%s ORDER BY %s%s, id%s", query, sortKey, direction, direction)
+	if req.PageSize > 0 {
+		// Fetch an extra plugin to determine whether there is a next page.
+		query = fmt.Sprintf("%s LIMIT $%d", query, len(args)+1)
+		args = append(args, req.PageSize+1)
+	}
+
+	rows, err := s.readDB.QueryxContext(ctx, query, args...)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return &pluginpb.GetPluginsResponse{Plugins: nil}, nil
+		}
+		return nil, contextError(ctx, status.Errorf(codes.Internal, "Failed to fetch plugins"))
+	}
 	defer rows.Close()
 
-	plugins := []*pluginpb.GetRetentionPluginsForOrgResponse_PluginState{}
+	var rowPlugins []Plugin
+	plugins := []*pluginpb.Plugin{}
 	for rows.Next() {
 		var p Plugin
 		err = rows.StructScan(&p)
 		if err != nil {
 			return nil, status.Error(codes.Internal, "failed to read plugins")
 		}
-		ppb := &pluginpb.GetRetentionPluginsForOrgResponse_PluginState{
-			Plugin: &pluginpb.Plugin{
-				Name:             p.Name,
-				ID:               p.ID,
-				RetentionEnabled: p.DataRetentionEnabled,
-			},
-			EnabledVersion: p.Version,
+		rowPlugins = append(rowPlugins, p)
+		plugins = append(plugins, pluginToProto(&p))
+	}
+
+	resp := &pluginpb.GetPluginsResponse{Plugins: plugins}
+	if req.PageSize > 0 && len(plugins) > int(req.PageSize) {
+		resp.Plugins = plugins[:req.PageSize]
+		last := rowPlugins[req.PageSize-1]
+		var lastUpdatedAt *time.Time
+		if req.SortBy == pluginpb.PLUGIN_SORT_BY_UPDATED_AT {
+			lastUpdatedAt = &last.UpdatedAt
 		}
-		plugins = append(plugins, ppb)
+		resp.NextPageToken = encodePluginPageToken(last.Name, last.ID, lastUpdatedAt)
 	}
-	return &pluginpb.GetRetentionPluginsForOrgResponse{Plugins: plugins}, nil
+	s.pluginsCache.set(req, resp)
+	return resp, nil
 }
 
-// GetOrgRetentionPluginConfig gets the org's configuration for a plugin.
-func (s *Server) GetOrgRetentionPluginConfig(ctx context.Context, req *pluginpb.GetOrgRetentionPluginConfigRequest) (*pluginpb.GetOrgRetentionPluginConfigResponse, error) {
-	query := `SELECT PGP_SYM_DECRYPT(configurations, $1::text) FROM org_data_retention_plugins WHERE org_id=$2 AND plugin_id=$3`
+// GetPluginsForExportFormat gets the plugins in the default namespace whose latest release supports exporting data in
+// the given format.
+func (s *Server) GetPluginsForExportFormat(ctx context.Context, req *pluginpb.GetPluginsForExportFormatRequest) (*pluginpb.GetPluginsForExportFormatResponse, error) {
+	if !knownExportFormats[req.Format] {
+		return nil, status.Error(codes.InvalidArgument, "Unknown export format")
+	}
 
-	orgID := utils.UUIDFromProtoOrNil(req.OrgID)
-	rows, err := s.db.Queryx(query, s.dbKey, orgID, req.PluginID)
+	latest, err := s.getLatestVersions(ctx, defaultPluginNamespace, "", false)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "Failed to fetch plugin")
+		return nil, contextError(ctx, status.Errorf(codes.Internal, "Failed to fetch plugins"))
 	}
-	defer rows.Close()
 
-	if rows.Next() {
-		var configurationJSON []byte
-		var configMap map[string]string
+	ids := make([]string, 0, len(latest))
+	versions := make([]string, 0, len(latest))
+	for id, version := range latest {
+		ids = append(ids, id)
+		versions = append(versions, version)
+	}
 
-		err := rows.Scan(&configurationJSON)
-		if err != nil {
-			return nil, status.Error(codes.Internal, "failed to read configs")
-		}
+	query := `SELECT r.name, r.id, r.description, r.logo, r.version, r.data_retention_enabled FROM plugin_releases AS r, data_retention_plugin_releases AS d
+		WHERE r.id = d.plugin_id AND r.version = d.version AND (r.id, r.version) IN (SELECT * FROM UNNEST($1::varchar[], $2::varchar[]))
+		AND $3 = ANY(d.export_formats) ORDER BY r.name, r.id`
+	rows, err := s.readDB.QueryxContext(ctx, query, pq.StringArray(ids), pq.StringArray(versions), req.Format)
+	if err != nil {
+		return nil, contextError(ctx, status.Errorf(codes.Internal, "Failed to fetch plugins"))
+	}
+	defer rows.Close()
 
-		err = json.Unmarshal(configurationJSON, &configMap)
+	plugins := []*pluginpb.Plugin{}
+	for rows.Next() {
+		var p Plugin
+		err = rows.StructScan(&p)
 		if err != nil {
-			return nil, status.Error(codes.Internal, "failed to read configs")
+			return nil, status.Error(codes.Internal, "failed to read plugins")
 		}
-
-		return &pluginpb.GetOrgRetentionPluginConfigResponse{
-			Configurations: configMap,
-		}, nil
+		plugins = append(plugins, pluginToProto(&p))
 	}
-	return nil, status.Error(codes.NotFound, "plugin is not enabled")
-}
-
-func (s *Server) enableOrgRetention(orgID uuid.UUID, pluginID string, version string, configurations []byte) error {
-	query := `INSERT INTO org_data_retention_plugins (org_id, plugin_id, version, configurations) VALUES ($1, $2, $3, PGP_SYM_ENCRYPT($4, $5))`
-
-	_, err := s.db.Exec(query, orgID, pluginID, version, configurations, s.dbKey)
-	return err
-}
-
-func (s *Server) disableOrgRetention(orgID uuid.UUID, pluginID string) error {
-	query := `DELETE FROM org_data_retention_plugins WHERE org_id=$1 AND plugin_id=$2`
-
-	_, err := s.db.Exec(query, orgID, pluginID)
-	return err
-}
-
-func (s *Server) updateOrgRetentionConfigs(orgID uuid.UUID, pluginID string, version string, configurations []byte) error {
-	query := `UPDATE org_data_retention_plugins SET version = $1, configurations = PGP_SYM_ENCRYPT($2, $3) WHERE org_id = $4 AND plugin_id = $5`
-
-	_, err := s.db.Exec(query, version, configurations, s.dbKey, orgID, pluginID)
-	return err
+	return &pluginpb.GetPluginsForExportFormatResponse{Plugins: plugins}, nil
 }
 
-// UpdateOrgRetentionPluginConfig updates an org's configuration for a plugin.
-func (s *Server) UpdateOrgRetentionPluginConfig(ctx context.Context, req *pluginpb.UpdateOrgRetentionPluginConfigRequest) (*pluginpb.UpdateOrgRetentionPluginConfigResponse, error) {
-	if utils.IsNilUUIDProto(req.OrgID) {
-		return nil, status.Error(codes.InvalidArgument, "Must specify OrgID")
+// CountPlugins counts the available plugins in the requested namespace. Like GetPlugins, a plugin is counted according
+// to its latest stable release in the namespace.
+func (s *Server) CountPlugins(ctx context.Context, req *pluginpb.CountPluginsRequest) (*pluginpb.CountPluginsResponse, error) {
+	namespace := req.Namespace
+	if namespace == "" {
+		namespace = defaultPluginNamespace
+	}
+	latest, err := s.getLatestVersions(ctx, namespace, "", false)
+	if err != nil {
+		return nil, contextError(ctx, status.Errorf(codes.Internal, "Failed to count plugins"))
 	}
 
-	if req.PluginID == "" {
-		return nil, status.Error(codes.InvalidArgument, "Must specify plugin ID")
+	ids := make([]string, 0, len(latest))
+	versions := make([]string, 0, len(latest))
+	for id, version := range latest {
+		ids = append(ids, id)
+		versions = append(versions, version)
 	}
 
-	if req.Enabled != nil && req.Enabled.Value && req.Version == nil {
-		return nil, status.Error(codes.InvalidArgument, "Must specify plugin version when enabling")
+	query := `SELECT COUNT(*), COUNT(*) FILTER (WHERE data_retention_enabled='true') FROM plugin_releases
+		WHERE (id, version) IN (SELECT * FROM UNNEST($1::varchar[], $2::varchar[]))`
+
+	query = fmt.Sprintf("%s %s", query, pluginKindFilter(req.Kind))
+
+	var total, retentionEnabled int64
+	err = s.readDB.QueryRowxContext(ctx, query, pq.StringArray(ids), pq.StringArray(versions)).Scan(&total, &retentionEnabled)
+	if err != nil {
+		return nil, contextError(ctx, status.Errorf(codes.Internal, "Failed to count plugins"))
 	}
+	return &pluginpb.CountPluginsResponse{
+		Total:            total,
+		RetentionEnabled: retentionEnabled,
+	}, nil
+}
 
-	var configurations []byte
-	var version string
+// semverOrder orders plugin releases from the latest version to the earliest, in the same order as compareVersions.
+// Versions which are not valid semver sort last, and releases sort before their pre-releases.
+const semverOrder = `version ~ '^v?[0-9]+\.[0-9]+\.[0-9]+' DESC,
+	string_to_array(substring(version from '^v?([0-9]+\.[0-9]+\.[0-9]+)'), '.')::bigint[] DESC,
+	version !~ '^v?[0-9]+\.[0-9]+\.[0-9]+-' DESC,
+	version DESC`
 
-	orgID := utils.UUIDFromProtoOrNil(req.OrgID)
-	if req.Version != nil {
-		version = req.Version.Value
+// GetLatestPluginReleases gets the latest release in the requested namespace of each of the plugins with the given names.
+func (s *Server) GetLatestPluginReleases(ctx context.Context, req *pluginpb.GetLatestPluginReleasesRequest) (*pluginpb.GetLatestPluginReleasesResponse, error) {
+	if len(req.Names) == 0 {
+		return &pluginpb.GetLatestPluginReleasesResponse{Plugins: []*pluginpb.Plugin{}}, nil
 	}
-	if req.Configurations != nil && len(req.Configurations) > 0 {
-		configurations, _ = json.Marshal(req.Configurations)
+	namespace := req.Namespace
+	if namespace == "" {
+		namespace = defaultPluginNamespace
 	}
 
-	if req.Enabled != nil && req.Enabled.Value { // Plugin was just enabled, we should create it.
-		return &pluginpb.UpdateOrgRetentionPluginConfigResponse{}, s.enableOrgRetention(orgID, req.PluginID, version, configurations)
-	} else if req.Enabled != nil && !req.Enabled.Value { // Plugin was disabled, we should delete it.
-		return &pluginpb.UpdateOrgRetentionPluginConfigResponse{}, s.disableOrgRetention(orgID, req.PluginID)
+	query := `SELECT DISTINCT ON (name) name, id, description, logo, version, data_retention_enabled, release_channel
+		FROM plugin_releases WHERE name = ANY($1) AND namespace=$2`
+	args := []interface{}{pq.StringArray(req.Names), namespace}
+	if !req.IncludeBeta {
+		args = append(args, releaseChannelStable)
+		query = fmt.Sprintf("%s AND release_channel=$%d", query, len(args))
 	}
+	query = fmt.Sprintf("%s ORDER BY name, %s", query, semverOrder)
 
-	// Fetch current configs.
-	query := `SELECT version, PGP_SYM_DECRYPT(configurations, $1::text) FROM org_data_retention_plugins WHERE org_id=$2 AND plugin_id=$3`
-	rows, err := s.db.Queryx(query, s.dbKey, orgID, req.PluginID)
+	rows, err := s.readDB.QueryxContext(ctx, query, args...)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "Failed to fetch plugin")
+		return nil, contextError(ctx, status.Error(codes.Internal, "Failed to fetch plugin releases"))
 	}
 	defer rows.Close()
 
-	var origConfig []byte
-	var origVersion string
-	if rows.Next() {
-		err := rows.Scan(&origVersion, &origConfig)
+	plugins := []*pluginpb.Plugin{}
+	for rows.Next() {
+		var p Plugin
+		err = rows.StructScan(&p)
 		if err != nil {
-			return nil, status.Error(codes.Internal, "failed to read configs")
+			return nil, status.Error(codes.Internal, "failed to read plugin releases")
 		}
+		plugins = append(plugins, pluginToProto(&p))
 	}
+	return &pluginpb.GetLatestPluginReleasesResponse{Plugins: plugins}, nil
+}
 
-	if configurations == nil {
-		configurations = origConfig
+// GetPluginLogos gets the logo of the latest release in the requested namespace of each of the plugins with the given
+// IDs. The latest stable release is used if the plugin has one, otherwise its latest beta release.
+func (s *Server) GetPluginLogos(ctx context.Context, req *pluginpb.GetPluginLogosRequest) (*pluginpb.GetPluginLogosResponse, error) {
+	logos := make(map[string]string)
+	if len(req.IDs) == 0 {
+		return &pluginpb.GetPluginLogosResponse{Logos: logos}, nil
 	}
-	if version == "" {
-		version = origVersion
+	namespace := req.Namespace
+	if namespace == "" {
+		namespace = defaultPluginNamespace
 	}
 
-	err = s.updateOrgRetentionConfigs(orgID, req.PluginID, version, configurations)
+	query := fmt.Sprintf(`SELECT DISTINCT ON (id) id, logo FROM plugin_releases WHERE id = ANY($1) AND namespace=$3
+		ORDER BY id, release_channel=$2 DESC, %s`, semverOrder)
+	rows, err := s.readDB.QueryxContext(ctx, query, pq.StringArray(req.IDs), releaseChannelStable, namespace)
 	if err != nil {
-		return nil, status.Error(codes.Internal, "failed to update configs")
+		return nil, contextError(ctx, status.Error(codes.Internal, "Failed to fetch plugin logos"))
 	}
+	defer rows.Close()
 
-	// if origVersion != version { // The user is updating the plugin.
-	// 	// TODO(michelle): If the user is updating the plugin, we may need to update some of the presetScripts users have configured.
-	// }
-
-	return &pluginpb.UpdateOrgRetentionPluginConfigResponse{}, nil
-}
-
-// GetRetentionScripts gets all retention scripts the org has configured.
-func (s *Server) GetRetentionScripts(ctx context.Context, req *pluginpb.GetRetentionScriptsRequest) (*pluginpb.GetRetentionScriptsResponse, error) {
-	return nil, errors.New("Not yet implemented")
-}
-
-// GetRetentionScript gets the details for a script an org is using for long-term data retention.
-func (s *Server) GetRetentionScript(ctx context.Context, req *pluginpb.GetRetentionScriptRequest) (*pluginpb.GetRetentionScriptResponse, error) {
-	return nil, errors.New("Not yet implemented")
+	for rows.Next() {
+		var id string
+		var logo sql.NullString
+		err = rows.Scan(&id, &logo)
+		if err != nil {
+			return nil, status.Error(codes.Internal, "failed to read plugin logos")
+		}
+		if logo.String != "" {
+			logos[id] = logo.String
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "Failed to fetch plugin logos"))
+	}
+	return &pluginpb.GetPluginLogosResponse{Logos: logos}, nil
 }
 
-// CreateRetentionScript creates a script that is used for long-term data retention.
+// CreatePluginRelease creates a new release of a plugin.
+func (s *Server) CreatePluginRelease(ctx context.Context, req *pluginpb.CreatePluginReleaseRequest) (*pluginpb.CreatePluginReleaseResponse, error) {
+	if req.ID == "" {
+		return nil, status.Error(codes.InvalidArgument, "Must specify plugin ID")
+	}
+	if req.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "Must specify plugin name")
+	}
+	if req.Version == "" {
+		return nil, status.Error(codes.InvalidArgument, "Must specify plugin version")
+	}
+	if len(req.Description) > s.maxDescriptionLength {
+		return nil, status.Errorf(codes.InvalidArgument, "Description must be at most %d characters", s.maxDescriptionLength)
+	}
+	if len(req.Logo) > s.maxLogoLength {
+		return nil, status.Errorf(codes.InvalidArgument, "Logo must be at most %d characters", s.maxLogoLength)
+	}
+	if req.Logo != "" {
+		if err := validateLogo(req.Logo); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "Invalid logo: %s", err.Error())
+		}
+	}
+	channel := req.ReleaseChannel
+	if channel == "" {
+		channel = releaseChannelStable
+	}
+	if !knownReleaseChannels[channel] {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown release channel %q", channel)
+	}
+	for _, tag := range req.Tags {
+		if tag == "" {
+			return nil, status.Error(codes.InvalidArgument, "Tags must not be empty")
+		}
+	}
+	namespace := req.Namespace
+	if namespace == "" {
+		namespace = defaultPluginNamespace
+	}
+	var typedConfigs []byte
+	if req.RetentionConfig != nil {
+		var err error
+		typedConfigs, err = typedConfigsToJSON(req.RetentionConfig.TypedConfigurations)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "Invalid typed configurations")
+		}
+		err = validateExportFormats(req.RetentionConfig.ExportFormats)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		err = validateRequiredConfigs(req.RetentionConfig.RequiredConfigurations, req.RetentionConfig.Configurations)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		err = validateSecretConfigs(req.RetentionConfig.SecretConfigurations, req.RetentionConfig.Configurations)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if duplicates := duplicatePresetScriptNames(req.RetentionConfig.PresetScripts); len(duplicates) > 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "Duplicate preset script names: %s", strings.Join(duplicates, ", "))
+		}
+		for _, dep := range req.RetentionConfig.Dependencies {
+			if dep == req.ID {
+				return nil, status.Error(codes.InvalidArgument, "Plugin cannot depend on itself")
+			}
+		}
+		if req.RetentionConfig.MinCLIVersion != "" {
+			_, err = semver.Parse(req.RetentionConfig.MinCLIVersion)
+			if err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "Invalid minimum CLI version: %s", err.Error())
+			}
+		}
+		if req.RetentionConfig.HealthCheckURL != "" && !isHTTPSURL(req.RetentionConfig.HealthCheckURL) {
+			return nil, status.Error(codes.InvalidArgument, "Health check URL must be an https URL")
+		}
+		if req.RetentionConfig.ConfigSchema != "" {
+			_, err = compileConfigSchema(req.RetentionConfig.ConfigSchema)
+			if err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "Invalid config schema: %s", err.Error())
+			}
+		}
+	}
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "failed to create release"))
+	}
+	defer tx.Rollback()
+
+	err = lockLatestReleases(ctx, tx)
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "failed to create release"))
+	}
+
+	// A plugin may have releases in several namespaces, such as a new version being tested in staging. Releases are
+	// still identified by their plugin ID and version, so a version can only be released to one namespace.
+	query := `INSERT INTO plugin_releases (name, id, description, logo, version, updated_at, data_retention_enabled, release_channel, tags, namespace) VALUES ($1, $2, $3, $4, $5, NOW(), $6, $7, $8, $9)`
+	_, err = tx.ExecContext(ctx, query, req.Name, req.ID, req.Description, req.Logo, req.Version, req.RetentionConfig != nil, channel, pq.StringArray(req.Tags), namespace)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+			return nil, status.Error(codes.AlreadyExists, "release already exists")
+		}
+		return nil, contextError(ctx, status.Error(codes.Internal, "failed to create release"))
+	}
+
+	if rc := req.RetentionConfig; rc != nil {
+		configurations := Configurations(rc.Configurations)
+		if configurations == nil {
+			configurations = Configurations{}
+		}
+		presetScripts := PresetScripts{}
+		for _, p := range rc.PresetScripts {
+			presetScripts = append(presetScripts, &PresetScript{
+				Name:              p.Name,
+				Description:       p.Description,
+				DefaultFrequencyS: p.DefaultFrequencyS,
+				Script:            p.Script,
+			})
+		}
+		var rateLimit *int64
+		if rc.RateLimitPerMinute > 0 {
+			rateLimit = &rc.RateLimitPerMinute
+		}
+
+		var configSchema *string
+		if rc.ConfigSchema != "" {
+			configSchema = &rc.ConfigSchema
+		}
+		var healthCheckURL *string
+		if rc.HealthCheckURL != "" {
+			healthCheckURL = &rc.HealthCheckURL
+		}
+		var minCLIVersion *string
+		if rc.MinCLIVersion != "" {
+			minCLIVersion = &rc.MinCLIVersion
+		}
+		// If no keys are marked as secret, every configuration is treated as secret.
+		var secretConfigs pq.StringArray
+		if len(rc.SecretConfigurations) > 0 {
+			secretConfigs = rc.SecretConfigurations
+		}
+
+		query = `INSERT INTO data_retention_plugin_releases (plugin_id, version, configurations, preset_scripts, documentation_url, default_export_url, allow_custom_export_url, rate_limit_per_minute, typed_configurations, export_formats, required_configurations, config_schema, health_check_url, dependencies, min_cli_version, namespace, secret_configurations)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)`
+		_, err = tx.ExecContext(ctx, query, req.ID, req.Version, configurations, presetScripts, rc.DocumentationURL, rc.DefaultExportURL, rc.AllowCustomExportURL, rateLimit, typedConfigs, pq.StringArray(rc.ExportFormats), pq.StringArray(rc.RequiredConfigurations), configSchema, healthCheckURL, pq.StringArray(rc.Dependencies), minCLIVersion, namespace, secretConfigs)
+		if err != nil {
+			return nil, contextError(ctx, status.Error(codes.Internal, "failed to create release"))
+		}
+	}
+
+	err = refreshLatestReleases(ctx, tx, req.ID)
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "failed to create release"))
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "failed to create release"))
+	}
+	s.pluginsCache.invalidate()
+	return &pluginpb.CreatePluginReleaseResponse{}, nil
+}
+
+// RetentionPlugin contains metadata about a retention plugin.
+type RetentionPlugin struct {
+	ID                   string         `db:"plugin_id"`
+	Version              string         `db:"version"`
+	Configurations       Configurations `db:"configurations"`
+	DocumentationURL     *string        `db:"documentation_url"`
+	DefaultExportURL     *string        `db:"default_export_url"`
+	AllowCustomExportURL bool           `db:"allow_custom_export_url"`
+	PresetScripts        PresetScripts  `db:"preset_scripts"`
+	TypedConfigurations  []byte         `db:"typed_configurations"`
+	ExportFormats        pq.StringArray `db:"export_formats"`
+	RateLimitPerMinute   *int64         `db:"rate_limit_per_minute"`
+	// RequiredConfigurations are the keys in Configurations which an org must set to enable the plugin.
+	RequiredConfigurations pq.StringArray `db:"required_configurations"`
+	// ConfigSchema is the JSON Schema which an org's configurations must satisfy, if any.
+	ConfigSchema *string `db:"config_schema"`
+	// HealthCheckURL is the endpoint which tests whether an org's configurations can connect to the plugin provider,
+	// if any.
+	HealthCheckURL *string `db:"health_check_url"`
+	// Dependencies are the IDs of other plugins which an org must have enabled before enabling the plugin.
+	Dependencies pq.StringArray `db:"dependencies"`
+	// MinCLIVersion is the minimum version of the CLI which the plugin works with, if any.
+	MinCLIVersion *string `db:"min_cli_version"`
+	// SecretConfigurations are the keys in Configurations whose values are stored encrypted. Nil if every
+	// configuration is secret.
+	SecretConfigurations pq.StringArray `db:"secret_configurations"`
+}
+
+// GetRetentionPluginConfig gets the config for a specific plugin release.
+func (s *Server) GetRetentionPluginConfig(ctx context.Context, req *pluginpb.GetRetentionPluginConfigRequest) (*pluginpb.GetRetentionPluginConfigResponse, error) {
+	var retentionEnabled bool
+	var namespace string
+	query := `SELECT data_retention_enabled, namespace FROM plugin_releases WHERE id=$1 AND version=$2`
+	err := s.readDB.QueryRowxContext(ctx, query, req.ID, req.Version).Scan(&retentionEnabled, &namespace)
+	if err == sql.ErrNoRows {
+		return nil, status.Error(codes.NotFound, "plugin not found")
+	}
+	if err != nil {
+		return nil, contextError(ctx, status.Errorf(codes.Internal, "Failed to fetch plugin"))
+	}
+	if !retentionEnabled {
+		return nil, status.Error(codes.FailedPrecondition, "plugin is not a retention plugin")
+	}
+
+	query = `SELECT plugin_id, version, configurations, preset_scripts, documentation_url, default_export_url, allow_custom_export_url, typed_configurations, export_formats, required_configurations, config_schema, dependencies, min_cli_version, secret_configurations FROM data_retention_plugin_releases WHERE plugin_id=$1 AND version=$2`
+	rows, err := s.readDB.QueryxContext(ctx, query, req.ID, req.Version)
+	if err != nil {
+		return nil, contextError(ctx, status.Errorf(codes.Internal, "Failed to fetch plugin"))
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		var plugin RetentionPlugin
+		err := rows.StructScan(&plugin)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "Failed to read plugin")
+		}
+		latest, err := s.getLatestVersions(ctx, namespace, req.ID, false)
+		if err != nil {
+			return nil, contextError(ctx, status.Errorf(codes.Internal, "Failed to fetch plugin"))
+		}
+		typedConfigs, err := typedConfigsFromJSON(plugin.TypedConfigurations)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "Failed to read plugin")
+		}
+
+		ppb := &pluginpb.GetRetentionPluginConfigResponse{
+			Configurations:         plugin.Configurations,
+			AllowCustomExportURL:   plugin.AllowCustomExportURL,
+			PresetScripts:          []*pluginpb.GetRetentionPluginConfigResponse_PresetScript{},
+			LatestVersion:          latest[req.ID],
+			TypedConfigurations:    typedConfigs,
+			ExportFormats:          plugin.ExportFormats,
+			RequiredConfigurations: plugin.RequiredConfigurations,
+			Dependencies:           plugin.Dependencies,
+			SecretConfigurations:   plugin.SecretConfigurations,
+		}
+		if plugin.DocumentationURL != nil {
+			ppb.DocumentationURL = *plugin.DocumentationURL
+		}
+		if plugin.DefaultExportURL != nil {
+			ppb.DefaultExportURL = *plugin.DefaultExportURL
+		}
+		if plugin.ConfigSchema != nil {
+			ppb.ConfigSchema = *plugin.ConfigSchema
+		}
+		if plugin.MinCLIVersion != nil {
+			ppb.MinCLIVersion = *plugin.MinCLIVersion
+		}
+		if plugin.PresetScripts != nil {
+			for _, p := range plugin.PresetScripts {
+				ppb.PresetScripts = append(ppb.PresetScripts, &pluginpb.GetRetentionPluginConfigResponse_PresetScript{
+					Name:              p.Name,
+					Description:       p.Description,
+					DefaultFrequencyS: p.DefaultFrequencyS,
+					Script:            p.Script,
+				})
+			}
+		}
+		return ppb, nil
+	}
+	return nil, status.Error(codes.NotFound, "plugin not found")
+}
+
+// pluginRelease contains the metadata of a plugin release. The retention fields are unset for releases which do not
+// support data retention.
+type pluginRelease struct {
+	Name                 string  `db:"name"`
+	ID                   string  `db:"id"`
+	Version              string  `db:"version"`
+	Description          *string `db:"description"`
+	Logo                 *string `db:"logo"`
+	DataRetentionEnabled bool    `db:"data_retention_enabled"`
+	ReleaseChannel       string  `db:"release_channel"`
+	Yanked               bool    `db:"yanked"`
+	Maintenance          bool    `db:"maintenance"`
+	DocumentationURL     *string `db:"documentation_url"`
+	DefaultExportURL     *string `db:"default_export_url"`
+	AllowCustomExportURL *bool   `db:"allow_custom_export_url"`
+}
+
+// GetPluginReleaseByVersion gets the metadata of a plugin release, without any org-specific settings.
+func (s *Server) GetPluginReleaseByVersion(ctx context.Context, req *pluginpb.GetPluginReleaseByVersionRequest) (*pluginpb.GetPluginReleaseByVersionResponse, error) {
+	if req.ID == "" {
+		return nil, status.Error(codes.InvalidArgument, "Must specify plugin ID")
+	}
+	if req.Version == "" {
+		return nil, status.Error(codes.InvalidArgument, "Must specify plugin version")
+	}
+
+	query := `SELECT r.name, r.id, r.version, r.description, r.logo, r.data_retention_enabled, r.release_channel, r.yanked, r.maintenance,
+		d.documentation_url, d.default_export_url, d.allow_custom_export_url
+		FROM plugin_releases AS r LEFT JOIN data_retention_plugin_releases AS d ON r.id = d.plugin_id AND r.version = d.version
+		WHERE r.id=$1 AND r.version=$2`
+	var release pluginRelease
+	err := s.readDB.QueryRowxContext(ctx, query, req.ID, req.Version).StructScan(&release)
+	if err == sql.ErrNoRows {
+		return nil, status.Error(codes.NotFound, "plugin release not found")
+	}
+	if err != nil {
+		return nil, contextError(ctx, status.Errorf(codes.Internal, "Failed to fetch plugin release"))
+	}
+
+	resp := &pluginpb.GetPluginReleaseByVersionResponse{
+		Name:             release.Name,
+		ID:               release.ID,
+		Version:          release.Version,
+		RetentionEnabled: release.DataRetentionEnabled,
+		ReleaseChannel:   release.ReleaseChannel,
+		Yanked:           release.Yanked,
+		Maintenance:      release.Maintenance,
+	}
+	if release.Description != nil {
+		resp.Description = *release.Description
+	}
+	if release.Logo != nil {
+		resp.Logo = *release.Logo
+	}
+	if release.DocumentationURL != nil {
+		resp.DocumentationURL = *release.DocumentationURL
+	}
+	if release.DefaultExportURL != nil {
+		resp.DefaultExportURL = *release.DefaultExportURL
+	}
+	if release.AllowCustomExportURL != nil {
+		resp.AllowCustomExportURL = *release.AllowCustomExportURL
+	}
+	return resp, nil
+}
+
+// VerifyPresetFrequenciesAgainstRateLimit verifies that the preset scripts for a plugin release do not run more
+// frequently than the release's rate limit, and reports any scripts which do.
+func (s *Server) VerifyPresetFrequenciesAgainstRateLimit(ctx context.Context, req *pluginpb.VerifyPresetFrequenciesAgainstRateLimitRequest) (*pluginpb.VerifyPresetFrequenciesAgainstRateLimitResponse, error) {
+	query := `SELECT rate_limit_per_minute, preset_scripts FROM data_retention_plugin_releases WHERE plugin_id=$1 AND version=$2`
+	rows, err := s.readDB.QueryxContext(ctx, query, req.ID, req.Version)
+	if err != nil {
+		return nil, contextError(ctx, status.Errorf(codes.Internal, "Failed to fetch plugin"))
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, status.Error(codes.NotFound, "plugin not found")
+	}
+
+	var rateLimit *int64
+	var presetScripts PresetScripts
+	err = rows.Scan(&rateLimit, &presetScripts)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to read plugin")
+	}
+
+	resp := &pluginpb.VerifyPresetFrequenciesAgainstRateLimitResponse{
+		Violations: []*pluginpb.VerifyPresetFrequenciesAgainstRateLimitResponse_Violation{},
+	}
+	if rateLimit == nil || *rateLimit <= 0 {
+		return resp, nil
+	}
+	resp.RateLimitPerMinute = *rateLimit
+
+	// A script running every f seconds makes 60/f requests per minute, so it respects the limit when f >= 60/limit.
+	minFrequencyS := (60 + *rateLimit - 1) / *rateLimit
+	for _, p := range presetScripts {
+		if p.DefaultFrequencyS < minFrequencyS {
+			resp.Violations = append(resp.Violations, &pluginpb.VerifyPresetFrequenciesAgainstRateLimitResponse_Violation{
+				Name:              p.Name,
+				DefaultFrequencyS: p.DefaultFrequencyS,
+				MinFrequencyS:     minFrequencyS,
+			})
+		}
+	}
+	return resp, nil
+}
+
+// GetPluginPresetScriptHistory gets the preset scripts of each release of a plugin, ordered by version. Releases
+// without preset scripts are omitted.
+func (s *Server) GetPluginPresetScriptHistory(ctx context.Context, req *pluginpb.GetPluginPresetScriptHistoryRequest) (*pluginpb.GetPluginPresetScriptHistoryResponse, error) {
+	if req.PluginID == "" {
+		return nil, status.Error(codes.InvalidArgument, "Must specify plugin ID")
+	}
+
+	query := `SELECT version, preset_scripts FROM data_retention_plugin_releases WHERE plugin_id=$1 AND preset_scripts IS NOT NULL`
+	rows, err := s.readDB.QueryxContext(ctx, query, req.PluginID)
+	if err != nil {
+		return nil, contextError(ctx, status.Errorf(codes.Internal, "Failed to fetch plugin"))
+	}
+	defer rows.Close()
+
+	releases := []*pluginpb.GetPluginPresetScriptHistoryResponse_ReleasePresetScripts{}
+	for rows.Next() {
+		var version string
+		var presetScripts PresetScripts
+		err = rows.Scan(&version, &presetScripts)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "Failed to read plugin")
+		}
+
+		release := &pluginpb.GetPluginPresetScriptHistoryResponse_ReleasePresetScripts{
+			Version:       version,
+			PresetScripts: make([]*pluginpb.GetPluginPresetScriptHistoryResponse_PresetScript, len(presetScripts)),
+		}
+		for i, p := range presetScripts {
+			release.PresetScripts[i] = &pluginpb.GetPluginPresetScriptHistoryResponse_PresetScript{
+				Name:        p.Name,
+				Description: p.Description,
+			}
+		}
+		releases = append(releases, release)
+	}
+
+	sort.Slice(releases, func(i, j int) bool {
+		return compareVersions(releases[i].Version, releases[j].Version) < 0
+	})
+	return &pluginpb.GetPluginPresetScriptHistoryResponse{Releases: releases}, nil
+}
+
+// GetConfigJSONSchema gets the configuration schema for a plugin release as a JSON Schema document, so that configs
+// can be validated with standard tooling.
+func (s *Server) GetConfigJSONSchema(ctx context.Context, req *pluginpb.GetConfigJSONSchemaRequest) (*pluginpb.GetConfigJSONSchemaResponse, error) {
+	query := `SELECT configurations, typed_configurations FROM data_retention_plugin_releases WHERE plugin_id=$1 AND version=$2`
+	rows, err := s.readDB.QueryxContext(ctx, query, req.ID, req.Version)
+	if err != nil {
+		return nil, contextError(ctx, status.Errorf(codes.Internal, "Failed to fetch plugin"))
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, status.Error(codes.NotFound, "plugin not found")
+	}
+
+	var configurations Configurations
+	var typedConfigurations []byte
+	err = rows.Scan(&configurations, &typedConfigurations)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to read plugin")
+	}
+
+	schema, err := configJSONSchema(fmt.Sprintf("%s %s configuration", req.ID, req.Version), configurations, typedConfigurations)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to generate schema")
+	}
+	return &pluginpb.GetConfigJSONSchemaResponse{Schema: string(schema)}, nil
+}
+
+// GetPluginConfigDiff compares the configuration keys of two releases of a plugin.
+func (s *Server) GetPluginConfigDiff(ctx context.Context, req *pluginpb.GetPluginConfigDiffRequest) (*pluginpb.GetPluginConfigDiffResponse, error) {
+	if req.PluginID == "" {
+		return nil, status.Error(codes.InvalidArgument, "Must specify plugin ID")
+	}
+
+	query := `SELECT configurations FROM data_retention_plugin_releases WHERE plugin_id=$1 AND version=$2`
+	configs := make([]Configurations, 2)
+	for i, version := range []string{req.FromVersion, req.ToVersion} {
+		err := s.readDB.QueryRowxContext(ctx, query, req.PluginID, version).Scan(&configs[i])
+		if err == sql.ErrNoRows {
+			return nil, status.Errorf(codes.NotFound, "plugin version %s not found", version)
+		}
+		if err != nil {
+			return nil, contextError(ctx, status.Errorf(codes.Internal, "Failed to fetch plugin"))
+		}
+	}
+
+	added, removed, changed, unchanged := diffConfigurations(configs[0], configs[1])
+	return &pluginpb.GetPluginConfigDiffResponse{
+		Added:     added,
+		Removed:   removed,
+		Changed:   changed,
+		Unchanged: unchanged,
+	}, nil
+}
+
+// GetReleaseDeletionImpact gets the orgs which are currently using a plugin release, and whether each could be moved
+// to another non-yanked stable release of the plugin in the same namespace if the release were deleted.
+func (s *Server) GetReleaseDeletionImpact(ctx context.Context, req *pluginpb.GetReleaseDeletionImpactRequest) (*pluginpb.GetReleaseDeletionImpactResponse, error) {
+	if req.ID == "" || req.Version == "" {
+		return nil, status.Error(codes.InvalidArgument, "Must specify ID and version")
+	}
+
+	exists, err := s.retentionReleaseExists(ctx, s.readDB, req.ID, req.Version)
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "Failed to fetch plugin"))
+	}
+	if !exists {
+		return nil, status.Error(codes.NotFound, "plugin not found")
+	}
+
+	query := `SELECT r.version FROM plugin_releases AS r, data_retention_plugin_releases AS d
+		WHERE r.id = d.plugin_id AND r.version = d.version AND r.id=$1 AND r.version != $2 AND r.yanked='false' AND r.release_channel=$3
+		AND r.namespace = (SELECT namespace FROM plugin_releases WHERE id=$1 AND version=$2)`
+	var fallbacks []string
+	err = s.readDB.SelectContext(ctx, &fallbacks, query, req.ID, req.Version, releaseChannelStable)
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "Failed to fetch releases"))
+	}
+	fallback := latestVersion(fallbacks)
+
+	query = `SELECT org_id FROM org_data_retention_plugins WHERE plugin_id=$1 AND version=$2 AND enabled='true' ORDER BY org_id`
+	var orgIDs []uuid.UUID
+	err = s.readDB.SelectContext(ctx, &orgIDs, query, req.ID, req.Version)
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "Failed to fetch orgs"))
+	}
+
+	resp := &pluginpb.GetReleaseDeletionImpactResponse{
+		Orgs: make([]*pluginpb.GetReleaseDeletionImpactResponse_AffectedOrg, len(orgIDs)),
+	}
+	for i, id := range orgIDs {
+		resp.Orgs[i] = &pluginpb.GetReleaseDeletionImpactResponse_AffectedOrg{
+			OrgID:           utils.ProtoFromUUID(id),
+			HasFallback:     fallback != "",
+			FallbackVersion: fallback,
+		}
+	}
+	return resp, nil
+}
+
+// orgPluginUsage is an org's enabled version of a plugin.
+type orgPluginUsage struct {
+	OrgID   uuid.UUID `db:"org_id"`
+	Version string    `db:"version"`
+}
+
+// GetOrgsUsingPlugin gets the orgs which have a plugin enabled, and the versions they are pinned to. This is used to
+// find the orgs affected by deprecating a plugin version, so is restricted to internal services.
+func (s *Server) GetOrgsUsingPlugin(ctx context.Context, req *pluginpb.GetOrgsUsingPluginRequest) (*pluginpb.GetOrgsUsingPluginResponse, error) {
+	if !isServiceCaller(ctx) {
+		return nil, status.Error(codes.PermissionDenied, "Only internal services may list orgs using a plugin")
+	}
+	if req.PluginID == "" {
+		return nil, status.Error(codes.InvalidArgument, "Must specify plugin ID")
+	}
+
+	query := `SELECT org_id, version FROM org_data_retention_plugins WHERE plugin_id=$1 AND enabled='true'`
+	args := []interface{}{req.PluginID}
+	if req.Version != "" {
+		query = fmt.Sprintf("%s %s", query, "AND version=$2")
+		args = append(args, req.Version)
+	}
+	query = fmt.Sprintf("%s %s", query, "ORDER BY org_id")
+
+	var usages []*orgPluginUsage
+	err := s.readDB.SelectContext(ctx, &usages, query, args...)
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "Failed to fetch orgs"))
+	}
+
+	resp := &pluginpb.GetOrgsUsingPluginResponse{
+		Orgs: make([]*pluginpb.GetOrgsUsingPluginResponse_OrgUsage, len(usages)),
+	}
+	for i, u := range usages {
+		resp.Orgs[i] = &pluginpb.GetOrgsUsingPluginResponse_OrgUsage{
+			OrgID:   utils.ProtoFromUUID(u.OrgID),
+			Version: u.Version,
+		}
+	}
+	return resp, nil
+}
+
+// RefreshLatestReleases rebuilds the stored latest release of each plugin from scratch. GetPlugins computes the latest
+// releases itself while the stored releases are stale, such as when releases were added outside of
+// CreatePluginRelease.
+func (s *Server) RefreshLatestReleases(ctx context.Context, req *pluginpb.RefreshLatestReleasesRequest) (*pluginpb.RefreshLatestReleasesResponse, error) {
+	if !isServiceCaller(ctx) {
+		return nil, status.Error(codes.PermissionDenied, "Only internal services may refresh the latest releases")
+	}
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "failed to refresh latest releases"))
+	}
+	defer tx.Rollback()
+
+	err = refreshLatestReleases(ctx, tx, "")
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "failed to refresh latest releases"))
+	}
+	var count int64
+	err = tx.QueryRowxContext(ctx, `SELECT COUNT(*) FROM plugin_latest_releases WHERE include_beta='true'`).Scan(&count)
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "failed to refresh latest releases"))
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "failed to refresh latest releases"))
+	}
+	s.pluginsCache.invalidate()
+	return &pluginpb.RefreshLatestReleasesResponse{PluginCount: count}, nil
+}
+
+// SetPluginMaintenanceMode enters or exits maintenance mode for all releases of a plugin. While in maintenance mode,
+// the plugin's retention scripts are reported as paused and are not due to run, but remain enabled. This pauses the
+// scripts of every org, so is restricted to internal services.
+func (s *Server) SetPluginMaintenanceMode(ctx context.Context, req *pluginpb.SetPluginMaintenanceModeRequest) (*pluginpb.SetPluginMaintenanceModeResponse, error) {
+	if !isServiceCaller(ctx) {
+		return nil, status.Error(codes.PermissionDenied, "Only internal services may set maintenance mode")
+	}
+	if req.PluginID == "" {
+		return nil, status.Error(codes.InvalidArgument, "Must specify plugin ID")
+	}
+
+	query := `UPDATE plugin_releases SET maintenance=$1 WHERE id=$2`
+	res, err := s.db.ExecContext(ctx, query, req.Active, req.PluginID)
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "Failed to update plugin"))
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, status.Error(codes.NotFound, "plugin not found")
+	}
+	return &pluginpb.SetPluginMaintenanceModeResponse{}, nil
+}
+
+// ExportPluginRelease exports a plugin release as a JSON bundle, for moving it to another environment with
+// ImportPluginRelease. The bundle is the JSON encoding of the CreatePluginReleaseRequest which creates the release.
+func (s *Server) ExportPluginRelease(ctx context.Context, req *pluginpb.ExportPluginReleaseRequest) (*pluginpb.ExportPluginReleaseResponse, error) {
+	if req.ID == "" {
+		return nil, status.Error(codes.InvalidArgument, "Must specify plugin ID")
+	}
+	if req.Version == "" {
+		return nil, status.Error(codes.InvalidArgument, "Must specify plugin version")
+	}
+
+	query := `SELECT name, id, description, logo, version, data_retention_enabled, release_channel, tags, namespace FROM plugin_releases WHERE id=$1 AND version=$2`
+	var plugin Plugin
+	err := s.readDB.QueryRowxContext(ctx, query, req.ID, req.Version).StructScan(&plugin)
+	if err == sql.ErrNoRows {
+		return nil, status.Error(codes.NotFound, "plugin not found")
+	}
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "Failed to fetch plugin"))
+	}
+
+	release := &pluginpb.CreatePluginReleaseRequest{
+		Name:           plugin.Name,
+		ID:             plugin.ID,
+		Version:        plugin.Version,
+		ReleaseChannel: plugin.ReleaseChannel,
+		Tags:           plugin.Tags,
+		Namespace:      plugin.Namespace,
+	}
+	if plugin.Description != nil {
+		release.Description = *plugin.Description
+	}
+	if plugin.Logo != nil {
+		release.Logo = *plugin.Logo
+	}
+
+	query = `SELECT plugin_id, version, configurations, preset_scripts, documentation_url, default_export_url, allow_custom_export_url, rate_limit_per_minute, typed_configurations, export_formats, required_configurations, config_schema, health_check_url, dependencies, min_cli_version, secret_configurations
+		FROM data_retention_plugin_releases WHERE plugin_id=$1 AND version=$2`
+	var rp RetentionPlugin
+	err = s.readDB.QueryRowxContext(ctx, query, req.ID, req.Version).StructScan(&rp)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, contextError(ctx, status.Error(codes.Internal, "Failed to fetch plugin"))
+	}
+	if err == nil {
+		typedConfigs, err := typedConfigsFromJSON(rp.TypedConfigurations)
+		if err != nil {
+			return nil, status.Error(codes.Internal, "Failed to read plugin")
+		}
+		rc := &pluginpb.RetentionReleaseConfig{
+			Configurations:         rp.Configurations,
+			AllowCustomExportURL:   rp.AllowCustomExportURL,
+			TypedConfigurations:    typedConfigs,
+			ExportFormats:          rp.ExportFormats,
+			RequiredConfigurations: rp.RequiredConfigurations,
+			Dependencies:           rp.Dependencies,
+			SecretConfigurations:   rp.SecretConfigurations,
+		}
+		if rp.DocumentationURL != nil {
+			rc.DocumentationURL = *rp.DocumentationURL
+		}
+		if rp.DefaultExportURL != nil {
+			rc.DefaultExportURL = *rp.DefaultExportURL
+		}
+		if rp.RateLimitPerMinute != nil {
+			rc.RateLimitPerMinute = *rp.RateLimitPerMinute
+		}
+		if rp.ConfigSchema != nil {
+			rc.ConfigSchema = *rp.ConfigSchema
+		}
+		if rp.HealthCheckURL != nil {
+			rc.HealthCheckURL = *rp.HealthCheckURL
+		}
+		if rp.MinCLIVersion != nil {
+			rc.MinCLIVersion = *rp.MinCLIVersion
+		}
+		for _, p := range rp.PresetScripts {
+			rc.PresetScripts = append(rc.PresetScripts, &pluginpb.GetRetentionPluginConfigResponse_PresetScript{
+				Name:              p.Name,
+				Description:       p.Description,
+				DefaultFrequencyS: p.DefaultFrequencyS,
+				Script:            p.Script,
+			})
+		}
+		release.RetentionConfig = rc
+	}
+
+	m := jsonpb.Marshaler{}
+	bundle, err := m.MarshalToString(release)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Failed to encode bundle")
+	}
+	return &pluginpb.ExportPluginReleaseResponse{Bundle: bundle}, nil
+}
+
+// ImportPluginRelease creates a plugin release from a JSON bundle produced by ExportPluginRelease. The release is
+// created transactionally, and is rejected if the version already exists.
+func (s *Server) ImportPluginRelease(ctx context.Context, req *pluginpb.ImportPluginReleaseRequest) (*pluginpb.ImportPluginReleaseResponse, error) {
+	release := &pluginpb.CreatePluginReleaseRequest{}
+	err := jsonpb.UnmarshalString(req.Bundle, release)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "Invalid bundle")
+	}
+
+	_, err = s.CreatePluginRelease(ctx, release)
+	if err != nil {
+		return nil, err
+	}
+	return &pluginpb.ImportPluginReleaseResponse{}, nil
+}
+
+// GetRetentionPluginsForOrg gets all data retention plugins enabled by the org. If requested, plugins which the org
+// has configured but disabled are included too.
+func (s *Server) GetRetentionPluginsForOrg(ctx context.Context, req *pluginpb.GetRetentionPluginsForOrgRequest) (*pluginpb.GetRetentionPluginsForOrgResponse, error) {
+	if utils.IsNilUUIDProto(req.OrgID) {
+		return nil, status.Error(codes.InvalidArgument, "Must specify OrgID")
+	}
+
+	query := `SELECT r.name, r.id, r.description, r.logo, r.version, r.data_retention_enabled, o.enabled from plugin_releases as r, org_data_retention_plugins as o WHERE r.id = o.plugin_id AND r.version = o.version AND o.org_id=$1 AND ($2 OR o.enabled='true')`
+	orgID := utils.UUIDFromProtoOrNil(req.OrgID)
+	rows, err := s.readDB.QueryxContext(ctx, query, orgID, req.IncludeDisabled)
+	if err != nil {
+		return nil, contextError(ctx, status.Errorf(codes.Internal, "Failed to fetch plugin"))
+	}
+
+	defer rows.Close()
+
+	plugins := []*pluginpb.GetRetentionPluginsForOrgResponse_PluginState{}
+	for rows.Next() {
+		var p struct {
+			Plugin
+			Enabled bool `db:"enabled"`
+		}
+		err = rows.StructScan(&p)
+		if err != nil {
+			return nil, status.Error(codes.Internal, "failed to read plugins")
+		}
+		ppb := &pluginpb.GetRetentionPluginsForOrgResponse_PluginState{
+			Plugin: &pluginpb.Plugin{
+				Name:             p.Name,
+				ID:               p.ID,
+				RetentionEnabled: p.DataRetentionEnabled,
+			},
+			EnabledVersion: p.Version,
+			Enabled:        p.Enabled,
+		}
+		plugins = append(plugins, ppb)
+	}
+	return &pluginpb.GetRetentionPluginsForOrgResponse{Plugins: plugins}, nil
+}
+
+// GetConfiguredPluginCountForOrg counts the data retention plugins enabled by the org.
+func (s *Server) GetConfiguredPluginCountForOrg(ctx context.Context, req *pluginpb.GetConfiguredPluginCountForOrgRequest) (*pluginpb.GetConfiguredPluginCountForOrgResponse, error) {
+	if utils.IsNilUUIDProto(req.OrgID) {
+		return nil, status.Error(codes.InvalidArgument, "Must specify OrgID")
+	}
+
+	var count int64
+	query := `SELECT COUNT(*) FROM org_data_retention_plugins WHERE org_id=$1 AND enabled='true'`
+	err := s.readDB.QueryRowxContext(ctx, query, utils.UUIDFromProtoOrNil(req.OrgID)).Scan(&count)
+	if err != nil {
+		return nil, contextError(ctx, status.Errorf(codes.Internal, "Failed to count plugins"))
+	}
+	return &pluginpb.GetConfiguredPluginCountForOrgResponse{Count: count}, nil
+}
+
+// GetOrgRetentionPluginConfig gets the org's configuration for a plugin.
+func (s *Server) GetOrgRetentionPluginConfig(ctx context.Context, req *pluginpb.GetOrgRetentionPluginConfigRequest) (_ *pluginpb.GetOrgRetentionPluginConfigResponse, err error) {
+	if utils.IsNilUUIDProto(req.OrgID) {
+		return nil, status.Error(codes.InvalidArgument, "Must specify OrgID")
+	}
+
+	release, err := s.acquireDecryption(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	query := `SELECT merge_configurations(PGP_SYM_DECRYPT(o.configurations, $1::text), o.plaintext_configurations), PGP_SYM_DECRYPT(o.typed_configurations, $1::text), o.custom_export_url,
+		d.default_export_url, d.allow_custom_export_url, st.default_export_url AS org_default_export_url
+		FROM org_data_retention_plugins AS o
+		LEFT JOIN data_retention_plugin_releases AS d ON d.plugin_id = o.plugin_id AND d.version = o.version
+		LEFT JOIN org_retention_settings AS st ON st.org_id = o.org_id
+		WHERE o.org_id=$2 AND o.plugin_id=$3 AND o.enabled='true'`
+
+	orgID := utils.UUIDFromProtoOrNil(req.OrgID)
+	ctx, span := startSpan(ctx, "decryptOrgConfig", orgID, req.PluginID)
+	defer func() { endSpan(span, err) }()
+	rows, err := s.readDB.QueryxContext(ctx, query, s.dbKey, orgID, req.PluginID)
+	if err != nil {
+		recordDecryptionFailure(req.PluginID, err)
+		return nil, contextError(ctx, status.Errorf(codes.Internal, "Failed to fetch plugin"))
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		var configurationJSON []byte
+		var typedConfigurationJSON []byte
+		var customExportURL, defaultExportURL, orgDefaultExportURL sql.NullString
+		var allowCustomExportURL sql.NullBool
+		var configMap map[string]string
+
+		err := rows.Scan(&configurationJSON, &typedConfigurationJSON, &customExportURL, &defaultExportURL, &allowCustomExportURL, &orgDefaultExportURL)
+		if err != nil {
+			return nil, status.Error(codes.Internal, "failed to read configs")
+		}
+
+		// An org which has enabled the plugin without setting any configs has NULL configurations. This is returned
+		// as an empty map, to distinguish it from an org which hasn't enabled the plugin.
+		if configurationJSON != nil {
+			err = json.Unmarshal(configurationJSON, &configMap)
+			if err != nil {
+				configDecryptionFailures.WithLabelValues(req.PluginID).Inc()
+				return nil, status.Error(codes.Internal, "failed to read configs")
+			}
+		}
+		if configMap == nil {
+			configMap = map[string]string{}
+		}
+
+		typedConfigs, err := typedConfigsFromJSON(typedConfigurationJSON)
+		if err != nil {
+			configDecryptionFailures.WithLabelValues(req.PluginID).Inc()
+			return nil, status.Error(codes.Internal, "failed to read configs")
+		}
+
+		if req.RedactSecrets || !s.canReadDecryptedConfigs(ctx) {
+			configMap = redactConfigs(configMap)
+			typedConfigs = redactTypedConfigs(typedConfigs)
+		}
+
+		return &pluginpb.GetOrgRetentionPluginConfigResponse{
+			Configurations:      configMap,
+			TypedConfigurations: typedConfigs,
+			CustomExportURL:     customExportURL.String,
+			EffectiveExportURL:  effectiveExportURL(customExportURL.String, orgDefaultExportURL.String, defaultExportURL.String, allowCustomExportURL.Bool),
+		}, nil
+	}
+	if err := rows.Err(); err != nil {
+		recordDecryptionFailure(req.PluginID, err)
+		return nil, contextError(ctx, status.Errorf(codes.Internal, "Failed to fetch plugin"))
+	}
+	return nil, status.Error(codes.NotFound, "plugin is not enabled")
+}
+
+// ListConfiguredPlugins gets the org's configuration for every plugin the org has enabled. The configs of all plugins
+// are decrypted in a single query.
+func (s *Server) ListConfiguredPlugins(ctx context.Context, req *pluginpb.ListConfiguredPluginsRequest) (_ *pluginpb.ListConfiguredPluginsResponse, err error) {
+	if utils.IsNilUUIDProto(req.OrgID) {
+		return nil, status.Error(codes.InvalidArgument, "Must specify OrgID")
+	}
+
+	release, err := s.acquireDecryption(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	// Orgs only have a row for the plugins they have enabled.
+	query := `SELECT plugin_id, version, merge_configurations(PGP_SYM_DECRYPT(configurations, $1::text), plaintext_configurations), PGP_SYM_DECRYPT(typed_configurations, $1::text) FROM org_data_retention_plugins WHERE org_id=$2 AND enabled='true'`
+
+	orgID := utils.UUIDFromProtoOrNil(req.OrgID)
+	ctx, span := startSpan(ctx, "decryptOrgConfigs", orgID, "")
+	defer func() { endSpan(span, err) }()
+	rows, err := s.readDB.QueryxContext(ctx, query, s.dbKey, orgID)
+	if err != nil {
+		recordDecryptionFailure(unknownPluginID, err)
+		return nil, contextError(ctx, status.Errorf(codes.Internal, "Failed to fetch plugins"))
+	}
+	defer rows.Close()
+
+	redact := !s.canReadDecryptedConfigs(ctx)
+	plugins := make(map[string]*pluginpb.ListConfiguredPluginsResponse_PluginConfig)
+	for rows.Next() {
+		var pluginID, version string
+		var configurationJSON []byte
+		var typedConfigurationJSON []byte
+		err := rows.Scan(&pluginID, &version, &configurationJSON, &typedConfigurationJSON)
+		if err != nil {
+			return nil, status.Error(codes.Internal, "failed to read configs")
+		}
+
+		configMap := map[string]string{}
+		if configurationJSON != nil {
+			err = json.Unmarshal(configurationJSON, &configMap)
+			if err != nil {
+				configDecryptionFailures.WithLabelValues(pluginID).Inc()
+				return nil, status.Error(codes.Internal, "failed to read configs")
+			}
+		}
+		typedConfigs, err := typedConfigsFromJSON(typedConfigurationJSON)
+		if err != nil {
+			configDecryptionFailures.WithLabelValues(pluginID).Inc()
+			return nil, status.Error(codes.Internal, "failed to read configs")
+		}
+
+		if redact {
+			configMap = redactConfigs(configMap)
+			typedConfigs = redactTypedConfigs(typedConfigs)
+		}
+		plugins[pluginID] = &pluginpb.ListConfiguredPluginsResponse_PluginConfig{
+			Version:             version,
+			Configurations:      configMap,
+			TypedConfigurations: typedConfigs,
+		}
+	}
+	if err := rows.Err(); err != nil {
+		recordDecryptionFailure(unknownPluginID, err)
+		return nil, contextError(ctx, status.Errorf(codes.Internal, "Failed to fetch plugins"))
+	}
+	return &pluginpb.ListConfiguredPluginsResponse{Plugins: plugins}, nil
+}
+
+// GetOrgConfigKeys lists every config key the org has stored, for enabled and disabled plugins and in the org's
+// config history. Only the keys are returned, never the values.
+func (s *Server) GetOrgConfigKeys(ctx context.Context, req *pluginpb.GetOrgConfigKeysRequest) (_ *pluginpb.GetOrgConfigKeysResponse, err error) {
+	if utils.IsNilUUIDProto(req.OrgID) {
+		return nil, status.Error(codes.InvalidArgument, "Must specify OrgID")
+	}
+
+	release, err := s.acquireDecryption(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	query := `SELECT plugin_id, merge_configurations(PGP_SYM_DECRYPT(configurations, $1::text), plaintext_configurations), PGP_SYM_DECRYPT(typed_configurations, $1::text) FROM org_data_retention_plugins WHERE org_id=$2
+		UNION ALL
+		SELECT plugin_id, merge_configurations(PGP_SYM_DECRYPT(configurations, $1::text), plaintext_configurations), NULL FROM org_data_retention_plugin_config_history WHERE org_id=$2`
+
+	orgID := utils.UUIDFromProtoOrNil(req.OrgID)
+	ctx, span := startSpan(ctx, "decryptOrgConfigs", orgID, "")
+	defer func() { endSpan(span, err) }()
+	rows, err := s.readDB.QueryxContext(ctx, query, s.dbKey, orgID)
+	if err != nil {
+		recordDecryptionFailure(unknownPluginID, err)
+		return nil, contextError(ctx, status.Errorf(codes.Internal, "Failed to fetch configs"))
+	}
+	defer rows.Close()
+
+	keySet := make(map[string]bool)
+	for rows.Next() {
+		var pluginID string
+		var configurationJSON []byte
+		var typedConfigurationJSON []byte
+		err := rows.Scan(&pluginID, &configurationJSON, &typedConfigurationJSON)
+		if err != nil {
+			return nil, status.Error(codes.Internal, "failed to read configs")
+		}
+		for _, j := range [][]byte{configurationJSON, typedConfigurationJSON} {
+			if j == nil {
+				continue
+			}
+			var configs map[string]json.RawMessage
+			err = json.Unmarshal(j, &configs)
+			if err != nil {
+				configDecryptionFailures.WithLabelValues(pluginID).Inc()
+				return nil, status.Error(codes.Internal, "failed to read configs")
+			}
+			for k := range configs {
+				keySet[k] = true
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		recordDecryptionFailure(unknownPluginID, err)
+		return nil, contextError(ctx, status.Errorf(codes.Internal, "Failed to fetch configs"))
+	}
+
+	keys := make([]string, 0, len(keySet))
+	for k := range keySet {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return &pluginpb.GetOrgConfigKeysResponse{Keys: keys}, nil
+}
+
+// CheckOrgConfigConsistency compares the config keys the org has stored for each of its enabled plugins against the
+// keys declared by the release the org is running, so that stale or incomplete configs can be flagged.
+func (s *Server) CheckOrgConfigConsistency(ctx context.Context, req *pluginpb.CheckOrgConfigConsistencyRequest) (_ *pluginpb.CheckOrgConfigConsistencyResponse, err error) {
+	if utils.IsNilUUIDProto(req.OrgID) {
+		return nil, status.Error(codes.InvalidArgument, "Must specify OrgID")
+	}
+
+	release, err := s.acquireDecryption(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	query := `SELECT o.plugin_id, o.version, merge_configurations(PGP_SYM_DECRYPT(o.configurations, $1::text), o.plaintext_configurations), PGP_SYM_DECRYPT(o.typed_configurations, $1::text), r.configurations, r.typed_configurations
+		FROM org_data_retention_plugins AS o
+		JOIN data_retention_plugin_releases AS r ON r.plugin_id = o.plugin_id AND r.version = o.version
+		WHERE o.org_id=$2 AND o.enabled='true' ORDER BY o.plugin_id`
+
+	orgID := utils.UUIDFromProtoOrNil(req.OrgID)
+	ctx, span := startSpan(ctx, "decryptOrgConfigs", orgID, "")
+	defer func() { endSpan(span, err) }()
+	rows, err := s.readDB.QueryxContext(ctx, query, s.dbKey, orgID)
+	if err != nil {
+		recordDecryptionFailure(unknownPluginID, err)
+		return nil, contextError(ctx, status.Errorf(codes.Internal, "Failed to fetch configs"))
+	}
+	defer rows.Close()
+
+	resp := &pluginpb.CheckOrgConfigConsistencyResponse{}
+	for rows.Next() {
+		var pluginID, version string
+		var orgConfigJSON, orgTypedConfigJSON, releaseConfigJSON, releaseTypedConfigJSON []byte
+		err := rows.Scan(&pluginID, &version, &orgConfigJSON, &orgTypedConfigJSON, &releaseConfigJSON, &releaseTypedConfigJSON)
+		if err != nil {
+			return nil, status.Error(codes.Internal, "failed to read configs")
+		}
+
+		stored := make(map[string]json.RawMessage)
+		for _, j := range [][]byte{orgConfigJSON, orgTypedConfigJSON} {
+			if j == nil {
+				continue
+			}
+			err = json.Unmarshal(j, &stored)
+			if err != nil {
+				configDecryptionFailures.WithLabelValues(pluginID).Inc()
+				return nil, status.Error(codes.Internal, "failed to read configs")
+			}
+		}
+		declared := make(map[string]json.RawMessage)
+		for _, j := range [][]byte{releaseConfigJSON, releaseTypedConfigJSON} {
+			if j == nil {
+				continue
+			}
+			err = json.Unmarshal(j, &declared)
+			if err != nil {
+				return nil, status.Error(codes.Internal, "failed to read plugin configurations")
+			}
+		}
+
+		pc := &pluginpb.CheckOrgConfigConsistencyResponse_PluginConsistency{
+			PluginID: pluginID,
+			Version:  version,
+		}
+		for k := range stored {
+			if _, ok := declared[k]; !ok {
+				pc.UnknownKeys = append(pc.UnknownKeys, k)
+			}
+		}
+		for k := range declared {
+			// Keys set to an empty string are treated as unset, as they are when finding non-compliant orgs.
+			if v, ok := stored[k]; !ok || string(v) == `""` {
+				pc.MissingKeys = append(pc.MissingKeys, k)
+			}
+		}
+		sort.Strings(pc.UnknownKeys)
+		sort.Strings(pc.MissingKeys)
+		resp.Plugins = append(resp.Plugins, pc)
+	}
+	if err := rows.Err(); err != nil {
+		recordDecryptionFailure(unknownPluginID, err)
+		return nil, contextError(ctx, status.Errorf(codes.Internal, "Failed to fetch configs"))
+	}
+	return resp, nil
+}
+
+// GetOrgRetentionPluginConfigAtVersion gets the last configuration the org had set for a plugin while running the
+// given version.
+func (s *Server) GetOrgRetentionPluginConfigAtVersion(ctx context.Context, req *pluginpb.GetOrgRetentionPluginConfigAtVersionRequest) (*pluginpb.GetOrgRetentionPluginConfigAtVersionResponse, error) {
+	if utils.IsNilUUIDProto(req.OrgID) {
+		return nil, status.Error(codes.InvalidArgument, "Must specify OrgID")
+	}
+
+	if req.PluginID == "" {
+		return nil, status.Error(codes.InvalidArgument, "Must specify plugin ID")
+	}
+
+	release, err := s.acquireDecryption(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	query := `SELECT merge_configurations(PGP_SYM_DECRYPT(configurations, $1::text), plaintext_configurations) FROM org_data_retention_plugin_config_history WHERE org_id=$2 AND plugin_id=$3 AND version=$4`
+
+	orgID := utils.UUIDFromProtoOrNil(req.OrgID)
+	rows, err := s.readDB.QueryxContext(ctx, query, s.dbKey, orgID, req.PluginID, req.Version)
+	if err != nil {
+		recordDecryptionFailure(req.PluginID, err)
+		return nil, contextError(ctx, status.Errorf(codes.Internal, "Failed to fetch plugin"))
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		var configurationJSON []byte
+		var configMap map[string]string
+
+		err := rows.Scan(&configurationJSON)
+		if err != nil {
+			return nil, status.Error(codes.Internal, "failed to read configs")
+		}
+
+		if configurationJSON != nil {
+			err = json.Unmarshal(configurationJSON, &configMap)
+			if err != nil {
+				configDecryptionFailures.WithLabelValues(req.PluginID).Inc()
+				return nil, status.Error(codes.Internal, "failed to read configs")
+			}
+		}
+		if !s.canReadDecryptedConfigs(ctx) {
+			configMap = redactConfigs(configMap)
+		}
+
+		return &pluginpb.GetOrgRetentionPluginConfigAtVersionResponse{
+			Configurations: configMap,
+		}, nil
+	}
+	if err := rows.Err(); err != nil {
+		recordDecryptionFailure(req.PluginID, err)
+		return nil, contextError(ctx, status.Errorf(codes.Internal, "Failed to fetch plugin"))
+	}
+	return nil, status.Error(codes.NotFound, "org has no config for version")
+}
+
+// GetConfigKeyAcrossOrgs gets the value of a single configuration key for every org which has the plugin enabled.
+func (s *Server) GetConfigKeyAcrossOrgs(ctx context.Context, req *pluginpb.GetConfigKeyAcrossOrgsRequest) (*pluginpb.GetConfigKeyAcrossOrgsResponse, error) {
+	if req.PluginID == "" {
+		return nil, status.Error(codes.InvalidArgument, "Must specify plugin ID")
+	}
+
+	if req.Key == "" {
+		return nil, status.Error(codes.InvalidArgument, "Must specify key")
+	}
+
+	release, err := s.acquireDecryption(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	query := `SELECT org_id, merge_configurations(PGP_SYM_DECRYPT(configurations, $1::text), plaintext_configurations)::json ->> $2 FROM org_data_retention_plugins WHERE plugin_id=$3 AND enabled='true'`
+	rows, err := s.readDB.QueryxContext(ctx, query, s.dbKey, req.Key, req.PluginID)
+	if err != nil {
+		recordDecryptionFailure(req.PluginID, err)
+		return nil, contextError(ctx, status.Errorf(codes.Internal, "Failed to fetch configs"))
+	}
+	defer rows.Close()
+
+	values := make(map[string]string)
+	for rows.Next() {
+		var orgID uuid.UUID
+		var value *string
+		err := rows.Scan(&orgID, &value)
+		if err != nil {
+			return nil, status.Error(codes.Internal, "failed to read configs")
+		}
+		if value != nil {
+			values[orgID.String()] = *value
+		}
+	}
+	if err := rows.Err(); err != nil {
+		recordDecryptionFailure(req.PluginID, err)
+		return nil, contextError(ctx, status.Errorf(codes.Internal, "Failed to fetch configs"))
+	}
+	if !s.canReadDecryptedConfigs(ctx) {
+		values = redactConfigs(values)
+	}
+	return &pluginpb.GetConfigKeyAcrossOrgsResponse{Values: values}, nil
+}
+
+// FindNonCompliantOrgsAfterSchemaChange finds the orgs running a plugin version whose configuration is missing keys
+// required by the release, or has them set to empty values. Releases which do not declare their required keys require
+// every key in their configurations. This allows finding the orgs which would be affected before previously-optional
+// keys are enforced.
+func (s *Server) FindNonCompliantOrgsAfterSchemaChange(ctx context.Context, req *pluginpb.FindNonCompliantOrgsAfterSchemaChangeRequest) (*pluginpb.FindNonCompliantOrgsAfterSchemaChangeResponse, error) {
+	if req.PluginID == "" {
+		return nil, status.Error(codes.InvalidArgument, "Must specify plugin ID")
+	}
+	if req.Version == "" {
+		return nil, status.Error(codes.InvalidArgument, "Must specify plugin version")
+	}
+
+	query := `SELECT configurations, required_configurations, required_configurations IS NOT NULL FROM data_retention_plugin_releases WHERE plugin_id=$1 AND version=$2`
+	var configs Configurations
+	var requiredConfigs pq.StringArray
+	var declaresRequired bool
+	err := s.readDB.QueryRowxContext(ctx, query, req.PluginID, req.Version).Scan(&configs, &requiredConfigs, &declaresRequired)
+	if err == sql.ErrNoRows {
+		return nil, status.Error(codes.NotFound, "plugin not found")
+	}
+	if err != nil {
+		return nil, contextError(ctx, status.Errorf(codes.Internal, "Failed to fetch plugin"))
+	}
+	requiredKeys := []string(requiredConfigs)
+	if !declaresRequired {
+		requiredKeys = make([]string, 0, len(configs))
+		for k := range configs {
+			requiredKeys = append(requiredKeys, k)
+		}
+	}
+	sort.Strings(requiredKeys)
+
+	release, err := s.acquireDecryption(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	query = `SELECT org_id, merge_configurations(PGP_SYM_DECRYPT(configurations, $1::text), plaintext_configurations) FROM org_data_retention_plugins WHERE plugin_id=$2 AND version=$3 AND enabled='true' ORDER BY org_id`
+	rows, err := s.readDB.QueryxContext(ctx, query, s.dbKey, req.PluginID, req.Version)
+	if err != nil {
+		recordDecryptionFailure(req.PluginID, err)
+		return nil, contextError(ctx, status.Errorf(codes.Internal, "Failed to fetch configs"))
+	}
+	defer rows.Close()
+
+	resp := &pluginpb.FindNonCompliantOrgsAfterSchemaChangeResponse{}
+	for rows.Next() {
+		var orgID uuid.UUID
+		var configurations []byte
+		err := rows.Scan(&orgID, &configurations)
+		if err != nil {
+			return nil, status.Error(codes.Internal, "failed to read configs")
+		}
+
+		var orgConfigs map[string]string
+		if configurations != nil {
+			err = json.Unmarshal(configurations, &orgConfigs)
+			if err != nil {
+				return nil, status.Error(codes.Internal, "failed to read configs")
+			}
+		}
+
+		var missingKeys []string
+		for _, k := range requiredKeys {
+			if orgConfigs[k] == "" {
+				missingKeys = append(missingKeys, k)
+			}
+		}
+		if len(missingKeys) > 0 {
+			resp.Orgs = append(resp.Orgs, &pluginpb.FindNonCompliantOrgsAfterSchemaChangeResponse_NonCompliantOrg{
+				OrgID:       utils.ProtoFromUUID(orgID),
+				MissingKeys: missingKeys,
+			})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		recordDecryptionFailure(req.PluginID, err)
+		return nil, contextError(ctx, status.Errorf(codes.Internal, "Failed to fetch configs"))
+	}
+	return resp, nil
+}
+
+// GetOrgConfigForGitOps gets the org's configuration for a plugin as a canonical string, with the values hashed so
+// that config drift can be diffed in version control without leaking secrets.
+func (s *Server) GetOrgConfigForGitOps(ctx context.Context, req *pluginpb.GetOrgConfigForGitOpsRequest) (*pluginpb.GetOrgConfigForGitOpsResponse, error) {
+	if utils.IsNilUUIDProto(req.OrgID) {
+		return nil, status.Error(codes.InvalidArgument, "Must specify OrgID")
+	}
+
+	if req.PluginID == "" {
+		return nil, status.Error(codes.InvalidArgument, "Must specify plugin ID")
+	}
+
+	release, err := s.acquireDecryption(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	query := `SELECT version, merge_configurations(PGP_SYM_DECRYPT(configurations, $1::text), plaintext_configurations) FROM org_data_retention_plugins WHERE org_id=$2 AND plugin_id=$3 AND enabled='true'`
+
+	orgID := utils.UUIDFromProtoOrNil(req.OrgID)
+	rows, err := s.readDB.QueryxContext(ctx, query, s.dbKey, orgID, req.PluginID)
+	if err != nil {
+		recordDecryptionFailure(req.PluginID, err)
+		return nil, contextError(ctx, status.Errorf(codes.Internal, "Failed to fetch plugin"))
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		var version string
+		var configurationJSON []byte
+		var configMap map[string]string
+
+		err := rows.Scan(&version, &configurationJSON)
+		if err != nil {
+			return nil, status.Error(codes.Internal, "failed to read configs")
+		}
+
+		if configurationJSON != nil {
+			err = json.Unmarshal(configurationJSON, &configMap)
+			if err != nil {
+				configDecryptionFailures.WithLabelValues(req.PluginID).Inc()
+				return nil, status.Error(codes.Internal, "failed to read configs")
+			}
+		}
+
+		return &pluginpb.GetOrgConfigForGitOpsResponse{
+			Config: redactedConfigString(req.PluginID, version, configMap, s.gitOpsHashKey),
+		}, nil
+	}
+	if err := rows.Err(); err != nil {
+		recordDecryptionFailure(req.PluginID, err)
+		return nil, contextError(ctx, status.Errorf(codes.Internal, "Failed to fetch plugin"))
+	}
+	return nil, status.Error(codes.NotFound, "plugin is not enabled")
+}
+
+func (s *Server) enableOrgRetention(ctx context.Context, tx *sqlx.Tx, orgID uuid.UUID, pluginID string, version string, configurations []byte, typedConfigurations []byte, minFrequencyS sql.NullInt64) error {
+	secretConfigs, plaintextConfigs, err := s.splitOrgConfigs(ctx, tx, pluginID, version, configurations)
+	if err != nil {
+		return err
+	}
+
+	// If the org already has a row for the plugin, it is replaced rather than duplicated.
+	query := `INSERT INTO org_data_retention_plugins (org_id, plugin_id, version, configurations, typed_configurations, min_frequency_s, plaintext_configurations) VALUES ($1, $2, $3, PGP_SYM_ENCRYPT($4, $5, $8::text), PGP_SYM_ENCRYPT($6, $5, $8::text), $7, $9)
+		ON CONFLICT (org_id, plugin_id) DO UPDATE SET version = EXCLUDED.version, configurations = EXCLUDED.configurations, typed_configurations = EXCLUDED.typed_configurations, min_frequency_s = EXCLUDED.min_frequency_s, plaintext_configurations = EXCLUDED.plaintext_configurations, enabled = true`
+
+	ctx, span := startSpan(ctx, "encryptOrgConfig", orgID, pluginID)
+	_, err = tx.ExecContext(ctx, query, orgID, pluginID, version, secretConfigs, s.dbKey, typedConfigurations, minFrequencyS, s.pgpOptions, plaintextConfigs)
+	endSpan(span, err)
+	return err
+}
+
+// splitOrgConfigs splits the org's configurations into the configurations which the plugin release marks as secret,
+// which are stored encrypted, and the plaintext configurations.
+func (s *Server) splitOrgConfigs(ctx context.Context, q sqlx.QueryerContext, pluginID string, version string, configurations []byte) ([]byte, []byte, error) {
+	query := `SELECT secret_configurations FROM data_retention_plugin_releases WHERE plugin_id=$1 AND version=$2`
+
+	var secretKeys pq.StringArray
+	err := q.QueryRowxContext(ctx, query, pluginID, version).Scan(&secretKeys)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, nil, err
+	}
+	return splitSecretConfigs(configurations, secretKeys)
+}
+
+// createPresetScripts creates the org's retention scripts for the preset scripts in the plugin release. Script
+// frequencies are clamped up to the org's minimum frequency, if set. Preset scripts which the org already has, such as
+// from a previous enablement, are left as they are.
+func (s *Server) createPresetScripts(ctx context.Context, tx *sqlx.Tx, orgID uuid.UUID, pluginID string, version string, minFrequencyS int64) error {
+	query := `SELECT preset_scripts FROM data_retention_plugin_releases WHERE plugin_id=$1 AND version=$2`
+
+	var presetScripts PresetScripts
+	err := tx.QueryRowxContext(ctx, query, pluginID, version).Scan(&presetScripts)
+	if err != nil {
+		return err
+	}
+
+	query = `INSERT INTO plugin_retention_scripts (org_id, plugin_id, plugin_version, script_id, script_name, description, contents, frequency_s, enabled, is_preset)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, true, true) ON CONFLICT (org_id, script_name) DO NOTHING`
+	for _, p := range presetScripts {
+		scriptID, err := uuid.NewV4()
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, query, orgID, pluginID, version, scriptID, p.Name, p.Description, p.Script, clampFrequency(p.DefaultFrequencyS, minFrequencyS))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// disableOrgRetention disables the plugin for the org. The org's configs are kept, so that they can be restored if the
+// org enables the plugin again.
+func (s *Server) disableOrgRetention(ctx context.Context, tx *sqlx.Tx, orgID uuid.UUID, pluginID string) error {
+	query := `UPDATE org_data_retention_plugins SET enabled='false' WHERE org_id=$1 AND plugin_id=$2`
+
+	_, err := tx.ExecContext(ctx, query, orgID, pluginID)
+	return err
+}
+
+func (s *Server) updateOrgRetentionConfigs(ctx context.Context, tx *sqlx.Tx, orgID uuid.UUID, pluginID string, version string, configurations []byte, typedConfigurations []byte) error {
+	secretConfigs, plaintextConfigs, err := s.splitOrgConfigs(ctx, tx, pluginID, version, configurations)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE org_data_retention_plugins SET version = $1, configurations = PGP_SYM_ENCRYPT($2, $3, $7::text), typed_configurations = PGP_SYM_ENCRYPT($6, $3, $7::text), plaintext_configurations = $8 WHERE org_id = $4 AND plugin_id = $5 AND enabled='true'`
+
+	ctx, span := startSpan(ctx, "encryptOrgConfig", orgID, pluginID)
+	_, err = tx.ExecContext(ctx, query, version, secretConfigs, s.dbKey, orgID, pluginID, typedConfigurations, s.pgpOptions, plaintextConfigs)
+	endSpan(span, err)
+	return err
+}
+
+// recordOrgConfigHistory saves the org's current config for a plugin as the last config it set for the version.
+func (s *Server) recordOrgConfigHistory(ctx context.Context, tx *sqlx.Tx, orgID uuid.UUID, pluginID string) error {
+	query := `INSERT INTO org_data_retention_plugin_config_history (org_id, plugin_id, version, configurations, plaintext_configurations, updated_at)
+		SELECT org_id, plugin_id, version, configurations, plaintext_configurations, NOW() FROM org_data_retention_plugins WHERE org_id=$1 AND plugin_id=$2
+		ON CONFLICT (org_id, plugin_id, version) DO UPDATE SET configurations = EXCLUDED.configurations, plaintext_configurations = EXCLUDED.plaintext_configurations, updated_at = EXCLUDED.updated_at`
+
+	_, err := tx.ExecContext(ctx, query, orgID, pluginID)
+	return err
+}
+
+// retentionReleaseExists checks whether the given plugin version has a data retention release.
+func (s *Server) retentionReleaseExists(ctx context.Context, q sqlx.QueryerContext, pluginID string, version string) (bool, error) {
+	query := `SELECT EXISTS(SELECT 1 FROM data_retention_plugin_releases WHERE plugin_id=$1 AND version=$2)`
+
+	var exists bool
+	err := q.QueryRowxContext(ctx, query, pluginID, version).Scan(&exists)
+	return exists, err
+}
+
+// checkExportURLAllowed returns a PermissionDenied error if the export URL is a custom URL and the plugin release does
+// not allow custom export URLs. An empty URL or the release's default export URL is always allowed.
+func (s *Server) checkExportURLAllowed(ctx context.Context, q sqlx.QueryerContext, pluginID string, version string, exportURL string) error {
+	if exportURL == "" {
+		return nil
+	}
+
+	var defaultExportURL sql.NullString
+	var allowCustomExportURL sql.NullBool
+	query := `SELECT default_export_url, allow_custom_export_url FROM data_retention_plugin_releases WHERE plugin_id=$1 AND version=$2`
+	err := q.QueryRowxContext(ctx, query, pluginID, version).Scan(&defaultExportURL, &allowCustomExportURL)
+	if err != nil {
+		return contextError(ctx, status.Error(codes.Internal, "Failed to fetch plugin"))
+	}
+	if allowCustomExportURL.Bool || exportURL == defaultExportURL.String {
+		return nil
+	}
+	return status.Error(codes.PermissionDenied, "Plugin does not allow custom export URLs")
+}
+
+// checkConfigSchema returns an InvalidArgument error describing each violation if the configs do not satisfy the
+// plugin release's config schema. Any configs are allowed if the release has no schema.
+func (s *Server) checkConfigSchema(ctx context.Context, q sqlx.QueryerContext, pluginID string, version string, configurations []byte, typedConfigurations []byte) error {
+	var configSchema []byte
+	query := `SELECT config_schema FROM data_retention_plugin_releases WHERE plugin_id=$1 AND version=$2`
+	err := q.QueryRowxContext(ctx, query, pluginID, version).Scan(&configSchema)
+	if err != nil {
+		return contextError(ctx, status.Error(codes.Internal, "Failed to fetch plugin"))
+	}
+	if configSchema == nil {
+		return nil
+	}
+
+	violations, err := configSchemaViolations(configSchema, configurations, typedConfigurations)
+	if err != nil {
+		return status.Error(codes.Internal, "Failed to validate configs")
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	descs := make([]string, len(violations))
+	for i, v := range violations {
+		descs[i] = fmt.Sprintf("%s: %s", v.Field, v.Description)
+	}
+	return fieldViolationsError(violations, fmt.Sprintf("Configurations do not match the plugin's config schema: %s", strings.Join(descs, "; ")))
+}
+
+// getOrgRetentionState gets the org's current version, configs and typed configs for a plugin. Returns sql.ErrNoRows
+// if the plugin is not enabled.
+func (s *Server) getOrgRetentionState(ctx context.Context, tx *sqlx.Tx, orgID uuid.UUID, pluginID string) (string, []byte, []byte, error) {
+	query := `SELECT version, merge_configurations(PGP_SYM_DECRYPT(configurations, $1::text), plaintext_configurations), PGP_SYM_DECRYPT(typed_configurations, $1::text) FROM org_data_retention_plugins WHERE org_id=$2 AND plugin_id=$3 AND enabled='true'`
+
+	var version string
+	var configurations []byte
+	var typedConfigurations []byte
+	ctx, span := startSpan(ctx, "decryptOrgConfig", orgID, pluginID)
+	err := tx.QueryRowxContext(ctx, query, s.dbKey, orgID, pluginID).Scan(&version, &configurations, &typedConfigurations)
+	endSpan(span, err)
+	if err != nil {
+		recordDecryptionFailure(pluginID, err)
+	}
+	return version, configurations, typedConfigurations, err
+}
+
+// getDisabledOrgRetentionConfigs gets the configs and typed configs the org had when it disabled the plugin. Returns
+// sql.ErrNoRows if the org has not disabled the plugin.
+func (s *Server) getDisabledOrgRetentionConfigs(ctx context.Context, tx *sqlx.Tx, orgID uuid.UUID, pluginID string) ([]byte, []byte, error) {
+	query := `SELECT merge_configurations(PGP_SYM_DECRYPT(configurations, $1::text), plaintext_configurations), PGP_SYM_DECRYPT(typed_configurations, $1::text) FROM org_data_retention_plugins WHERE org_id=$2 AND plugin_id=$3 AND enabled='false'`
+
+	var configurations []byte
+	var typedConfigurations []byte
+	ctx, span := startSpan(ctx, "decryptOrgConfig", orgID, pluginID)
+	err := tx.QueryRowxContext(ctx, query, s.dbKey, orgID, pluginID).Scan(&configurations, &typedConfigurations)
+	endSpan(span, err)
+	if err != nil {
+		recordDecryptionFailure(pluginID, err)
+	}
+	return configurations, typedConfigurations, err
+}
+
+// lockOrgRetentionVersion gets the version of the plugin the org is running, and locks the org's config for the plugin
+// until the transaction ends. Returns an empty version if the plugin is not enabled.
+func (s *Server) lockOrgRetentionVersion(ctx context.Context, tx *sqlx.Tx, orgID uuid.UUID, pluginID string) (string, error) {
+	query := `SELECT version FROM org_data_retention_plugins WHERE org_id=$1 AND plugin_id=$2 AND enabled='true' FOR UPDATE`
+
+	var version string
+	err := tx.QueryRowxContext(ctx, query, orgID, pluginID).Scan(&version)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return version, err
+}
+
+// TestRetentionPluginConfig tests whether an org's configuration for a plugin can connect to the plugin provider,
+// without saving it. Configurations which aren't specified are taken from the org's saved configuration.
+func (s *Server) TestRetentionPluginConfig(ctx context.Context, req *pluginpb.TestRetentionPluginConfigRequest) (*pluginpb.TestRetentionPluginConfigResponse, error) {
+	if utils.IsNilUUIDProto(req.OrgID) {
+		return nil, invalidFieldError("org_id", "Must specify OrgID")
+	}
+	if req.PluginID == "" {
+		return nil, invalidFieldError("plugin_id", "Must specify plugin ID")
+	}
+	orgID := utils.UUIDFromProtoOrNil(req.OrgID)
+
+	release, err := s.acquireDecryption(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var savedVersion string
+	var savedConfig, savedTypedConfig []byte
+	query := `SELECT version, merge_configurations(PGP_SYM_DECRYPT(configurations, $1::text), plaintext_configurations), PGP_SYM_DECRYPT(typed_configurations, $1::text) FROM org_data_retention_plugins WHERE org_id=$2 AND plugin_id=$3 AND enabled='true'`
+	spanCtx, span := startSpan(ctx, "decryptOrgConfig", orgID, req.PluginID)
+	err = s.readDB.QueryRowxContext(spanCtx, query, s.dbKey, orgID, req.PluginID).Scan(&savedVersion, &savedConfig, &savedTypedConfig)
+	endSpan(span, err)
+	release()
+	if err != nil && err != sql.ErrNoRows {
+		recordDecryptionFailure(req.PluginID, err)
+		return nil, contextError(ctx, status.Errorf(codes.Internal, "Failed to fetch plugin"))
+	}
+
+	configs := make(map[string]string)
+	if savedConfig != nil {
+		err = json.Unmarshal(savedConfig, &configs)
+		if err != nil {
+			return nil, status.Error(codes.Internal, "failed to read configs")
+		}
+	}
+	for k, v := range req.Configurations {
+		configs[k] = v
+	}
+	version := req.Version
+	if version == "" {
+		version = savedVersion
+	}
+	if version == "" {
+		return nil, invalidFieldError("version", "Must specify plugin version if the plugin is not enabled")
+	}
+
+	var rp RetentionPlugin
+	query = `SELECT plugin_id, version, configurations, required_configurations, config_schema, health_check_url FROM data_retention_plugin_releases WHERE plugin_id=$1 AND version=$2`
+	err = s.readDB.QueryRowxContext(ctx, query, req.PluginID, version).StructScan(&rp)
+	if err == sql.ErrNoRows {
+		return nil, invalidFieldError("version", "plugin version does not exist")
+	}
+	if err != nil {
+		return nil, contextError(ctx, status.Errorf(codes.Internal, "Failed to fetch plugin"))
+	}
+
+	configJSON, err := json.Marshal(configs)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to read configs")
+	}
+	violations, err := configViolations(rp, configs, configJSON, savedTypedConfig)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Failed to validate configs")
+	}
+	if len(violations) > 0 {
+		resp := &pluginpb.TestRetentionPluginConfigResponse{Result: pluginpb.RESULT_INVALID_CONFIG}
+		descs := make([]string, len(violations))
+		for i, v := range violations {
+			resp.InvalidFields = append(resp.InvalidFields, v.Field)
+			descs[i] = fmt.Sprintf("%s: %s", v.Field, v.Description)
+		}
+		resp.Message = strings.Join(descs, "; ")
+		return resp, nil
+	}
+
+	if rp.HealthCheckURL == nil {
+		return &pluginpb.TestRetentionPluginConfigResponse{
+			Result:  pluginpb.RESULT_NOT_SUPPORTED,
+			Message: "The plugin does not support testing connections",
+		}, nil
+	}
+	err = s.checkPluginHealth(ctx, *rp.HealthCheckURL, configJSON)
+	if ctx.Err() != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "Failed to test connection"))
+	}
+	if err != nil {
+		return &pluginpb.TestRetentionPluginConfigResponse{
+			Result:  pluginpb.RESULT_FAILURE,
+			Message: err.Error(),
+		}, nil
+	}
+	return &pluginpb.TestRetentionPluginConfigResponse{Result: pluginpb.RESULT_SUCCESS}, nil
+}
+
+// checkPluginHealth POSTs the configs to the plugin's health check, returning an error if the check does not succeed.
+func (s *Server) checkPluginHealth(ctx context.Context, healthCheckURL string, configJSON []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, healthCheckURL, bytes.NewReader(configJSON))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.healthCheckClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("health check failed with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// UpdateOrgRetentionPluginConfig updates an org's configuration for a plugin. All writes, including creating preset
+// scripts and recording the config history, are made in a single transaction, so a failure at any step leaves the
+// org's configuration unchanged.
+func (s *Server) UpdateOrgRetentionPluginConfig(ctx context.Context, req *pluginpb.UpdateOrgRetentionPluginConfigRequest) (*pluginpb.UpdateOrgRetentionPluginConfigResponse, error) {
+	if utils.IsNilUUIDProto(req.OrgID) {
+		return nil, invalidFieldError("org_id", "Must specify OrgID")
+	}
+
+	if req.PluginID == "" {
+		return nil, invalidFieldError("plugin_id", "Must specify plugin ID")
+	}
+
+	if req.Enabled != nil && req.Enabled.Value && req.Version == nil {
+		return nil, invalidFieldError("version", "Must specify plugin version when enabling")
+	}
+
+	if req.MinFrequencyS != nil && req.MinFrequencyS.Value < 0 {
+		return nil, invalidFieldError("min_frequency_s", "Minimum frequency must not be negative")
+	}
+
+	var configurations []byte
+	var version string
+
+	orgID := utils.UUIDFromProtoOrNil(req.OrgID)
+	if req.Version != nil {
+		version = req.Version.Value
+	}
+	if req.Configurations != nil && len(req.Configurations) > 0 {
+		configurations, _ = json.Marshal(req.Configurations)
+	}
+	typedConfigurations, err := typedConfigsToJSON(req.TypedConfigurations)
+	if err != nil {
+		return nil, invalidFieldError("typed_configurations", "Invalid typed configurations")
+	}
+	err = s.checkOrgConfigWriteRate(orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "failed to update configs"))
+	}
+	defer tx.Rollback()
+
+	if version != "" {
+		exists, err := s.retentionReleaseExists(ctx, tx, req.PluginID, version)
+		if err != nil {
+			return nil, contextError(ctx, status.Errorf(codes.Internal, "Failed to fetch plugin"))
+		}
+		if !exists {
+			return nil, invalidFieldError("version", "plugin version does not exist")
+		}
+	}
+
+	if req.ExpectedVersion != nil {
+		currentVersion, err := s.lockOrgRetentionVersion(ctx, tx, orgID, req.PluginID)
+		if err != nil {
+			return nil, contextError(ctx, status.Errorf(codes.Internal, "Failed to fetch plugin"))
+		}
+		if currentVersion != req.ExpectedVersion.Value {
+			return nil, status.Error(codes.FailedPrecondition, "plugin version has changed")
+		}
+	}
+
+	if req.Enabled != nil && req.Enabled.Value { // Plugin was just enabled, we should create it.
+		// Restore the configs the org had when it disabled the plugin, for any configs which aren't specified.
+		savedConfig, savedTypedConfig, err := s.getDisabledOrgRetentionConfigs(ctx, tx, orgID, req.PluginID)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, contextError(ctx, status.Errorf(codes.Internal, "Failed to fetch plugin"))
+		}
+		if configurations == nil {
+			configurations = savedConfig
+		}
+		if typedConfigurations == nil {
+			typedConfigurations = savedTypedConfig
+		}
+
+		var minFrequencyS sql.NullInt64
+		if req.MinFrequencyS != nil {
+			minFrequencyS = sql.NullInt64{Int64: req.MinFrequencyS.Value, Valid: true}
+		}
+		err = s.enableOrgPlugin(ctx, tx, orgID, req.PluginID, version, configurations, typedConfigurations, minFrequencyS)
+		if err != nil {
+			return nil, err
+		}
+	} else if req.Enabled != nil && !req.Enabled.Value { // Plugin was disabled, but its configs are kept.
+		dependents, err := s.enabledDependents(ctx, tx, orgID, req.PluginID)
+		if err != nil {
+			return nil, contextError(ctx, status.Errorf(codes.Internal, "Failed to fetch plugin"))
+		}
+		if len(dependents) > 0 {
+			return nil, status.Errorf(codes.FailedPrecondition, "Plugin is required by enabled plugins: %s", strings.Join(dependents, ", "))
+		}
+		err = s.disableOrgRetention(ctx, tx, orgID, req.PluginID)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		// Fetch current configs.
+		origVersion, origConfig, origTypedConfig, err := s.getOrgRetentionState(ctx, tx, orgID, req.PluginID)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, contextError(ctx, status.Errorf(codes.Internal, "Failed to fetch plugin"))
+		}
+
+		if configurations == nil {
+			configurations = origConfig
+		}
+		if typedConfigurations == nil {
+			typedConfigurations = origTypedConfig
+		}
+		if version == "" {
+			version = origVersion
+		}
+
+		err = s.updateOrgRetentionConfigs(ctx, tx, orgID, req.PluginID, version, configurations, typedConfigurations)
+		if err != nil {
+			return nil, contextError(ctx, status.Error(codes.Internal, "failed to update configs"))
+		}
+		err = s.recordOrgConfigHistory(ctx, tx, orgID, req.PluginID)
+		if err != nil {
+			return nil, contextError(ctx, status.Error(codes.Internal, "failed to update configs"))
+		}
+
+		// if origVersion != version { // The user is updating the plugin.
+		// 	// TODO(michelle): If the user is updating the plugin, we may need to update some of the presetScripts users have configured.
+		// }
+	}
+
+	// Enabling checks the schema itself, so only updates are checked here.
+	if version != "" && req.Enabled == nil {
+		err = s.checkConfigSchema(ctx, tx, req.PluginID, version, configurations, typedConfigurations)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if req.CustomExportURL != nil && (req.Enabled == nil || req.Enabled.Value) {
+		if version == "" {
+			return nil, invalidFieldError("custom_export_url", "Plugin must be enabled to set a custom export URL")
+		}
+		err = s.checkExportURLAllowed(ctx, tx, req.PluginID, version, req.CustomExportURL.Value)
+		if err != nil {
+			return nil, err
+		}
+		query := `UPDATE org_data_retention_plugins SET custom_export_url=NULLIF($1, '') WHERE org_id=$2 AND plugin_id=$3 AND enabled='true'`
+		_, err = tx.ExecContext(ctx, query, req.CustomExportURL.Value, orgID, req.PluginID)
+		if err != nil {
+			return nil, contextError(ctx, status.Error(codes.Internal, "failed to update configs"))
+		}
+	}
+
+	if req.DryRun {
+		// Read back the would-be state, and leave the deferred rollback to discard the update.
+		resp := &pluginpb.UpdateOrgRetentionPluginConfigResponse{}
+		newVersion, newConfig, newTypedConfig, err := s.getOrgRetentionState(ctx, tx, orgID, req.PluginID)
+		if err == sql.ErrNoRows {
+			return resp, nil
+		}
+		if err != nil {
+			return nil, contextError(ctx, status.Errorf(codes.Internal, "Failed to fetch plugin"))
+		}
+		resp.Enabled = true
+		resp.Version = newVersion
+		if newConfig != nil {
+			err = json.Unmarshal(newConfig, &resp.Configurations)
+			if err != nil {
+				configDecryptionFailures.WithLabelValues(req.PluginID).Inc()
+				return nil, status.Error(codes.Internal, "failed to read configs")
+			}
+		}
+		resp.TypedConfigurations, err = typedConfigsFromJSON(newTypedConfig)
+		if err != nil {
+			configDecryptionFailures.WithLabelValues(req.PluginID).Inc()
+			return nil, status.Error(codes.Internal, "failed to read configs")
+		}
+		if !s.canReadDecryptedConfigs(ctx) {
+			resp.Configurations = redactConfigs(resp.Configurations)
+			resp.TypedConfigurations = redactTypedConfigs(resp.TypedConfigurations)
+		}
+		return resp, nil
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "failed to update configs"))
+	}
+
+	return &pluginpb.UpdateOrgRetentionPluginConfigResponse{}, nil
+}
+
+// enableOrgPlugin checks that the org may enable the plugin release with the given configs, and enables it, replacing
+// any config the org has for the plugin. The org's preset scripts for the release are created, and its config history
+// is recorded. Every path which enables a plugin for an org goes through here, so that they enforce the same checks.
+func (s *Server) enableOrgPlugin(ctx context.Context, tx *sqlx.Tx, orgID uuid.UUID, pluginID string, version string, configurations []byte, typedConfigurations []byte, minFrequencyS sql.NullInt64) error {
+	err := s.checkOrgPluginRequirements(ctx, tx, orgID, pluginID, version, configurations, typedConfigurations)
+	if err != nil {
+		return err
+	}
+
+	err = s.enableOrgRetention(ctx, tx, orgID, pluginID, version, configurations, typedConfigurations, minFrequencyS)
+	if err != nil {
+		return contextError(ctx, status.Error(codes.Internal, "failed to update configs"))
+	}
+	err = s.createPresetScripts(ctx, tx, orgID, pluginID, version, minFrequencyS.Int64)
+	if err != nil {
+		return contextError(ctx, status.Error(codes.Internal, "failed to create preset scripts"))
+	}
+	err = s.recordOrgConfigHistory(ctx, tx, orgID, pluginID)
+	if err != nil {
+		return contextError(ctx, status.Error(codes.Internal, "failed to update configs"))
+	}
+	return nil
+}
+
+// checkOrgPluginRequirements checks that the org may run the plugin release with the given configs. The plugins the
+// release depends on must be enabled, its required configs must be set, and the configs must satisfy its schema.
+func (s *Server) checkOrgPluginRequirements(ctx context.Context, tx *sqlx.Tx, orgID uuid.UUID, pluginID string, version string, configurations []byte, typedConfigurations []byte) error {
+	var configs map[string]string
+	if configurations != nil {
+		err := json.Unmarshal(configurations, &configs)
+		if err != nil {
+			configDecryptionFailures.WithLabelValues(pluginID).Inc()
+			return status.Error(codes.Internal, "failed to read configs")
+		}
+	}
+
+	var requiredConfigs, dependencies pq.StringArray
+	query := `SELECT required_configurations, dependencies FROM data_retention_plugin_releases WHERE plugin_id=$1 AND version=$2`
+	err := tx.QueryRowxContext(ctx, query, pluginID, version).Scan(&requiredConfigs, &dependencies)
+	if err != nil {
+		return contextError(ctx, status.Errorf(codes.Internal, "Failed to fetch plugin"))
+	}
+	missingDeps, err := s.missingDependencies(ctx, tx, orgID, dependencies)
+	if err != nil {
+		return contextError(ctx, status.Errorf(codes.Internal, "Failed to fetch plugin"))
+	}
+	if len(missingDeps) > 0 {
+		return status.Errorf(codes.FailedPrecondition, "Plugin depends on plugins which are not enabled: %s", strings.Join(missingDeps, ", "))
+	}
+	if missing := missingRequiredConfigs(requiredConfigs, configs); len(missing) > 0 {
+		fields := make([]string, len(missing))
+		for i, k := range missing {
+			fields[i] = "configurations." + k
+		}
+		return invalidFieldsError(fields, fmt.Sprintf("Missing required configurations: %s", strings.Join(missing, ", ")))
+	}
+	return s.checkConfigSchema(ctx, tx, pluginID, version, configurations, typedConfigurations)
+}
+
+// missingDependencies returns the dependencies, in sorted order, which the org does not have enabled.
+func (s *Server) missingDependencies(ctx context.Context, tx *sqlx.Tx, orgID uuid.UUID, dependencies []string) ([]string, error) {
+	if len(dependencies) == 0 {
+		return nil, nil
+	}
+	query := `SELECT DISTINCT d FROM UNNEST($1::text[]) AS d
+		WHERE NOT EXISTS(SELECT 1 FROM org_data_retention_plugins WHERE org_id=$2 AND plugin_id=d AND enabled='true')
+		ORDER BY d`
+	var missing []string
+	err := tx.SelectContext(ctx, &missing, query, pq.StringArray(dependencies), orgID)
+	if err != nil {
+		return nil, err
+	}
+	return missing, nil
+}
+
+// enabledDependents returns the IDs of the plugins which the org has enabled at a release depending on the given
+// plugin.
+func (s *Server) enabledDependents(ctx context.Context, tx *sqlx.Tx, orgID uuid.UUID, pluginID string) ([]string, error) {
+	query := `SELECT o.plugin_id FROM org_data_retention_plugins AS o, data_retention_plugin_releases AS d
+		WHERE o.plugin_id = d.plugin_id AND o.version = d.version AND o.org_id=$1 AND o.enabled='true' AND $2 = ANY(d.dependencies)
+		ORDER BY o.plugin_id`
+	var dependents []string
+	err := tx.SelectContext(ctx, &dependents, query, orgID, pluginID)
+	if err != nil {
+		return nil, err
+	}
+	return dependents, nil
+}
+
+// SetOrgDefaultExportURL sets the URL which the org's data is exported to for every plugin which allows custom export
+// URLs. Custom export URLs which the org has set for individual plugins still take precedence.
+func (s *Server) SetOrgDefaultExportURL(ctx context.Context, req *pluginpb.SetOrgDefaultExportURLRequest) (*pluginpb.SetOrgDefaultExportURLResponse, error) {
+	if utils.IsNilUUIDProto(req.OrgID) {
+		return nil, invalidFieldError("org_id", "Must specify OrgID")
+	}
+	if req.DefaultExportURL != "" && !isAbsoluteURL(req.DefaultExportURL) {
+		return nil, invalidFieldError("default_export_url", "Default export URL must be an absolute URL")
+	}
+	orgID := utils.UUIDFromProtoOrNil(req.OrgID)
+	err := s.checkOrgConfigWriteRate(orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `INSERT INTO org_retention_settings (org_id, default_export_url) VALUES ($1, NULLIF($2, ''))
+		ON CONFLICT (org_id) DO UPDATE SET default_export_url = EXCLUDED.default_export_url`
+	_, err = s.db.ExecContext(ctx, query, orgID, req.DefaultExportURL)
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "failed to set default export URL"))
+	}
+	return &pluginpb.SetOrgDefaultExportURLResponse{}, nil
+}
+
+// MigrateOrgToLatestVersion moves an org to the latest non-yanked stable version of a plugin which supports data
+// retention, in the namespace of the org's current version, keeping the org's configs and creating the version's preset
+// scripts. Orgs are never moved to an older version. The request's key renames are applied to the org's configs, which
+// must then satisfy the new version's requirements, as when enabling it. The migration is rejected if the org has set
+// keys which the new version removed and which are not renamed.
+func (s *Server) MigrateOrgToLatestVersion(ctx context.Context, req *pluginpb.MigrateOrgToLatestVersionRequest) (*pluginpb.MigrateOrgToLatestVersionResponse, error) {
+	if utils.IsNilUUIDProto(req.OrgID) {
+		return nil, status.Error(codes.InvalidArgument, "Must specify OrgID")
+	}
+	if req.PluginID == "" {
+		return nil, status.Error(codes.InvalidArgument, "Must specify plugin ID")
+	}
+	orgID := utils.UUIDFromProtoOrNil(req.OrgID)
+	err := s.checkOrgConfigWriteRate(orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "Failed to start transaction"))
+	}
+	defer tx.Rollback()
+
+	oldVersion, err := s.lockOrgRetentionVersion(ctx, tx, orgID, req.PluginID)
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "Failed to fetch plugin"))
+	}
+	if oldVersion == "" {
+		return nil, status.Error(codes.NotFound, "plugin is not enabled")
+	}
+
+	// Orgs stay in the namespace of the release they are on.
+	query := `SELECT r.version FROM plugin_releases AS r, data_retention_plugin_releases AS d
+		WHERE r.id = d.plugin_id AND r.version = d.version AND r.id=$1 AND r.yanked='false' AND r.release_channel=$2
+		AND r.namespace = (SELECT namespace FROM plugin_releases WHERE id=$1 AND version=$3)`
+	var versions []string
+	err = tx.SelectContext(ctx, &versions, query, req.PluginID, releaseChannelStable, oldVersion)
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "Failed to fetch plugin"))
+	}
+	newVersion := latestVersion(versions)
+	if newVersion == "" || compareVersions(newVersion, oldVersion) <= 0 {
+		return &pluginpb.MigrateOrgToLatestVersionResponse{OldVersion: oldVersion, NewVersion: oldVersion}, nil
+	}
+
+	_, configurations, typedConfigurations, err := s.getOrgRetentionState(ctx, tx, orgID, req.PluginID)
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "Failed to fetch plugin"))
+	}
+	var configs map[string]string
+	if configurations != nil {
+		err = json.Unmarshal(configurations, &configs)
+		if err != nil {
+			configDecryptionFailures.WithLabelValues(req.PluginID).Inc()
+			return nil, status.Error(codes.Internal, "failed to read configs")
+		}
+	}
+	if len(req.KeyRenames) > 0 {
+		configs, err = renameConfigKeys(configs, req.KeyRenames)
+		if err != nil {
+			return nil, err
+		}
+		configurations, err = json.Marshal(configs)
+		if err != nil {
+			return nil, status.Error(codes.Internal, "failed to update configs")
+		}
+	}
+
+	var oldConfigs, newConfigs Configurations
+	query = `SELECT configurations FROM data_retention_plugin_releases WHERE plugin_id=$1 AND version=$2`
+	err = tx.QueryRowxContext(ctx, query, req.PluginID, oldVersion).Scan(&oldConfigs)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, contextError(ctx, status.Error(codes.Internal, "Failed to fetch plugin"))
+	}
+	err = tx.QueryRowxContext(ctx, query, req.PluginID, newVersion).Scan(&newConfigs)
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "Failed to fetch plugin"))
+	}
+	_, removed, _, _ := diffConfigurations(oldConfigs, newConfigs)
+	var removedSet []string
+	for _, k := range removed {
+		if configs[k] != "" {
+			removedSet = append(removedSet, k)
+		}
+	}
+	if len(removedSet) > 0 {
+		return nil, status.Errorf(codes.FailedPrecondition, "Version %s removes configurations which the org has set and which are not renamed: %s", newVersion, strings.Join(removedSet, ", "))
+	}
+
+	err = s.checkOrgPluginRequirements(ctx, tx, orgID, req.PluginID, newVersion, configurations, typedConfigurations)
+	if err != nil {
+		return nil, err
+	}
+
+	var minFrequencyS sql.NullInt64
+	query = `SELECT min_frequency_s FROM org_data_retention_plugins WHERE org_id=$1 AND plugin_id=$2`
+	err = tx.QueryRowxContext(ctx, query, orgID, req.PluginID).Scan(&minFrequencyS)
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "Failed to fetch plugin"))
+	}
+	// The configs are split by the new version's secret keys as they are written.
+	err = s.updateOrgRetentionConfigs(ctx, tx, orgID, req.PluginID, newVersion, configurations, typedConfigurations)
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "Failed to update plugin"))
+	}
+	err = s.createPresetScripts(ctx, tx, orgID, req.PluginID, newVersion, minFrequencyS.Int64)
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "failed to create preset scripts"))
+	}
+	err = s.recordOrgConfigHistory(ctx, tx, orgID, req.PluginID)
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "Failed to update plugin"))
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "Failed to commit transaction"))
+	}
+	return &pluginpb.MigrateOrgToLatestVersionResponse{OldVersion: oldVersion, NewVersion: newVersion}, nil
+}
+
+// SaveConfigTemplate saves a plugin config template which can be applied to many orgs.
+func (s *Server) SaveConfigTemplate(ctx context.Context, req *pluginpb.SaveConfigTemplateRequest) (*pluginpb.SaveConfigTemplateResponse, error) {
+	if req.PluginID == "" {
+		return nil, status.Error(codes.InvalidArgument, "Must specify plugin ID")
+	}
+	if req.Version == "" {
+		return nil, status.Error(codes.InvalidArgument, "Must specify plugin version")
+	}
+
+	templateID := utils.UUIDFromProtoOrNil(req.TemplateID)
+	if utils.IsNilUUID(templateID) {
+		var err error
+		templateID, err = uuid.NewV4()
+		if err != nil {
+			return nil, status.Error(codes.Internal, "failed to create template ID")
+		}
+	}
+
+	exists, err := s.retentionReleaseExists(ctx, s.db, req.PluginID, req.Version)
+	if err != nil {
+		return nil, contextError(ctx, status.Errorf(codes.Internal, "Failed to fetch plugin"))
+	}
+	if !exists {
+		return nil, status.Error(codes.InvalidArgument, "plugin version does not exist")
+	}
+
+	configurations, err := json.Marshal(req.Configurations)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid configurations")
+	}
+
+	query := `INSERT INTO plugin_config_templates (template_id, name, plugin_id, version, configurations) VALUES ($1, $2, $3, $4, PGP_SYM_ENCRYPT($5, $6, $7::text))
+		ON CONFLICT (template_id) DO UPDATE SET name = EXCLUDED.name, plugin_id = EXCLUDED.plugin_id, version = EXCLUDED.version, configurations = EXCLUDED.configurations`
+	_, err = s.db.ExecContext(ctx, query, templateID, req.Name, req.PluginID, req.Version, configurations, s.dbKey, s.pgpOptions)
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "failed to save template"))
+	}
+
+	return &pluginpb.SaveConfigTemplateResponse{
+		TemplateID: utils.ProtoFromUUID(templateID),
+	}, nil
+}
+
+// ApplyConfigTemplate applies a plugin config template to an org, overwriting the org's config for the plugin. The
+// template's placeholders are filled in with the given values before the config is encrypted for the org. The plugin is
+// enabled with the same checks as UpdateOrgRetentionPluginConfig.
+func (s *Server) ApplyConfigTemplate(ctx context.Context, req *pluginpb.ApplyConfigTemplateRequest) (*pluginpb.ApplyConfigTemplateResponse, error) {
+	if utils.IsNilUUIDProto(req.TemplateID) {
+		return nil, status.Error(codes.InvalidArgument, "Must specify TemplateID")
+	}
+	if utils.IsNilUUIDProto(req.OrgID) {
+		return nil, status.Error(codes.InvalidArgument, "Must specify OrgID")
+	}
+	err := s.checkOrgConfigWriteRate(utils.UUIDFromProtoOrNil(req.OrgID))
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "failed to apply template"))
+	}
+	defer tx.Rollback()
+
+	query := `SELECT plugin_id, version, PGP_SYM_DECRYPT(configurations, $1::text) FROM plugin_config_templates WHERE template_id=$2`
+	templateID := utils.UUIDFromProtoOrNil(req.TemplateID)
+
+	var pluginID, version string
+	var templateJSON []byte
+	err = tx.QueryRowxContext(ctx, query, s.dbKey, templateID).Scan(&pluginID, &version, &templateJSON)
+	if err == sql.ErrNoRows {
+		return nil, status.Error(codes.NotFound, "template not found")
+	}
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "failed to fetch template"))
+	}
+
+	var templateConfigs map[string]string
+	err = json.Unmarshal(templateJSON, &templateConfigs)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to read template")
+	}
+
+	orgID := utils.UUIDFromProtoOrNil(req.OrgID)
+	values := map[string]string{}
+	for k, v := range req.PlaceholderValues {
+		values[k] = v
+	}
+	values["org_id"] = orgID.String()
+
+	orgConfigs, err := fillConfigPlaceholders(templateConfigs, values)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	configurations, err := json.Marshal(orgConfigs)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to apply template")
+	}
+
+	exists, err := s.retentionReleaseExists(ctx, tx, pluginID, version)
+	if err != nil {
+		return nil, contextError(ctx, status.Errorf(codes.Internal, "Failed to fetch plugin"))
+	}
+	if !exists {
+		return nil, status.Error(codes.FailedPrecondition, "template's plugin version no longer exists")
+	}
+
+	// The template replaces the org's whole config, so the org's typed configs, minimum frequency and custom export URL
+	// are reset rather than kept from its previous config.
+	err = s.enableOrgPlugin(ctx, tx, orgID, pluginID, version, configurations, nil, sql.NullInt64{})
+	if err != nil {
+		return nil, err
+	}
+	query = `UPDATE org_data_retention_plugins SET custom_export_url=NULL WHERE org_id=$1 AND plugin_id=$2`
+	_, err = tx.ExecContext(ctx, query, orgID, pluginID)
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "failed to apply template"))
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "failed to apply template"))
+	}
+	return &pluginpb.ApplyConfigTemplateResponse{}, nil
+}
+
+// CloneOrgRetentionConfig copies the source org's configuration for every plugin to the target org, and creates the
+// target org's preset scripts for each plugin the source org has enabled. The source org's other scripts are not
+// copied, since they may run on the source org's clusters.
+func (s *Server) CloneOrgRetentionConfig(ctx context.Context, req *pluginpb.CloneOrgRetentionConfigRequest) (*pluginpb.CloneOrgRetentionConfigResponse, error) {
+	if utils.IsNilUUIDProto(req.SourceOrgID) {
+		return nil, invalidFieldError("source_org_id", "Must specify source OrgID")
+	}
+	if utils.IsNilUUIDProto(req.TargetOrgID) {
+		return nil, invalidFieldError("target_org_id", "Must specify target OrgID")
+	}
+	sourceOrgID := utils.UUIDFromProtoOrNil(req.SourceOrgID)
+	targetOrgID := utils.UUIDFromProtoOrNil(req.TargetOrgID)
+	if sourceOrgID == targetOrgID {
+		return nil, invalidFieldError("target_org_id", "Target org must differ from the source org")
+	}
+	err := s.checkOrgConfigWriteRate(targetOrgID)
+	if err != nil {
+		return nil, err
+	}
+
+	release, err := s.acquireDecryption(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "failed to clone configs"))
+	}
+	defer tx.Rollback()
+
+	var targetPlugins int
+	query := `SELECT COUNT(*) FROM org_data_retention_plugins WHERE org_id=$1`
+	err = tx.QueryRowxContext(ctx, query, targetOrgID).Scan(&targetPlugins)
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "Failed to fetch plugins"))
+	}
+	if targetPlugins > 0 && !req.Overwrite {
+		return nil, status.Error(codes.AlreadyExists, "target org already has plugin configs")
+	}
+	query = `DELETE FROM org_data_retention_plugins WHERE org_id=$1`
+	_, err = tx.ExecContext(ctx, query, targetOrgID)
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "failed to clone configs"))
+	}
+
+	// The configs are re-encrypted rather than copied, so that the clone's ciphertexts are independent of the source's.
+	query = `INSERT INTO org_data_retention_plugins (org_id, plugin_id, version, configurations, typed_configurations, min_frequency_s, custom_export_url, enabled, plaintext_configurations)
+		SELECT $1, plugin_id, version, PGP_SYM_ENCRYPT(PGP_SYM_DECRYPT(configurations, $2::text), $2::text, $4::text), PGP_SYM_ENCRYPT(PGP_SYM_DECRYPT(typed_configurations, $2::text), $2::text, $4::text), min_frequency_s, custom_export_url, enabled, plaintext_configurations
+		FROM org_data_retention_plugins WHERE org_id=$3
+		RETURNING plugin_id, version, enabled, min_frequency_s`
+	var cloned []struct {
+		PluginID      string        `db:"plugin_id"`
+		Version       string        `db:"version"`
+		Enabled       bool          `db:"enabled"`
+		MinFrequencyS sql.NullInt64 `db:"min_frequency_s"`
+	}
+	err = tx.SelectContext(ctx, &cloned, query, targetOrgID, s.dbKey, sourceOrgID, s.pgpOptions)
+	if err != nil {
+		recordDecryptionFailure(unknownPluginID, err)
+		return nil, contextError(ctx, status.Error(codes.Internal, "failed to clone configs"))
+	}
+
+	resp := &pluginpb.CloneOrgRetentionConfigResponse{PluginIDs: []string{}}
+	for _, c := range cloned {
+		resp.PluginIDs = append(resp.PluginIDs, c.PluginID)
+		err = s.recordOrgConfigHistory(ctx, tx, targetOrgID, c.PluginID)
+		if err != nil {
+			return nil, contextError(ctx, status.Error(codes.Internal, "failed to clone configs"))
+		}
+		if !c.Enabled {
+			continue
+		}
+		err = s.createPresetScripts(ctx, tx, targetOrgID, c.PluginID, c.Version, c.MinFrequencyS.Int64)
+		if err != nil {
+			return nil, contextError(ctx, status.Error(codes.Internal, "failed to create preset scripts"))
+		}
+	}
+	sort.Strings(resp.PluginIDs)
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "failed to clone configs"))
+	}
+	return resp, nil
+}
+
+// DeleteOrgRetentionConfig permanently deletes an org's configs and retention scripts for a plugin, or for every plugin
+// and the org's retention settings if no plugin is specified, including the org's config history. The deletion is recorded in an audit table, which
+// only contains the number of rows deleted.
+func (s *Server) DeleteOrgRetentionConfig(ctx context.Context, req *pluginpb.DeleteOrgRetentionConfigRequest) (*pluginpb.DeleteOrgRetentionConfigResponse, error) {
+	if utils.IsNilUUIDProto(req.OrgID) {
+		return nil, invalidFieldError("org_id", "Must specify OrgID")
+	}
+	orgID := utils.UUIDFromProtoOrNil(req.OrgID)
+	err := s.checkOrgConfigWriteRate(orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "failed to delete configs"))
+	}
+	defer tx.Rollback()
+
+	// Deleting every plugin can't break a dependency, but deleting a single plugin can.
+	if req.PluginID != "" {
+		dependents, err := s.enabledDependents(ctx, tx, orgID, req.PluginID)
+		if err != nil {
+			return nil, contextError(ctx, status.Error(codes.Internal, "failed to delete configs"))
+		}
+		if len(dependents) > 0 {
+			return nil, status.Errorf(codes.FailedPrecondition, "Plugin is required by enabled plugins: %s", strings.Join(dependents, ", "))
+		}
+	}
+
+	// An empty plugin ID matches every plugin.
+	const pluginFilter = `org_id=$1 AND ($2 = '' OR plugin_id=$2)`
+	resp := &pluginpb.DeleteOrgRetentionConfigResponse{}
+	res, err := tx.ExecContext(ctx, `DELETE FROM plugin_retention_scripts WHERE `+pluginFilter, orgID, req.PluginID)
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "failed to delete scripts"))
+	}
+	resp.DeletedScripts, err = res.RowsAffected()
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to delete scripts")
+	}
+
+	res, err = tx.ExecContext(ctx, `DELETE FROM org_data_retention_plugins WHERE `+pluginFilter, orgID, req.PluginID)
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "failed to delete configs"))
+	}
+	resp.DeletedPluginConfigs, err = res.RowsAffected()
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to delete configs")
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM org_data_retention_plugin_config_history WHERE `+pluginFilter, orgID, req.PluginID)
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "failed to delete config history"))
+	}
+	if req.PluginID == "" {
+		_, err = tx.ExecContext(ctx, `DELETE FROM org_retention_settings WHERE org_id=$1`, orgID)
+		if err != nil {
+			return nil, contextError(ctx, status.Error(codes.Internal, "failed to delete settings"))
+		}
+	}
+
+	var pluginID *string
+	if req.PluginID != "" {
+		pluginID = &req.PluginID
+	}
+	query := `INSERT INTO org_retention_config_deletions (org_id, plugin_id, deleted_plugin_configs, deleted_scripts) VALUES ($1, $2, $3, $4)`
+	_, err = tx.ExecContext(ctx, query, orgID, pluginID, resp.DeletedPluginConfigs, resp.DeletedScripts)
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "failed to record deletion"))
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "failed to delete configs"))
+	}
+	return resp, nil
+}
+
+// OrgPluginVersion is a plugin version which an org has enabled.
+type OrgPluginVersion struct {
+	OrgID    uuid.UUID `db:"org_id"`
+	PluginID string    `db:"plugin_id"`
+	Version  string    `db:"version"`
+}
+
+// FindOrgsOnYankedVersions finds all orgs which have a yanked plugin version enabled.
+func (s *Server) FindOrgsOnYankedVersions(ctx context.Context) ([]*OrgPluginVersion, error) {
+	query := `SELECT o.org_id, o.plugin_id, o.version FROM org_data_retention_plugins AS o, plugin_releases AS r
+		WHERE r.id = o.plugin_id AND r.version = o.version AND r.yanked='true' AND o.enabled='true' ORDER BY o.plugin_id, o.org_id`
+
+	var orgs []*OrgPluginVersion
+	err := s.readDB.SelectContext(ctx, &orgs, query)
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "Failed to fetch orgs"))
+	}
+	return orgs, nil
+}
+
+// FindUnusedPlugins finds the latest release of each plugin in each namespace which no org has enabled, for any version
+// in the namespace.
+func (s *Server) FindUnusedPlugins(ctx context.Context) ([]*Plugin, error) {
+	query := `SELECT t1.name, t1.id, t1.description, t1.logo, t1.version, t1.data_retention_enabled, t1.namespace
+		FROM (SELECT DISTINCT ON (namespace, id) * FROM plugin_releases ORDER BY namespace, id, ` + semverOrder + `) t1
+		LEFT JOIN (SELECT DISTINCT r.namespace, o.plugin_id FROM org_data_retention_plugins AS o, plugin_releases AS r
+			WHERE r.id = o.plugin_id AND r.version = o.version AND o.enabled='true') AS u
+		ON u.plugin_id = t1.id AND u.namespace = t1.namespace
+		WHERE u.plugin_id IS NULL ORDER BY t1.id, t1.namespace`
+
+	var plugins []*Plugin
+	err := s.readDB.SelectContext(ctx, &plugins, query)
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "Failed to fetch plugins"))
+	}
+	return plugins, nil
+}
+
+// LogoFailure is a plugin release whose logo could not be rendered.
+type LogoFailure struct {
+	PluginID string
+	Version  string
+	Reason   string
+}
+
+// VerifyAllLogos checks that the logo of the latest release of every plugin in each namespace can be decoded and is
+// within the size limit, and reports the releases whose logos cannot.
+func (s *Server) VerifyAllLogos(ctx context.Context) ([]*LogoFailure, error) {
+	query := `SELECT DISTINCT ON (id, namespace) name, id, description, logo, version, data_retention_enabled FROM plugin_releases
+		ORDER BY id, namespace, ` + semverOrder
+
+	var plugins []*Plugin
+	err := s.readDB.SelectContext(ctx, &plugins, query)
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "Failed to fetch plugins"))
+	}
+
+	failures := []*LogoFailure{}
+	for _, p := range plugins {
+		if p.Logo == nil || *p.Logo == "" {
+			continue
+		}
+		err := decodeLogo(*p.Logo, s.maxLogoLength)
+		if err != nil {
+			failures = append(failures, &LogoFailure{
+				PluginID: p.ID,
+				Version:  p.Version,
+				Reason:   err.Error(),
+			})
+		}
+	}
+	return failures, nil
+}
+
+// EncryptionMismatch is an org's config for a plugin which cannot be decrypted with any of the configured keys.
+type EncryptionMismatch struct {
+	OrgID    uuid.UUID `db:"org_id"`
+	PluginID string    `db:"plugin_id"`
+}
+
+// AuditConfigEncryptionConsistency reports the org configs which cannot be decrypted with the current key, nor with
+// any of the previous keys. This detects configs written while the service was running with a different key.
+func (s *Server) AuditConfigEncryptionConsistency(ctx context.Context) ([]*EncryptionMismatch, error) {
+	// Every config is checked in a single query, rather than a query per config and key, since pgp_sym_decrypts doesn't
+	// abort the statement when a value can't be decrypted.
+	query := `SELECT org_id, plugin_id FROM org_data_retention_plugins AS o
+		WHERE NOT EXISTS(SELECT 1 FROM UNNEST($1::text[]) AS k WHERE o.configurations IS NULL OR pgp_sym_decrypts(o.configurations, k))
+		OR NOT EXISTS(SELECT 1 FROM UNNEST($1::text[]) AS k WHERE o.typed_configurations IS NULL OR pgp_sym_decrypts(o.typed_configurations, k))
+		ORDER BY org_id, plugin_id`
+
+	keys := append([]string{s.dbKey}, s.previousDBKeys...)
+	mismatches := []*EncryptionMismatch{}
+	err := s.readDB.SelectContext(ctx, &mismatches, query, pq.StringArray(keys))
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "Failed to decrypt configs"))
+	}
+	return mismatches, nil
+}
+
+// MaterializePresetScripts creates the org's retention scripts for each preset script in the plugin release which the
+// org doesn't already have a script for. It is safe to call repeatedly, for example to backfill the preset scripts of
+// orgs which enabled the plugin before the scripts were created on enable.
+func (s *Server) MaterializePresetScripts(ctx context.Context, orgID uuid.UUID, pluginID string, version string) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return contextError(ctx, status.Error(codes.Internal, "failed to create preset scripts"))
+	}
+	defer tx.Rollback()
+
+	var minFrequencyS sql.NullInt64
+	query := `SELECT min_frequency_s FROM org_data_retention_plugins WHERE org_id=$1 AND plugin_id=$2 AND enabled='true'`
+	err = tx.QueryRowxContext(ctx, query, orgID, pluginID).Scan(&minFrequencyS)
+	if err == sql.ErrNoRows {
+		return status.Error(codes.FailedPrecondition, "plugin is not enabled")
+	}
+	if err != nil {
+		return contextError(ctx, status.Error(codes.Internal, "Failed to fetch plugin"))
+	}
+
+	err = s.createPresetScripts(ctx, tx, orgID, pluginID, version, minFrequencyS.Int64)
+	if err != nil {
+		return contextError(ctx, status.Error(codes.Internal, "failed to create preset scripts"))
+	}
+	err = tx.Commit()
+	if err != nil {
+		return contextError(ctx, status.Error(codes.Internal, "failed to create preset scripts"))
+	}
+	return nil
+}
+
+// BumpOrgsOnYankedVersions moves all orgs which have a yanked plugin version enabled to the latest non-yanked stable
+// version of the plugin in the same namespace, and returns the versions they were moved to. Orgs are left on the yanked
+// version if the namespace has no non-yanked stable version of the plugin.
+func (s *Server) BumpOrgsOnYankedVersions(ctx context.Context) ([]*OrgPluginVersion, error) {
+	query := `UPDATE org_data_retention_plugins AS o SET version = l.version
+		FROM plugin_releases AS r, (SELECT DISTINCT ON (namespace, id) namespace, id, version FROM plugin_releases WHERE yanked='false' AND release_channel=$1 ORDER BY namespace, id, ` + semverOrder + `) AS l
+		WHERE r.id = o.plugin_id AND r.version = o.version AND r.yanked='true' AND l.id = o.plugin_id AND l.namespace = r.namespace AND o.enabled='true'
+		RETURNING o.org_id, o.plugin_id, o.version`
+
+	var orgs []*OrgPluginVersion
+	err := s.db.SelectContext(ctx, &orgs, query, releaseChannelStable)
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "Failed to update orgs"))
+	}
+	return orgs, nil
+}
+
+// GetRetentionScripts gets all retention scripts the org has configured.
+func (s *Server) GetRetentionScripts(ctx context.Context, req *pluginpb.GetRetentionScriptsRequest) (*pluginpb.GetRetentionScriptsResponse, error) {
+	if utils.IsNilUUIDProto(req.OrgID) {
+		return nil, status.Error(codes.InvalidArgument, "Must specify OrgID")
+	}
+
+	query := `SELECT org_id, script_id, script_name, description, frequency_s, cron_schedule, cluster_ids, plugin_id, plugin_version, enabled, is_preset, last_run_at, last_run_status, last_error, ` + pluginInMaintenance + ` AS paused_for_maintenance
+		FROM plugin_retention_scripts WHERE org_id=$1 ORDER BY script_name`
+	orgID := utils.UUIDFromProtoOrNil(req.OrgID)
+	rows, err := s.readDB.QueryxContext(ctx, query, orgID)
+	if err != nil {
+		return nil, contextError(ctx, status.Errorf(codes.Internal, "Failed to fetch scripts"))
+	}
+	defer rows.Close()
+
+	scripts := []*pluginpb.RetentionScript{}
+	for rows.Next() {
+		var script RetentionScript
+		err = rows.StructScan(&script)
+		if err != nil {
+			return nil, status.Error(codes.Internal, "failed to read scripts")
+		}
+		scripts = append(scripts, retentionScriptToProto(&script).Script)
+	}
+	return &pluginpb.GetRetentionScriptsResponse{Scripts: scripts}, nil
+}
+
+// StreamRetentionScripts streams all of the scripts an org is using for long-term data retention, in batches as they
+// are read from the database.
+func (s *Server) StreamRetentionScripts(req *pluginpb.StreamRetentionScriptsRequest, srv pluginpb.DataRetentionPluginService_StreamRetentionScriptsServer) error {
+	if utils.IsNilUUIDProto(req.OrgID) {
+		return status.Error(codes.InvalidArgument, "Must specify OrgID")
+	}
+	if req.BatchSize < 0 {
+		return status.Error(codes.InvalidArgument, "Batch size must not be negative")
+	}
+	batchSize := int(req.BatchSize)
+	if batchSize == 0 {
+		batchSize = defaultScriptStreamBatchSize
+	}
+
+	ctx := srv.Context()
+	query := `SELECT org_id, script_id, script_name, description, frequency_s, cron_schedule, cluster_ids, plugin_id, plugin_version, enabled, is_preset, last_run_at, last_run_status, last_error, ` + pluginInMaintenance + ` AS paused_for_maintenance
+		FROM plugin_retention_scripts WHERE org_id=$1 ORDER BY script_name`
+	orgID := utils.UUIDFromProtoOrNil(req.OrgID)
+	rows, err := s.readDB.QueryxContext(ctx, query, orgID)
+	if err != nil {
+		return contextError(ctx, status.Errorf(codes.Internal, "Failed to fetch scripts"))
+	}
+	defer rows.Close()
+
+	scripts := make([]*pluginpb.RetentionScript, 0, batchSize)
+	for rows.Next() {
+		var script RetentionScript
+		err = rows.StructScan(&script)
+		if err != nil {
+			return status.Error(codes.Internal, "failed to read scripts")
+		}
+		scripts = append(scripts, retentionScriptToProto(&script).Script)
+		if len(scripts) < batchSize {
+			continue
+		}
+		err = srv.Send(&pluginpb.StreamRetentionScriptsResponse{Scripts: scripts})
+		if err != nil {
+			return err
+		}
+		scripts = make([]*pluginpb.RetentionScript, 0, batchSize)
+	}
+	if err = rows.Err(); err != nil {
+		return contextError(ctx, status.Errorf(codes.Internal, "Failed to fetch scripts"))
+	}
+	if len(scripts) > 0 {
+		return srv.Send(&pluginpb.StreamRetentionScriptsResponse{Scripts: scripts})
+	}
+	return nil
+}
+
+// GetRetentionScript gets the details for a script an org is using for long-term data retention.
+func (s *Server) GetRetentionScript(ctx context.Context, req *pluginpb.GetRetentionScriptRequest) (*pluginpb.GetRetentionScriptResponse, error) {
+	if utils.IsNilUUIDProto(req.OrgID) {
+		return nil, status.Error(codes.InvalidArgument, "Must specify OrgID")
+	}
+	if utils.IsNilUUIDProto(req.ScriptID) {
+		return nil, status.Error(codes.InvalidArgument, "Must specify ScriptID")
+	}
+
+	query := `SELECT org_id, script_id, script_name, description, contents, override_body, frequency_s, cron_schedule, export_url, cluster_ids, plugin_id, plugin_version, enabled, is_preset, last_run_at, last_run_status, last_error, ` + pluginInMaintenance + ` AS paused_for_maintenance
+		FROM plugin_retention_scripts WHERE org_id=$1 AND script_id=$2`
+	orgID := utils.UUIDFromProtoOrNil(req.OrgID)
+	scriptID := utils.UUIDFromProtoOrNil(req.ScriptID)
+	rows, err := s.readDB.QueryxContext(ctx, query, orgID, scriptID)
+	if err != nil {
+		return nil, contextError(ctx, status.Errorf(codes.Internal, "Failed to fetch script"))
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, status.Error(codes.NotFound, "script not found")
+	}
+
+	var script RetentionScript
+	err = rows.StructScan(&script)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to read script")
+	}
+	return &pluginpb.GetRetentionScriptResponse{Script: retentionScriptToProto(&script)}, nil
+}
+
+// GetScriptOwner gets the org and plugin which own a retention script.
+func (s *Server) GetScriptOwner(ctx context.Context, req *pluginpb.GetScriptOwnerRequest) (*pluginpb.GetScriptOwnerResponse, error) {
+	if utils.IsNilUUIDProto(req.ScriptID) {
+		return nil, status.Error(codes.InvalidArgument, "Must specify ScriptID")
+	}
+
+	query := `SELECT org_id, plugin_id, plugin_version FROM plugin_retention_scripts WHERE script_id=$1`
+	scriptID := utils.UUIDFromProtoOrNil(req.ScriptID)
+
+	var owner struct {
+		OrgID         uuid.UUID `db:"org_id"`
+		PluginID      string    `db:"plugin_id"`
+		PluginVersion string    `db:"plugin_version"`
+	}
+	err := s.readDB.QueryRowxContext(ctx, query, scriptID).StructScan(&owner)
+	if err == sql.ErrNoRows {
+		return nil, status.Error(codes.NotFound, "script not found")
+	}
+	if err != nil {
+		return nil, contextError(ctx, status.Errorf(codes.Internal, "Failed to fetch script"))
+	}
+
+	return &pluginpb.GetScriptOwnerResponse{
+		OrgID:         utils.ProtoFromUUID(owner.OrgID),
+		PluginID:      owner.PluginID,
+		PluginVersion: owner.PluginVersion,
+	}, nil
+}
+
+// CreateRetentionScript creates a script that is used for long-term data retention.
 func (s *Server) CreateRetentionScript(ctx context.Context, req *pluginpb.CreateRetentionScriptRequest) (*pluginpb.CreateRetentionScriptResponse, error) {
-	return nil, errors.New("Not yet implemented")
+	if utils.IsNilUUIDProto(req.OrgID) {
+		return nil, status.Error(codes.InvalidArgument, "Must specify OrgID")
+	}
+	if req.Script == nil || req.Script.Script == nil {
+		return nil, status.Error(codes.InvalidArgument, "Must specify script")
+	}
+	rs := req.Script.Script
+	if rs.ScriptName == "" {
+		return nil, status.Error(codes.InvalidArgument, "Must specify script name")
+	}
+	if rs.PluginId == "" {
+		return nil, status.Error(codes.InvalidArgument, "Must specify plugin ID")
+	}
+	if rs.FrequencyS <= 0 || rs.FrequencyS > maxScriptFrequencyS {
+		return nil, status.Errorf(codes.InvalidArgument, "Frequency must be between 1 and %d seconds", maxScriptFrequencyS)
+	}
+
+	orgID := utils.UUIDFromProtoOrNil(req.OrgID)
+	err := s.checkOrgConfigWriteRate(orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "Failed to start transaction"))
+	}
+	defer tx.Rollback()
+
+	// Scripts are created against the version of the plugin the org is running.
+	var version string
+	var minFrequencyS *int64
+	query := `SELECT version, min_frequency_s FROM org_data_retention_plugins WHERE org_id=$1 AND plugin_id=$2 AND enabled='true'`
+	err = tx.QueryRowxContext(ctx, query, orgID, rs.PluginId).Scan(&version, &minFrequencyS)
+	if err == sql.ErrNoRows {
+		return nil, status.Error(codes.NotFound, "plugin is not enabled")
+	}
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "Failed to fetch plugin"))
+	}
+	if minFrequencyS != nil && rs.FrequencyS < *minFrequencyS {
+		return nil, status.Errorf(codes.InvalidArgument, "Frequency must be at least the org's minimum of %d seconds", *minFrequencyS)
+	}
+	if rs.CronSchedule != "" {
+		err = checkCronSchedule(rs.CronSchedule, minFrequencyS)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = s.checkExportURLAllowed(ctx, tx, rs.PluginId, version, req.Script.ExportURL)
+	if err != nil {
+		return nil, err
+	}
+
+	scriptID, err := uuid.NewV4()
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Failed to create script ID")
+	}
+	clusterIDs := make(pq.StringArray, len(rs.ClusterIDs))
+	for i, id := range rs.ClusterIDs {
+		clusterIDs[i] = utils.ProtoToUUIDStr(id)
+	}
+
+	query = `INSERT INTO plugin_retention_scripts (org_id, plugin_id, plugin_version, script_id, script_name, description, contents, frequency_s, export_url, cluster_ids, enabled, is_preset, cron_schedule)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''), $10::uuid[], $11, false, NULLIF($12, ''))`
+	_, err = tx.ExecContext(ctx, query, orgID, rs.PluginId, version, scriptID, rs.ScriptName, rs.Description, req.Script.Contents, rs.FrequencyS, req.Script.ExportURL, clusterIDs, rs.Enabled, rs.CronSchedule)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+			return nil, status.Error(codes.AlreadyExists, "script with name already exists")
+		}
+		return nil, contextError(ctx, status.Error(codes.Internal, "Failed to create script"))
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "Failed to create script"))
+	}
+
+	return &pluginpb.CreateRetentionScriptResponse{ID: utils.ProtoFromUUID(scriptID)}, nil
+}
+
+// UpdateRetentionScript updates a script used for long-term data retention.
+func (s *Server) UpdateRetentionScript(ctx context.Context, req *pluginpb.UpdateRetentionScriptRequest) (*pluginpb.UpdateRetentionScriptResponse, error) {
+	if utils.IsNilUUIDProto(req.OrgID) {
+		return nil, status.Error(codes.InvalidArgument, "Must specify OrgID")
+	}
+	if utils.IsNilUUIDProto(req.ScriptID) {
+		return nil, status.Error(codes.InvalidArgument, "Must specify ScriptID")
+	}
+	if req.ScriptName != nil && req.ScriptName.Value == "" {
+		return nil, status.Error(codes.InvalidArgument, "Script name must not be empty")
+	}
+	if req.FrequencyS != nil && (req.FrequencyS.Value <= 0 || req.FrequencyS.Value > maxScriptFrequencyS) {
+		return nil, status.Errorf(codes.InvalidArgument, "Frequency must be between 1 and %d seconds", maxScriptFrequencyS)
+	}
+
+	orgID := utils.UUIDFromProtoOrNil(req.OrgID)
+	scriptID := utils.UUIDFromProtoOrNil(req.ScriptID)
+	err := s.checkOrgConfigWriteRate(orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "Failed to start transaction"))
+	}
+	defer tx.Rollback()
+
+	var script RetentionScript
+	query := `SELECT plugin_id, plugin_version, is_preset FROM plugin_retention_scripts WHERE org_id=$1 AND script_id=$2 FOR UPDATE`
+	err = tx.QueryRowxContext(ctx, query, orgID, scriptID).StructScan(&script)
+	if err == sql.ErrNoRows {
+		return nil, status.Error(codes.NotFound, "script not found")
+	}
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "Failed to fetch script"))
+	}
+
+	if req.Contents != nil && script.IsPreset != nil && *script.IsPreset {
+		return nil, status.Error(codes.InvalidArgument, "Preset script contents cannot be updated, set an override instead")
+	}
+
+	if req.FrequencyS != nil || req.CronSchedule != nil {
+		var minFrequencyS *int64
+		query = `SELECT min_frequency_s FROM org_data_retention_plugins WHERE org_id=$1 AND plugin_id=$2 AND enabled='true'`
+		err = tx.QueryRowxContext(ctx, query, orgID, script.PluginID).Scan(&minFrequencyS)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, contextError(ctx, status.Error(codes.Internal, "Failed to fetch plugin"))
+		}
+		if req.FrequencyS != nil && minFrequencyS != nil && req.FrequencyS.Value < *minFrequencyS {
+			return nil, status.Errorf(codes.InvalidArgument, "Frequency must be at least the org's minimum of %d seconds", *minFrequencyS)
+		}
+		if req.CronSchedule != nil && req.CronSchedule.Value != "" {
+			err = checkCronSchedule(req.CronSchedule.Value, minFrequencyS)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if req.ExportUrl != nil {
+		err = s.checkExportURLAllowed(ctx, tx, script.PluginID, script.PluginVersion, req.ExportUrl.Value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var scriptName, description, contents, exportURL *string
+	var frequencyS *int64
+	var enabled *bool
+	var clusterIDs pq.StringArray
+	if req.ScriptName != nil {
+		scriptName = &req.ScriptName.Value
+	}
+	if req.Description != nil {
+		description = &req.Description.Value
+	}
+	if req.Contents != nil {
+		contents = &req.Contents.Value
+	}
+	if req.ExportUrl != nil {
+		exportURL = &req.ExportUrl.Value
+	}
+	if req.FrequencyS != nil {
+		frequencyS = &req.FrequencyS.Value
+	}
+	if req.Enabled != nil {
+		enabled = &req.Enabled.Value
+	}
+	if len(req.ClusterIDs) > 0 {
+		clusterIDs = make(pq.StringArray, len(req.ClusterIDs))
+		for i, id := range req.ClusterIDs {
+			clusterIDs[i] = utils.ProtoToUUIDStr(id)
+		}
+	}
+
+	// Fields which are not set in the request are left unchanged. An empty cron schedule clears the schedule.
+	query = `UPDATE plugin_retention_scripts SET script_name=COALESCE($1, script_name), description=COALESCE($2, description), contents=COALESCE($3, contents),
+		export_url=COALESCE($4, export_url), frequency_s=COALESCE($5, frequency_s), enabled=COALESCE($6, enabled), cluster_ids=COALESCE($7::uuid[], cluster_ids),
+		cron_schedule=CASE WHEN $10 THEN NULLIF($11, '') ELSE cron_schedule END
+		WHERE org_id=$8 AND script_id=$9`
+	_, err = tx.ExecContext(ctx, query, scriptName, description, contents, exportURL, frequencyS, enabled, clusterIDs, orgID, scriptID, req.CronSchedule != nil, req.CronSchedule.GetValue())
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+			return nil, status.Error(codes.AlreadyExists, "script with name already exists")
+		}
+		return nil, contextError(ctx, status.Error(codes.Internal, "Failed to update script"))
+	}
+	if req.FrequencyS != nil || req.CronSchedule != nil {
+		err = s.updateNextRunAt(ctx, tx, scriptID)
+		if err != nil {
+			return nil, contextError(ctx, status.Error(codes.Internal, "Failed to update script"))
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "Failed to commit transaction"))
+	}
+	return &pluginpb.UpdateRetentionScriptResponse{}, nil
+}
+
+// ValidateRetentionScript checks a retention script's contents for structural problems, so that they can be
+// reported before the script is saved. Nothing is persisted.
+func (s *Server) ValidateRetentionScript(ctx context.Context, req *pluginpb.ValidateRetentionScriptRequest) (*pluginpb.ValidateRetentionScriptResponse, error) {
+	resp := &pluginpb.ValidateRetentionScriptResponse{}
+	for _, p := range validateScriptContents(req.Contents) {
+		resp.Problems = append(resp.Problems, &pluginpb.ValidateRetentionScriptResponse_Problem{
+			Line:    int64(p.line),
+			Message: p.message,
+		})
+	}
+	return resp, nil
+}
+
+// SetRetentionScriptFrequency sets how often a retention script is run, clearing any cron schedule it has. The
+// script's next run is rescheduled from its last run, so that the new frequency takes effect immediately.
+func (s *Server) SetRetentionScriptFrequency(ctx context.Context, req *pluginpb.SetRetentionScriptFrequencyRequest) (*pluginpb.SetRetentionScriptFrequencyResponse, error) {
+	if utils.IsNilUUIDProto(req.OrgID) {
+		return nil, status.Error(codes.InvalidArgument, "Must specify OrgID")
+	}
+	if utils.IsNilUUIDProto(req.ScriptID) {
+		return nil, status.Error(codes.InvalidArgument, "Must specify ScriptID")
+	}
+	if req.FrequencyS <= 0 || req.FrequencyS > maxScriptFrequencyS {
+		return nil, status.Errorf(codes.InvalidArgument, "Frequency must be between 1 and %d seconds", maxScriptFrequencyS)
+	}
+
+	orgID := utils.UUIDFromProtoOrNil(req.OrgID)
+	err := s.checkOrgConfigWriteRate(orgID)
+	if err != nil {
+		return nil, err
+	}
+	scriptID := utils.UUIDFromProtoOrNil(req.ScriptID)
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "Failed to start transaction"))
+	}
+	defer tx.Rollback()
+
+	var pluginID string
+	query := `SELECT plugin_id FROM plugin_retention_scripts WHERE org_id=$1 AND script_id=$2 FOR UPDATE`
+	err = tx.QueryRowxContext(ctx, query, orgID, scriptID).Scan(&pluginID)
+	if err == sql.ErrNoRows {
+		return nil, status.Error(codes.NotFound, "script not found")
+	}
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "Failed to fetch script"))
+	}
+
+	var minFrequencyS *int64
+	query = `SELECT min_frequency_s FROM org_data_retention_plugins WHERE org_id=$1 AND plugin_id=$2 AND enabled='true'`
+	err = tx.QueryRowxContext(ctx, query, orgID, pluginID).Scan(&minFrequencyS)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, contextError(ctx, status.Error(codes.Internal, "Failed to fetch plugin"))
+	}
+	if minFrequencyS != nil && req.FrequencyS < *minFrequencyS {
+		return nil, status.Errorf(codes.InvalidArgument, "Frequency must be at least the org's minimum of %d seconds", *minFrequencyS)
+	}
+
+	query = `UPDATE plugin_retention_scripts SET frequency_s=$1, cron_schedule=NULL WHERE org_id=$2 AND script_id=$3`
+	_, err = tx.ExecContext(ctx, query, req.FrequencyS, orgID, scriptID)
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "Failed to update script"))
+	}
+	err = s.updateNextRunAt(ctx, tx, scriptID)
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "Failed to update script"))
+	}
+
+	var nextRunAt *time.Time
+	query = `SELECT next_run_at FROM plugin_retention_scripts WHERE script_id=$1`
+	err = tx.QueryRowxContext(ctx, query, scriptID).Scan(&nextRunAt)
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "Failed to fetch script"))
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "Failed to commit transaction"))
+	}
+
+	resp := &pluginpb.SetRetentionScriptFrequencyResponse{}
+	if nextRunAt != nil {
+		resp.NextRunAt, _ = types.TimestampProto(*nextRunAt)
+	}
+	return resp, nil
 }
 
-// UpdateRetentionScript updates a script used for long-term data retention.
-func (s *Server) UpdateRetentionScript(ctx context.Context, req *pluginpb.UpdateRetentionScriptRequest) (*pluginpb.UpdateRetentionScriptResponse, error) {
-	return nil, errors.New("Not yet implemented")
+// SetPresetScriptOverride sets or clears an org's override of the contents of a preset script. Only scripts derived
+// from a plugin's preset scripts may be overridden.
+func (s *Server) SetPresetScriptOverride(ctx context.Context, req *pluginpb.SetPresetScriptOverrideRequest) (*pluginpb.SetPresetScriptOverrideResponse, error) {
+	if utils.IsNilUUIDProto(req.OrgID) {
+		return nil, status.Error(codes.InvalidArgument, "Must specify OrgID")
+	}
+	if utils.IsNilUUIDProto(req.ScriptID) {
+		return nil, status.Error(codes.InvalidArgument, "Must specify ScriptID")
+	}
+
+	orgID := utils.UUIDFromProtoOrNil(req.OrgID)
+	scriptID := utils.UUIDFromProtoOrNil(req.ScriptID)
+	err := s.checkOrgConfigWriteRate(orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	var overrideBody *string
+	if req.OverrideBody != nil {
+		overrideBody = &req.OverrideBody.Value
+	}
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "Failed to start transaction"))
+	}
+	defer tx.Rollback()
+
+	var isPreset *bool
+	query := `SELECT is_preset FROM plugin_retention_scripts WHERE org_id=$1 AND script_id=$2 FOR UPDATE`
+	err = tx.QueryRowxContext(ctx, query, orgID, scriptID).Scan(&isPreset)
+	if err == sql.ErrNoRows {
+		return nil, status.Error(codes.NotFound, "script not found")
+	}
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "Failed to fetch script"))
+	}
+	if isPreset == nil || !*isPreset {
+		return nil, status.Error(codes.InvalidArgument, "Only preset scripts may be overridden")
+	}
+
+	query = `UPDATE plugin_retention_scripts SET override_body=$1 WHERE org_id=$2 AND script_id=$3`
+	_, err = tx.ExecContext(ctx, query, overrideBody, orgID, scriptID)
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "Failed to update script"))
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "Failed to commit transaction"))
+	}
+	return &pluginpb.SetPresetScriptOverrideResponse{}, nil
+}
+
+// RetentionScript contains metadata about a retention script configured by an org.
+type RetentionScript struct {
+	OrgID         uuid.UUID      `db:"org_id"`
+	ScriptID      uuid.UUID      `db:"script_id"`
+	ScriptName    string         `db:"script_name"`
+	Description   *string        `db:"description"`
+	Contents      *string        `db:"contents"`
+	OverrideBody  *string        `db:"override_body"`
+	FrequencyS    *int64         `db:"frequency_s"`
+	CronSchedule  *string        `db:"cron_schedule"`
+	ExportURL     *string        `db:"export_url"`
+	ClusterIDs    pq.StringArray `db:"cluster_ids"`
+	PluginID      string         `db:"plugin_id"`
+	PluginVersion string         `db:"plugin_version"`
+	Enabled       *bool          `db:"enabled"`
+	IsPreset      *bool          `db:"is_preset"`
+	LastRunAt     *time.Time     `db:"last_run_at"`
+	NextRunAt     *time.Time     `db:"next_run_at"`
+	LastRunStatus *string        `db:"last_run_status"`
+	LastError     *string        `db:"last_error"`
+	// PausedForMaintenance is whether the script's plugin is in maintenance mode.
+	PausedForMaintenance bool `db:"paused_for_maintenance"`
+}
+
+// pluginInMaintenance is a column expression for whether a retention script's plugin is in maintenance mode.
+const pluginInMaintenance = `EXISTS(SELECT 1 FROM plugin_releases AS r WHERE r.id = plugin_retention_scripts.plugin_id AND r.maintenance='true')`
+
+func retentionScriptToProto(script *RetentionScript) *pluginpb.DetailedRetentionScript {
+	clusterIDs := make([]*uuidpb.UUID, len(script.ClusterIDs))
+	for i, id := range script.ClusterIDs {
+		clusterIDs[i] = utils.ProtoFromUUIDStrOrNil(id)
+	}
+
+	spb := &pluginpb.DetailedRetentionScript{
+		Script: &pluginpb.RetentionScript{
+			ScriptID:   utils.ProtoFromUUID(script.ScriptID),
+			ScriptName: script.ScriptName,
+			ClusterIDs: clusterIDs,
+			PluginId:   script.PluginID,
+		},
+	}
+	if script.Description != nil {
+		spb.Script.Description = *script.Description
+	}
+	if script.FrequencyS != nil {
+		spb.Script.FrequencyS = *script.FrequencyS
+	}
+	if script.CronSchedule != nil {
+		spb.Script.CronSchedule = *script.CronSchedule
+	}
+	if script.Enabled != nil {
+		spb.Script.Enabled = *script.Enabled
+	}
+	if script.IsPreset != nil {
+		spb.Script.IsPreset = *script.IsPreset
+	}
+	spb.Script.PausedForMaintenance = script.PausedForMaintenance
+	if script.OverrideBody != nil {
+		spb.Contents = *script.OverrideBody
+		spb.IsOverridden = true
+	} else if script.Contents != nil {
+		spb.Contents = *script.Contents
+	}
+	if script.ExportURL != nil {
+		spb.ExportURL = *script.ExportURL
+	}
+	if script.LastRunAt != nil {
+		spb.Script.LastRunAt, _ = types.TimestampProto(*script.LastRunAt)
+	}
+	if script.LastRunStatus != nil {
+		spb.Script.LastRunStatus = pluginpb.RetentionScriptRunStatus(pluginpb.RetentionScriptRunStatus_value[*script.LastRunStatus])
+	}
+	if script.LastError != nil {
+		spb.Script.LastError = *script.LastError
+	}
+	return spb
+}
+
+// retentionScriptManifestEntry is the metadata about a script written to the manifest of an exported archive.
+type retentionScriptManifestEntry struct {
+	FileName      string   `json:"file_name"`
+	ScriptID      string   `json:"script_id"`
+	ScriptName    string   `json:"script_name"`
+	Description   string   `json:"description"`
+	FrequencyS    int64    `json:"frequency_s"`
+	CronSchedule  string   `json:"cron_schedule,omitempty"`
+	ExportURL     string   `json:"export_url"`
+	ClusterIDs    []string `json:"cluster_ids"`
+	PluginID      string   `json:"plugin_id"`
+	PluginVersion string   `json:"plugin_version"`
+	Enabled       bool     `json:"enabled"`
+	IsPreset      bool     `json:"is_preset"`
+}
+
+// ExportRetentionScriptsArchive exports all retention scripts the org has configured as a ZIP archive.
+func (s *Server) ExportRetentionScriptsArchive(ctx context.Context, req *pluginpb.ExportRetentionScriptsArchiveRequest) (*pluginpb.ExportRetentionScriptsArchiveResponse, error) {
+	if utils.IsNilUUIDProto(req.OrgID) {
+		return nil, status.Error(codes.InvalidArgument, "Must specify OrgID")
+	}
+
+	query := `SELECT org_id, script_id, script_name, description, contents, override_body, frequency_s, cron_schedule, export_url, cluster_ids, plugin_id, plugin_version, enabled, is_preset FROM plugin_retention_scripts WHERE org_id=$1 ORDER BY script_name`
+	orgID := utils.UUIDFromProtoOrNil(req.OrgID)
+	rows, err := s.readDB.QueryxContext(ctx, query, orgID)
+	if err != nil {
+		return nil, contextError(ctx, status.Errorf(codes.Internal, "Failed to fetch scripts"))
+	}
+	defer rows.Close()
+
+	var buf bytes.Buffer
+	zf := zip.NewWriter(&buf)
+
+	usedNames := make(map[string]bool)
+	manifest := []*retentionScriptManifestEntry{}
+	for rows.Next() {
+		var script RetentionScript
+		err = rows.StructScan(&script)
+		if err != nil {
+			return nil, status.Error(codes.Internal, "failed to read scripts")
+		}
+
+		fileName := uniqueFileName(sanitizeFileName(script.ScriptName), ".pxl", usedNames)
+		w, err := zf.Create(fileName)
+		if err != nil {
+			return nil, status.Error(codes.Internal, "failed to write archive")
+		}
+		contents := script.Contents
+		if script.OverrideBody != nil {
+			contents = script.OverrideBody
+		}
+		if contents != nil {
+			_, err = w.Write([]byte(*contents))
+			if err != nil {
+				return nil, status.Error(codes.Internal, "failed to write archive")
+			}
+		}
+
+		entry := &retentionScriptManifestEntry{
+			FileName:      fileName,
+			ScriptID:      script.ScriptID.String(),
+			ScriptName:    script.ScriptName,
+			ClusterIDs:    []string(script.ClusterIDs),
+			PluginID:      script.PluginID,
+			PluginVersion: script.PluginVersion,
+		}
+		if entry.ClusterIDs == nil {
+			entry.ClusterIDs = []string{}
+		}
+		if script.Description != nil {
+			entry.Description = *script.Description
+		}
+		if script.FrequencyS != nil {
+			entry.FrequencyS = *script.FrequencyS
+		}
+		if script.CronSchedule != nil {
+			entry.CronSchedule = *script.CronSchedule
+		}
+		if script.ExportURL != nil {
+			entry.ExportURL = *script.ExportURL
+		}
+		if script.Enabled != nil {
+			entry.Enabled = *script.Enabled
+		}
+		if script.IsPreset != nil {
+			entry.IsPreset = *script.IsPreset
+		}
+		manifest = append(manifest, entry)
+	}
+
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to write manifest")
+	}
+	w, err := zf.Create("manifest.json")
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to write archive")
+	}
+	_, err = w.Write(manifestJSON)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to write archive")
+	}
+
+	err = zf.Close()
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to write archive")
+	}
+
+	return &pluginpb.ExportRetentionScriptsArchiveResponse{
+		Archive: buf.Bytes(),
+	}, nil
+}
+
+// GetRetentionScriptsDue gets all enabled retention scripts, across all orgs, whose next run is before the given time.
+func (s *Server) GetRetentionScriptsDue(ctx context.Context, req *pluginpb.GetRetentionScriptsDueRequest) (*pluginpb.GetRetentionScriptsDueResponse, error) {
+	if req.BeforeTimestamp == nil {
+		return nil, status.Error(codes.InvalidArgument, "Must specify timestamp")
+	}
+	before, err := types.TimestampFromProto(req.BeforeTimestamp)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "Invalid timestamp")
+	}
+	if req.PageSize < 0 {
+		return nil, status.Error(codes.InvalidArgument, "Page size must not be negative")
+	}
+	var pageToken *dueScriptPageToken
+	if req.PageToken != "" {
+		pageToken, err = decodeDueScriptPageToken(req.PageToken)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "Invalid page token")
+		}
+	}
+
+	// This reads from the primary, since a lagging replica may return scripts which have already been run.
+	// Scripts which have never been run have no next_run_at, and are always due. Scripts whose plugin is in maintenance
+	// mode are paused, and are never due.
+	query := `SELECT org_id, script_id, script_name, description, contents, override_body, frequency_s, cron_schedule, export_url, cluster_ids, plugin_id, plugin_version, enabled, is_preset, last_run_at, next_run_at, last_run_status, last_error FROM plugin_retention_scripts
+		WHERE enabled='true' AND (next_run_at IS NULL OR next_run_at < $1) AND NOT ` + pluginInMaintenance
+	args := []interface{}{before.UTC()}
+	// Paginate with a (next_run_at, script_id) cursor rather than an offset, so that scripts which are run between page
+	// fetches do not cause other scripts to be skipped. Scripts which have never been run sort first.
+	if pageToken != nil && pageToken.NextRunAt == nil {
+		query = fmt.Sprintf("%s AND (next_run_at IS NOT NULL OR script_id > $%d)", query, len(args)+1)
+		args = append(args, pageToken.ScriptID)
+	} else if pageToken != nil {
+		query = fmt.Sprintf("%s AND next_run_at IS NOT NULL AND (next_run_at, script_id) > ($%d, $%d)", query, len(args)+1, len(args)+2)
+		args = append(args, pageToken.NextRunAt.UTC(), pageToken.ScriptID)
+	}
+	query = fmt.Sprintf("%s %s", query, "ORDER BY next_run_at NULLS FIRST, script_id")
+	if req.PageSize > 0 {
+		// Fetch an extra script to determine whether there is a next page.
+		query = fmt.Sprintf("%s LIMIT $%d", query, len(args)+1)
+		args = append(args, req.PageSize+1)
+	}
+
+	rows, err := s.db.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return nil, contextError(ctx, status.Errorf(codes.Internal, "Failed to fetch scripts"))
+	}
+	defer rows.Close()
+
+	scripts := []*pluginpb.GetRetentionScriptsDueResponse_DueScript{}
+	var nextRunAts []*time.Time
+	for rows.Next() {
+		var script RetentionScript
+		err = rows.StructScan(&script)
+		if err != nil {
+			return nil, status.Error(codes.Internal, "failed to read scripts")
+		}
+
+		dpb := &pluginpb.GetRetentionScriptsDueResponse_DueScript{
+			OrgID:  utils.ProtoFromUUID(script.OrgID),
+			Script: retentionScriptToProto(&script),
+		}
+		if script.LastRunAt != nil {
+			dpb.LastRunAt, _ = types.TimestampProto(*script.LastRunAt)
+		}
+		if script.NextRunAt != nil {
+			dpb.NextRunAt, _ = types.TimestampProto(*script.NextRunAt)
+		}
+		scripts = append(scripts, dpb)
+		nextRunAts = append(nextRunAts, script.NextRunAt)
+	}
+
+	resp := &pluginpb.GetRetentionScriptsDueResponse{Scripts: scripts}
+	if req.PageSize > 0 && len(scripts) > int(req.PageSize) {
+		resp.Scripts = scripts[:req.PageSize]
+		last := resp.Scripts[len(resp.Scripts)-1]
+		resp.NextPageToken = encodeDueScriptPageToken(nextRunAts[req.PageSize-1], utils.ProtoToUUIDStr(last.Script.Script.ScriptID))
+	}
+	return resp, nil
+}
+
+// GetActiveRetentionWorkload gets every org plugin with active retention scripts, along with the org's decrypted
+// configs for the plugin. Scripts are active if they are enabled and their plugin is not in maintenance mode. The
+// scripts' contents are rendered with the org's configs, so that they can be run as they are. Callers which can't read
+// decrypted configs get redacted configs, and scripts which reference configs are reported as unrenderable for them,
+// since their rendered contents would contain the configs.
+func (s *Server) GetActiveRetentionWorkload(ctx context.Context, req *pluginpb.GetActiveRetentionWorkloadRequest) (*pluginpb.GetActiveRetentionWorkloadResponse, error) {
+	// The configs and scripts are read in a single snapshot, so that they are consistent with each other.
+	tx, err := s.readDB.BeginTxx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "Failed to fetch workload"))
+	}
+	defer tx.Rollback()
+
+	activeScripts := `plugin_retention_scripts.enabled='true' AND NOT ` + pluginInMaintenance
+
+	release, err := s.acquireDecryption(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	// The configs of all orgs are decrypted in a single query.
+	query := `SELECT o.org_id, o.plugin_id, o.version, merge_configurations(PGP_SYM_DECRYPT(o.configurations, $1::text), o.plaintext_configurations), PGP_SYM_DECRYPT(o.typed_configurations, $1::text)
+		FROM org_data_retention_plugins AS o
+		WHERE o.enabled='true' AND EXISTS(SELECT 1 FROM plugin_retention_scripts WHERE plugin_retention_scripts.org_id = o.org_id AND plugin_retention_scripts.plugin_id = o.plugin_id AND ` + activeScripts + `)
+		ORDER BY o.org_id, o.plugin_id`
+	rows, err := tx.QueryxContext(ctx, query, s.dbKey)
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "Failed to fetch configs"))
+	}
+	defer rows.Close()
+
+	redact := !s.canReadDecryptedConfigs(ctx)
+	resp := &pluginpb.GetActiveRetentionWorkloadResponse{}
+	workloads := make(map[string]*pluginpb.GetActiveRetentionWorkloadResponse_OrgPluginWorkload)
+	orgConfigs := make(map[string]map[string]string)
+	for rows.Next() {
+		var orgID uuid.UUID
+		var pluginID, version string
+		var configurationJSON, typedConfigurationJSON []byte
+		err := rows.Scan(&orgID, &pluginID, &version, &configurationJSON, &typedConfigurationJSON)
+		if err != nil {
+			return nil, status.Error(codes.Internal, "failed to read configs")
+		}
+
+		var configMap map[string]string
+		if configurationJSON != nil {
+			err = json.Unmarshal(configurationJSON, &configMap)
+			if err != nil {
+				configDecryptionFailures.WithLabelValues(pluginID).Inc()
+				return nil, status.Error(codes.Internal, "failed to read configs")
+			}
+		}
+		typedConfigs, err := typedConfigsFromJSON(typedConfigurationJSON)
+		if err != nil {
+			configDecryptionFailures.WithLabelValues(pluginID).Inc()
+			return nil, status.Error(codes.Internal, "failed to read configs")
+		}
+		// Scripts are rendered with the decrypted configs, which are kept separately from the returned configs.
+		orgConfigs[orgID.String()+"/"+pluginID] = configMap
+		if redact {
+			configMap = redactConfigs(configMap)
+			typedConfigs = redactTypedConfigs(typedConfigs)
+		}
+
+		w := &pluginpb.GetActiveRetentionWorkloadResponse_OrgPluginWorkload{
+			OrgID:               utils.ProtoFromUUID(orgID),
+			PluginID:            pluginID,
+			Version:             version,
+			Configurations:      configMap,
+			TypedConfigurations: typedConfigs,
+		}
+		workloads[orgID.String()+"/"+pluginID] = w
+		resp.Workloads = append(resp.Workloads, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "Failed to fetch configs"))
+	}
+
+	query = `SELECT org_id, script_id, script_name, description, contents, override_body, frequency_s, cron_schedule, export_url, cluster_ids, plugin_id, plugin_version, enabled, is_preset, last_run_at, last_run_status, last_error
+		FROM plugin_retention_scripts WHERE ` + activeScripts + ` ORDER BY script_name`
+	scriptRows, err := tx.QueryxContext(ctx, query)
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "Failed to fetch scripts"))
+	}
+	defer scriptRows.Close()
+
+	for scriptRows.Next() {
+		var script RetentionScript
+		err = scriptRows.StructScan(&script)
+		if err != nil {
+			return nil, status.Error(codes.Internal, "failed to read scripts")
+		}
+		// Scripts for plugins which the org no longer has enabled are not part of the workload.
+		key := script.OrgID.String() + "/" + script.PluginID
+		w, ok := workloads[key]
+		if !ok {
+			continue
+		}
+		spb := retentionScriptToProto(&script)
+		// Scripts which reference configs the org has not set are left out, rather than run with empty values.
+		rendered, err := renderScriptContents(spb.Contents, orgConfigs[key])
+		if err == nil && redact && rendered != spb.Contents {
+			err = errors.New("script references configs which the caller cannot read")
+		}
+		spb.Contents = rendered
+		if err != nil {
+			w.UnrenderableScripts = append(w.UnrenderableScripts, &pluginpb.GetActiveRetentionWorkloadResponse_UnrenderableScript{
+				ScriptID:   spb.Script.ScriptID,
+				ScriptName: spb.Script.ScriptName,
+				Error:      err.Error(),
+			})
+			continue
+		}
+		w.Scripts = append(w.Scripts, spb)
+	}
+	if err := scriptRows.Err(); err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "Failed to fetch scripts"))
+	}
+	return resp, nil
+}
+
+// RecordScriptRun records the result of a run of a retention script.
+func (s *Server) RecordScriptRun(ctx context.Context, req *pluginpb.RecordScriptRunRequest) (*pluginpb.RecordScriptRunResponse, error) {
+	if utils.IsNilUUIDProto(req.ScriptID) {
+		return nil, status.Error(codes.InvalidArgument, "Must specify ScriptID")
+	}
+	if req.Status == pluginpb.RUN_STATUS_UNKNOWN {
+		return nil, status.Error(codes.InvalidArgument, "Must specify run status")
+	}
+
+	runAt := time.Now()
+	if req.RunAt != nil {
+		t, err := types.TimestampFromProto(req.RunAt)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "Invalid timestamp")
+		}
+		runAt = t
+	}
+
+	if req.DurationMs < 0 {
+		return nil, status.Error(codes.InvalidArgument, "Duration must not be negative")
+	}
+
+	var lastError *string
+	if req.Error != "" {
+		lastError = &req.Error
+	}
+	var durationMs *int64
+	if req.DurationMs > 0 {
+		durationMs = &req.DurationMs
+	}
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "failed to record script run"))
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE plugin_retention_scripts SET last_run_at = $1, last_run_status = $2, last_error = $3 WHERE script_id = $4`
+	scriptID := utils.UUIDFromProtoOrNil(req.ScriptID)
+	res, err := tx.ExecContext(ctx, query, runAt.UTC(), req.Status.String(), lastError, scriptID)
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "failed to record script run"))
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, status.Error(codes.NotFound, "script not found")
+	}
+	err = s.updateNextRunAt(ctx, tx, scriptID)
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "failed to record script run"))
+	}
+
+	query = `INSERT INTO retention_script_runs (script_id, run_at, status, duration_ms, error) VALUES ($1, $2, $3, $4, $5)`
+	_, err = tx.ExecContext(ctx, query, scriptID, runAt.UTC(), req.Status.String(), durationMs, lastError)
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "failed to record script run"))
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "failed to record script run"))
+	}
+	return &pluginpb.RecordScriptRunResponse{}, nil
+}
+
+// GetRetentionScriptRunHistory gets the most recent runs of a retention script, most recent first.
+func (s *Server) GetRetentionScriptRunHistory(ctx context.Context, req *pluginpb.GetRetentionScriptRunHistoryRequest) (*pluginpb.GetRetentionScriptRunHistoryResponse, error) {
+	if utils.IsNilUUIDProto(req.OrgID) {
+		return nil, status.Error(codes.InvalidArgument, "Must specify OrgID")
+	}
+	if utils.IsNilUUIDProto(req.ScriptID) {
+		return nil, status.Error(codes.InvalidArgument, "Must specify ScriptID")
+	}
+	if req.Limit < 0 || req.Limit > maxScriptRunHistoryLimit {
+		return nil, status.Errorf(codes.InvalidArgument, "Limit must be between 0 and %d", maxScriptRunHistoryLimit)
+	}
+	limit := req.Limit
+	if limit == 0 {
+		limit = defaultScriptRunHistoryLimit
+	}
+	orgID := utils.UUIDFromProtoOrNil(req.OrgID)
+	scriptID := utils.UUIDFromProtoOrNil(req.ScriptID)
+
+	// Scripts are scoped to the org, so another org's script is reported as not found.
+	var exists bool
+	query := `SELECT EXISTS(SELECT 1 FROM plugin_retention_scripts WHERE org_id=$1 AND script_id=$2)`
+	err := s.readDB.QueryRowxContext(ctx, query, orgID, scriptID).Scan(&exists)
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "Failed to fetch script"))
+	}
+	if !exists {
+		return nil, status.Error(codes.NotFound, "script not found")
+	}
+
+	query = `SELECT run_at, status, duration_ms, error FROM retention_script_runs WHERE script_id=$1 ORDER BY run_at DESC LIMIT $2`
+	rows, err := s.readDB.QueryxContext(ctx, query, scriptID, limit)
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "Failed to fetch script runs"))
+	}
+	defer rows.Close()
+
+	resp := &pluginpb.GetRetentionScriptRunHistoryResponse{Runs: []*pluginpb.GetRetentionScriptRunHistoryResponse_ScriptRun{}}
+	for rows.Next() {
+		var runAt time.Time
+		var runStatus string
+		var durationMs *int64
+		var runError *string
+		err = rows.Scan(&runAt, &runStatus, &durationMs, &runError)
+		if err != nil {
+			return nil, status.Error(codes.Internal, "Failed to read script runs")
+		}
+		run := &pluginpb.GetRetentionScriptRunHistoryResponse_ScriptRun{
+			Status: pluginpb.RetentionScriptRunStatus(pluginpb.RetentionScriptRunStatus_value[runStatus]),
+		}
+		run.RunAt, _ = types.TimestampProto(runAt)
+		if durationMs != nil {
+			run.DurationMs = *durationMs
+		}
+		if runError != nil {
+			run.Error = *runError
+		}
+		resp.Runs = append(resp.Runs, run)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "Failed to fetch script runs"))
+	}
+	return resp, nil
+}
+
+// updateNextRunAt sets when the script should next be run, from when it was last run and its schedule.
+func (s *Server) updateNextRunAt(ctx context.Context, tx *sqlx.Tx, scriptID uuid.UUID) error {
+	var lastRunAt *time.Time
+	var frequencyS *int64
+	var cronSchedule *string
+	query := `SELECT last_run_at, frequency_s, cron_schedule FROM plugin_retention_scripts WHERE script_id=$1`
+	err := tx.QueryRowxContext(ctx, query, scriptID).Scan(&lastRunAt, &frequencyS, &cronSchedule)
+	if err != nil {
+		return err
+	}
+	next, err := nextRunAt(lastRunAt, frequencyS, cronSchedule)
+	if err != nil {
+		return err
+	}
+	if next != nil {
+		utc := next.UTC()
+		next = &utc
+	}
+	query = `UPDATE plugin_retention_scripts SET next_run_at=$1 WHERE script_id=$2`
+	_, err = tx.ExecContext(ctx, query, next, scriptID)
+	return err
+}
+
+// checkCronSchedule checks that a script's cron schedule is valid, and does not run the script more often than the
+// org's minimum frequency, if any.
+func checkCronSchedule(expr string, minFrequencyS *int64) error {
+	schedule, err := parseCronSchedule(expr)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "Invalid cron schedule: %s", err.Error())
+	}
+	if minFrequencyS != nil && minCronIntervalS(schedule, time.Now()) < *minFrequencyS {
+		return status.Errorf(codes.InvalidArgument, "Cron schedule must not run more often than the org's minimum frequency of %d seconds", *minFrequencyS)
+	}
+	return nil
+}
+
+// ScriptCounts contains the number of retention scripts an org has configured for a plugin version.
+type ScriptCounts struct {
+	PluginID string `db:"plugin_id"`
+	Version  string `db:"plugin_version"`
+	Total    int64  `db:"total"`
+	Enabled  int64  `db:"enabled"`
+	Paused   int64  `db:"paused"`
+}
+
+// GetOrgScriptCountsByPlugin gets the number of total, enabled and paused retention scripts the org has configured for
+// each plugin version.
+func (s *Server) GetOrgScriptCountsByPlugin(ctx context.Context, req *pluginpb.GetOrgScriptCountsByPluginRequest) (*pluginpb.GetOrgScriptCountsByPluginResponse, error) {
+	if utils.IsNilUUIDProto(req.OrgID) {
+		return nil, status.Error(codes.InvalidArgument, "Must specify OrgID")
+	}
+
+	query := `SELECT plugin_id, plugin_version, COUNT(*) AS total,
+		COUNT(*) FILTER (WHERE enabled) AS enabled, COUNT(*) FILTER (WHERE enabled IS NOT TRUE) AS paused
+		FROM plugin_retention_scripts WHERE org_id=$1 GROUP BY plugin_id, plugin_version ORDER BY plugin_id, plugin_version`
+	orgID := utils.UUIDFromProtoOrNil(req.OrgID)
+
+	var counts []*ScriptCounts
+	err := s.readDB.SelectContext(ctx, &counts, query, orgID)
+	if err != nil {
+		return nil, contextError(ctx, status.Error(codes.Internal, "Failed to fetch script counts"))
+	}
+
+	resp := &pluginpb.GetOrgScriptCountsByPluginResponse{
+		Counts: []*pluginpb.GetOrgScriptCountsByPluginResponse_ScriptCounts{},
+	}
+	for _, c := range counts {
+		resp.Counts = append(resp.Counts, &pluginpb.GetOrgScriptCountsByPluginResponse_ScriptCounts{
+			PluginID: c.PluginID,
+			Version:  c.Version,
+			Total:    c.Total,
+			Enabled:  c.Enabled,
+			Paused:   c.Paused,
+		})
+	}
+	return resp, nil
 }
@@ -0,0 +1,89 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+
+	"px.dev/pixie/src/cloud/plugin/controllers"
+	"px.dev/pixie/src/cloud/plugin/pluginpb"
+	"px.dev/pixie/src/utils"
+)
+
+const benchmarkOrgCount = 1000
+
+// mustLoadBenchmarkData loads the test data along with benchmarkOrgCount orgs which each have an encrypted
+// config and an enabled retention script for test-plugin.
+func mustLoadBenchmarkData(db *sqlx.DB) {
+	mustLoadTestData(db)
+	db.MustExec(`INSERT INTO org_data_retention_plugins(org_id, plugin_id, version, configurations)
+		SELECT ('00000000-0000-0000-0000-' || LPAD(i::text, 12, '0'))::uuid, 'test-plugin', '0.0.3',
+			PGP_SYM_ENCRYPT('{"license_key3": "' || i || '"}', 'test')
+		FROM generate_series(1, $1) AS i`, benchmarkOrgCount)
+	db.MustExec(`INSERT INTO plugin_retention_scripts(org_id, plugin_id, plugin_version, script_id, script_name, contents, frequency_s, enabled, is_preset)
+		SELECT ('00000000-0000-0000-0000-' || LPAD(i::text, 12, '0'))::uuid, 'test-plugin', '0.0.3', MD5(i::text)::uuid,
+			'benchmark script', 'px.display()', 60, true, false
+		FROM generate_series(1, $1) AS i`, benchmarkOrgCount)
+}
+
+func BenchmarkServer_GetActiveRetentionWorkload(b *testing.B) {
+	mustLoadBenchmarkData(db)
+	s := controllers.New(db, "test")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := s.GetActiveRetentionWorkload(context.Background(), &pluginpb.GetActiveRetentionWorkloadRequest{})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkServer_ListConfiguredPlugins(b *testing.B) {
+	mustLoadBenchmarkData(db)
+	s := controllers.New(db, "test")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		orgID := fmt.Sprintf("00000000-0000-0000-0000-%012d", i%benchmarkOrgCount+1)
+		_, err := s.ListConfiguredPlugins(context.Background(), &pluginpb.ListConfiguredPluginsRequest{
+			OrgID: utils.ProtoFromUUIDStrOrNil(orgID),
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkServer_AuditConfigEncryptionConsistency(b *testing.B) {
+	mustLoadBenchmarkData(db)
+	s := controllers.New(db, "test", controllers.WithPreviousDBKeys("old-key"))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := s.AuditConfigEncryptionConsistency(context.Background())
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
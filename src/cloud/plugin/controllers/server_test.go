@@ -19,23 +19,46 @@
 package controllers_test
 
 import (
+	"archive/zip"
+	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/gofrs/uuid"
+	"github.com/gogo/protobuf/jsonpb"
 	"github.com/gogo/protobuf/types"
 	bindata "github.com/golang-migrate/migrate/source/go_bindata"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/xeipuuv/gojsonschema"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
+	"px.dev/pixie/src/api/proto/uuidpb"
 	"px.dev/pixie/src/cloud/plugin/controllers"
 	"px.dev/pixie/src/cloud/plugin/pluginpb"
 	"px.dev/pixie/src/cloud/plugin/schema"
+	"px.dev/pixie/src/shared/services/authcontext"
 	"px.dev/pixie/src/shared/services/pgtest"
+	svcutils "px.dev/pixie/src/shared/services/utils"
 	"px.dev/pixie/src/utils"
 )
 
@@ -68,8 +91,16 @@ func testMain(m *testing.M) error {
 }
 
 func mustLoadTestData(db *sqlx.DB) {
+	db.MustExec(`DELETE FROM retention_script_runs`)
+	db.MustExec(`DELETE FROM org_retention_config_deletions`)
+	db.MustExec(`DELETE FROM org_retention_settings`)
+	db.MustExec(`DELETE FROM org_data_retention_plugin_config_history`)
+	db.MustExec(`DELETE FROM plugin_config_templates`)
+	db.MustExec(`DELETE FROM plugin_retention_scripts`)
 	db.MustExec(`DELETE FROM org_data_retention_plugins`)
 	db.MustExec(`DELETE FROM data_retention_plugin_releases`)
+	db.MustExec(`DELETE FROM plugin_latest_releases_state`)
+	db.MustExec(`DELETE FROM plugin_latest_releases`)
 	db.MustExec(`DELETE FROM plugin_releases`)
 
 	insertRelease := `INSERT INTO plugin_releases(name, id, description, logo, version, data_retention_enabled) VALUES ($1, $2, $3, $4, $5, $6)`
@@ -109,6 +140,7 @@ func mustLoadTestData(db *sqlx.DB) {
 		},
 	}), "http://test-doc-url2", "http://test-export-url2", true)
 	db.MustExec(insertRetentionRelease, "test-plugin", "0.0.3", controllers.Configurations(map[string]string{"license_key3": "This is what we use to authenticate 3"}), nil, "http://test-doc-url3", "http://test-export-url3", true)
+	db.MustExec(insertRetentionRelease, "another-plugin", "0.0.1", controllers.Configurations(map[string]string{"abcd": "This is another config"}), nil, "http://another-doc-url", "http://another-export-url", false)
 
 	orgConfig1 := map[string]string{
 		"license_key2": "12345",
@@ -123,6 +155,11 @@ func mustLoadTestData(db *sqlx.DB) {
 	insertOrgRelease := `INSERT INTO org_data_retention_plugins(org_id, plugin_id, version, configurations) VALUES ($1, $2, $3, PGP_SYM_ENCRYPT($4, $5))`
 	db.MustExec(insertOrgRelease, "223e4567-e89b-12d3-a456-426655440000", "test-plugin", "0.0.3", configJSON1, "test")
 	db.MustExec(insertOrgRelease, "223e4567-e89b-12d3-a456-426655440001", "test-plugin", "0.0.2", configJSON2, "test")
+
+	insertScript := `INSERT INTO plugin_retention_scripts(org_id, plugin_id, plugin_version, script_id, script_name, description, contents, frequency_s, export_url, cluster_ids, enabled, is_preset) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
+	db.MustExec(insertScript, "223e4567-e89b-12d3-a456-426655440000", "test-plugin", "0.0.3", "123e4567-e89b-12d3-a456-426655440000", "http data", "This is a script to get http data", "http script", 10, "http://test-export-url", pq.StringArray([]string{"323e4567-e89b-12d3-a456-426655440000"}), true, true)
+	db.MustExec(insertScript, "223e4567-e89b-12d3-a456-426655440000", "test-plugin", "0.0.3", "123e4567-e89b-12d3-a456-426655440001", "http/data", "This is another script to get http data", "http script 2", 20, "http://test-export-url", pq.StringArray([]string{}), false, false)
+	db.MustExec(insertScript, "223e4567-e89b-12d3-a456-426655440001", "test-plugin", "0.0.2", "123e4567-e89b-12d3-a456-426655440002", "dns data", "This is a script to get dns data", "dns script", 30, "http://test-export-url2", pq.StringArray([]string{}), true, true)
 }
 
 func TestServer_GetPlugins(t *testing.T) {
@@ -140,20 +177,161 @@ func TestServer_GetPlugins(t *testing.T) {
 			ID:               "test-plugin",
 			LatestVersion:    "0.0.3",
 			RetentionEnabled: true,
+			ReleaseChannel:   "stable",
 			Description:      "This is the newest test plugin",
 			Logo:             "logo3",
+			Kind:             pluginpb.PLUGIN_KIND_RETENTION,
 		},
 		&pluginpb.Plugin{
 			Name:             "another_plugin",
 			ID:               "another-plugin",
 			LatestVersion:    "0.0.2",
 			RetentionEnabled: false,
+			ReleaseChannel:   "stable",
 			Description:      "This is another new plugin",
 			Logo:             "anotherLogo2",
+			Kind:             pluginpb.PLUGIN_KIND_CUSTOM,
 		},
 	}, resp.Plugins)
 }
 
+func TestServer_GetPluginsUsageStats(t *testing.T) {
+	mustLoadTestData(db)
+
+	tests := []struct {
+		name              string
+		includeUsageStats bool
+		expectedCounts    map[string]int64
+	}{
+		{
+			name:              "with usage stats",
+			includeUsageStats: true,
+			expectedCounts: map[string]int64{
+				"test-plugin":    2,
+				"another-plugin": 0,
+			},
+		},
+		{
+			name: "without usage stats",
+			expectedCounts: map[string]int64{
+				"test-plugin":    0,
+				"another-plugin": 0,
+			},
+		},
+	}
+
+	s := controllers.New(db, "test")
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, err := s.GetPlugins(context.Background(), &pluginpb.GetPluginsRequest{IncludeUsageStats: test.includeUsageStats})
+			require.NoError(t, err)
+
+			counts := make(map[string]int64)
+			for _, p := range resp.Plugins {
+				counts[p.ID] = p.EnabledOrgCount
+			}
+			assert.Equal(t, test.expectedCounts, counts)
+		})
+	}
+}
+
+func TestServer_GetPluginsCache(t *testing.T) {
+	mustLoadTestData(db)
+
+	updateDescription := `UPDATE plugin_releases SET description=$1 WHERE id=$2 AND version=$3`
+	getDescription := func(s *controllers.Server) string {
+		resp, err := s.GetPlugins(context.Background(), &pluginpb.GetPluginsRequest{Kind: pluginpb.PLUGIN_KIND_RETENTION})
+		require.NoError(t, err)
+		require.Equal(t, 1, len(resp.Plugins))
+		return resp.Plugins[0].Description
+	}
+
+	s := controllers.New(db, "test", controllers.WithPluginsCacheTTL(time.Hour))
+	assert.Equal(t, "This is the newest test plugin", getDescription(s))
+
+	// Changes made outside of the server are not seen until the cache is invalidated.
+	db.MustExec(updateDescription, "Updated description", "test-plugin", "0.0.3")
+	assert.Equal(t, "This is the newest test plugin", getDescription(s))
+
+	_, err := s.CreatePluginRelease(context.Background(), &pluginpb.CreatePluginReleaseRequest{
+		Name:            "test_plugin",
+		ID:              "test-plugin",
+		Description:     "This is the newer test plugin",
+		Version:         "0.0.4",
+		RetentionConfig: &pluginpb.RetentionReleaseConfig{},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "This is the newer test plugin", getDescription(s))
+
+	// Cached responses expire after the TTL.
+	s = controllers.New(db, "test", controllers.WithPluginsCacheTTL(10*time.Millisecond))
+	assert.Equal(t, "This is the newer test plugin", getDescription(s))
+	db.MustExec(updateDescription, "Updated description", "test-plugin", "0.0.4")
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, "Updated description", getDescription(s))
+
+	// A TTL of 0 bypasses the cache.
+	s = controllers.New(db, "test", controllers.WithPluginsCacheTTL(0))
+	assert.Equal(t, "Updated description", getDescription(s))
+	db.MustExec(updateDescription, "Another description", "test-plugin", "0.0.4")
+	assert.Equal(t, "Another description", getDescription(s))
+}
+
+func TestServer_GetPluginsReleaseChannel(t *testing.T) {
+	mustLoadTestData(db)
+
+	s := controllers.New(db, "test")
+	_, err := s.CreatePluginRelease(context.Background(), &pluginpb.CreatePluginReleaseRequest{
+		Name:            "test_plugin",
+		ID:              "test-plugin",
+		Description:     "This is a beta test plugin",
+		Version:         "0.1.0",
+		ReleaseChannel:  "beta",
+		RetentionConfig: &pluginpb.RetentionReleaseConfig{},
+	})
+	require.NoError(t, err)
+
+	_, err = s.CreatePluginRelease(context.Background(), &pluginpb.CreatePluginReleaseRequest{
+		Name:           "test_plugin",
+		ID:             "test-plugin",
+		Version:        "0.2.0",
+		ReleaseChannel: "nightly",
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	tests := []struct {
+		name            string
+		includeBeta     bool
+		expectedVersion string
+		expectedChannel string
+	}{
+		{
+			name:            "stable only",
+			expectedVersion: "0.0.3",
+			expectedChannel: "stable",
+		},
+		{
+			name:            "include beta",
+			includeBeta:     true,
+			expectedVersion: "0.1.0",
+			expectedChannel: "beta",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, err := s.GetPlugins(context.Background(), &pluginpb.GetPluginsRequest{
+				Kind:        pluginpb.PLUGIN_KIND_RETENTION,
+				IncludeBeta: test.includeBeta,
+			})
+			require.NoError(t, err)
+			require.Equal(t, 1, len(resp.Plugins))
+			assert.Equal(t, test.expectedVersion, resp.Plugins[0].LatestVersion)
+			assert.Equal(t, test.expectedChannel, resp.Plugins[0].ReleaseChannel)
+		})
+	}
+}
+
 func TestServer_GetPluginsWithKind(t *testing.T) {
 	mustLoadTestData(db)
 
@@ -169,207 +347,1109 @@ func TestServer_GetPluginsWithKind(t *testing.T) {
 			ID:               "test-plugin",
 			LatestVersion:    "0.0.3",
 			RetentionEnabled: true,
+			ReleaseChannel:   "stable",
 			Description:      "This is the newest test plugin",
 			Logo:             "logo3",
+			Kind:             pluginpb.PLUGIN_KIND_RETENTION,
 		},
 	}, resp.Plugins)
 }
 
-func TestServer_GetRetentionPluginConfig(t *testing.T) {
+func TestServer_GetPluginsWithCustomKind(t *testing.T) {
 	mustLoadTestData(db)
 
 	s := controllers.New(db, "test")
-	resp, err := s.GetRetentionPluginConfig(context.Background(), &pluginpb.GetRetentionPluginConfigRequest{
-		ID:      "test-plugin",
-		Version: "0.0.2",
+	resp, err := s.GetPlugins(context.Background(), &pluginpb.GetPluginsRequest{
+		Kind:              pluginpb.PLUGIN_KIND_CUSTOM,
+		IncludeUsageStats: true,
 	})
 	require.NoError(t, err)
-	require.NotNil(t, resp)
 
-	assert.Equal(t, &pluginpb.GetRetentionPluginConfigResponse{
-		Configurations: map[string]string{
-			"license_key2": "This is what we use to authenticate 2",
+	assert.Equal(t, []*pluginpb.Plugin{
+		&pluginpb.Plugin{
+			Name:           "another_plugin",
+			ID:             "another-plugin",
+			LatestVersion:  "0.0.2",
+			ReleaseChannel: "stable",
+			Description:    "This is another new plugin",
+			Logo:           "anotherLogo2",
+			Kind:           pluginpb.PLUGIN_KIND_CUSTOM,
 		},
-		DocumentationURL:     "http://test-doc-url2",
-		DefaultExportURL:     "http://test-export-url2",
-		AllowCustomExportURL: true,
-		PresetScripts: []*pluginpb.GetRetentionPluginConfigResponse_PresetScript{
-			&pluginpb.GetRetentionPluginConfigResponse_PresetScript{
-				Name:              "dns data",
-				Description:       "This is a script to get dns data",
-				DefaultFrequencyS: 10,
-				Script:            "dns script",
+	}, resp.Plugins)
+}
+
+func TestServer_CountPlugins(t *testing.T) {
+	mustLoadTestData(db)
+
+	tests := []struct {
+		name         string
+		kind         pluginpb.PluginKind
+		expectedResp *pluginpb.CountPluginsResponse
+	}{
+		{
+			name: "all plugins",
+			kind: pluginpb.PLUGIN_KIND_UNKNOWN,
+			expectedResp: &pluginpb.CountPluginsResponse{
+				Total:            2,
+				RetentionEnabled: 1,
 			},
-			&pluginpb.GetRetentionPluginConfigResponse_PresetScript{
-				Name:              "dns data 2",
-				Description:       "This is a script to get dns data 2",
-				DefaultFrequencyS: 20,
-				Script:            "dns script 2",
+		},
+		{
+			name: "retention plugins",
+			kind: pluginpb.PLUGIN_KIND_RETENTION,
+			expectedResp: &pluginpb.CountPluginsResponse{
+				Total:            1,
+				RetentionEnabled: 1,
 			},
 		},
-	}, resp)
+		{
+			name: "custom plugins",
+			kind: pluginpb.PLUGIN_KIND_CUSTOM,
+			expectedResp: &pluginpb.CountPluginsResponse{
+				Total:            1,
+				RetentionEnabled: 0,
+			},
+		},
+	}
+
+	s := controllers.New(db, "test")
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, err := s.CountPlugins(context.Background(), &pluginpb.CountPluginsRequest{Kind: test.kind})
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedResp, resp)
+		})
+	}
 }
 
-func TestServer_GetRetentionPluginsForOrg(t *testing.T) {
+func TestServer_GetLatestPluginReleases(t *testing.T) {
 	mustLoadTestData(db)
 
+	// A release which is only the latest when compared by semver.
+	insertRelease := `INSERT INTO plugin_releases(name, id, description, logo, version, data_retention_enabled) VALUES ($1, $2, $3, $4, $5, $6)`
+	db.MustExec(insertRelease, "test_plugin", "test-plugin", "This is the latest test plugin", "logo4", "0.0.10", "true")
+
 	s := controllers.New(db, "test")
-	resp, err := s.GetRetentionPluginsForOrg(context.Background(), &pluginpb.GetRetentionPluginsForOrgRequest{
-		OrgID: utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440001"),
+	resp, err := s.GetLatestPluginReleases(context.Background(), &pluginpb.GetLatestPluginReleasesRequest{
+		Names: []string{"test_plugin", "another_plugin", "missing_plugin"},
 	})
 	require.NoError(t, err)
-	require.NotNil(t, resp)
 
-	assert.Equal(t, &pluginpb.GetRetentionPluginsForOrgResponse{
-		Plugins: []*pluginpb.GetRetentionPluginsForOrgResponse_PluginState{
-			&pluginpb.GetRetentionPluginsForOrgResponse_PluginState{
-				Plugin: &pluginpb.Plugin{
-					Name:             "test_plugin",
-					ID:               "test-plugin",
-					RetentionEnabled: true,
-				},
-				EnabledVersion: "0.0.2",
-			},
-		},
-	}, resp)
+	latest := make(map[string]string)
+	for _, p := range resp.Plugins {
+		latest[p.Name] = p.LatestVersion
+	}
+	assert.Equal(t, map[string]string{
+		"test_plugin":    "0.0.10",
+		"another_plugin": "0.0.2",
+	}, latest)
 }
 
-func TestServer_GetOrgRetentionPluginConfig(t *testing.T) {
+func TestServer_GetPluginLogos(t *testing.T) {
 	mustLoadTestData(db)
 
+	insertRelease := `INSERT INTO plugin_releases(name, id, description, logo, version, data_retention_enabled, release_channel) VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	// Beta releases are only used for plugins without a stable release.
+	db.MustExec(insertRelease, "test_plugin", "test-plugin", "This is a beta test plugin", "betaLogo", "0.1.0", "true", "beta")
+	db.MustExec(insertRelease, "beta_plugin", "beta-plugin", "This is a beta plugin", "betaPluginLogo", "0.0.1", "false", "beta")
+	db.MustExec(`INSERT INTO plugin_releases(name, id, version, data_retention_enabled) VALUES ($1, $2, $3, $4)`, "no_logo_plugin", "no-logo-plugin", "0.0.1", "false")
+
 	s := controllers.New(db, "test")
-	resp, err := s.GetOrgRetentionPluginConfig(context.Background(), &pluginpb.GetOrgRetentionPluginConfigRequest{
-		PluginID: "test-plugin",
-		OrgID:    utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440001"),
+	resp, err := s.GetPluginLogos(context.Background(), &pluginpb.GetPluginLogosRequest{
+		IDs: []string{"test-plugin", "another-plugin", "beta-plugin", "no-logo-plugin", "missing-plugin"},
 	})
-
 	require.NoError(t, err)
-	require.NotNil(t, resp)
+	assert.Equal(t, map[string]string{
+		"test-plugin":    "logo3",
+		"another-plugin": "anotherLogo2",
+		"beta-plugin":    "betaPluginLogo",
+	}, resp.Logos)
 
-	assert.Equal(t, &pluginpb.GetOrgRetentionPluginConfigResponse{
-		Configurations: map[string]string{
-			"license_key3": "hello",
-		},
-	}, resp)
+	resp, err = s.GetPluginLogos(context.Background(), &pluginpb.GetPluginLogosRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{}, resp.Logos)
 }
 
-type orgConfig struct {
-	OrgID              string `db:"org_id"`
-	PluginID           string `db:"plugin_id"`
-	Version            string `db:"version"`
-	Configurations     map[string]string
-	ConfigurationBytes []byte `db:"configurations"`
+func TestServer_GetPluginsPaginated(t *testing.T) {
+	mustLoadTestData(db)
+
+	s := controllers.New(db, "test")
+	resp, err := s.GetPlugins(context.Background(), &pluginpb.GetPluginsRequest{PageSize: 1})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(resp.Plugins))
+	assert.Equal(t, "another-plugin", resp.Plugins[0].ID)
+	require.NotEmpty(t, resp.NextPageToken)
+
+	// Create plugins before and after the current position between page fetches.
+	insertRelease := `INSERT INTO plugin_releases(name, id, description, logo, version, data_retention_enabled) VALUES ($1, $2, $3, $4, $5, $6)`
+	db.MustExec(insertRelease, "a_plugin", "a-plugin", "This is a plugin", "logo", "0.0.1", "false")
+	db.MustExec(insertRelease, "b_plugin", "b-plugin", "This is b plugin", "logo", "0.0.1", "false")
+
+	seen := []string{resp.Plugins[0].ID}
+	token := resp.NextPageToken
+	for token != "" {
+		resp, err = s.GetPlugins(context.Background(), &pluginpb.GetPluginsRequest{PageSize: 1, PageToken: token})
+		require.NoError(t, err)
+		for _, p := range resp.Plugins {
+			seen = append(seen, p.ID)
+		}
+		token = resp.NextPageToken
+	}
+	assert.Equal(t, []string{"another-plugin", "b-plugin", "test-plugin"}, seen)
+
+	_, err = s.GetPlugins(context.Background(), &pluginpb.GetPluginsRequest{PageSize: 1, PageToken: "not a token"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
 }
 
-func TestServer_UpdateRetentionConfigs(t *testing.T) {
+func TestServer_GetPluginsTagFilter(t *testing.T) {
+	mustLoadTestData(db)
+
+	s := controllers.New(db, "test", controllers.WithPluginsCacheTTL(0))
+	_, err := s.CreatePluginRelease(context.Background(), &pluginpb.CreatePluginReleaseRequest{
+		Name:    "test_plugin",
+		ID:      "test-plugin",
+		Version: "0.0.4",
+		Tags:    []string{"observability", "security"},
+	})
+	require.NoError(t, err)
+	_, err = s.CreatePluginRelease(context.Background(), &pluginpb.CreatePluginReleaseRequest{
+		Name:    "another_plugin",
+		ID:      "another-plugin",
+		Version: "0.0.3",
+		Tags:    []string{"observability"},
+	})
+	require.NoError(t, err)
+
 	tests := []struct {
-		name               string
-		request            *pluginpb.UpdateOrgRetentionPluginConfigRequest
-		expectedOrgConfigs []orgConfig
+		name        string
+		tagFilter   []string
+		expectedIDs []string
 	}{
 		{
-			name: "enabling new config",
-			request: &pluginpb.UpdateOrgRetentionPluginConfigRequest{
-				OrgID:    utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440001"),
-				PluginID: "another-plugin",
-				Configurations: map[string]string{
-					"abcd": "hello",
-				},
-				Enabled: &types.BoolValue{Value: true},
-				Version: &types.StringValue{Value: "0.0.1"},
-			},
-			expectedOrgConfigs: []orgConfig{
-				orgConfig{
-					OrgID:    "223e4567-e89b-12d3-a456-426655440000",
-					PluginID: "test-plugin",
-					Version:  "0.0.3",
-					Configurations: map[string]string{
-						"license_key2": "12345",
-					},
-				},
-				orgConfig{
-					OrgID:    "223e4567-e89b-12d3-a456-426655440001",
-					PluginID: "test-plugin",
-					Version:  "0.0.2",
-					Configurations: map[string]string{
-						"license_key3": "hello",
-					},
-				},
-				orgConfig{
-					OrgID:    "223e4567-e89b-12d3-a456-426655440001",
-					PluginID: "another-plugin",
-					Version:  "0.0.1",
-					Configurations: map[string]string{
-						"abcd": "hello",
-					},
-				},
-			},
+			name:        "no filter",
+			expectedIDs: []string{"another-plugin", "test-plugin"},
 		},
 		{
-			name: "deleting config",
-			request: &pluginpb.UpdateOrgRetentionPluginConfigRequest{
-				OrgID:    utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
-				PluginID: "test-plugin",
-				Enabled:  &types.BoolValue{Value: false},
-			},
-			expectedOrgConfigs: []orgConfig{
-				orgConfig{
-					OrgID:    "223e4567-e89b-12d3-a456-426655440001",
-					PluginID: "test-plugin",
-					Version:  "0.0.2",
-					Configurations: map[string]string{
-						"license_key3": "hello",
-					},
-				},
-			},
+			name:        "single tag",
+			tagFilter:   []string{"observability"},
+			expectedIDs: []string{"another-plugin", "test-plugin"},
 		},
 		{
-			name: "updating existing config",
-			request: &pluginpb.UpdateOrgRetentionPluginConfigRequest{
-				OrgID:    utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
-				PluginID: "test-plugin",
-				Configurations: map[string]string{
-					"abcd": "hello",
-				},
-			},
-			expectedOrgConfigs: []orgConfig{
-				orgConfig{
-					OrgID:    "223e4567-e89b-12d3-a456-426655440000",
-					PluginID: "test-plugin",
-					Version:  "0.0.3",
-					Configurations: map[string]string{
-						"abcd": "hello",
-					},
-				},
-				orgConfig{
-					OrgID:    "223e4567-e89b-12d3-a456-426655440001",
-					PluginID: "test-plugin",
-					Version:  "0.0.2",
-					Configurations: map[string]string{
-						"license_key3": "hello",
-					},
-				},
-			},
+			name:        "all tags must match",
+			tagFilter:   []string{"observability", "security"},
+			expectedIDs: []string{"test-plugin"},
 		},
 		{
-			name: "updating version",
-			request: &pluginpb.UpdateOrgRetentionPluginConfigRequest{
-				OrgID:    utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
-				PluginID: "test-plugin",
-				Version:  &types.StringValue{Value: "0.0.2"},
-			},
-			expectedOrgConfigs: []orgConfig{
-				orgConfig{
-					OrgID:    "223e4567-e89b-12d3-a456-426655440000",
-					PluginID: "test-plugin",
-					Version:  "0.0.2",
-					Configurations: map[string]string{
-						"license_key2": "12345",
-					},
-				},
-				orgConfig{
-					OrgID:    "223e4567-e89b-12d3-a456-426655440001",
-					PluginID: "test-plugin",
+			name:        "unknown tag",
+			tagFilter:   []string{"networking"},
+			expectedIDs: []string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, err := s.GetPlugins(context.Background(), &pluginpb.GetPluginsRequest{TagFilter: test.tagFilter})
+			require.NoError(t, err)
+			ids := []string{}
+			for _, p := range resp.Plugins {
+				ids = append(ids, p.ID)
+			}
+			assert.Equal(t, test.expectedIDs, ids)
+		})
+	}
+
+	resp, err := s.GetPlugins(context.Background(), &pluginpb.GetPluginsRequest{TagFilter: []string{"security"}})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(resp.Plugins))
+	assert.Equal(t, []string{"observability", "security"}, resp.Plugins[0].Tags)
+
+	_, err = s.CreatePluginRelease(context.Background(), &pluginpb.CreatePluginReleaseRequest{
+		Name:    "test_plugin",
+		ID:      "test-plugin",
+		Version: "0.0.5",
+		Tags:    []string{""},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServer_RefreshLatestReleases(t *testing.T) {
+	mustLoadTestData(db)
+
+	sCtx := authcontext.New()
+	sCtx.Claims = svcutils.GenerateJWTForService("vzmgr", "withpixie.ai")
+	serviceCtx := authcontext.NewContext(context.Background(), sCtx)
+
+	storedLatest := func(includeBeta bool) map[string]string {
+		var rows []struct {
+			ID      string `db:"id"`
+			Version string `db:"version"`
+		}
+		err := db.Select(&rows, `SELECT id, version FROM plugin_latest_releases WHERE include_beta=$1`, includeBeta)
+		require.NoError(t, err)
+		latest := make(map[string]string)
+		for _, r := range rows {
+			latest[r.ID] = r.Version
+		}
+		return latest
+	}
+	latestVersions := func(s *controllers.Server) map[string]string {
+		resp, err := s.GetPlugins(context.Background(), &pluginpb.GetPluginsRequest{})
+		require.NoError(t, err)
+		latest := make(map[string]string)
+		for _, p := range resp.Plugins {
+			latest[p.ID] = p.LatestVersion
+		}
+		return latest
+	}
+
+	s := controllers.New(db, "test", controllers.WithPluginsCacheTTL(0))
+	_, err := s.RefreshLatestReleases(context.Background(), &pluginpb.RefreshLatestReleasesRequest{})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	resp, err := s.RefreshLatestReleases(serviceCtx, &pluginpb.RefreshLatestReleasesRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), resp.PluginCount)
+	assert.Equal(t, map[string]string{"test-plugin": "0.0.3", "another-plugin": "0.0.2"}, storedLatest(false))
+	assert.Equal(t, map[string]string{"test-plugin": "0.0.3", "another-plugin": "0.0.2"}, latestVersions(s))
+
+	// Releases added outside of CreatePluginRelease make the stored releases stale, so the latest releases are computed.
+	db.MustExec(`INSERT INTO plugin_releases(name, id, description, logo, version, data_retention_enabled) VALUES ($1, $2, $3, $4, $5, $6)`,
+		"test_plugin", "test-plugin", "This is a test plugin", "logo", "0.0.10", "true")
+	assert.Equal(t, "0.0.3", storedLatest(false)["test-plugin"])
+	assert.Equal(t, map[string]string{"test-plugin": "0.0.10", "another-plugin": "0.0.2"}, latestVersions(s))
+
+	_, err = s.RefreshLatestReleases(serviceCtx, &pluginpb.RefreshLatestReleasesRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, "0.0.10", storedLatest(false)["test-plugin"])
+
+	// Created releases are kept current.
+	_, err = s.CreatePluginRelease(context.Background(), &pluginpb.CreatePluginReleaseRequest{
+		Name:    "another_plugin",
+		ID:      "another-plugin",
+		Version: "0.1.0",
+	})
+	require.NoError(t, err)
+	_, err = s.CreatePluginRelease(context.Background(), &pluginpb.CreatePluginReleaseRequest{
+		Name:           "another_plugin",
+		ID:             "another-plugin",
+		Version:        "0.2.0-beta",
+		ReleaseChannel: "beta",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"test-plugin": "0.0.10", "another-plugin": "0.1.0"}, storedLatest(false))
+	assert.Equal(t, map[string]string{"test-plugin": "0.0.10", "another-plugin": "0.2.0-beta"}, storedLatest(true))
+
+	var fresh bool
+	err = db.QueryRow(`SELECT revision = refreshed_revision FROM plugin_latest_releases_state`).Scan(&fresh)
+	require.NoError(t, err)
+	assert.True(t, fresh)
+	assert.Equal(t, map[string]string{"test-plugin": "0.0.10", "another-plugin": "0.1.0"}, latestVersions(s))
+
+	// Changes outside of CreatePluginRelease which keep the number of releases also make the stored releases stale.
+	db.MustExec(`UPDATE plugin_releases SET release_channel=$1 WHERE id=$2 AND version=$3`, "beta", "test-plugin", "0.0.10")
+	assert.Equal(t, "0.0.10", storedLatest(false)["test-plugin"])
+	assert.Equal(t, map[string]string{"test-plugin": "0.0.3", "another-plugin": "0.1.0"}, latestVersions(s))
+}
+
+func TestServer_GetPluginsNamespace(t *testing.T) {
+	mustLoadTestData(db)
+
+	s := controllers.New(db, "test", controllers.WithPluginsCacheTTL(0))
+	_, err := s.CreatePluginRelease(context.Background(), &pluginpb.CreatePluginReleaseRequest{
+		Name:      "staging_plugin",
+		ID:        "staging-plugin",
+		Version:   "0.0.1",
+		Namespace: "staging",
+		RetentionConfig: &pluginpb.RetentionReleaseConfig{
+			Configurations: map[string]string{"license_key": "The license key"},
+		},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		namespace   string
+		expectedIDs []string
+	}{
+		{
+			name:        "default namespace",
+			expectedIDs: []string{"another-plugin", "test-plugin"},
+		},
+		{
+			name:        "explicit default namespace",
+			namespace:   "default",
+			expectedIDs: []string{"another-plugin", "test-plugin"},
+		},
+		{
+			name:        "staging namespace",
+			namespace:   "staging",
+			expectedIDs: []string{"staging-plugin"},
+		},
+		{
+			name:        "unknown namespace",
+			namespace:   "dev",
+			expectedIDs: []string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, err := s.GetPlugins(context.Background(), &pluginpb.GetPluginsRequest{Namespace: test.namespace})
+			require.NoError(t, err)
+			ids := []string{}
+			for _, p := range resp.Plugins {
+				ids = append(ids, p.ID)
+			}
+			assert.Equal(t, test.expectedIDs, ids)
+		})
+	}
+
+	var namespace string
+	err = db.QueryRow(`SELECT namespace FROM data_retention_plugin_releases WHERE plugin_id=$1`, "staging-plugin").Scan(&namespace)
+	require.NoError(t, err)
+	assert.Equal(t, "staging", namespace)
+
+	// A new version of a plugin can be tested in another namespace, without changing its latest release elsewhere.
+	_, err = s.CreatePluginRelease(context.Background(), &pluginpb.CreatePluginReleaseRequest{
+		Name:      "test_plugin",
+		ID:        "test-plugin",
+		Version:   "0.0.4",
+		Logo:      "https://example.com/staging-logo.png",
+		Namespace: "staging",
+	})
+	require.NoError(t, err)
+
+	latestVersions := func(namespace string) map[string]string {
+		resp, err := s.GetPlugins(context.Background(), &pluginpb.GetPluginsRequest{Namespace: namespace})
+		require.NoError(t, err)
+		latest := make(map[string]string)
+		for _, p := range resp.Plugins {
+			latest[p.ID] = p.LatestVersion
+		}
+		return latest
+	}
+	assert.Equal(t, map[string]string{"test-plugin": "0.0.3", "another-plugin": "0.0.2"}, latestVersions(""))
+	assert.Equal(t, map[string]string{"test-plugin": "0.0.4", "staging-plugin": "0.0.1"}, latestVersions("staging"))
+
+	count, err := s.CountPlugins(context.Background(), &pluginpb.CountPluginsRequest{Namespace: "staging"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count.Total)
+	count, err = s.CountPlugins(context.Background(), &pluginpb.CountPluginsRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count.Total)
+
+	releases, err := s.GetLatestPluginReleases(context.Background(), &pluginpb.GetLatestPluginReleasesRequest{
+		Names:     []string{"test_plugin"},
+		Namespace: "staging",
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(releases.Plugins))
+	assert.Equal(t, "0.0.4", releases.Plugins[0].LatestVersion)
+	releases, err = s.GetLatestPluginReleases(context.Background(), &pluginpb.GetLatestPluginReleasesRequest{Names: []string{"test_plugin"}})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(releases.Plugins))
+	assert.Equal(t, "0.0.3", releases.Plugins[0].LatestVersion)
+
+	logos, err := s.GetPluginLogos(context.Background(), &pluginpb.GetPluginLogosRequest{IDs: []string{"test-plugin"}, Namespace: "staging"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"test-plugin": "https://example.com/staging-logo.png"}, logos.Logos)
+
+	// The namespace is kept when a release is exported and imported.
+	exported, err := s.ExportPluginRelease(context.Background(), &pluginpb.ExportPluginReleaseRequest{ID: "test-plugin", Version: "0.0.4"})
+	require.NoError(t, err)
+	release := &pluginpb.CreatePluginReleaseRequest{}
+	require.NoError(t, jsonpb.UnmarshalString(exported.Bundle, release))
+	assert.Equal(t, "staging", release.Namespace)
+
+	// A version can only be released to one namespace.
+	_, err = s.CreatePluginRelease(context.Background(), &pluginpb.CreatePluginReleaseRequest{
+		Name:    "test_plugin",
+		ID:      "test-plugin",
+		Version: "0.0.4",
+	})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+}
+
+func TestServer_GetPluginsSorted(t *testing.T) {
+	mustLoadTestData(db)
+	insertRelease := `INSERT INTO plugin_releases(name, id, description, logo, version, data_retention_enabled, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	db.MustExec(insertRelease, "a_plugin", "a-plugin", "This is a plugin", "logo", "0.0.1", "false", "2022-01-03")
+	db.MustExec(`UPDATE plugin_releases SET updated_at=$1 WHERE id=$2 AND version=$3`, "2022-01-01", "test-plugin", "0.0.3")
+	// another-plugin has no updated_at, so it is the least recently updated.
+
+	tests := []struct {
+		name           string
+		sortBy         pluginpb.PluginSortBy
+		sortDescending bool
+		expectedIDs    []string
+	}{
+		{
+			name:        "name",
+			expectedIDs: []string{"a-plugin", "another-plugin", "test-plugin"},
+		},
+		{
+			name:           "name descending",
+			sortDescending: true,
+			expectedIDs:    []string{"test-plugin", "another-plugin", "a-plugin"},
+		},
+		{
+			name:        "updated at",
+			sortBy:      pluginpb.PLUGIN_SORT_BY_UPDATED_AT,
+			expectedIDs: []string{"another-plugin", "test-plugin", "a-plugin"},
+		},
+		{
+			name:           "most recently updated",
+			sortBy:         pluginpb.PLUGIN_SORT_BY_UPDATED_AT,
+			sortDescending: true,
+			expectedIDs:    []string{"a-plugin", "test-plugin", "another-plugin"},
+		},
+	}
+
+	s := controllers.New(db, "test")
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, err := s.GetPlugins(context.Background(), &pluginpb.GetPluginsRequest{
+				SortBy:         test.sortBy,
+				SortDescending: test.sortDescending,
+			})
+			require.NoError(t, err)
+			ids := []string{}
+			for _, p := range resp.Plugins {
+				ids = append(ids, p.ID)
+			}
+			assert.Equal(t, test.expectedIDs, ids)
+
+			// Paging through the plugins returns them in the same order.
+			ids = []string{}
+			token := ""
+			for {
+				resp, err = s.GetPlugins(context.Background(), &pluginpb.GetPluginsRequest{
+					SortBy:         test.sortBy,
+					SortDescending: test.sortDescending,
+					PageSize:       1,
+					PageToken:      token,
+				})
+				require.NoError(t, err)
+				for _, p := range resp.Plugins {
+					ids = append(ids, p.ID)
+				}
+				token = resp.NextPageToken
+				if token == "" {
+					break
+				}
+			}
+			assert.Equal(t, test.expectedIDs, ids)
+		})
+	}
+}
+
+func TestServer_ExportImportPluginRelease(t *testing.T) {
+	mustLoadTestData(db)
+
+	s := controllers.New(db, "test")
+	resp, err := s.ExportPluginRelease(context.Background(), &pluginpb.ExportPluginReleaseRequest{
+		ID:      "test-plugin",
+		Version: "0.0.2",
+	})
+	require.NoError(t, err)
+
+	release := &pluginpb.CreatePluginReleaseRequest{}
+	require.NoError(t, jsonpb.UnmarshalString(resp.Bundle, release))
+	assert.Equal(t, &pluginpb.CreatePluginReleaseRequest{
+		Name:           "test_plugin",
+		ID:             "test-plugin",
+		Description:    "This is a newer test plugin",
+		Logo:           "logo2",
+		Version:        "0.0.2",
+		ReleaseChannel: "stable",
+		Namespace:      "default",
+		RetentionConfig: &pluginpb.RetentionReleaseConfig{
+			Configurations: map[string]string{
+				"license_key2": "This is what we use to authenticate 2",
+			},
+			PresetScripts: []*pluginpb.GetRetentionPluginConfigResponse_PresetScript{
+				{
+					Name:              "dns data",
+					Description:       "This is a script to get dns data",
+					DefaultFrequencyS: 10,
+					Script:            "dns script",
+				},
+				{
+					Name:              "dns data 2",
+					Description:       "This is a script to get dns data 2",
+					DefaultFrequencyS: 20,
+					Script:            "dns script 2",
+				},
+			},
+			DocumentationURL:     "http://test-doc-url2",
+			DefaultExportURL:     "http://test-export-url2",
+			AllowCustomExportURL: true,
+		},
+	}, release)
+
+	// The test data's logos are not valid for new releases.
+	release.Logo = "https://example.com/logo2.svg"
+	m := jsonpb.Marshaler{}
+	bundle, err := m.MarshalToString(release)
+	require.NoError(t, err)
+
+	// The bundle can't be imported into an environment which already has the version.
+	_, err = s.ImportPluginRelease(context.Background(), &pluginpb.ImportPluginReleaseRequest{Bundle: bundle})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+	release.Version = "0.1.0"
+	bundle, err = m.MarshalToString(release)
+	require.NoError(t, err)
+	_, err = s.ImportPluginRelease(context.Background(), &pluginpb.ImportPluginReleaseRequest{Bundle: bundle})
+	require.NoError(t, err)
+
+	resp, err = s.ExportPluginRelease(context.Background(), &pluginpb.ExportPluginReleaseRequest{
+		ID:      "test-plugin",
+		Version: "0.1.0",
+	})
+	require.NoError(t, err)
+	imported := &pluginpb.CreatePluginReleaseRequest{}
+	require.NoError(t, jsonpb.UnmarshalString(resp.Bundle, imported))
+	assert.Equal(t, release, imported)
+
+	_, err = s.ImportPluginRelease(context.Background(), &pluginpb.ImportPluginReleaseRequest{Bundle: "not json"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = s.ExportPluginRelease(context.Background(), &pluginpb.ExportPluginReleaseRequest{
+		ID:      "test-plugin",
+		Version: "1.0.0",
+	})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestServer_GetRetentionPluginConfig(t *testing.T) {
+	mustLoadTestData(db)
+
+	s := controllers.New(db, "test")
+	resp, err := s.GetRetentionPluginConfig(context.Background(), &pluginpb.GetRetentionPluginConfigRequest{
+		ID:      "test-plugin",
+		Version: "0.0.2",
+	})
+	require.NoError(t, err)
+	require.NotNil(t, resp)
+
+	assert.Equal(t, &pluginpb.GetRetentionPluginConfigResponse{
+		Configurations: map[string]string{
+			"license_key2": "This is what we use to authenticate 2",
+		},
+		DocumentationURL:     "http://test-doc-url2",
+		DefaultExportURL:     "http://test-export-url2",
+		AllowCustomExportURL: true,
+		LatestVersion:        "0.0.3",
+		PresetScripts: []*pluginpb.GetRetentionPluginConfigResponse_PresetScript{
+			&pluginpb.GetRetentionPluginConfigResponse_PresetScript{
+				Name:              "dns data",
+				Description:       "This is a script to get dns data",
+				DefaultFrequencyS: 10,
+				Script:            "dns script",
+			},
+			&pluginpb.GetRetentionPluginConfigResponse_PresetScript{
+				Name:              "dns data 2",
+				Description:       "This is a script to get dns data 2",
+				DefaultFrequencyS: 20,
+				Script:            "dns script 2",
+			},
+		},
+	}, resp)
+}
+
+func TestServer_GetRetentionPluginConfigMinCLIVersion(t *testing.T) {
+	mustLoadTestData(db)
+
+	s := controllers.New(db, "test")
+	_, err := s.CreatePluginRelease(context.Background(), &pluginpb.CreatePluginReleaseRequest{
+		Name:    "test_plugin",
+		ID:      "test-plugin",
+		Version: "0.0.4",
+		RetentionConfig: &pluginpb.RetentionReleaseConfig{
+			MinCLIVersion: "not a version",
+		},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = s.CreatePluginRelease(context.Background(), &pluginpb.CreatePluginReleaseRequest{
+		Name:    "test_plugin",
+		ID:      "test-plugin",
+		Version: "0.0.4",
+		RetentionConfig: &pluginpb.RetentionReleaseConfig{
+			MinCLIVersion: "0.7.2",
+		},
+	})
+	require.NoError(t, err)
+
+	resp, err := s.GetRetentionPluginConfig(context.Background(), &pluginpb.GetRetentionPluginConfigRequest{
+		ID:      "test-plugin",
+		Version: "0.0.4",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "0.7.2", resp.MinCLIVersion)
+
+	// Releases without a minimum version are compatible with any CLI.
+	resp, err = s.GetRetentionPluginConfig(context.Background(), &pluginpb.GetRetentionPluginConfigRequest{
+		ID:      "test-plugin",
+		Version: "0.0.3",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "", resp.MinCLIVersion)
+}
+
+func TestServer_GetPluginReleaseByVersion(t *testing.T) {
+	mustLoadTestData(db)
+
+	tests := []struct {
+		name         string
+		id           string
+		version      string
+		expectedResp *pluginpb.GetPluginReleaseByVersionResponse
+		expectedCode codes.Code
+	}{
+		{
+			name:    "retention release",
+			id:      "test-plugin",
+			version: "0.0.2",
+			expectedResp: &pluginpb.GetPluginReleaseByVersionResponse{
+				Name:                 "test_plugin",
+				ID:                   "test-plugin",
+				Version:              "0.0.2",
+				Description:          "This is a newer test plugin",
+				Logo:                 "logo2",
+				RetentionEnabled:     true,
+				ReleaseChannel:       "stable",
+				DocumentationURL:     "http://test-doc-url2",
+				DefaultExportURL:     "http://test-export-url2",
+				AllowCustomExportURL: true,
+			},
+		},
+		{
+			name:    "non-retention release",
+			id:      "another-plugin",
+			version: "0.0.2",
+			expectedResp: &pluginpb.GetPluginReleaseByVersionResponse{
+				Name:           "another_plugin",
+				ID:             "another-plugin",
+				Version:        "0.0.2",
+				Description:    "This is another new plugin",
+				Logo:           "anotherLogo2",
+				ReleaseChannel: "stable",
+			},
+		},
+		{
+			name:         "missing version",
+			id:           "test-plugin",
+			version:      "0.0.4",
+			expectedCode: codes.NotFound,
+		},
+		{
+			name:         "missing ID",
+			version:      "0.0.1",
+			expectedCode: codes.InvalidArgument,
+		},
+	}
+
+	s := controllers.New(db, "test")
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, err := s.GetPluginReleaseByVersion(context.Background(), &pluginpb.GetPluginReleaseByVersionRequest{
+				ID:      test.id,
+				Version: test.version,
+			})
+			if test.expectedCode != codes.OK {
+				assert.Equal(t, test.expectedCode, status.Code(err))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedResp, resp)
+		})
+	}
+}
+
+func TestServer_GetRetentionPluginsForOrg(t *testing.T) {
+	mustLoadTestData(db)
+
+	s := controllers.New(db, "test")
+	resp, err := s.GetRetentionPluginsForOrg(context.Background(), &pluginpb.GetRetentionPluginsForOrgRequest{
+		OrgID: utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440001"),
+	})
+	require.NoError(t, err)
+	require.NotNil(t, resp)
+
+	assert.Equal(t, &pluginpb.GetRetentionPluginsForOrgResponse{
+		Plugins: []*pluginpb.GetRetentionPluginsForOrgResponse_PluginState{
+			&pluginpb.GetRetentionPluginsForOrgResponse_PluginState{
+				Plugin: &pluginpb.Plugin{
+					Name:             "test_plugin",
+					ID:               "test-plugin",
+					RetentionEnabled: true,
+				},
+				EnabledVersion: "0.0.2",
+				Enabled:        true,
+			},
+		},
+	}, resp)
+}
+
+func TestServer_GetRetentionPluginsForOrgIncludeDisabled(t *testing.T) {
+	mustLoadTestData(db)
+
+	s := controllers.New(db, "test")
+	orgID := utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440001")
+	_, err := s.UpdateOrgRetentionPluginConfig(context.Background(), &pluginpb.UpdateOrgRetentionPluginConfigRequest{
+		OrgID:    orgID,
+		PluginID: "test-plugin",
+		Enabled:  &types.BoolValue{Value: false},
+	})
+	require.NoError(t, err)
+
+	// Disabled plugins are excluded by default.
+	resp, err := s.GetRetentionPluginsForOrg(context.Background(), &pluginpb.GetRetentionPluginsForOrgRequest{
+		OrgID: orgID,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(resp.Plugins))
+
+	resp, err = s.GetRetentionPluginsForOrg(context.Background(), &pluginpb.GetRetentionPluginsForOrgRequest{
+		OrgID:           orgID,
+		IncludeDisabled: true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &pluginpb.GetRetentionPluginsForOrgResponse{
+		Plugins: []*pluginpb.GetRetentionPluginsForOrgResponse_PluginState{
+			&pluginpb.GetRetentionPluginsForOrgResponse_PluginState{
+				Plugin: &pluginpb.Plugin{
+					Name:             "test_plugin",
+					ID:               "test-plugin",
+					RetentionEnabled: true,
+				},
+				EnabledVersion: "0.0.2",
+				Enabled:        false,
+			},
+		},
+	}, resp)
+}
+
+func TestServer_GetConfiguredPluginCountForOrg(t *testing.T) {
+	mustLoadTestData(db)
+
+	s := controllers.New(db, "test")
+	orgID := utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000")
+	resp, err := s.GetConfiguredPluginCountForOrg(context.Background(), &pluginpb.GetConfiguredPluginCountForOrgRequest{OrgID: orgID})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), resp.Count)
+
+	// Disabled plugins are not counted.
+	_, err = s.UpdateOrgRetentionPluginConfig(context.Background(), &pluginpb.UpdateOrgRetentionPluginConfigRequest{
+		OrgID:    orgID,
+		PluginID: "test-plugin",
+		Enabled:  &types.BoolValue{Value: false},
+	})
+	require.NoError(t, err)
+	resp, err = s.GetConfiguredPluginCountForOrg(context.Background(), &pluginpb.GetConfiguredPluginCountForOrgRequest{OrgID: orgID})
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), resp.Count)
+
+	_, err = s.GetConfiguredPluginCountForOrg(context.Background(), &pluginpb.GetConfiguredPluginCountForOrgRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServer_GetRetentionPluginConfigKind(t *testing.T) {
+	tests := []struct {
+		name         string
+		pluginID     string
+		version      string
+		expectedCode codes.Code
+	}{
+		{
+			name:         "retention plugin",
+			pluginID:     "test-plugin",
+			version:      "0.0.3",
+			expectedCode: codes.OK,
+		},
+		{
+			name:         "non-retention plugin",
+			pluginID:     "another-plugin",
+			version:      "0.0.2",
+			expectedCode: codes.FailedPrecondition,
+		},
+		{
+			name:         "nonexistent release",
+			pluginID:     "another-plugin",
+			version:      "0.0.3",
+			expectedCode: codes.NotFound,
+		},
+	}
+
+	mustLoadTestData(db)
+	s := controllers.New(db, "test")
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := s.GetRetentionPluginConfig(context.Background(), &pluginpb.GetRetentionPluginConfigRequest{
+				ID:      test.pluginID,
+				Version: test.version,
+			})
+			assert.Equal(t, test.expectedCode, status.Code(err))
+		})
+	}
+}
+
+func TestServer_GetOrgRetentionPluginConfig(t *testing.T) {
+	mustLoadTestData(db)
+
+	insertOrgRelease := `INSERT INTO org_data_retention_plugins(org_id, plugin_id, version, configurations) VALUES ($1, $2, $3, PGP_SYM_ENCRYPT($4, $5))`
+	db.MustExec(insertOrgRelease, "223e4567-e89b-12d3-a456-426655440002", "test-plugin", "0.0.3", []byte(`{}`), "test")
+	db.MustExec(`INSERT INTO org_data_retention_plugins(org_id, plugin_id, version) VALUES ($1, $2, $3)`, "223e4567-e89b-12d3-a456-426655440003", "test-plugin", "0.0.3")
+
+	tests := []struct {
+		name          string
+		orgID         string
+		pluginID      string
+		redactSecrets bool
+		expectedResp  *pluginpb.GetOrgRetentionPluginConfigResponse
+		expectedCode  codes.Code
+	}{
+		{
+			name:     "configured",
+			orgID:    "223e4567-e89b-12d3-a456-426655440001",
+			pluginID: "test-plugin",
+			expectedResp: &pluginpb.GetOrgRetentionPluginConfigResponse{
+				Configurations: map[string]string{
+					"license_key3": "hello",
+				},
+				EffectiveExportURL: "http://test-export-url2",
+			},
+		},
+		{
+			name:          "redacted secrets",
+			orgID:         "223e4567-e89b-12d3-a456-426655440001",
+			pluginID:      "test-plugin",
+			redactSecrets: true,
+			expectedResp: &pluginpb.GetOrgRetentionPluginConfigResponse{
+				Configurations: map[string]string{
+					"license_key3": "********",
+				},
+				EffectiveExportURL: "http://test-export-url2",
+			},
+		},
+		{
+			name:     "empty configs",
+			orgID:    "223e4567-e89b-12d3-a456-426655440002",
+			pluginID: "test-plugin",
+			expectedResp: &pluginpb.GetOrgRetentionPluginConfigResponse{
+				Configurations:     map[string]string{},
+				EffectiveExportURL: "http://test-export-url3",
+			},
+		},
+		{
+			name:     "no configs",
+			orgID:    "223e4567-e89b-12d3-a456-426655440003",
+			pluginID: "test-plugin",
+			expectedResp: &pluginpb.GetOrgRetentionPluginConfigResponse{
+				Configurations:     map[string]string{},
+				EffectiveExportURL: "http://test-export-url3",
+			},
+		},
+		{
+			name:         "not configured",
+			orgID:        "223e4567-e89b-12d3-a456-426655440001",
+			pluginID:     "another-plugin",
+			expectedCode: codes.NotFound,
+		},
+	}
+
+	s := controllers.New(db, "test")
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, err := s.GetOrgRetentionPluginConfig(context.Background(), &pluginpb.GetOrgRetentionPluginConfigRequest{
+				PluginID:      test.pluginID,
+				OrgID:         utils.ProtoFromUUIDStrOrNil(test.orgID),
+				RedactSecrets: test.redactSecrets,
+			})
+			assert.Equal(t, test.expectedCode, status.Code(err))
+			assert.Equal(t, test.expectedResp, resp)
+		})
+	}
+}
+
+type orgConfig struct {
+	OrgID              string `db:"org_id"`
+	PluginID           string `db:"plugin_id"`
+	Version            string `db:"version"`
+	Configurations     map[string]string
+	ConfigurationBytes []byte `db:"configurations"`
+}
+
+func TestServer_UpdateRetentionConfigs(t *testing.T) {
+	tests := []struct {
+		name               string
+		request            *pluginpb.UpdateOrgRetentionPluginConfigRequest
+		expectedOrgConfigs []orgConfig
+	}{
+		{
+			name: "enabling new config",
+			request: &pluginpb.UpdateOrgRetentionPluginConfigRequest{
+				OrgID:    utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440001"),
+				PluginID: "another-plugin",
+				Configurations: map[string]string{
+					"abcd": "hello",
+				},
+				Enabled: &types.BoolValue{Value: true},
+				Version: &types.StringValue{Value: "0.0.1"},
+			},
+			expectedOrgConfigs: []orgConfig{
+				orgConfig{
+					OrgID:    "223e4567-e89b-12d3-a456-426655440000",
+					PluginID: "test-plugin",
+					Version:  "0.0.3",
+					Configurations: map[string]string{
+						"license_key2": "12345",
+					},
+				},
+				orgConfig{
+					OrgID:    "223e4567-e89b-12d3-a456-426655440001",
+					PluginID: "test-plugin",
+					Version:  "0.0.2",
+					Configurations: map[string]string{
+						"license_key3": "hello",
+					},
+				},
+				orgConfig{
+					OrgID:    "223e4567-e89b-12d3-a456-426655440001",
+					PluginID: "another-plugin",
+					Version:  "0.0.1",
+					Configurations: map[string]string{
+						"abcd": "hello",
+					},
+				},
+			},
+		},
+		{
+			name: "deleting config",
+			request: &pluginpb.UpdateOrgRetentionPluginConfigRequest{
+				OrgID:    utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
+				PluginID: "test-plugin",
+				Enabled:  &types.BoolValue{Value: false},
+			},
+			expectedOrgConfigs: []orgConfig{
+				orgConfig{
+					OrgID:    "223e4567-e89b-12d3-a456-426655440001",
+					PluginID: "test-plugin",
+					Version:  "0.0.2",
+					Configurations: map[string]string{
+						"license_key3": "hello",
+					},
+				},
+			},
+		},
+		{
+			name: "updating existing config",
+			request: &pluginpb.UpdateOrgRetentionPluginConfigRequest{
+				OrgID:    utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
+				PluginID: "test-plugin",
+				Configurations: map[string]string{
+					"abcd": "hello",
+				},
+			},
+			expectedOrgConfigs: []orgConfig{
+				orgConfig{
+					OrgID:    "223e4567-e89b-12d3-a456-426655440000",
+					PluginID: "test-plugin",
+					Version:  "0.0.3",
+					Configurations: map[string]string{
+						"abcd": "hello",
+					},
+				},
+				orgConfig{
+					OrgID:    "223e4567-e89b-12d3-a456-426655440001",
+					PluginID: "test-plugin",
+					Version:  "0.0.2",
+					Configurations: map[string]string{
+						"license_key3": "hello",
+					},
+				},
+			},
+		},
+		{
+			name: "updating version",
+			request: &pluginpb.UpdateOrgRetentionPluginConfigRequest{
+				OrgID:    utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
+				PluginID: "test-plugin",
+				Version:  &types.StringValue{Value: "0.0.2"},
+			},
+			expectedOrgConfigs: []orgConfig{
+				orgConfig{
+					OrgID:    "223e4567-e89b-12d3-a456-426655440000",
+					PluginID: "test-plugin",
+					Version:  "0.0.2",
+					Configurations: map[string]string{
+						"license_key2": "12345",
+					},
+				},
+				orgConfig{
+					OrgID:    "223e4567-e89b-12d3-a456-426655440001",
+					PluginID: "test-plugin",
+					Version:  "0.0.2",
+					Configurations: map[string]string{
+						"license_key3": "hello",
+					},
+				},
+			},
+		},
+		{
+			name: "enabling already enabled plugin",
+			request: &pluginpb.UpdateOrgRetentionPluginConfigRequest{
+				OrgID:    utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440001"),
+				PluginID: "test-plugin",
+				Configurations: map[string]string{
+					"abcd": "hello",
+				},
+				Enabled: &types.BoolValue{Value: true},
+				Version: &types.StringValue{Value: "0.0.1"},
+			},
+			expectedOrgConfigs: []orgConfig{
+				orgConfig{
+					OrgID:    "223e4567-e89b-12d3-a456-426655440000",
+					PluginID: "test-plugin",
+					Version:  "0.0.3",
+					Configurations: map[string]string{
+						"license_key2": "12345",
+					},
+				},
+				orgConfig{
+					OrgID:    "223e4567-e89b-12d3-a456-426655440001",
+					PluginID: "test-plugin",
+					Version:  "0.0.1",
+					Configurations: map[string]string{
+						"abcd": "hello",
+					},
+				},
+			},
+		},
+		{
+			name: "updating version and config",
+			request: &pluginpb.UpdateOrgRetentionPluginConfigRequest{
+				OrgID:    utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
+				PluginID: "test-plugin",
+				Version:  &types.StringValue{Value: "0.0.2"},
+				Configurations: map[string]string{
+					"abcd": "hello",
+				},
+			},
+			expectedOrgConfigs: []orgConfig{
+				orgConfig{
+					OrgID:    "223e4567-e89b-12d3-a456-426655440000",
+					PluginID: "test-plugin",
+					Version:  "0.0.2",
+					Configurations: map[string]string{
+						"abcd": "hello",
+					},
+				},
+				orgConfig{
+					OrgID:    "223e4567-e89b-12d3-a456-426655440001",
+					PluginID: "test-plugin",
 					Version:  "0.0.2",
 					Configurations: map[string]string{
 						"license_key3": "hello",
@@ -377,70 +1457,4422 @@ func TestServer_UpdateRetentionConfigs(t *testing.T) {
 				},
 			},
 		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mustLoadTestData(db)
+
+			s := controllers.New(db, "test")
+			resp, err := s.UpdateOrgRetentionPluginConfig(context.Background(), test.request)
+
+			require.NoError(t, err)
+			require.NotNil(t, resp)
+
+			assert.Equal(t, &pluginpb.UpdateOrgRetentionPluginConfigResponse{}, resp)
+
+			query := `SELECT org_id, plugin_id, version, PGP_SYM_DECRYPT(configurations, $1::text) as configurations FROM org_data_retention_plugins WHERE enabled='true'`
+			rows, err := db.Queryx(query, "test")
+			require.Nil(t, err)
+
+			defer rows.Close()
+			plugins := []orgConfig{}
+			for rows.Next() {
+				var p orgConfig
+				err = rows.StructScan(&p)
+				require.Nil(t, err)
+
+				var cm map[string]string
+				err = json.Unmarshal(p.ConfigurationBytes, &cm)
+				require.Nil(t, err)
+				p.Configurations = cm
+				p.ConfigurationBytes = nil
+
+				plugins = append(plugins, p)
+			}
+
+			assert.ElementsMatch(t, test.expectedOrgConfigs, plugins)
+		})
+	}
+}
+
+func TestServer_UpdateOrgRetentionPluginConfigReenable(t *testing.T) {
+	mustLoadTestData(db)
+
+	s := controllers.New(db, "test")
+	orgID := utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000")
+	_, err := s.UpdateOrgRetentionPluginConfig(context.Background(), &pluginpb.UpdateOrgRetentionPluginConfigRequest{
+		OrgID:    orgID,
+		PluginID: "test-plugin",
+		Enabled:  &types.BoolValue{Value: false},
+	})
+	require.NoError(t, err)
+
+	pluginsResp, err := s.GetRetentionPluginsForOrg(context.Background(), &pluginpb.GetRetentionPluginsForOrgRequest{OrgID: orgID})
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(pluginsResp.Plugins))
+	_, err = s.GetOrgRetentionPluginConfig(context.Background(), &pluginpb.GetOrgRetentionPluginConfigRequest{
+		OrgID:    orgID,
+		PluginID: "test-plugin",
+	})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	// Re-enabling without specifying configs restores the configs the org had before disabling the plugin.
+	_, err = s.UpdateOrgRetentionPluginConfig(context.Background(), &pluginpb.UpdateOrgRetentionPluginConfigRequest{
+		OrgID:    orgID,
+		PluginID: "test-plugin",
+		Enabled:  &types.BoolValue{Value: true},
+		Version:  &types.StringValue{Value: "0.0.3"},
+	})
+	require.NoError(t, err)
+
+	pluginsResp, err = s.GetRetentionPluginsForOrg(context.Background(), &pluginpb.GetRetentionPluginsForOrgRequest{OrgID: orgID})
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(pluginsResp.Plugins))
+	configResp, err := s.GetOrgRetentionPluginConfig(context.Background(), &pluginpb.GetOrgRetentionPluginConfigRequest{
+		OrgID:    orgID,
+		PluginID: "test-plugin",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"license_key2": "12345"}, configResp.Configurations)
+}
+
+func TestServer_UpdateOrgRetentionPluginConfigRollback(t *testing.T) {
+	tests := []struct {
+		name string
+		// failingTable is the table whose writes fail, after the org's config has been written.
+		failingTable string
+		orgID        string
+		request      *pluginpb.UpdateOrgRetentionPluginConfigRequest
+	}{
+		{
+			name:         "preset script creation fails",
+			failingTable: "plugin_retention_scripts",
+			orgID:        "223e4567-e89b-12d3-a456-426655440005",
+			request: &pluginpb.UpdateOrgRetentionPluginConfigRequest{
+				PluginID:       "test-plugin",
+				Configurations: map[string]string{"license_key": "abcd"},
+				Enabled:        &types.BoolValue{Value: true},
+				Version:        &types.StringValue{Value: "0.0.1"},
+			},
+		},
+		{
+			name:         "config history fails",
+			failingTable: "org_data_retention_plugin_config_history",
+			orgID:        "223e4567-e89b-12d3-a456-426655440000",
+			request: &pluginpb.UpdateOrgRetentionPluginConfigRequest{
+				PluginID:       "test-plugin",
+				Configurations: map[string]string{"license_key3": "abcd"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mustLoadTestData(db)
+			db.MustExec(`CREATE OR REPLACE FUNCTION fail_write() RETURNS trigger AS $$ BEGIN RAISE EXCEPTION 'injected failure'; END; $$ LANGUAGE plpgsql`)
+			db.MustExec(fmt.Sprintf(`CREATE TRIGGER fail_write BEFORE INSERT OR UPDATE ON %s FOR EACH ROW EXECUTE PROCEDURE fail_write()`, test.failingTable))
+			defer db.MustExec(fmt.Sprintf(`DROP TRIGGER fail_write ON %s`, test.failingTable))
+
+			stateQuery := `SELECT version, PGP_SYM_DECRYPT(configurations, 'test') FROM org_data_retention_plugins WHERE org_id=$1 AND plugin_id=$2`
+			var origVersion, origConfig sql.NullString
+			err := db.QueryRowx(stateQuery, test.orgID, test.request.PluginID).Scan(&origVersion, &origConfig)
+			if err != sql.ErrNoRows {
+				require.NoError(t, err)
+			}
+			var origScripts int
+			require.NoError(t, db.Get(&origScripts, `SELECT COUNT(*) FROM plugin_retention_scripts WHERE org_id=$1`, test.orgID))
+
+			s := controllers.New(db, "test")
+			test.request.OrgID = utils.ProtoFromUUIDStrOrNil(test.orgID)
+			_, err = s.UpdateOrgRetentionPluginConfig(context.Background(), test.request)
+			assert.Equal(t, codes.Internal, status.Code(err))
+
+			// Nothing which was written before the failure is committed.
+			var version, config sql.NullString
+			err = db.QueryRowx(stateQuery, test.orgID, test.request.PluginID).Scan(&version, &config)
+			if err != sql.ErrNoRows {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, origVersion, version)
+			assert.Equal(t, origConfig, config)
+
+			var scripts int
+			require.NoError(t, db.Get(&scripts, `SELECT COUNT(*) FROM plugin_retention_scripts WHERE org_id=$1`, test.orgID))
+			assert.Equal(t, origScripts, scripts)
+		})
+	}
+}
+
+func TestServer_UpdateOrgRetentionPluginConfigRateLimit(t *testing.T) {
+	mustLoadTestData(db)
+
+	s := controllers.New(db, "test", controllers.WithOrgConfigWriteRateLimit(1, 2))
+	update := func(orgID string) error {
+		_, err := s.UpdateOrgRetentionPluginConfig(context.Background(), &pluginpb.UpdateOrgRetentionPluginConfigRequest{
+			OrgID:          utils.ProtoFromUUIDStrOrNil(orgID),
+			PluginID:       "test-plugin",
+			Configurations: map[string]string{"license_key3": "abcd"},
+		})
+		return err
+	}
+
+	// The org can write up to the burst at once.
+	require.NoError(t, update("223e4567-e89b-12d3-a456-426655440000"))
+	require.NoError(t, update("223e4567-e89b-12d3-a456-426655440000"))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(update("223e4567-e89b-12d3-a456-426655440000")))
+
+	// Other orgs are limited separately.
+	require.NoError(t, update("223e4567-e89b-12d3-a456-426655440001"))
+
+	// A rate of 0 disables the limit.
+	s = controllers.New(db, "test", controllers.WithOrgConfigWriteRateLimit(0, 0))
+	for i := 0; i < 5; i++ {
+		require.NoError(t, update("223e4567-e89b-12d3-a456-426655440000"))
+	}
+
+	// Script writes and deletions count towards the same limit.
+	s = controllers.New(db, "test", controllers.WithOrgConfigWriteRateLimit(1, 1))
+	orgID := utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000")
+	_, err := s.UpdateRetentionScript(context.Background(), &pluginpb.UpdateRetentionScriptRequest{
+		OrgID:       orgID,
+		ScriptID:    utils.ProtoFromUUIDStrOrNil("123e4567-e89b-12d3-a456-426655440000"),
+		Description: &types.StringValue{Value: "updated"},
+	})
+	require.NoError(t, err)
+	_, err = s.SetPresetScriptOverride(context.Background(), &pluginpb.SetPresetScriptOverrideRequest{
+		OrgID:    orgID,
+		ScriptID: utils.ProtoFromUUIDStrOrNil("123e4567-e89b-12d3-a456-426655440000"),
+	})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	_, err = s.DeleteOrgRetentionConfig(context.Background(), &pluginpb.DeleteOrgRetentionConfigRequest{OrgID: orgID})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
+
+func TestServer_UpdateOrgRetentionPluginConfigPGPOptions(t *testing.T) {
+	mustLoadTestData(db)
+
+	orgID := utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000")
+	servers := []*controllers.Server{
+		controllers.New(db, "test"),
+		controllers.New(db, "test", controllers.WithPGPOptions("aes256", 2)),
+		controllers.New(db, "test", controllers.WithPGPOptions("bf", 1)),
+	}
+
+	// Configs written with any algorithm can be read by servers configured with any other algorithm.
+	for i, writer := range servers {
+		value := fmt.Sprintf("key-%d", i)
+		_, err := writer.UpdateOrgRetentionPluginConfig(context.Background(), &pluginpb.UpdateOrgRetentionPluginConfigRequest{
+			OrgID:          orgID,
+			PluginID:       "test-plugin",
+			Configurations: map[string]string{"license_key3": value},
+		})
+		require.NoError(t, err)
+
+		for _, reader := range servers {
+			resp, err := reader.GetOrgRetentionPluginConfig(context.Background(), &pluginpb.GetOrgRetentionPluginConfigRequest{
+				OrgID:    orgID,
+				PluginID: "test-plugin",
+			})
+			require.NoError(t, err)
+			assert.Equal(t, map[string]string{"license_key3": value}, resp.Configurations)
+		}
+	}
+}
+
+func TestServer_TestRetentionPluginConfig(t *testing.T) {
+	mustLoadTestData(db)
+
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var configs map[string]string
+		err := json.NewDecoder(r.Body).Decode(&configs)
+		if err != nil || configs["license_key4"] != "valid" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	s := controllers.New(db, "test", controllers.WithHealthCheckClient(ts.Client()))
+	_, err := s.CreatePluginRelease(context.Background(), &pluginpb.CreatePluginReleaseRequest{
+		Name:    "test_plugin",
+		ID:      "test-plugin",
+		Version: "0.0.4",
+		RetentionConfig: &pluginpb.RetentionReleaseConfig{
+			Configurations:         map[string]string{"license_key4": "The license key"},
+			RequiredConfigurations: []string{"license_key4"},
+			HealthCheckURL:         ts.URL,
+		},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		orgID          string
+		version        string
+		configurations map[string]string
+		expectedResult pluginpb.TestRetentionPluginConfigResponse_Result
+		expectedFields []string
+		expectedCode   codes.Code
+	}{
+		{
+			name:           "no health check",
+			orgID:          "223e4567-e89b-12d3-a456-426655440000",
+			expectedResult: pluginpb.RESULT_NOT_SUPPORTED,
+		},
+		{
+			name:           "missing required config",
+			orgID:          "223e4567-e89b-12d3-a456-426655440000",
+			version:        "0.0.4",
+			expectedResult: pluginpb.RESULT_INVALID_CONFIG,
+			expectedFields: []string{"configurations.license_key4"},
+		},
+		{
+			name:           "valid config",
+			orgID:          "223e4567-e89b-12d3-a456-426655440000",
+			version:        "0.0.4",
+			configurations: map[string]string{"license_key4": "valid"},
+			expectedResult: pluginpb.RESULT_SUCCESS,
+		},
+		{
+			name:           "rejected config",
+			orgID:          "223e4567-e89b-12d3-a456-426655440000",
+			version:        "0.0.4",
+			configurations: map[string]string{"license_key4": "expired"},
+			expectedResult: pluginpb.RESULT_FAILURE,
+		},
+		{
+			name:           "plugin not enabled, without version",
+			orgID:          "223e4567-e89b-12d3-a456-426655440009",
+			configurations: map[string]string{"license_key4": "valid"},
+			expectedCode:   codes.InvalidArgument,
+		},
+		{
+			name:           "plugin not enabled, with version",
+			orgID:          "223e4567-e89b-12d3-a456-426655440009",
+			version:        "0.0.4",
+			configurations: map[string]string{"license_key4": "valid"},
+			expectedResult: pluginpb.RESULT_SUCCESS,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, err := s.TestRetentionPluginConfig(context.Background(), &pluginpb.TestRetentionPluginConfigRequest{
+				OrgID:          utils.ProtoFromUUIDStrOrNil(test.orgID),
+				PluginID:       "test-plugin",
+				Version:        test.version,
+				Configurations: test.configurations,
+			})
+			if test.expectedCode != codes.OK {
+				assert.Equal(t, test.expectedCode, status.Code(err))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedResult, resp.Result)
+			assert.Equal(t, test.expectedFields, resp.InvalidFields)
+		})
+	}
+
+	// Testing a config does not save it.
+	configResp, err := s.GetOrgRetentionPluginConfig(context.Background(), &pluginpb.GetOrgRetentionPluginConfigRequest{
+		OrgID:    utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
+		PluginID: "test-plugin",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"license_key2": "12345"}, configResp.Configurations)
+}
+
+func TestServer_ExportRetentionScriptsArchive(t *testing.T) {
+	mustLoadTestData(db)
+
+	s := controllers.New(db, "test")
+	resp, err := s.ExportRetentionScriptsArchive(context.Background(), &pluginpb.ExportRetentionScriptsArchiveRequest{
+		OrgID: utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
+	})
+	require.NoError(t, err)
+	require.NotNil(t, resp)
+
+	zr, err := zip.NewReader(bytes.NewReader(resp.Archive), int64(len(resp.Archive)))
+	require.NoError(t, err)
+
+	files := make(map[string]string)
+	for _, f := range zr.File {
+		r, err := f.Open()
+		require.NoError(t, err)
+		contents, err := ioutil.ReadAll(r)
+		require.NoError(t, err)
+		r.Close()
+		files[f.Name] = string(contents)
+	}
+	require.Equal(t, 3, len(files))
+
+	var manifest []struct {
+		FileName    string   `json:"file_name"`
+		ScriptID    string   `json:"script_id"`
+		ScriptName  string   `json:"script_name"`
+		Description string   `json:"description"`
+		FrequencyS  int64    `json:"frequency_s"`
+		ClusterIDs  []string `json:"cluster_ids"`
+		Enabled     bool     `json:"enabled"`
+	}
+	require.Contains(t, files, "manifest.json")
+	err = json.Unmarshal([]byte(files["manifest.json"]), &manifest)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(manifest))
+
+	fileNames := []string{}
+	scripts := make(map[string]string)
+	for _, m := range manifest {
+		fileNames = append(fileNames, m.FileName)
+		require.Contains(t, files, m.FileName)
+		scripts[m.ScriptName] = files[m.FileName]
+
+		if m.ScriptName == "http data" {
+			assert.Equal(t, "123e4567-e89b-12d3-a456-426655440000", m.ScriptID)
+			assert.Equal(t, "This is a script to get http data", m.Description)
+			assert.Equal(t, int64(10), m.FrequencyS)
+			assert.Equal(t, []string{"323e4567-e89b-12d3-a456-426655440000"}, m.ClusterIDs)
+			assert.True(t, m.Enabled)
+		}
+	}
+	assert.ElementsMatch(t, []string{"http_data.pxl", "http_data_1.pxl"}, fileNames)
+	assert.Equal(t, map[string]string{
+		"http data": "http script",
+		"http/data": "http script 2",
+	}, scripts)
+}
+
+func TestServer_GetRetentionScriptsDue(t *testing.T) {
+	mustLoadTestData(db)
+	db.MustExec(`UPDATE plugin_retention_scripts SET last_run_at=$1, next_run_at=$1::timestamp + frequency_s * interval '1 second' WHERE script_id=$2`, "2021-01-01 00:00:00", "123e4567-e89b-12d3-a456-426655440002")
+
+	tests := []struct {
+		name            string
+		before          time.Time
+		expectedScripts []string
+	}{
+		{
+			name:            "never run",
+			before:          time.Date(2021, 1, 1, 0, 0, 10, 0, time.UTC),
+			expectedScripts: []string{"123e4567-e89b-12d3-a456-426655440000"},
+		},
+		{
+			name:   "due after frequency",
+			before: time.Date(2021, 1, 1, 0, 1, 0, 0, time.UTC),
+			expectedScripts: []string{
+				"123e4567-e89b-12d3-a456-426655440000",
+				"123e4567-e89b-12d3-a456-426655440002",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := controllers.New(db, "test")
+			before, _ := types.TimestampProto(test.before)
+			resp, err := s.GetRetentionScriptsDue(context.Background(), &pluginpb.GetRetentionScriptsDueRequest{
+				BeforeTimestamp: before,
+			})
+			require.NoError(t, err)
+
+			scriptIDs := []string{}
+			for _, sc := range resp.Scripts {
+				scriptIDs = append(scriptIDs, utils.ProtoToUUIDStr(sc.Script.Script.ScriptID))
+			}
+			assert.Equal(t, test.expectedScripts, scriptIDs)
+		})
+	}
+
+	s := controllers.New(db, "test")
+	resp, err := s.GetRetentionScriptsDue(context.Background(), &pluginpb.GetRetentionScriptsDueRequest{
+		BeforeTimestamp: types.TimestampNow(),
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(resp.Scripts))
+
+	neverRun := resp.Scripts[0]
+	assert.Equal(t, "223e4567-e89b-12d3-a456-426655440000", utils.ProtoToUUIDStr(neverRun.OrgID))
+	assert.Equal(t, "http data", neverRun.Script.Script.ScriptName)
+	assert.Equal(t, "http script", neverRun.Script.Contents)
+	assert.Nil(t, neverRun.LastRunAt)
+	assert.Nil(t, neverRun.NextRunAt)
+
+	lastRun, _ := types.TimestampProto(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	nextRun, _ := types.TimestampProto(time.Date(2021, 1, 1, 0, 0, 30, 0, time.UTC))
+	assert.Equal(t, lastRun, resp.Scripts[1].LastRunAt)
+	assert.Equal(t, nextRun, resp.Scripts[1].NextRunAt)
+}
+
+func TestServer_GetRetentionScriptsDueOverriddenPreset(t *testing.T) {
+	mustLoadTestData(db)
+	db.MustExec(`UPDATE plugin_retention_scripts SET override_body=$1 WHERE script_id=$2`, "overridden http script", "123e4567-e89b-12d3-a456-426655440000")
+
+	s := controllers.New(db, "test")
+	resp, err := s.GetRetentionScriptsDue(context.Background(), &pluginpb.GetRetentionScriptsDueRequest{
+		BeforeTimestamp: types.TimestampNow(),
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(resp.Scripts))
+	assert.Equal(t, "123e4567-e89b-12d3-a456-426655440000", utils.ProtoToUUIDStr(resp.Scripts[0].Script.Script.ScriptID))
+	assert.True(t, resp.Scripts[0].Script.Script.IsPreset)
+	assert.Equal(t, "overridden http script", resp.Scripts[0].Script.Contents)
+}
+
+func TestServer_GetRetentionScriptsDuePaginated(t *testing.T) {
+	mustLoadTestData(db)
+	db.MustExec(`UPDATE plugin_retention_scripts SET last_run_at=$1, next_run_at=$1::timestamp + frequency_s * interval '1 second' WHERE script_id=$2`, "2021-01-01 00:00:00", "123e4567-e89b-12d3-a456-426655440002")
+	insertScript := `INSERT INTO plugin_retention_scripts(org_id, plugin_id, plugin_version, script_id, script_name, description, contents, frequency_s, enabled, is_preset) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+	db.MustExec(insertScript, "223e4567-e89b-12d3-a456-426655440000", "test-plugin", "0.0.3", "123e4567-e89b-12d3-a456-426655440020", "another http data", "This is another script", "http script 3", 10, true, false)
+
+	s := controllers.New(db, "test")
+	before := types.TimestampNow()
+	var scriptIDs []string
+	token := ""
+	for {
+		resp, err := s.GetRetentionScriptsDue(context.Background(), &pluginpb.GetRetentionScriptsDueRequest{
+			BeforeTimestamp: before,
+			PageSize:        1,
+			PageToken:       token,
+		})
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(resp.Scripts), 1)
+		for _, sc := range resp.Scripts {
+			scriptIDs = append(scriptIDs, utils.ProtoToUUIDStr(sc.Script.Script.ScriptID))
+		}
+		if resp.NextPageToken == "" {
+			break
+		}
+		token = resp.NextPageToken
+		// Scripts which are run between page fetches should not cause other scripts to be skipped.
+		db.MustExec(`UPDATE plugin_retention_scripts SET last_run_at=NOW(), next_run_at=NOW() + frequency_s * interval '1 second' WHERE script_id=$1`, scriptIDs[len(scriptIDs)-1])
+	}
+	// Scripts which have never been run come first, ordered by ID.
+	assert.Equal(t, []string{
+		"123e4567-e89b-12d3-a456-426655440000",
+		"123e4567-e89b-12d3-a456-426655440020",
+		"123e4567-e89b-12d3-a456-426655440002",
+	}, scriptIDs)
+
+	_, err := s.GetRetentionScriptsDue(context.Background(), &pluginpb.GetRetentionScriptsDueRequest{
+		BeforeTimestamp: before,
+		PageToken:       "not-a-token",
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServer_SetPluginMaintenanceMode(t *testing.T) {
+	mustLoadTestData(db)
+
+	sCtx := authcontext.New()
+	sCtx.Claims = svcutils.GenerateJWTForService("vzmgr", "withpixie.ai")
+	serviceCtx := authcontext.NewContext(context.Background(), sCtx)
+
+	s := controllers.New(db, "test")
+	orgID := utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000")
+
+	_, err := s.SetPluginMaintenanceMode(context.Background(), &pluginpb.SetPluginMaintenanceModeRequest{
+		PluginID: "test-plugin",
+		Active:   true,
+	})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = s.SetPluginMaintenanceMode(serviceCtx, &pluginpb.SetPluginMaintenanceModeRequest{
+		PluginID: "test-plugin",
+		Active:   true,
+	})
+	require.NoError(t, err)
+
+	// Scripts are reported as paused, but remain enabled.
+	scriptsResp, err := s.GetRetentionScripts(context.Background(), &pluginpb.GetRetentionScriptsRequest{OrgID: orgID})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(scriptsResp.Scripts))
+	assert.True(t, scriptsResp.Scripts[0].PausedForMaintenance)
+	assert.True(t, scriptsResp.Scripts[0].Enabled)
+	assert.True(t, scriptsResp.Scripts[1].PausedForMaintenance)
+
+	scriptResp, err := s.GetRetentionScript(context.Background(), &pluginpb.GetRetentionScriptRequest{
+		OrgID:    orgID,
+		ScriptID: utils.ProtoFromUUIDStrOrNil("123e4567-e89b-12d3-a456-426655440000"),
+	})
+	require.NoError(t, err)
+	assert.True(t, scriptResp.Script.Script.PausedForMaintenance)
+
+	dueResp, err := s.GetRetentionScriptsDue(context.Background(), &pluginpb.GetRetentionScriptsDueRequest{
+		BeforeTimestamp: types.TimestampNow(),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(dueResp.Scripts))
+
+	_, err = s.SetPluginMaintenanceMode(serviceCtx, &pluginpb.SetPluginMaintenanceModeRequest{
+		PluginID: "test-plugin",
+		Active:   false,
+	})
+	require.NoError(t, err)
+
+	scriptsResp, err = s.GetRetentionScripts(context.Background(), &pluginpb.GetRetentionScriptsRequest{OrgID: orgID})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(scriptsResp.Scripts))
+	assert.False(t, scriptsResp.Scripts[0].PausedForMaintenance)
+	assert.False(t, scriptsResp.Scripts[1].PausedForMaintenance)
+
+	dueResp, err = s.GetRetentionScriptsDue(context.Background(), &pluginpb.GetRetentionScriptsDueRequest{
+		BeforeTimestamp: types.TimestampNow(),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(dueResp.Scripts))
+
+	_, err = s.SetPluginMaintenanceMode(serviceCtx, &pluginpb.SetPluginMaintenanceModeRequest{
+		PluginID: "nonexistent-plugin",
+		Active:   true,
+	})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestServer_GetActiveRetentionWorkload(t *testing.T) {
+	mustLoadTestData(db)
+	sCtx := authcontext.New()
+	sCtx.Claims = svcutils.GenerateJWTForService("vzmgr", "withpixie.ai")
+	serviceCtx := authcontext.NewContext(context.Background(), sCtx)
+
+	s := controllers.New(db, "test")
+	resp, err := s.GetActiveRetentionWorkload(context.Background(), &pluginpb.GetActiveRetentionWorkloadRequest{})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(resp.Workloads))
+
+	// Disabled scripts are excluded.
+	w := resp.Workloads[0]
+	assert.Equal(t, "223e4567-e89b-12d3-a456-426655440000", utils.ProtoToUUIDStr(w.OrgID))
+	assert.Equal(t, "test-plugin", w.PluginID)
+	assert.Equal(t, "0.0.3", w.Version)
+	assert.Equal(t, map[string]string{"license_key2": "12345"}, w.Configurations)
+	require.Equal(t, 1, len(w.Scripts))
+	assert.Equal(t, "http data", w.Scripts[0].Script.ScriptName)
+	assert.Equal(t, "http script", w.Scripts[0].Contents)
+
+	w = resp.Workloads[1]
+	assert.Equal(t, "223e4567-e89b-12d3-a456-426655440001", utils.ProtoToUUIDStr(w.OrgID))
+	assert.Equal(t, "0.0.2", w.Version)
+	assert.Equal(t, map[string]string{"license_key3": "hello"}, w.Configurations)
+	require.Equal(t, 1, len(w.Scripts))
+	assert.Equal(t, "dns data", w.Scripts[0].Script.ScriptName)
+
+	// Orgs whose only active script is paused are excluded.
+	db.MustExec(`UPDATE plugin_retention_scripts SET enabled='false' WHERE script_id=$1`, "123e4567-e89b-12d3-a456-426655440002")
+	resp, err = s.GetActiveRetentionWorkload(context.Background(), &pluginpb.GetActiveRetentionWorkloadRequest{})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(resp.Workloads))
+	assert.Equal(t, "223e4567-e89b-12d3-a456-426655440000", utils.ProtoToUUIDStr(resp.Workloads[0].OrgID))
+
+	// Plugins in maintenance mode are excluded.
+	_, err = s.SetPluginMaintenanceMode(serviceCtx, &pluginpb.SetPluginMaintenanceModeRequest{
+		PluginID: "test-plugin",
+		Active:   true,
+	})
+	require.NoError(t, err)
+	resp, err = s.GetActiveRetentionWorkload(context.Background(), &pluginpb.GetActiveRetentionWorkloadRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(resp.Workloads))
+}
+
+func TestServer_GetActiveRetentionWorkloadRendersScripts(t *testing.T) {
+	mustLoadTestData(db)
+	db.MustExec(`UPDATE plugin_retention_scripts SET contents=$1 WHERE script_id=$2`,
+		`px.export(df, license_key="{{ .Config.license_key2 }}")`, "123e4567-e89b-12d3-a456-426655440000")
+	db.MustExec(`UPDATE plugin_retention_scripts SET contents=$1, enabled=true WHERE script_id=$2`,
+		`px.export(df, license_key="{{ .Config.license_key4 }}")`, "123e4567-e89b-12d3-a456-426655440001")
+
+	s := controllers.New(db, "test")
+	resp, err := s.GetActiveRetentionWorkload(context.Background(), &pluginpb.GetActiveRetentionWorkloadRequest{})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(resp.Workloads))
+
+	w := resp.Workloads[0]
+	assert.Equal(t, "223e4567-e89b-12d3-a456-426655440000", utils.ProtoToUUIDStr(w.OrgID))
+	require.Equal(t, 1, len(w.Scripts))
+	assert.Equal(t, `px.export(df, license_key="12345")`, w.Scripts[0].Contents)
+
+	// The script referencing a config which the org hasn't set is reported rather than rendered with an empty value.
+	require.Equal(t, 1, len(w.UnrenderableScripts))
+	assert.Equal(t, "123e4567-e89b-12d3-a456-426655440001", utils.ProtoToUUIDStr(w.UnrenderableScripts[0].ScriptID))
+	assert.Equal(t, "http/data", w.UnrenderableScripts[0].ScriptName)
+	assert.Contains(t, w.UnrenderableScripts[0].Error, "license_key4")
+
+	// Scripts without placeholders are unchanged.
+	require.Equal(t, 1, len(resp.Workloads[1].Scripts))
+	assert.Equal(t, "dns script", resp.Workloads[1].Scripts[0].Contents)
+
+	// Callers which can't read decrypted configs don't get them through the rendered scripts.
+	sCtx := authcontext.New()
+	sCtx.Claims = svcutils.GenerateJWTForService("api", "withpixie.ai")
+	unauthorizedCtx := authcontext.NewContext(context.Background(), sCtx)
+	s = controllers.New(db, "test", controllers.WithDecryptedConfigServices("vzmgr"))
+	resp, err = s.GetActiveRetentionWorkload(unauthorizedCtx, &pluginpb.GetActiveRetentionWorkloadRequest{})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(resp.Workloads))
+
+	w = resp.Workloads[0]
+	assert.NotContains(t, w.Configurations["license_key2"], "12345")
+	assert.Equal(t, 0, len(w.Scripts))
+	require.Equal(t, 2, len(w.UnrenderableScripts))
+	for _, script := range w.UnrenderableScripts {
+		assert.NotContains(t, script.Error, "12345")
+	}
+	require.Equal(t, 1, len(resp.Workloads[1].Scripts))
+	assert.Equal(t, "dns script", resp.Workloads[1].Scripts[0].Contents)
+}
+
+func TestServer_CrossOrgIsolation(t *testing.T) {
+	mustLoadTestData(db)
+
+	// Org 2 has test-plugin enabled, and no scripts. Org 0's config and scripts for the same plugin must never be
+	// returned for it.
+	otherOrgID := utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440002")
+	db.MustExec(`INSERT INTO org_data_retention_plugins(org_id, plugin_id, version, configurations) VALUES ($1, $2, $3, PGP_SYM_ENCRYPT($4, $5))`,
+		"223e4567-e89b-12d3-a456-426655440002", "test-plugin", "0.0.3", []byte(`{"license_key3":"other"}`), "test")
+	orgScriptID := utils.ProtoFromUUIDStrOrNil("123e4567-e89b-12d3-a456-426655440000")
+
+	s := controllers.New(db, "test")
+	ctx := context.Background()
+
+	configResp, err := s.GetOrgRetentionPluginConfig(ctx, &pluginpb.GetOrgRetentionPluginConfigRequest{OrgID: otherOrgID, PluginID: "test-plugin"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"license_key3": "other"}, configResp.Configurations)
+
+	gitOpsResp, err := s.GetOrgConfigForGitOps(ctx, &pluginpb.GetOrgConfigForGitOpsRequest{OrgID: otherOrgID, PluginID: "test-plugin"})
+	require.NoError(t, err)
+	assert.NotContains(t, gitOpsResp.Config, "license_key2")
+
+	_, err = s.GetOrgRetentionPluginConfigAtVersion(ctx, &pluginpb.GetOrgRetentionPluginConfigAtVersionRequest{OrgID: otherOrgID, PluginID: "test-plugin", Version: "0.0.2"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	scriptsResp, err := s.GetRetentionScripts(ctx, &pluginpb.GetRetentionScriptsRequest{OrgID: otherOrgID})
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(scriptsResp.Scripts))
+
+	_, err = s.GetRetentionScript(ctx, &pluginpb.GetRetentionScriptRequest{OrgID: otherOrgID, ScriptID: orgScriptID})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	countsResp, err := s.GetOrgScriptCountsByPlugin(ctx, &pluginpb.GetOrgScriptCountsByPluginRequest{OrgID: otherOrgID})
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(countsResp.Counts))
+
+	_, err = s.SetPresetScriptOverride(ctx, &pluginpb.SetPresetScriptOverrideRequest{OrgID: otherOrgID, ScriptID: orgScriptID, OverrideBody: &types.StringValue{Value: "leak"}})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	// Requests which don't specify an org are rejected, rather than matching any org.
+	_, err = s.GetOrgRetentionPluginConfig(ctx, &pluginpb.GetOrgRetentionPluginConfigRequest{PluginID: "test-plugin"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = s.GetRetentionPluginsForOrg(ctx, &pluginpb.GetRetentionPluginsForOrgRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServer_FindOrgsOnYankedVersions(t *testing.T) {
+	mustLoadTestData(db)
+
+	s := controllers.New(db, "test")
+	orgs, err := s.FindOrgsOnYankedVersions(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(orgs))
+
+	db.MustExec(`UPDATE plugin_releases SET yanked='true' WHERE id=$1 AND version=$2`, "test-plugin", "0.0.2")
+
+	orgs, err = s.FindOrgsOnYankedVersions(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []*controllers.OrgPluginVersion{
+		&controllers.OrgPluginVersion{
+			OrgID:    uuid.FromStringOrNil("223e4567-e89b-12d3-a456-426655440001"),
+			PluginID: "test-plugin",
+			Version:  "0.0.2",
+		},
+	}, orgs)
+}
+
+func TestServer_BumpOrgsOnYankedVersions(t *testing.T) {
+	mustLoadTestData(db)
+	db.MustExec(`UPDATE plugin_releases SET yanked='true' WHERE id=$1 AND version=$2`, "test-plugin", "0.0.2")
+
+	s := controllers.New(db, "test")
+	orgs, err := s.BumpOrgsOnYankedVersions(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []*controllers.OrgPluginVersion{
+		&controllers.OrgPluginVersion{
+			OrgID:    uuid.FromStringOrNil("223e4567-e89b-12d3-a456-426655440001"),
+			PluginID: "test-plugin",
+			Version:  "0.0.3",
+		},
+	}, orgs)
+
+	orgs, err = s.FindOrgsOnYankedVersions(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(orgs))
+}
+
+func TestServer_BumpOrgsOnYankedVersionsSemverStable(t *testing.T) {
+	mustLoadTestData(db)
+
+	s := controllers.New(db, "test")
+	for _, release := range []struct {
+		version string
+		channel string
+	}{
+		{"0.0.9", "stable"},
+		{"0.0.10", "stable"},
+		{"0.0.11", "beta"},
+	} {
+		_, err := s.CreatePluginRelease(context.Background(), &pluginpb.CreatePluginReleaseRequest{
+			Name:            "test_plugin",
+			ID:              "test-plugin",
+			Version:         release.version,
+			ReleaseChannel:  release.channel,
+			RetentionConfig: &pluginpb.RetentionReleaseConfig{},
+		})
+		require.NoError(t, err)
+	}
+	db.MustExec(`UPDATE plugin_releases SET yanked='true' WHERE id=$1 AND version=$2`, "test-plugin", "0.0.2")
+
+	// Orgs are bumped to the latest stable version by semver, rather than to "0.0.9" or to the beta release.
+	orgs, err := s.BumpOrgsOnYankedVersions(context.Background())
+	require.NoError(t, err)
+	require.Len(t, orgs, 1)
+	assert.Equal(t, "0.0.10", orgs[0].Version)
+}
+
+func TestServer_MaterializePresetScripts(t *testing.T) {
+	mustLoadTestData(db)
+
+	s := controllers.New(db, "test")
+	orgID := uuid.FromStringOrNil("223e4567-e89b-12d3-a456-426655440001")
+	// Materializing twice should only create each missing preset script once.
+	for i := 0; i < 2; i++ {
+		err := s.MaterializePresetScripts(context.Background(), orgID, "test-plugin", "0.0.2")
+		require.NoError(t, err)
+	}
+
+	var frequencies []struct {
+		Name       string `db:"script_name"`
+		FrequencyS int64  `db:"frequency_s"`
+	}
+	err := db.Select(&frequencies, `SELECT script_name, frequency_s FROM plugin_retention_scripts WHERE org_id=$1 ORDER BY script_name`, orgID)
+	require.NoError(t, err)
+	require.Len(t, frequencies, 2)
+	// The existing preset script is left as it is.
+	assert.Equal(t, "dns data", frequencies[0].Name)
+	assert.Equal(t, int64(30), frequencies[0].FrequencyS)
+	assert.Equal(t, "dns data 2", frequencies[1].Name)
+	assert.Equal(t, int64(20), frequencies[1].FrequencyS)
+
+	err = s.MaterializePresetScripts(context.Background(), uuid.FromStringOrNil("223e4567-e89b-12d3-a456-426655440002"), "test-plugin", "0.0.2")
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+func TestServer_CloneOrgRetentionConfig(t *testing.T) {
+	mustLoadTestData(db)
+
+	s := controllers.New(db, "test")
+	sourceOrgID := utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440001")
+	targetOrgID := utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440005")
+	resp, err := s.CloneOrgRetentionConfig(context.Background(), &pluginpb.CloneOrgRetentionConfigRequest{
+		SourceOrgID: sourceOrgID,
+		TargetOrgID: targetOrgID,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"test-plugin"}, resp.PluginIDs)
+
+	configResp, err := s.GetOrgRetentionPluginConfig(context.Background(), &pluginpb.GetOrgRetentionPluginConfigRequest{
+		OrgID:    targetOrgID,
+		PluginID: "test-plugin",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"license_key3": "hello"}, configResp.Configurations)
+
+	scriptsResp, err := s.GetRetentionScripts(context.Background(), &pluginpb.GetRetentionScriptsRequest{OrgID: targetOrgID})
+	require.NoError(t, err)
+	scriptNames := []string{}
+	for _, sc := range scriptsResp.Scripts {
+		scriptNames = append(scriptNames, sc.ScriptName)
+	}
+	assert.Equal(t, []string{"dns data", "dns data 2"}, scriptNames)
+
+	// The target org now has configs, which are only replaced if requested.
+	_, err = s.CloneOrgRetentionConfig(context.Background(), &pluginpb.CloneOrgRetentionConfigRequest{
+		SourceOrgID: utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
+		TargetOrgID: targetOrgID,
+	})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+	_, err = s.CloneOrgRetentionConfig(context.Background(), &pluginpb.CloneOrgRetentionConfigRequest{
+		SourceOrgID: utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
+		TargetOrgID: targetOrgID,
+		Overwrite:   true,
+	})
+	require.NoError(t, err)
+	configResp, err = s.GetOrgRetentionPluginConfig(context.Background(), &pluginpb.GetOrgRetentionPluginConfigRequest{
+		OrgID:    targetOrgID,
+		PluginID: "test-plugin",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"license_key2": "12345"}, configResp.Configurations)
+
+	_, err = s.CloneOrgRetentionConfig(context.Background(), &pluginpb.CloneOrgRetentionConfigRequest{
+		SourceOrgID: sourceOrgID,
+		TargetOrgID: sourceOrgID,
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServer_DeleteOrgRetentionConfig(t *testing.T) {
+	mustLoadTestData(db)
+	orgID := "223e4567-e89b-12d3-a456-426655440000"
+	otherOrgID := "223e4567-e89b-12d3-a456-426655440001"
+	db.MustExec(`INSERT INTO org_data_retention_plugin_config_history(org_id, plugin_id, version, configurations) VALUES ($1, $2, $3, PGP_SYM_ENCRYPT($4, $5))`,
+		orgID, "test-plugin", "0.0.2", `{"old_key": "secret"}`, "test")
+
+	s := controllers.New(db, "test")
+	resp, err := s.DeleteOrgRetentionConfig(context.Background(), &pluginpb.DeleteOrgRetentionConfigRequest{
+		OrgID:    utils.ProtoFromUUIDStrOrNil(orgID),
+		PluginID: "test-plugin",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &pluginpb.DeleteOrgRetentionConfigResponse{DeletedPluginConfigs: 1, DeletedScripts: 2}, resp)
+
+	var count int
+	err = db.QueryRow(`SELECT COUNT(*) FROM org_data_retention_plugins WHERE org_id=$1`, orgID).Scan(&count)
+	require.NoError(t, err)
+	assert.Equal(t, 0, count)
+	err = db.QueryRow(`SELECT COUNT(*) FROM plugin_retention_scripts WHERE org_id=$1`, orgID).Scan(&count)
+	require.NoError(t, err)
+	assert.Equal(t, 0, count)
+	err = db.QueryRow(`SELECT COUNT(*) FROM org_data_retention_plugin_config_history WHERE org_id=$1`, orgID).Scan(&count)
+	require.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	// Other orgs are unaffected.
+	err = db.QueryRow(`SELECT COUNT(*) FROM org_data_retention_plugins WHERE org_id=$1`, otherOrgID).Scan(&count)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	// Without a plugin ID, all of the org's config is deleted.
+	resp, err = s.DeleteOrgRetentionConfig(context.Background(), &pluginpb.DeleteOrgRetentionConfigRequest{
+		OrgID: utils.ProtoFromUUIDStrOrNil(otherOrgID),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &pluginpb.DeleteOrgRetentionConfigResponse{DeletedPluginConfigs: 1, DeletedScripts: 1}, resp)
+
+	resp, err = s.DeleteOrgRetentionConfig(context.Background(), &pluginpb.DeleteOrgRetentionConfigRequest{
+		OrgID: utils.ProtoFromUUIDStrOrNil(otherOrgID),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &pluginpb.DeleteOrgRetentionConfigResponse{}, resp)
+
+	// Each deletion is audited.
+	var deletions []struct {
+		OrgID                uuid.UUID `db:"org_id"`
+		PluginID             *string   `db:"plugin_id"`
+		DeletedPluginConfigs int64     `db:"deleted_plugin_configs"`
+		DeletedScripts       int64     `db:"deleted_scripts"`
+	}
+	err = db.Select(&deletions, `SELECT org_id, plugin_id, deleted_plugin_configs, deleted_scripts FROM org_retention_config_deletions ORDER BY deleted_at, deleted_plugin_configs DESC`)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(deletions))
+	assert.Equal(t, orgID, deletions[0].OrgID.String())
+	require.NotNil(t, deletions[0].PluginID)
+	assert.Equal(t, "test-plugin", *deletions[0].PluginID)
+	assert.Equal(t, int64(2), deletions[0].DeletedScripts)
+	assert.Equal(t, otherOrgID, deletions[1].OrgID.String())
+	assert.Nil(t, deletions[1].PluginID)
+	assert.Equal(t, int64(1), deletions[1].DeletedPluginConfigs)
+
+	_, err = s.DeleteOrgRetentionConfig(context.Background(), &pluginpb.DeleteOrgRetentionConfigRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServer_GetRetentionScripts(t *testing.T) {
+	mustLoadTestData(db)
+
+	s := controllers.New(db, "test")
+	resp, err := s.GetRetentionScripts(context.Background(), &pluginpb.GetRetentionScriptsRequest{
+		OrgID: utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &pluginpb.GetRetentionScriptsResponse{
+		Scripts: []*pluginpb.RetentionScript{
+			&pluginpb.RetentionScript{
+				ScriptID:    utils.ProtoFromUUIDStrOrNil("123e4567-e89b-12d3-a456-426655440000"),
+				ScriptName:  "http data",
+				Description: "This is a script to get http data",
+				FrequencyS:  10,
+				ClusterIDs: []*uuidpb.UUID{
+					utils.ProtoFromUUIDStrOrNil("323e4567-e89b-12d3-a456-426655440000"),
+				},
+				PluginId: "test-plugin",
+				Enabled:  true,
+				IsPreset: true,
+			},
+			&pluginpb.RetentionScript{
+				ScriptID:    utils.ProtoFromUUIDStrOrNil("123e4567-e89b-12d3-a456-426655440001"),
+				ScriptName:  "http/data",
+				Description: "This is another script to get http data",
+				FrequencyS:  20,
+				ClusterIDs:  []*uuidpb.UUID{},
+				PluginId:    "test-plugin",
+				Enabled:     false,
+				IsPreset:    false,
+			},
+		},
+	}, resp)
+}
+
+type fakeRetentionScriptsStream struct {
+	grpc.ServerStream
+	ctx       context.Context
+	responses []*pluginpb.StreamRetentionScriptsResponse
+}
+
+func (f *fakeRetentionScriptsStream) Context() context.Context {
+	return f.ctx
+}
+
+func (f *fakeRetentionScriptsStream) Send(resp *pluginpb.StreamRetentionScriptsResponse) error {
+	f.responses = append(f.responses, resp)
+	return nil
+}
+
+func TestServer_StreamRetentionScripts(t *testing.T) {
+	tests := []struct {
+		name            string
+		orgID           string
+		batchSize       int32
+		expectedBatches [][]string
+		expectedCode    codes.Code
+	}{
+		{
+			name:            "default batch size",
+			orgID:           "223e4567-e89b-12d3-a456-426655440000",
+			expectedBatches: [][]string{{"http data", "http/data"}},
+		},
+		{
+			name:            "multiple batches",
+			orgID:           "223e4567-e89b-12d3-a456-426655440000",
+			batchSize:       1,
+			expectedBatches: [][]string{{"http data"}, {"http/data"}},
+		},
+		{
+			name:            "no scripts",
+			orgID:           "223e4567-e89b-12d3-a456-426655440002",
+			expectedBatches: [][]string{},
+		},
+		{
+			name:         "negative batch size",
+			orgID:        "223e4567-e89b-12d3-a456-426655440000",
+			batchSize:    -1,
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "missing org",
+			expectedCode: codes.InvalidArgument,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mustLoadTestData(db)
+
+			s := controllers.New(db, "test")
+			srv := &fakeRetentionScriptsStream{ctx: context.Background()}
+			err := s.StreamRetentionScripts(&pluginpb.StreamRetentionScriptsRequest{
+				OrgID:     utils.ProtoFromUUIDStrOrNil(test.orgID),
+				BatchSize: test.batchSize,
+			}, srv)
+			assert.Equal(t, test.expectedCode, status.Code(err))
+			if test.expectedCode != codes.OK {
+				return
+			}
+
+			batches := [][]string{}
+			for _, resp := range srv.responses {
+				names := []string{}
+				for _, script := range resp.Scripts {
+					names = append(names, script.ScriptName)
+				}
+				batches = append(batches, names)
+			}
+			assert.Equal(t, test.expectedBatches, batches)
+		})
+	}
+}
+
+func TestServer_RecordScriptRun(t *testing.T) {
+	mustLoadTestData(db)
+
+	s := controllers.New(db, "test")
+	runAt, _ := types.TimestampProto(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	_, err := s.RecordScriptRun(context.Background(), &pluginpb.RecordScriptRunRequest{
+		ScriptID: utils.ProtoFromUUIDStrOrNil("123e4567-e89b-12d3-a456-426655440000"),
+		Status:   pluginpb.RUN_STATUS_FAILURE,
+		Error:    "failed to connect to export URL",
+		RunAt:    runAt,
+	})
+	require.NoError(t, err)
+
+	resp, err := s.GetRetentionScripts(context.Background(), &pluginpb.GetRetentionScriptsRequest{
+		OrgID: utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(resp.Scripts))
+	assert.Equal(t, runAt, resp.Scripts[0].LastRunAt)
+	assert.Equal(t, pluginpb.RUN_STATUS_FAILURE, resp.Scripts[0].LastRunStatus)
+	assert.Equal(t, "failed to connect to export URL", resp.Scripts[0].LastError)
+	assert.Nil(t, resp.Scripts[1].LastRunAt)
+	assert.Equal(t, pluginpb.RUN_STATUS_UNKNOWN, resp.Scripts[1].LastRunStatus)
+
+	_, err = s.RecordScriptRun(context.Background(), &pluginpb.RecordScriptRunRequest{
+		ScriptID: utils.ProtoFromUUIDStrOrNil("123e4567-e89b-12d3-a456-426655440000"),
+		Status:   pluginpb.RUN_STATUS_SUCCESS,
+		RunAt:    runAt,
+	})
+	require.NoError(t, err)
+
+	resp, err = s.GetRetentionScripts(context.Background(), &pluginpb.GetRetentionScriptsRequest{
+		OrgID: utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, pluginpb.RUN_STATUS_SUCCESS, resp.Scripts[0].LastRunStatus)
+	assert.Equal(t, "", resp.Scripts[0].LastError)
+
+	_, err = s.RecordScriptRun(context.Background(), &pluginpb.RecordScriptRunRequest{
+		ScriptID: utils.ProtoFromUUIDStrOrNil("123e4567-e89b-12d3-a456-426655449999"),
+		Status:   pluginpb.RUN_STATUS_SUCCESS,
+	})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestServer_GetRetentionScriptRunHistory(t *testing.T) {
+	mustLoadTestData(db)
+
+	s := controllers.New(db, "test")
+	orgID := utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000")
+	scriptID := utils.ProtoFromUUIDStrOrNil("123e4567-e89b-12d3-a456-426655440000")
+
+	resp, err := s.GetRetentionScriptRunHistory(context.Background(), &pluginpb.GetRetentionScriptRunHistoryRequest{
+		OrgID:    orgID,
+		ScriptID: scriptID,
+	})
+	require.NoError(t, err)
+	assert.Empty(t, resp.Runs)
+
+	runAts := make([]*types.Timestamp, 3)
+	for i := range runAts {
+		runAts[i], _ = types.TimestampProto(time.Date(2021, 1, 1, i, 0, 0, 0, time.UTC))
+	}
+	_, err = s.RecordScriptRun(context.Background(), &pluginpb.RecordScriptRunRequest{
+		ScriptID:   scriptID,
+		Status:     pluginpb.RUN_STATUS_SUCCESS,
+		RunAt:      runAts[0],
+		DurationMs: 1500,
+	})
+	require.NoError(t, err)
+	// Runs may be reported out of order.
+	_, err = s.RecordScriptRun(context.Background(), &pluginpb.RecordScriptRunRequest{
+		ScriptID: scriptID,
+		Status:   pluginpb.RUN_STATUS_SUCCESS,
+		RunAt:    runAts[2],
+	})
+	require.NoError(t, err)
+	_, err = s.RecordScriptRun(context.Background(), &pluginpb.RecordScriptRunRequest{
+		ScriptID:   scriptID,
+		Status:     pluginpb.RUN_STATUS_FAILURE,
+		Error:      "failed to connect to export URL",
+		RunAt:      runAts[1],
+		DurationMs: 200,
+	})
+	require.NoError(t, err)
+
+	resp, err = s.GetRetentionScriptRunHistory(context.Background(), &pluginpb.GetRetentionScriptRunHistoryRequest{
+		OrgID:    orgID,
+		ScriptID: scriptID,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []*pluginpb.GetRetentionScriptRunHistoryResponse_ScriptRun{
+		{RunAt: runAts[2], Status: pluginpb.RUN_STATUS_SUCCESS},
+		{RunAt: runAts[1], Status: pluginpb.RUN_STATUS_FAILURE, DurationMs: 200, Error: "failed to connect to export URL"},
+		{RunAt: runAts[0], Status: pluginpb.RUN_STATUS_SUCCESS, DurationMs: 1500},
+	}, resp.Runs)
+
+	resp, err = s.GetRetentionScriptRunHistory(context.Background(), &pluginpb.GetRetentionScriptRunHistoryRequest{
+		OrgID:    orgID,
+		ScriptID: scriptID,
+		Limit:    1,
+	})
+	require.NoError(t, err)
+	require.Len(t, resp.Runs, 1)
+	assert.Equal(t, runAts[2], resp.Runs[0].RunAt)
+
+	_, err = s.GetRetentionScriptRunHistory(context.Background(), &pluginpb.GetRetentionScriptRunHistoryRequest{
+		OrgID:    orgID,
+		ScriptID: scriptID,
+		Limit:    -1,
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// Scripts are scoped to the org.
+	_, err = s.GetRetentionScriptRunHistory(context.Background(), &pluginpb.GetRetentionScriptRunHistoryRequest{
+		OrgID:    utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440001"),
+		ScriptID: scriptID,
+	})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestServer_RetentionScriptCronSchedule(t *testing.T) {
+	mustLoadTestData(db)
+
+	s := controllers.New(db, "test")
+	orgID := utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000")
+	scriptID := utils.ProtoFromUUIDStrOrNil("123e4567-e89b-12d3-a456-426655440000")
+
+	_, err := s.UpdateRetentionScript(context.Background(), &pluginpb.UpdateRetentionScriptRequest{
+		OrgID:        orgID,
+		ScriptID:     scriptID,
+		CronSchedule: &types.StringValue{Value: "not a schedule"},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = s.UpdateRetentionScript(context.Background(), &pluginpb.UpdateRetentionScriptRequest{
+		OrgID:        orgID,
+		ScriptID:     scriptID,
+		CronSchedule: &types.StringValue{Value: "0 2 * * *"},
+	})
+	require.NoError(t, err)
+
+	runAt, _ := types.TimestampProto(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	_, err = s.RecordScriptRun(context.Background(), &pluginpb.RecordScriptRunRequest{
+		ScriptID: scriptID,
+		Status:   pluginpb.RUN_STATUS_SUCCESS,
+		RunAt:    runAt,
+	})
+	require.NoError(t, err)
+
+	dueScriptIDs := func(before time.Time) map[string]*types.Timestamp {
+		beforeTS, _ := types.TimestampProto(before)
+		resp, err := s.GetRetentionScriptsDue(context.Background(), &pluginpb.GetRetentionScriptsDueRequest{
+			BeforeTimestamp: beforeTS,
+		})
+		require.NoError(t, err)
+		due := make(map[string]*types.Timestamp)
+		for _, sc := range resp.Scripts {
+			due[utils.ProtoToUUIDStr(sc.Script.Script.ScriptID)] = sc.NextRunAt
+		}
+		return due
+	}
+
+	// The script is next due at 2am, rather than after its frequency.
+	assert.NotContains(t, dueScriptIDs(time.Date(2021, 1, 1, 1, 0, 0, 0, time.UTC)), "123e4567-e89b-12d3-a456-426655440000")
+	due := dueScriptIDs(time.Date(2021, 1, 1, 3, 0, 0, 0, time.UTC))
+	require.Contains(t, due, "123e4567-e89b-12d3-a456-426655440000")
+	nextRun, _ := types.TimestampProto(time.Date(2021, 1, 1, 2, 0, 0, 0, time.UTC))
+	assert.Equal(t, nextRun, due["123e4567-e89b-12d3-a456-426655440000"])
+
+	scriptResp, err := s.GetRetentionScript(context.Background(), &pluginpb.GetRetentionScriptRequest{
+		OrgID:    orgID,
+		ScriptID: scriptID,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "0 2 * * *", scriptResp.Script.Script.CronSchedule)
+
+	// Clearing the schedule falls back to the script's frequency.
+	_, err = s.UpdateRetentionScript(context.Background(), &pluginpb.UpdateRetentionScriptRequest{
+		OrgID:        orgID,
+		ScriptID:     scriptID,
+		CronSchedule: &types.StringValue{Value: ""},
+	})
+	require.NoError(t, err)
+	frequencyS := scriptResp.Script.Script.FrequencyS
+	due = dueScriptIDs(time.Date(2021, 1, 1, 3, 0, 0, 0, time.UTC))
+	nextRun, _ = types.TimestampProto(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(frequencyS) * time.Second))
+	assert.Equal(t, nextRun, due["123e4567-e89b-12d3-a456-426655440000"])
+}
+
+func TestServer_GetOrgConfigForGitOps(t *testing.T) {
+	mustLoadTestData(db)
+
+	s := controllers.New(db, "test", controllers.WithGitOpsHashKey("gitops"))
+	resp1, err := s.GetOrgConfigForGitOps(context.Background(), &pluginpb.GetOrgConfigForGitOpsRequest{
+		OrgID:    utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
+		PluginID: "test-plugin",
+	})
+	require.NoError(t, err)
+
+	mac := hmac.New(sha256.New, []byte("gitops"))
+	mac.Write([]byte("12345"))
+	expected := fmt.Sprintf("plugin_id: \"test-plugin\"\nversion: \"0.0.3\"\nconfigurations:\n  \"license_key2\": \"hmac-sha256:%s\"\n", hex.EncodeToString(mac.Sum(nil)))
+	assert.Equal(t, expected, resp1.Config)
+	assert.NotContains(t, resp1.Config, "12345")
+
+	// Give the second org an identical config, which should produce identical output.
+	_, err = s.UpdateOrgRetentionPluginConfig(context.Background(), &pluginpb.UpdateOrgRetentionPluginConfigRequest{
+		OrgID:          utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440001"),
+		PluginID:       "test-plugin",
+		Configurations: map[string]string{"license_key2": "12345"},
+		Version:        &types.StringValue{Value: "0.0.3"},
+	})
+	require.NoError(t, err)
+
+	resp2, err := s.GetOrgConfigForGitOps(context.Background(), &pluginpb.GetOrgConfigForGitOpsRequest{
+		OrgID:    utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440001"),
+		PluginID: "test-plugin",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, resp1.Config, resp2.Config)
+
+	_, err = s.GetOrgConfigForGitOps(context.Background(), &pluginpb.GetOrgConfigForGitOpsRequest{
+		OrgID:    utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440001"),
+		PluginID: "another-plugin",
+	})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	// Without a hash key, the values aren't hashed with the database key itself.
+	resp3, err := controllers.New(db, "test").GetOrgConfigForGitOps(context.Background(), &pluginpb.GetOrgConfigForGitOpsRequest{
+		OrgID:    utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
+		PluginID: "test-plugin",
+	})
+	require.NoError(t, err)
+	dbKeyMAC := hmac.New(sha256.New, []byte("test"))
+	dbKeyMAC.Write([]byte("12345"))
+	assert.NotContains(t, resp3.Config, hex.EncodeToString(dbKeyMAC.Sum(nil)))
+}
+
+func TestServer_WithReadReplica(t *testing.T) {
+	mustLoadTestData(db)
+
+	// Use a closed handle as the replica, so that any query routed to it fails.
+	replica, err := sqlx.Open("postgres", "")
+	require.NoError(t, err)
+	require.NoError(t, replica.Close())
+
+	s := controllers.New(db, "test", controllers.WithReadReplica(replica))
+
+	_, err = s.GetPlugins(context.Background(), &pluginpb.GetPluginsRequest{})
+	assert.Equal(t, codes.Internal, status.Code(err))
+
+	_, err = s.GetRetentionPluginsForOrg(context.Background(), &pluginpb.GetRetentionPluginsForOrgRequest{
+		OrgID: utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
+	})
+	assert.Equal(t, codes.Internal, status.Code(err))
+
+	// Writes should still go to the primary.
+	_, err = s.UpdateOrgRetentionPluginConfig(context.Background(), &pluginpb.UpdateOrgRetentionPluginConfigRequest{
+		OrgID:    utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
+		PluginID: "test-plugin",
+		Enabled:  &types.BoolValue{Value: false},
+	})
+	require.NoError(t, err)
+
+	resp, err := controllers.New(db, "test").GetRetentionPluginsForOrg(context.Background(), &pluginpb.GetRetentionPluginsForOrgRequest{
+		OrgID: utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(resp.Plugins))
+
+	// A nil replica keeps reads on the primary.
+	_, err = controllers.New(db, "test", controllers.WithReadReplica(nil)).GetPlugins(context.Background(), &pluginpb.GetPluginsRequest{})
+	require.NoError(t, err)
+}
+
+func TestServer_VerifyPresetFrequenciesAgainstRateLimit(t *testing.T) {
+	mustLoadTestData(db)
+	db.MustExec(`UPDATE data_retention_plugin_releases SET rate_limit_per_minute=$1 WHERE plugin_id=$2 AND version=$3`, 4, "test-plugin", "0.0.1")
+
+	s := controllers.New(db, "test")
+	resp, err := s.VerifyPresetFrequenciesAgainstRateLimit(context.Background(), &pluginpb.VerifyPresetFrequenciesAgainstRateLimitRequest{
+		ID:      "test-plugin",
+		Version: "0.0.1",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &pluginpb.VerifyPresetFrequenciesAgainstRateLimitResponse{
+		RateLimitPerMinute: 4,
+		Violations: []*pluginpb.VerifyPresetFrequenciesAgainstRateLimitResponse_Violation{
+			&pluginpb.VerifyPresetFrequenciesAgainstRateLimitResponse_Violation{
+				Name:              "http data",
+				DefaultFrequencyS: 10,
+				MinFrequencyS:     15,
+			},
+		},
+	}, resp)
+
+	// Releases without a rate limit have no violations.
+	resp, err = s.VerifyPresetFrequenciesAgainstRateLimit(context.Background(), &pluginpb.VerifyPresetFrequenciesAgainstRateLimitRequest{
+		ID:      "test-plugin",
+		Version: "0.0.2",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), resp.RateLimitPerMinute)
+	assert.Equal(t, 0, len(resp.Violations))
+
+	_, err = s.VerifyPresetFrequenciesAgainstRateLimit(context.Background(), &pluginpb.VerifyPresetFrequenciesAgainstRateLimitRequest{
+		ID:      "test-plugin",
+		Version: "0.0.9",
+	})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestServer_CanceledContext(t *testing.T) {
+	mustLoadTestData(db)
+
+	s := controllers.New(db, "test")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	orgID := utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000")
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{
+			name: "GetPlugins",
+			call: func() error {
+				_, err := s.GetPlugins(ctx, &pluginpb.GetPluginsRequest{})
+				return err
+			},
+		},
+		{
+			name: "GetRetentionPluginConfig",
+			call: func() error {
+				_, err := s.GetRetentionPluginConfig(ctx, &pluginpb.GetRetentionPluginConfigRequest{ID: "test-plugin", Version: "0.0.1"})
+				return err
+			},
+		},
+		{
+			name: "GetRetentionPluginsForOrg",
+			call: func() error {
+				_, err := s.GetRetentionPluginsForOrg(ctx, &pluginpb.GetRetentionPluginsForOrgRequest{OrgID: orgID})
+				return err
+			},
+		},
+		{
+			name: "GetOrgRetentionPluginConfig",
+			call: func() error {
+				_, err := s.GetOrgRetentionPluginConfig(ctx, &pluginpb.GetOrgRetentionPluginConfigRequest{OrgID: orgID, PluginID: "test-plugin"})
+				return err
+			},
+		},
+		{
+			name: "UpdateOrgRetentionPluginConfig",
+			call: func() error {
+				_, err := s.UpdateOrgRetentionPluginConfig(ctx, &pluginpb.UpdateOrgRetentionPluginConfigRequest{
+					OrgID:          orgID,
+					PluginID:       "test-plugin",
+					Configurations: map[string]string{"license_key2": "abc"},
+				})
+				return err
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.call()
+			require.Error(t, err)
+			assert.Equal(t, codes.Canceled, status.Code(err))
+		})
+	}
+}
+
+func TestServer_UpdateRetentionConfigsDryRun(t *testing.T) {
+	tests := []struct {
+		name          string
+		request       *pluginpb.UpdateOrgRetentionPluginConfigRequest
+		expectedResp  *pluginpb.UpdateOrgRetentionPluginConfigResponse
+		expectedError bool
+	}{
+		{
+			name: "updating version and config",
+			request: &pluginpb.UpdateOrgRetentionPluginConfigRequest{
+				OrgID:    utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
+				PluginID: "test-plugin",
+				Version:  &types.StringValue{Value: "0.0.2"},
+				Configurations: map[string]string{
+					"abcd": "hello",
+				},
+				DryRun: true,
+			},
+			expectedResp: &pluginpb.UpdateOrgRetentionPluginConfigResponse{
+				Enabled: true,
+				Version: "0.0.2",
+				Configurations: map[string]string{
+					"abcd": "hello",
+				},
+			},
+		},
+		{
+			name: "enabling plugin",
+			request: &pluginpb.UpdateOrgRetentionPluginConfigRequest{
+				OrgID:    utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
+				PluginID: "another-plugin",
+				Version:  &types.StringValue{Value: "0.0.1"},
+				Enabled:  &types.BoolValue{Value: true},
+				Configurations: map[string]string{
+					"abcd": "hello",
+				},
+				DryRun: true,
+			},
+			expectedResp: &pluginpb.UpdateOrgRetentionPluginConfigResponse{
+				Enabled: true,
+				Version: "0.0.1",
+				Configurations: map[string]string{
+					"abcd": "hello",
+				},
+			},
+		},
+		{
+			name: "disabling plugin",
+			request: &pluginpb.UpdateOrgRetentionPluginConfigRequest{
+				OrgID:    utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
+				PluginID: "test-plugin",
+				Enabled:  &types.BoolValue{Value: false},
+				DryRun:   true,
+			},
+			expectedResp: &pluginpb.UpdateOrgRetentionPluginConfigResponse{},
+		},
+		{
+			name: "enabling nonexistent version",
+			request: &pluginpb.UpdateOrgRetentionPluginConfigRequest{
+				OrgID:    utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
+				PluginID: "another-plugin",
+				Version:  &types.StringValue{Value: "1.0.0"},
+				Enabled:  &types.BoolValue{Value: true},
+				DryRun:   true,
+			},
+			expectedError: true,
+		},
+		{
+			name: "enabling version without retention release",
+			request: &pluginpb.UpdateOrgRetentionPluginConfigRequest{
+				OrgID:    utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
+				PluginID: "another-plugin",
+				Version:  &types.StringValue{Value: "0.0.2"},
+				Enabled:  &types.BoolValue{Value: true},
+				DryRun:   true,
+			},
+			expectedError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mustLoadTestData(db)
+
+			s := controllers.New(db, "test")
+			resp, err := s.UpdateOrgRetentionPluginConfig(context.Background(), test.request)
+			if test.expectedError {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, test.expectedResp, resp)
+			}
+
+			// The org's config should be unchanged.
+			var count int
+			err = db.Get(&count, `SELECT COUNT(*) FROM org_data_retention_plugins`)
+			require.NoError(t, err)
+			assert.Equal(t, 2, count)
+
+			configResp, err := s.GetOrgRetentionPluginConfig(context.Background(), &pluginpb.GetOrgRetentionPluginConfigRequest{
+				OrgID:    utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
+				PluginID: "test-plugin",
+			})
+			require.NoError(t, err)
+			assert.Equal(t, map[string]string{"license_key2": "12345"}, configResp.Configurations)
+		})
+	}
+}
+
+func TestServer_GetOrgScriptCountsByPlugin(t *testing.T) {
+	mustLoadTestData(db)
+
+	insertScript := `INSERT INTO plugin_retention_scripts(org_id, plugin_id, plugin_version, script_id, script_name, enabled, is_preset) VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	db.MustExec(insertScript, "223e4567-e89b-12d3-a456-426655440000", "another-plugin", "0.0.1", "123e4567-e89b-12d3-a456-426655440010", "another script", true, false)
+	db.MustExec(insertScript, "223e4567-e89b-12d3-a456-426655440000", "another-plugin", "0.0.1", "123e4567-e89b-12d3-a456-426655440011", "another script 2", true, false)
+	db.MustExec(insertScript, "223e4567-e89b-12d3-a456-426655440000", "another-plugin", "0.0.2", "123e4567-e89b-12d3-a456-426655440012", "another script 3", nil, false)
+
+	s := controllers.New(db, "test")
+	resp, err := s.GetOrgScriptCountsByPlugin(context.Background(), &pluginpb.GetOrgScriptCountsByPluginRequest{
+		OrgID: utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []*pluginpb.GetOrgScriptCountsByPluginResponse_ScriptCounts{
+		&pluginpb.GetOrgScriptCountsByPluginResponse_ScriptCounts{
+			PluginID: "another-plugin",
+			Version:  "0.0.1",
+			Total:    2,
+			Enabled:  2,
+			Paused:   0,
+		},
+		&pluginpb.GetOrgScriptCountsByPluginResponse_ScriptCounts{
+			PluginID: "another-plugin",
+			Version:  "0.0.2",
+			Total:    1,
+			Enabled:  0,
+			Paused:   1,
+		},
+		&pluginpb.GetOrgScriptCountsByPluginResponse_ScriptCounts{
+			PluginID: "test-plugin",
+			Version:  "0.0.3",
+			Total:    2,
+			Enabled:  1,
+			Paused:   1,
+		},
+	}, resp.Counts)
+}
+
+func TestServer_UpdateRetentionConfigsNonexistentVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		request *pluginpb.UpdateOrgRetentionPluginConfigRequest
+	}{
+		{
+			name: "enabling",
+			request: &pluginpb.UpdateOrgRetentionPluginConfigRequest{
+				OrgID:    utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440001"),
+				PluginID: "another-plugin",
+				Enabled:  &types.BoolValue{Value: true},
+				Version:  &types.StringValue{Value: "0.0.2"},
+			},
+		},
+		{
+			name: "updating version",
+			request: &pluginpb.UpdateOrgRetentionPluginConfigRequest{
+				OrgID:    utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
+				PluginID: "test-plugin",
+				Version:  &types.StringValue{Value: "1.0.0"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mustLoadTestData(db)
+
+			s := controllers.New(db, "test")
+			_, err := s.UpdateOrgRetentionPluginConfig(context.Background(), test.request)
+			assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		})
+	}
+}
+
+func TestServer_ConfigTemplates(t *testing.T) {
+	mustLoadTestData(db)
+
+	s := controllers.New(db, "test")
+	saveResp, err := s.SaveConfigTemplate(context.Background(), &pluginpb.SaveConfigTemplateRequest{
+		Name:     "default template",
+		PluginID: "test-plugin",
+		Version:  "0.0.2",
+		Configurations: map[string]string{
+			"license_key2": "${license_key}",
+			"tag":          "org-${org_id}",
+		},
+	})
+	require.NoError(t, err)
+	require.False(t, utils.IsNilUUIDProto(saveResp.TemplateID))
+
+	// Apply the template to an org which already has the plugin enabled, and to an org which does not.
+	orgs := map[string]string{
+		"223e4567-e89b-12d3-a456-426655440000": "abc",
+		"223e4567-e89b-12d3-a456-426655440002": "def",
+	}
+	for orgID, licenseKey := range orgs {
+		_, err = s.ApplyConfigTemplate(context.Background(), &pluginpb.ApplyConfigTemplateRequest{
+			TemplateID:        saveResp.TemplateID,
+			OrgID:             utils.ProtoFromUUIDStrOrNil(orgID),
+			PlaceholderValues: map[string]string{"license_key": licenseKey},
+		})
+		require.NoError(t, err)
+	}
+
+	for orgID, licenseKey := range orgs {
+		resp, err := s.GetOrgRetentionPluginConfig(context.Background(), &pluginpb.GetOrgRetentionPluginConfigRequest{
+			OrgID:    utils.ProtoFromUUIDStrOrNil(orgID),
+			PluginID: "test-plugin",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{
+			"license_key2": licenseKey,
+			"tag":          "org-" + orgID,
+		}, resp.Configurations)
+
+		var version string
+		err = db.Get(&version, `SELECT version FROM org_data_retention_plugins WHERE org_id=$1 AND plugin_id=$2`, orgID, "test-plugin")
+		require.NoError(t, err)
+		assert.Equal(t, "0.0.2", version)
+	}
+
+	// Applying without a value for each placeholder should fail.
+	_, err = s.ApplyConfigTemplate(context.Background(), &pluginpb.ApplyConfigTemplateRequest{
+		TemplateID: saveResp.TemplateID,
+		OrgID:      utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440001"),
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = s.ApplyConfigTemplate(context.Background(), &pluginpb.ApplyConfigTemplateRequest{
+		TemplateID: utils.ProtoFromUUIDStrOrNil("423e4567-e89b-12d3-a456-426655440000"),
+		OrgID:      utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440001"),
+	})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestServer_ApplyConfigTemplateEnables(t *testing.T) {
+	mustLoadTestData(db)
+
+	s := controllers.New(db, "test")
+	_, err := s.CreatePluginRelease(context.Background(), &pluginpb.CreatePluginReleaseRequest{
+		Name:    "test_plugin",
+		ID:      "test-plugin",
+		Version: "0.0.4",
+		RetentionConfig: &pluginpb.RetentionReleaseConfig{
+			Configurations: map[string]string{
+				"license_key": "This is what we use to authenticate",
+				"region":      "The region to send data to",
+			},
+			RequiredConfigurations: []string{"region"},
+			PresetScripts: []*pluginpb.GetRetentionPluginConfigResponse_PresetScript{
+				{Name: "template script", DefaultFrequencyS: 30, Script: "template script contents"},
+			},
+		},
+	})
+	require.NoError(t, err)
+	_, err = s.CreatePluginRelease(context.Background(), &pluginpb.CreatePluginReleaseRequest{
+		Name:    "test_plugin",
+		ID:      "test-plugin",
+		Version: "0.0.5",
+		RetentionConfig: &pluginpb.RetentionReleaseConfig{
+			Configurations: map[string]string{"region": "The region to send data to"},
+			Dependencies:   []string{"another-plugin"},
+		},
+	})
+	require.NoError(t, err)
+
+	saveTemplate := func(version string, configs map[string]string) *uuidpb.UUID {
+		resp, err := s.SaveConfigTemplate(context.Background(), &pluginpb.SaveConfigTemplateRequest{
+			Name:           "template " + version,
+			PluginID:       "test-plugin",
+			Version:        version,
+			Configurations: configs,
+		})
+		require.NoError(t, err)
+		return resp.TemplateID
+	}
+	orgID := "223e4567-e89b-12d3-a456-426655440000"
+
+	// Templates must satisfy the release's required configurations and dependencies.
+	_, err = s.ApplyConfigTemplate(context.Background(), &pluginpb.ApplyConfigTemplateRequest{
+		TemplateID: saveTemplate("0.0.4", map[string]string{"license_key": "abc"}),
+		OrgID:      utils.ProtoFromUUIDStrOrNil(orgID),
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = s.ApplyConfigTemplate(context.Background(), &pluginpb.ApplyConfigTemplateRequest{
+		TemplateID: saveTemplate("0.0.5", map[string]string{"region": "us"}),
+		OrgID:      utils.ProtoFromUUIDStrOrNil(orgID),
+	})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	// Applying replaces the org's previous config entirely, and creates the release's preset scripts.
+	db.MustExec(`UPDATE org_data_retention_plugins SET custom_export_url=$1, min_frequency_s=$2, typed_configurations=PGP_SYM_ENCRYPT($3, 'test') WHERE org_id=$4 AND plugin_id=$5`,
+		"https://custom-export-url", 30, `{"endpoints":["a"]}`, orgID, "test-plugin")
+	_, err = s.ApplyConfigTemplate(context.Background(), &pluginpb.ApplyConfigTemplateRequest{
+		TemplateID: saveTemplate("0.0.4", map[string]string{"region": "us"}),
+		OrgID:      utils.ProtoFromUUIDStrOrNil(orgID),
+	})
+	require.NoError(t, err)
+
+	var row struct {
+		Version             string  `db:"version"`
+		CustomExportURL     *string `db:"custom_export_url"`
+		MinFrequencyS       *int64  `db:"min_frequency_s"`
+		TypedConfigurations []byte  `db:"typed_configurations"`
+		Enabled             bool    `db:"enabled"`
+	}
+	err = db.Get(&row, `SELECT version, custom_export_url, min_frequency_s, typed_configurations, enabled FROM org_data_retention_plugins WHERE org_id=$1 AND plugin_id=$2`, orgID, "test-plugin")
+	require.NoError(t, err)
+	assert.Equal(t, "0.0.4", row.Version)
+	assert.Nil(t, row.CustomExportURL)
+	assert.Nil(t, row.MinFrequencyS)
+	assert.Nil(t, row.TypedConfigurations)
+	assert.True(t, row.Enabled)
+
+	var scripts int
+	err = db.Get(&scripts, `SELECT COUNT(*) FROM plugin_retention_scripts WHERE org_id=$1 AND script_name=$2 AND plugin_version=$3`, orgID, "template script", "0.0.4")
+	require.NoError(t, err)
+	assert.Equal(t, 1, scripts)
+}
+
+func TestServer_FindUnusedPlugins(t *testing.T) {
+	mustLoadTestData(db)
+
+	s := controllers.New(db, "test")
+	plugins, err := s.FindUnusedPlugins(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, len(plugins))
+	assert.Equal(t, "another-plugin", plugins[0].ID)
+	assert.Equal(t, "0.0.2", plugins[0].Version)
+
+	// The latest release is chosen by semver, rather than by comparing the versions as strings.
+	for _, version := range []string{"0.0.9", "0.0.10"} {
+		_, err = s.CreatePluginRelease(context.Background(), &pluginpb.CreatePluginReleaseRequest{
+			Name:    "another_plugin",
+			ID:      "another-plugin",
+			Version: version,
+		})
+		require.NoError(t, err)
+	}
+	plugins, err = s.FindUnusedPlugins(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, len(plugins))
+	assert.Equal(t, "0.0.10", plugins[0].Version)
+}
+
+func TestServer_MaxConcurrentDecryptions(t *testing.T) {
+	mustLoadTestData(db)
+
+	s := controllers.New(db, "test", controllers.WithMaxConcurrentDecryptions(1))
+	req := &pluginpb.GetOrgRetentionPluginConfigRequest{
+		PluginID: "test-plugin",
+		OrgID:    utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440001"),
+	}
+
+	// Holding a lock on the configs makes the decryptions block in the database.
+	lockTx := db.MustBegin()
+	lockTx.MustExec(`LOCK TABLE org_data_retention_plugins IN ACCESS EXCLUSIVE MODE`)
+	waitingQueries := func() int {
+		var n int
+		require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM pg_stat_activity WHERE wait_event_type = 'Lock'`).Scan(&n))
+		return n
+	}
+
+	errs := make(chan error, 2)
+	getConfig := func() {
+		_, err := s.GetOrgRetentionPluginConfig(context.Background(), req)
+		errs <- err
+	}
+	go getConfig()
+	require.Eventually(t, func() bool { return waitingQueries() == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	// Later decryptions wait for the first to finish, rather than reaching the database.
+	go getConfig()
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	_, err := s.GetOrgRetentionPluginConfig(ctx, req)
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+	assert.Equal(t, 1, waitingQueries())
+
+	require.NoError(t, lockTx.Rollback())
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, <-errs)
+	}
+}
+
+func TestServer_ListConfiguredPlugins(t *testing.T) {
+	mustLoadTestData(db)
+	db.MustExec(`INSERT INTO org_data_retention_plugins(org_id, plugin_id, version) VALUES ($1, $2, $3)`, "223e4567-e89b-12d3-a456-426655440000", "another-plugin", "0.0.1")
+
+	s := controllers.New(db, "test")
+	_, err := s.UpdateOrgRetentionPluginConfig(context.Background(), &pluginpb.UpdateOrgRetentionPluginConfigRequest{
+		OrgID:    utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440001"),
+		PluginID: "test-plugin",
+		Enabled:  &types.BoolValue{Value: false},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		orgID        string
+		expectedResp *pluginpb.ListConfiguredPluginsResponse
+	}{
+		{
+			name:  "multiple plugins",
+			orgID: "223e4567-e89b-12d3-a456-426655440000",
+			expectedResp: &pluginpb.ListConfiguredPluginsResponse{
+				Plugins: map[string]*pluginpb.ListConfiguredPluginsResponse_PluginConfig{
+					"test-plugin": {
+						Version: "0.0.3",
+						Configurations: map[string]string{
+							"license_key2": "12345",
+						},
+					},
+					"another-plugin": {
+						Version:        "0.0.1",
+						Configurations: map[string]string{},
+					},
+				},
+			},
+		},
+		{
+			name:  "disabled plugin",
+			orgID: "223e4567-e89b-12d3-a456-426655440001",
+			expectedResp: &pluginpb.ListConfiguredPluginsResponse{
+				Plugins: map[string]*pluginpb.ListConfiguredPluginsResponse_PluginConfig{},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, err := s.ListConfiguredPlugins(context.Background(), &pluginpb.ListConfiguredPluginsRequest{
+				OrgID: utils.ProtoFromUUIDStrOrNil(test.orgID),
+			})
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedResp, resp)
+		})
+	}
+}
+
+func TestServer_GetOrgConfigKeys(t *testing.T) {
+	mustLoadTestData(db)
+	orgID := "223e4567-e89b-12d3-a456-426655440000"
+	db.MustExec(`INSERT INTO org_data_retention_plugins(org_id, plugin_id, version, configurations, typed_configurations, enabled) VALUES ($1, $2, $3, PGP_SYM_ENCRYPT($4, $6), PGP_SYM_ENCRYPT($5, $6), false)`,
+		orgID, "another-plugin", "0.0.1", `{"abcd": "secret", "license_key2": "secret"}`, `{"endpoints": ["http://endpoint"]}`, "test")
+	db.MustExec(`INSERT INTO org_data_retention_plugin_config_history(org_id, plugin_id, version, configurations) VALUES ($1, $2, $3, PGP_SYM_ENCRYPT($4, $5))`,
+		orgID, "test-plugin", "0.0.2", `{"old_key": "secret"}`, "test")
+
+	s := controllers.New(db, "test")
+	resp, err := s.GetOrgConfigKeys(context.Background(), &pluginpb.GetOrgConfigKeysRequest{
+		OrgID: utils.ProtoFromUUIDStrOrNil(orgID),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"abcd", "endpoints", "license_key2", "old_key"}, resp.Keys)
+
+	resp, err = s.GetOrgConfigKeys(context.Background(), &pluginpb.GetOrgConfigKeysRequest{
+		OrgID: utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440009"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{}, resp.Keys)
+}
+
+func TestServer_CheckOrgConfigConsistency(t *testing.T) {
+	mustLoadTestData(db)
+	orgID := "223e4567-e89b-12d3-a456-426655440000"
+	// Disabled plugins are not checked.
+	db.MustExec(`INSERT INTO org_data_retention_plugins(org_id, plugin_id, version, configurations, enabled) VALUES ($1, $2, $3, PGP_SYM_ENCRYPT($4, $5), false)`,
+		orgID, "another-plugin", "0.0.1", `{"old_key": "secret"}`, "test")
+
+	s := controllers.New(db, "test")
+	resp, err := s.CheckOrgConfigConsistency(context.Background(), &pluginpb.CheckOrgConfigConsistencyRequest{
+		OrgID: utils.ProtoFromUUIDStrOrNil(orgID),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []*pluginpb.CheckOrgConfigConsistencyResponse_PluginConsistency{
+		{
+			PluginID:    "test-plugin",
+			Version:     "0.0.3",
+			UnknownKeys: []string{"license_key2"},
+			MissingKeys: []string{"license_key3"},
+		},
+	}, resp.Plugins)
+
+	// Keys set to an empty string are missing.
+	db.MustExec(`UPDATE org_data_retention_plugins SET configurations=PGP_SYM_ENCRYPT($1, $2) WHERE org_id=$3 AND plugin_id=$4`,
+		`{"license_key3": ""}`, "test", orgID, "test-plugin")
+	resp, err = s.CheckOrgConfigConsistency(context.Background(), &pluginpb.CheckOrgConfigConsistencyRequest{
+		OrgID: utils.ProtoFromUUIDStrOrNil(orgID),
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(resp.Plugins))
+	assert.Nil(t, resp.Plugins[0].UnknownKeys)
+	assert.Equal(t, []string{"license_key3"}, resp.Plugins[0].MissingKeys)
+
+	db.MustExec(`UPDATE org_data_retention_plugins SET configurations=PGP_SYM_ENCRYPT($1, $2) WHERE org_id=$3 AND plugin_id=$4`,
+		`{"license_key3": "12345"}`, "test", orgID, "test-plugin")
+	resp, err = s.CheckOrgConfigConsistency(context.Background(), &pluginpb.CheckOrgConfigConsistencyRequest{
+		OrgID: utils.ProtoFromUUIDStrOrNil(orgID),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []*pluginpb.CheckOrgConfigConsistencyResponse_PluginConsistency{
+		{PluginID: "test-plugin", Version: "0.0.3"},
+	}, resp.Plugins)
+
+	_, err = s.CheckOrgConfigConsistency(context.Background(), &pluginpb.CheckOrgConfigConsistencyRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServer_GetOrgRetentionPluginConfigAtVersion(t *testing.T) {
+	mustLoadTestData(db)
+
+	s := controllers.New(db, "test")
+	orgID := utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000")
+
+	_, err := s.UpdateOrgRetentionPluginConfig(context.Background(), &pluginpb.UpdateOrgRetentionPluginConfigRequest{
+		OrgID:          orgID,
+		PluginID:       "test-plugin",
+		Configurations: map[string]string{"license_key3": "before"},
+	})
+	require.NoError(t, err)
+
+	// Bump the version, which should keep the config the org had for the previous version.
+	_, err = s.UpdateOrgRetentionPluginConfig(context.Background(), &pluginpb.UpdateOrgRetentionPluginConfigRequest{
+		OrgID:          orgID,
+		PluginID:       "test-plugin",
+		Version:        &types.StringValue{Value: "0.0.2"},
+		Configurations: map[string]string{"license_key2": "after"},
+	})
+	require.NoError(t, err)
+
+	resp, err := s.GetOrgRetentionPluginConfigAtVersion(context.Background(), &pluginpb.GetOrgRetentionPluginConfigAtVersionRequest{
+		OrgID:    orgID,
+		PluginID: "test-plugin",
+		Version:  "0.0.3",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"license_key3": "before"}, resp.Configurations)
+
+	resp, err = s.GetOrgRetentionPluginConfigAtVersion(context.Background(), &pluginpb.GetOrgRetentionPluginConfigAtVersionRequest{
+		OrgID:    orgID,
+		PluginID: "test-plugin",
+		Version:  "0.0.2",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"license_key2": "after"}, resp.Configurations)
+
+	_, err = s.GetOrgRetentionPluginConfigAtVersion(context.Background(), &pluginpb.GetOrgRetentionPluginConfigAtVersionRequest{
+		OrgID:    orgID,
+		PluginID: "test-plugin",
+		Version:  "0.0.1",
+	})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestServer_GetConfigKeyAcrossOrgs(t *testing.T) {
+	mustLoadTestData(db)
+
+	s := controllers.New(db, "test")
+	_, err := s.UpdateOrgRetentionPluginConfig(context.Background(), &pluginpb.UpdateOrgRetentionPluginConfigRequest{
+		OrgID:          utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
+		PluginID:       "test-plugin",
+		Configurations: map[string]string{"license_key2": "12345", "tier": "gold"},
+	})
+	require.NoError(t, err)
+	_, err = s.UpdateOrgRetentionPluginConfig(context.Background(), &pluginpb.UpdateOrgRetentionPluginConfigRequest{
+		OrgID:          utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440002"),
+		PluginID:       "test-plugin",
+		Enabled:        &types.BoolValue{Value: true},
+		Version:        &types.StringValue{Value: "0.0.3"},
+		Configurations: map[string]string{"tier": "silver"},
+	})
+	require.NoError(t, err)
+
+	resp, err := s.GetConfigKeyAcrossOrgs(context.Background(), &pluginpb.GetConfigKeyAcrossOrgsRequest{
+		PluginID: "test-plugin",
+		Key:      "tier",
+	})
+	require.NoError(t, err)
+	// The org which has not set the key should be absent.
+	assert.Equal(t, map[string]string{
+		"223e4567-e89b-12d3-a456-426655440000": "gold",
+		"223e4567-e89b-12d3-a456-426655440002": "silver",
+	}, resp.Values)
+}
+
+func TestServer_FindNonCompliantOrgsAfterSchemaChange(t *testing.T) {
+	mustLoadTestData(db)
+
+	s := controllers.New(db, "test")
+	_, err := s.UpdateOrgRetentionPluginConfig(context.Background(), &pluginpb.UpdateOrgRetentionPluginConfigRequest{
+		OrgID:          utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440002"),
+		PluginID:       "test-plugin",
+		Enabled:        &types.BoolValue{Value: true},
+		Version:        &types.StringValue{Value: "0.0.2"},
+		Configurations: map[string]string{"license_key2": "abcd"},
+	})
+	require.NoError(t, err)
+	_, err = s.UpdateOrgRetentionPluginConfig(context.Background(), &pluginpb.UpdateOrgRetentionPluginConfigRequest{
+		OrgID:          utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440003"),
+		PluginID:       "test-plugin",
+		Enabled:        &types.BoolValue{Value: true},
+		Version:        &types.StringValue{Value: "0.0.2"},
+		Configurations: map[string]string{"license_key2": ""},
+	})
+	require.NoError(t, err)
+
+	resp, err := s.FindNonCompliantOrgsAfterSchemaChange(context.Background(), &pluginpb.FindNonCompliantOrgsAfterSchemaChangeRequest{
+		PluginID: "test-plugin",
+		Version:  "0.0.2",
+	})
+	require.NoError(t, err)
+	// Orgs which have not set the key, or set it to an empty value, are non-compliant. Orgs on other versions are not checked.
+	assert.Equal(t, []*pluginpb.FindNonCompliantOrgsAfterSchemaChangeResponse_NonCompliantOrg{
+		{
+			OrgID:       utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440001"),
+			MissingKeys: []string{"license_key2"},
+		},
+		{
+			OrgID:       utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440003"),
+			MissingKeys: []string{"license_key2"},
+		},
+	}, resp.Orgs)
+
+	_, err = s.FindNonCompliantOrgsAfterSchemaChange(context.Background(), &pluginpb.FindNonCompliantOrgsAfterSchemaChangeRequest{
+		PluginID: "test-plugin",
+		Version:  "1.0.0",
+	})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestServer_FindNonCompliantOrgsAfterSchemaChangeOptionalKeys(t *testing.T) {
+	mustLoadTestData(db)
+	db.MustExec(`UPDATE data_retention_plugin_releases SET configurations=$1, required_configurations=$2 WHERE plugin_id=$3 AND version=$4`,
+		controllers.Configurations(map[string]string{"license_key2": "The license key", "tier": "An optional tier"}), pq.StringArray{"license_key2"}, "test-plugin", "0.0.2")
+
+	s := controllers.New(db, "test")
+	_, err := s.UpdateOrgRetentionPluginConfig(context.Background(), &pluginpb.UpdateOrgRetentionPluginConfigRequest{
+		OrgID:          utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440002"),
+		PluginID:       "test-plugin",
+		Enabled:        &types.BoolValue{Value: true},
+		Version:        &types.StringValue{Value: "0.0.2"},
+		Configurations: map[string]string{"license_key2": "abcd"},
+	})
+	require.NoError(t, err)
+
+	resp, err := s.FindNonCompliantOrgsAfterSchemaChange(context.Background(), &pluginpb.FindNonCompliantOrgsAfterSchemaChangeRequest{
+		PluginID: "test-plugin",
+		Version:  "0.0.2",
+	})
+	require.NoError(t, err)
+	// The org which has set the required key is compliant, even though it has not set the optional key.
+	assert.Equal(t, []*pluginpb.FindNonCompliantOrgsAfterSchemaChangeResponse_NonCompliantOrg{
+		{
+			OrgID:       utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440001"),
+			MissingKeys: []string{"license_key2"},
+		},
+	}, resp.Orgs)
+}
+
+func TestServer_VerifyAllLogos(t *testing.T) {
+	mustLoadTestData(db)
+
+	validSVG := `data:image/svg+xml,<svg xmlns="http://www.w3.org/2000/svg" width="10" height="10"><rect width="10" height="10"/></svg>`
+	brokenSVG := `data:image/svg+xml,<svg xmlns="http://www.w3.org/2000/svg"><rect width="10"`
+	updateLogo := `UPDATE plugin_releases SET logo=$1 WHERE id=$2 AND version=$3`
+	db.MustExec(updateLogo, validSVG, "test-plugin", "0.0.3")
+	db.MustExec(updateLogo, brokenSVG, "another-plugin", "0.0.2")
+
+	s := controllers.New(db, "test")
+	failures, err := s.VerifyAllLogos(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, len(failures))
+	assert.Equal(t, "another-plugin", failures[0].PluginID)
+	assert.Equal(t, "0.0.2", failures[0].Version)
+
+	// Bare SVG markup is not a logo the UI can render.
+	db.MustExec(updateLogo, `<svg xmlns="http://www.w3.org/2000/svg" width="10" height="10"></svg>`, "another-plugin", "0.0.2")
+	failures, err = s.VerifyAllLogos(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, len(failures))
+	assert.Equal(t, "another-plugin", failures[0].PluginID)
+
+	// Only the latest release by semver is checked, so the broken logo of "0.0.9" is not reported once "0.0.10" exists.
+	db.MustExec(updateLogo, validSVG, "another-plugin", "0.0.2")
+	for version, logo := range map[string]string{
+		"0.0.9":  brokenSVG,
+		"0.0.10": validSVG,
+	} {
+		_, err = s.CreatePluginRelease(context.Background(), &pluginpb.CreatePluginReleaseRequest{
+			Name:    "another_plugin",
+			ID:      "another-plugin",
+			Version: version,
+			Logo:    logo,
+		})
+		require.NoError(t, err)
+	}
+	failures, err = s.VerifyAllLogos(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, failures)
+}
+
+func TestServer_VerifyAllLogosDataURI(t *testing.T) {
+	mustLoadTestData(db)
+
+	// A 1x1 transparent PNG.
+	png := "iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAQAAAC1HAwCAAAAC0lEQVR42mNkYAAAAAYAAjCB0C8AAAAASUVORK5CYII="
+	updateLogo := `UPDATE plugin_releases SET logo=$1 WHERE id=$2 AND version=$3`
+	db.MustExec(updateLogo, "data:image/png;base64,"+png, "test-plugin", "0.0.3")
+	db.MustExec(updateLogo, "data:image/png;base64,"+png[:20], "another-plugin", "0.0.2")
+
+	s := controllers.New(db, "test")
+	failures, err := s.VerifyAllLogos(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, len(failures))
+	assert.Equal(t, "another-plugin", failures[0].PluginID)
+}
+
+func TestServer_CreatePluginRelease(t *testing.T) {
+	mustLoadTestData(db)
+
+	s := controllers.New(db, "test")
+	_, err := s.CreatePluginRelease(context.Background(), &pluginpb.CreatePluginReleaseRequest{
+		Name:        "test_plugin",
+		ID:          "test-plugin",
+		Description: "This is the newest-est test plugin",
+		Logo:        "https://example.com/logo4.svg",
+		Version:     "0.0.4",
+		RetentionConfig: &pluginpb.RetentionReleaseConfig{
+			Configurations: map[string]string{"license_key4": "This is what we use to authenticate 4"},
+			PresetScripts: []*pluginpb.GetRetentionPluginConfigResponse_PresetScript{
+				&pluginpb.GetRetentionPluginConfigResponse_PresetScript{
+					Name:              "http data",
+					Description:       "This is a script to get http data",
+					DefaultFrequencyS: 10,
+					Script:            "script",
+				},
+			},
+			DocumentationURL: "http://test-doc-url4",
+			DefaultExportURL: "http://test-export-url4",
+		},
+	})
+	require.NoError(t, err)
+
+	resp, err := s.GetRetentionPluginConfig(context.Background(), &pluginpb.GetRetentionPluginConfigRequest{
+		ID:      "test-plugin",
+		Version: "0.0.4",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &pluginpb.GetRetentionPluginConfigResponse{
+		Configurations: map[string]string{"license_key4": "This is what we use to authenticate 4"},
+		PresetScripts: []*pluginpb.GetRetentionPluginConfigResponse_PresetScript{
+			&pluginpb.GetRetentionPluginConfigResponse_PresetScript{
+				Name:              "http data",
+				Description:       "This is a script to get http data",
+				DefaultFrequencyS: 10,
+				Script:            "script",
+			},
+		},
+		DocumentationURL: "http://test-doc-url4",
+		DefaultExportURL: "http://test-export-url4",
+		LatestVersion:    "0.0.4",
+	}, resp)
+
+	_, err = s.CreatePluginRelease(context.Background(), &pluginpb.CreatePluginReleaseRequest{
+		Name:    "test_plugin",
+		ID:      "test-plugin",
+		Version: "0.0.4",
+	})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+}
+
+func TestServer_CreatePluginReleaseLengthLimits(t *testing.T) {
+	tests := []struct {
+		name         string
+		request      *pluginpb.CreatePluginReleaseRequest
+		expectedCode codes.Code
+	}{
+		{
+			name: "valid lengths",
+			request: &pluginpb.CreatePluginReleaseRequest{
+				Name:        "new_plugin",
+				ID:          "new-plugin",
+				Description: "This is a new plugin",
+				Logo:        "data:image/svg+xml,<svg/>",
+				Version:     "0.0.1",
+			},
+			expectedCode: codes.OK,
+		},
+		{
+			name: "description too long",
+			request: &pluginpb.CreatePluginReleaseRequest{
+				Name:        "new_plugin",
+				ID:          "new-plugin",
+				Description: strings.Repeat("a", 21),
+				Version:     "0.0.1",
+			},
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name: "logo too long",
+			request: &pluginpb.CreatePluginReleaseRequest{
+				Name:    "new_plugin",
+				ID:      "new-plugin",
+				Logo:    strings.Repeat("a", 31),
+				Version: "0.0.1",
+			},
+			expectedCode: codes.InvalidArgument,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mustLoadTestData(db)
+
+			s := controllers.New(db, "test", controllers.WithMaxDescriptionLength(20), controllers.WithMaxLogoLength(30))
+			_, err := s.CreatePluginRelease(context.Background(), test.request)
+			assert.Equal(t, test.expectedCode, status.Code(err))
+		})
+	}
+}
+
+func TestServer_CreatePluginReleaseLogo(t *testing.T) {
+	tests := []struct {
+		name         string
+		logo         string
+		expectedCode codes.Code
+	}{
+		{
+			name:         "empty",
+			expectedCode: codes.OK,
+		},
+		{
+			name:         "https URL",
+			logo:         "https://example.com/logo.png",
+			expectedCode: codes.OK,
+		},
+		{
+			name:         "image data URI",
+			logo:         "data:image/png;base64,iVBORw0KGgo=",
+			expectedCode: codes.OK,
+		},
+		{
+			name:         "SVG data URI",
+			logo:         `data:image/svg+xml,<svg xmlns="http://www.w3.org/2000/svg"></svg>`,
+			expectedCode: codes.OK,
+		},
+		{
+			name:         "SVG markup",
+			logo:         `<svg xmlns="http://www.w3.org/2000/svg"></svg>`,
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "base64 data URI with invalid data",
+			logo:         "data:image/png;base64,not base64",
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "http URL",
+			logo:         "http://example.com/logo.png",
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "non-image data URI",
+			logo:         "data:text/html,<script></script>",
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "data URI without data",
+			logo:         "data:image/png",
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "arbitrary text",
+			logo:         "logo",
+			expectedCode: codes.InvalidArgument,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mustLoadTestData(db)
+
+			s := controllers.New(db, "test")
+			_, err := s.CreatePluginRelease(context.Background(), &pluginpb.CreatePluginReleaseRequest{
+				Name:    "new_plugin",
+				ID:      "new-plugin",
+				Logo:    test.logo,
+				Version: "0.0.1",
+			})
+			assert.Equal(t, test.expectedCode, status.Code(err))
+		})
+	}
+}
+
+func TestServer_GetPluginsSemverLatest(t *testing.T) {
+	mustLoadTestData(db)
+
+	s := controllers.New(db, "test")
+	_, err := s.CreatePluginRelease(context.Background(), &pluginpb.CreatePluginReleaseRequest{
+		Name:            "test_plugin",
+		ID:              "test-plugin",
+		Description:     "This is the tenth test plugin",
+		Logo:            "https://example.com/logo10.svg",
+		Version:         "0.0.10",
+		RetentionConfig: &pluginpb.RetentionReleaseConfig{},
+	})
+	require.NoError(t, err)
+
+	resp, err := s.GetPlugins(context.Background(), &pluginpb.GetPluginsRequest{Kind: pluginpb.PLUGIN_KIND_RETENTION})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(resp.Plugins))
+	assert.Equal(t, "0.0.10", resp.Plugins[0].LatestVersion)
+	assert.Equal(t, "https://example.com/logo10.svg", resp.Plugins[0].Logo)
+
+	configResp, err := s.GetRetentionPluginConfig(context.Background(), &pluginpb.GetRetentionPluginConfigRequest{
+		ID:      "test-plugin",
+		Version: "0.0.2",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "0.0.10", configResp.LatestVersion)
+}
+
+func TestServer_GetRetentionScript(t *testing.T) {
+	mustLoadTestData(db)
+
+	s := controllers.New(db, "test")
+	resp, err := s.GetRetentionScript(context.Background(), &pluginpb.GetRetentionScriptRequest{
+		OrgID:    utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
+		ScriptID: utils.ProtoFromUUIDStrOrNil("123e4567-e89b-12d3-a456-426655440000"),
+	})
+	require.NoError(t, err)
+	require.NotNil(t, resp)
+	assert.Equal(t, &pluginpb.DetailedRetentionScript{
+		Script: &pluginpb.RetentionScript{
+			ScriptID:    utils.ProtoFromUUIDStrOrNil("123e4567-e89b-12d3-a456-426655440000"),
+			ScriptName:  "http data",
+			Description: "This is a script to get http data",
+			FrequencyS:  10,
+			ClusterIDs: []*uuidpb.UUID{
+				utils.ProtoFromUUIDStrOrNil("323e4567-e89b-12d3-a456-426655440000"),
+			},
+			PluginId: "test-plugin",
+			Enabled:  true,
+			IsPreset: true,
+		},
+		Contents:     "http script",
+		ExportURL:    "http://test-export-url",
+		IsOverridden: false,
+	}, resp.Script)
+
+	// Scripts are scoped to the org.
+	_, err = s.GetRetentionScript(context.Background(), &pluginpb.GetRetentionScriptRequest{
+		OrgID:    utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440001"),
+		ScriptID: utils.ProtoFromUUIDStrOrNil("123e4567-e89b-12d3-a456-426655440000"),
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestServer_CreateRetentionScript(t *testing.T) {
+	tests := []struct {
+		name         string
+		orgID        string
+		pluginID     string
+		exportURL    string
+		expectedCode codes.Code
+	}{
+		{
+			name:         "custom URL on plugin allowing custom URLs",
+			orgID:        "223e4567-e89b-12d3-a456-426655440000",
+			pluginID:     "test-plugin",
+			exportURL:    "https://my-export-url",
+			expectedCode: codes.OK,
+		},
+		{
+			name:         "custom URL on plugin forbidding custom URLs",
+			orgID:        "223e4567-e89b-12d3-a456-426655440000",
+			pluginID:     "another-plugin",
+			exportURL:    "https://my-export-url",
+			expectedCode: codes.PermissionDenied,
+		},
+		{
+			name:         "default URL on plugin forbidding custom URLs",
+			orgID:        "223e4567-e89b-12d3-a456-426655440000",
+			pluginID:     "another-plugin",
+			exportURL:    "http://another-export-url",
+			expectedCode: codes.OK,
+		},
+		{
+			name:         "no URL on plugin forbidding custom URLs",
+			orgID:        "223e4567-e89b-12d3-a456-426655440000",
+			pluginID:     "another-plugin",
+			expectedCode: codes.OK,
+		},
+		{
+			name:         "plugin not enabled",
+			orgID:        "223e4567-e89b-12d3-a456-426655440001",
+			pluginID:     "another-plugin",
+			expectedCode: codes.NotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mustLoadTestData(db)
+			db.MustExec(`INSERT INTO org_data_retention_plugins(org_id, plugin_id, version) VALUES ($1, $2, $3)`, "223e4567-e89b-12d3-a456-426655440000", "another-plugin", "0.0.1")
+
+			s := controllers.New(db, "test")
+			resp, err := s.CreateRetentionScript(context.Background(), &pluginpb.CreateRetentionScriptRequest{
+				OrgID: utils.ProtoFromUUIDStrOrNil(test.orgID),
+				Script: &pluginpb.DetailedRetentionScript{
+					Script: &pluginpb.RetentionScript{
+						ScriptName:  "new script",
+						Description: "A new script",
+						FrequencyS:  60,
+						PluginId:    test.pluginID,
+						Enabled:     true,
+					},
+					Contents:  "new script contents",
+					ExportURL: test.exportURL,
+				},
+			})
+			assert.Equal(t, test.expectedCode, status.Code(err))
+			if test.expectedCode != codes.OK {
+				return
+			}
+
+			scriptResp, err := s.GetRetentionScript(context.Background(), &pluginpb.GetRetentionScriptRequest{
+				OrgID:    utils.ProtoFromUUIDStrOrNil(test.orgID),
+				ScriptID: resp.ID,
+			})
+			require.NoError(t, err)
+			assert.Equal(t, "new script", scriptResp.Script.Script.ScriptName)
+			assert.Equal(t, test.pluginID, scriptResp.Script.Script.PluginId)
+			assert.Equal(t, "new script contents", scriptResp.Script.Contents)
+			assert.Equal(t, test.exportURL, scriptResp.Script.ExportURL)
+		})
+	}
+}
+
+func TestServer_UpdateRetentionScript(t *testing.T) {
+	tests := []struct {
+		name           string
+		request        *pluginpb.UpdateRetentionScriptRequest
+		expectedCode   codes.Code
+		expectedScript *pluginpb.DetailedRetentionScript
+	}{
+		{
+			name: "frequency only",
+			request: &pluginpb.UpdateRetentionScriptRequest{
+				OrgID:      utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
+				ScriptID:   utils.ProtoFromUUIDStrOrNil("123e4567-e89b-12d3-a456-426655440001"),
+				FrequencyS: &types.Int64Value{Value: 60},
+			},
+			expectedCode: codes.OK,
+			expectedScript: &pluginpb.DetailedRetentionScript{
+				Script: &pluginpb.RetentionScript{
+					ScriptID:    utils.ProtoFromUUIDStrOrNil("123e4567-e89b-12d3-a456-426655440001"),
+					ScriptName:  "http/data",
+					Description: "This is another script to get http data",
+					FrequencyS:  60,
+					ClusterIDs:  []*uuidpb.UUID{},
+					PluginId:    "test-plugin",
+					Enabled:     false,
+					IsPreset:    false,
+				},
+				Contents:  "http script 2",
+				ExportURL: "http://test-export-url",
+			},
+		},
+		{
+			name: "several fields",
+			request: &pluginpb.UpdateRetentionScriptRequest{
+				OrgID:       utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
+				ScriptID:    utils.ProtoFromUUIDStrOrNil("123e4567-e89b-12d3-a456-426655440001"),
+				ScriptName:  &types.StringValue{Value: "new name"},
+				Description: &types.StringValue{Value: "new description"},
+				Contents:    &types.StringValue{Value: "new script"},
+				Enabled:     &types.BoolValue{Value: true},
+				ExportUrl:   &types.StringValue{Value: "http://new-export-url"},
+				ClusterIDs:  []*uuidpb.UUID{utils.ProtoFromUUIDStrOrNil("323e4567-e89b-12d3-a456-426655440000")},
+			},
+			expectedCode: codes.OK,
+			expectedScript: &pluginpb.DetailedRetentionScript{
+				Script: &pluginpb.RetentionScript{
+					ScriptID:    utils.ProtoFromUUIDStrOrNil("123e4567-e89b-12d3-a456-426655440001"),
+					ScriptName:  "new name",
+					Description: "new description",
+					FrequencyS:  20,
+					ClusterIDs:  []*uuidpb.UUID{utils.ProtoFromUUIDStrOrNil("323e4567-e89b-12d3-a456-426655440000")},
+					PluginId:    "test-plugin",
+					Enabled:     true,
+					IsPreset:    false,
+				},
+				Contents:  "new script",
+				ExportURL: "http://new-export-url",
+			},
+		},
+		{
+			name: "other org",
+			request: &pluginpb.UpdateRetentionScriptRequest{
+				OrgID:      utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440001"),
+				ScriptID:   utils.ProtoFromUUIDStrOrNil("123e4567-e89b-12d3-a456-426655440001"),
+				FrequencyS: &types.Int64Value{Value: 60},
+			},
+			expectedCode: codes.NotFound,
+		},
+		{
+			name: "zero frequency",
+			request: &pluginpb.UpdateRetentionScriptRequest{
+				OrgID:      utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
+				ScriptID:   utils.ProtoFromUUIDStrOrNil("123e4567-e89b-12d3-a456-426655440001"),
+				FrequencyS: &types.Int64Value{Value: 0},
+			},
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name: "frequency too long",
+			request: &pluginpb.UpdateRetentionScriptRequest{
+				OrgID:      utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
+				ScriptID:   utils.ProtoFromUUIDStrOrNil("123e4567-e89b-12d3-a456-426655440001"),
+				FrequencyS: &types.Int64Value{Value: 7 * 24 * 60 * 60},
+			},
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name: "preset contents",
+			request: &pluginpb.UpdateRetentionScriptRequest{
+				OrgID:    utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
+				ScriptID: utils.ProtoFromUUIDStrOrNil("123e4567-e89b-12d3-a456-426655440000"),
+				Contents: &types.StringValue{Value: "new script"},
+			},
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name: "duplicate name",
+			request: &pluginpb.UpdateRetentionScriptRequest{
+				OrgID:      utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
+				ScriptID:   utils.ProtoFromUUIDStrOrNil("123e4567-e89b-12d3-a456-426655440001"),
+				ScriptName: &types.StringValue{Value: "http data"},
+			},
+			expectedCode: codes.AlreadyExists,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mustLoadTestData(db)
+
+			s := controllers.New(db, "test")
+			_, err := s.UpdateRetentionScript(context.Background(), test.request)
+			assert.Equal(t, test.expectedCode, status.Code(err))
+			if test.expectedScript == nil {
+				return
+			}
+
+			resp, err := s.GetRetentionScript(context.Background(), &pluginpb.GetRetentionScriptRequest{
+				OrgID:    test.request.OrgID,
+				ScriptID: test.request.ScriptID,
+			})
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedScript, resp.Script)
+		})
+	}
+}
+
+func TestServer_UpdateRetentionScriptCustomExportURL(t *testing.T) {
+	mustLoadTestData(db)
+	db.MustExec(`UPDATE data_retention_plugin_releases SET allow_custom_export_url='false' WHERE plugin_id=$1 AND version=$2`, "test-plugin", "0.0.3")
+
+	s := controllers.New(db, "test")
+	orgID := utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000")
+	scriptID := utils.ProtoFromUUIDStrOrNil("123e4567-e89b-12d3-a456-426655440001")
+
+	_, err := s.UpdateRetentionScript(context.Background(), &pluginpb.UpdateRetentionScriptRequest{
+		OrgID:     orgID,
+		ScriptID:  scriptID,
+		ExportUrl: &types.StringValue{Value: "http://custom-export-url"},
+	})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// The release's default export URL is always allowed.
+	_, err = s.UpdateRetentionScript(context.Background(), &pluginpb.UpdateRetentionScriptRequest{
+		OrgID:     orgID,
+		ScriptID:  scriptID,
+		ExportUrl: &types.StringValue{Value: "http://test-export-url3"},
+	})
+	require.NoError(t, err)
+}
+
+func TestServer_UpdateRetentionScriptBelowOrgMinFrequency(t *testing.T) {
+	mustLoadTestData(db)
+	db.MustExec(`UPDATE org_data_retention_plugins SET min_frequency_s=$1 WHERE org_id=$2 AND plugin_id=$3`, 30, "223e4567-e89b-12d3-a456-426655440000", "test-plugin")
+
+	s := controllers.New(db, "test")
+	_, err := s.UpdateRetentionScript(context.Background(), &pluginpb.UpdateRetentionScriptRequest{
+		OrgID:      utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
+		ScriptID:   utils.ProtoFromUUIDStrOrNil("123e4567-e89b-12d3-a456-426655440001"),
+		FrequencyS: &types.Int64Value{Value: 15},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = s.UpdateRetentionScript(context.Background(), &pluginpb.UpdateRetentionScriptRequest{
+		OrgID:      utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
+		ScriptID:   utils.ProtoFromUUIDStrOrNil("123e4567-e89b-12d3-a456-426655440001"),
+		FrequencyS: &types.Int64Value{Value: 30},
+	})
+	require.NoError(t, err)
+}
+
+func TestServer_ValidateRetentionScript(t *testing.T) {
+	tests := []struct {
+		name             string
+		contents         string
+		expectedProblems []*pluginpb.ValidateRetentionScriptResponse_Problem
+	}{
+		{
+			name: "valid",
+			contents: `import px
+
+# Export the http events (see https://docs.px.dev).
+df = px.DataFrame(table='http_events', start_time=px.plugin.start_time)
+df = df[['time_', "req_path"]]
+px.export(df, px.otel.Data(
+    endpoint=px.otel.Endpoint(url="{{ .Config.url }}"),
+    resource={'service.name': df.req_path},
+))`,
+		},
+		{
+			name:     "empty",
+			contents: "  \n",
+			expectedProblems: []*pluginpb.ValidateRetentionScriptResponse_Problem{
+				{Message: "Script is empty"},
+			},
+		},
+		{
+			name: "unbalanced brackets and strings",
+			contents: `import px
+df = px.DataFrame(table='http_events)
+df = df[['time_']]]
+px.export(df, px.otel.Data(
+`,
+			expectedProblems: []*pluginpb.ValidateRetentionScriptResponse_Problem{
+				{Line: 2, Message: "String is never closed"},
+				{Line: 3, Message: "Unexpected ']'"},
+				{Line: 2, Message: "'(' is never closed"},
+				{Line: 4, Message: "'(' is never closed"},
+				{Line: 4, Message: "'(' is never closed"},
+			},
+		},
+		{
+			name:     "no import or export",
+			contents: "df = px.DataFrame(table='http_events')\n# px.export(df)\n",
+			expectedProblems: []*pluginpb.ValidateRetentionScriptResponse_Problem{
+				{Message: "Script must import px"},
+				{Message: "Script must export its data with px.export"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := controllers.New(db, "test")
+			resp, err := s.ValidateRetentionScript(context.Background(), &pluginpb.ValidateRetentionScriptRequest{
+				Contents: test.contents,
+			})
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedProblems, resp.Problems)
+		})
+	}
+
+	s := controllers.New(db, "test")
+	resp, err := s.ValidateRetentionScript(context.Background(), &pluginpb.ValidateRetentionScriptRequest{
+		Contents: "import px\npx.export(df, url='{{ .Config.url')\n",
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(resp.Problems))
+	assert.Contains(t, resp.Problems[0].Message, "Invalid config placeholder")
+}
+
+func TestServer_SetRetentionScriptFrequency(t *testing.T) {
+	mustLoadTestData(db)
+	db.MustExec(`UPDATE org_data_retention_plugins SET min_frequency_s=$1 WHERE org_id=$2 AND plugin_id=$3`, 30, "223e4567-e89b-12d3-a456-426655440000", "test-plugin")
+
+	s := controllers.New(db, "test")
+	orgID := utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000")
+	scriptID := utils.ProtoFromUUIDStrOrNil("123e4567-e89b-12d3-a456-426655440000")
+
+	// A script which has never run is due immediately.
+	resp, err := s.SetRetentionScriptFrequency(context.Background(), &pluginpb.SetRetentionScriptFrequencyRequest{
+		OrgID:      orgID,
+		ScriptID:   scriptID,
+		FrequencyS: 60,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp.NextRunAt)
+
+	lastRunAt := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	runAt, _ := types.TimestampProto(lastRunAt)
+	_, err = s.RecordScriptRun(context.Background(), &pluginpb.RecordScriptRunRequest{
+		ScriptID: scriptID,
+		Status:   pluginpb.RUN_STATUS_SUCCESS,
+		RunAt:    runAt,
+	})
+	require.NoError(t, err)
+	_, err = s.UpdateRetentionScript(context.Background(), &pluginpb.UpdateRetentionScriptRequest{
+		OrgID:        orgID,
+		ScriptID:     scriptID,
+		CronSchedule: &types.StringValue{Value: "0 2 * * *"},
+	})
+	require.NoError(t, err)
+
+	// The next run is rescheduled from the last run, and the cron schedule is cleared.
+	resp, err = s.SetRetentionScriptFrequency(context.Background(), &pluginpb.SetRetentionScriptFrequencyRequest{
+		OrgID:      orgID,
+		ScriptID:   scriptID,
+		FrequencyS: 300,
+	})
+	require.NoError(t, err)
+	expectedNextRunAt, _ := types.TimestampProto(lastRunAt.Add(300 * time.Second))
+	assert.Equal(t, expectedNextRunAt, resp.NextRunAt)
+
+	script, err := s.GetRetentionScript(context.Background(), &pluginpb.GetRetentionScriptRequest{
+		OrgID:    orgID,
+		ScriptID: scriptID,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(300), script.Script.Script.FrequencyS)
+	assert.Equal(t, "", script.Script.Script.CronSchedule)
+
+	tests := []struct {
+		name         string
+		orgID        string
+		frequencyS   int64
+		expectedCode codes.Code
+	}{
+		{
+			name:         "zero frequency",
+			orgID:        "223e4567-e89b-12d3-a456-426655440000",
+			frequencyS:   0,
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "below org minimum",
+			orgID:        "223e4567-e89b-12d3-a456-426655440000",
+			frequencyS:   15,
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "another org's script",
+			orgID:        "223e4567-e89b-12d3-a456-426655440001",
+			frequencyS:   60,
+			expectedCode: codes.NotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := s.SetRetentionScriptFrequency(context.Background(), &pluginpb.SetRetentionScriptFrequencyRequest{
+				OrgID:      utils.ProtoFromUUIDStrOrNil(test.orgID),
+				ScriptID:   scriptID,
+				FrequencyS: test.frequencyS,
+			})
+			assert.Equal(t, test.expectedCode, status.Code(err))
+		})
+	}
+}
+
+func TestServer_GetScriptOwner(t *testing.T) {
+	mustLoadTestData(db)
+
+	s := controllers.New(db, "test")
+	resp, err := s.GetScriptOwner(context.Background(), &pluginpb.GetScriptOwnerRequest{
+		ScriptID: utils.ProtoFromUUIDStrOrNil("123e4567-e89b-12d3-a456-426655440002"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &pluginpb.GetScriptOwnerResponse{
+		OrgID:         utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440001"),
+		PluginID:      "test-plugin",
+		PluginVersion: "0.0.2",
+	}, resp)
+
+	_, err = s.GetScriptOwner(context.Background(), &pluginpb.GetScriptOwnerRequest{
+		ScriptID: utils.ProtoFromUUIDStrOrNil("123e4567-e89b-12d3-a456-426655449999"),
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestServer_SetPresetScriptOverride(t *testing.T) {
+	mustLoadTestData(db)
+
+	orgID := utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000")
+	scriptID := utils.ProtoFromUUIDStrOrNil("123e4567-e89b-12d3-a456-426655440000")
+
+	s := controllers.New(db, "test")
+	_, err := s.SetPresetScriptOverride(context.Background(), &pluginpb.SetPresetScriptOverrideRequest{
+		OrgID:        orgID,
+		ScriptID:     scriptID,
+		OverrideBody: &types.StringValue{Value: "overridden http script"},
+	})
+	require.NoError(t, err)
+
+	resp, err := s.GetRetentionScript(context.Background(), &pluginpb.GetRetentionScriptRequest{
+		OrgID:    orgID,
+		ScriptID: scriptID,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "overridden http script", resp.Script.Contents)
+	assert.True(t, resp.Script.IsOverridden)
+
+	// Other orgs' preset scripts are unaffected.
+	resp, err = s.GetRetentionScript(context.Background(), &pluginpb.GetRetentionScriptRequest{
+		OrgID:    utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440001"),
+		ScriptID: utils.ProtoFromUUIDStrOrNil("123e4567-e89b-12d3-a456-426655440002"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "dns script", resp.Script.Contents)
+	assert.False(t, resp.Script.IsOverridden)
+
+	// Clearing the override restores the preset's contents.
+	_, err = s.SetPresetScriptOverride(context.Background(), &pluginpb.SetPresetScriptOverrideRequest{
+		OrgID:    orgID,
+		ScriptID: scriptID,
+	})
+	require.NoError(t, err)
+
+	resp, err = s.GetRetentionScript(context.Background(), &pluginpb.GetRetentionScriptRequest{
+		OrgID:    orgID,
+		ScriptID: scriptID,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "http script", resp.Script.Contents)
+	assert.False(t, resp.Script.IsOverridden)
+
+	// Custom scripts cannot be overridden.
+	_, err = s.SetPresetScriptOverride(context.Background(), &pluginpb.SetPresetScriptOverrideRequest{
+		OrgID:        orgID,
+		ScriptID:     utils.ProtoFromUUIDStrOrNil("123e4567-e89b-12d3-a456-426655440001"),
+		OverrideBody: &types.StringValue{Value: "overridden http script"},
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServer_GetReleaseDeletionImpactBetaFallback(t *testing.T) {
+	mustLoadTestData(db)
+	db.MustExec(`UPDATE plugin_releases SET yanked='true' WHERE id=$1 AND version=$2`, "test-plugin", "0.0.1")
+	db.MustExec(`UPDATE plugin_releases SET release_channel=$1 WHERE id=$2 AND version=$3`, "beta", "test-plugin", "0.0.3")
+
+	s := controllers.New(db, "test")
+	resp, err := s.GetReleaseDeletionImpact(context.Background(), &pluginpb.GetReleaseDeletionImpactRequest{
+		ID:      "test-plugin",
+		Version: "0.0.2",
+	})
+	require.NoError(t, err)
+	// Orgs are only moved to stable releases, so the beta release is not a fallback.
+	assert.Equal(t, &pluginpb.GetReleaseDeletionImpactResponse{
+		Orgs: []*pluginpb.GetReleaseDeletionImpactResponse_AffectedOrg{
+			{
+				OrgID: utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440001"),
+			},
+		},
+	}, resp)
+}
+
+func TestServer_GetReleaseDeletionImpact(t *testing.T) {
+	mustLoadTestData(db)
+
+	insertOrgRelease := `INSERT INTO org_data_retention_plugins(org_id, plugin_id, version, configurations) VALUES ($1, $2, $3, PGP_SYM_ENCRYPT($4, $5))`
+	db.MustExec(insertOrgRelease, "223e4567-e89b-12d3-a456-426655440002", "test-plugin", "0.0.2", []byte(`{}`), "test")
+	db.MustExec(`UPDATE plugin_releases SET yanked='true' WHERE id=$1 AND version=$2`, "test-plugin", "0.0.3")
+
+	s := controllers.New(db, "test")
+
+	tests := []struct {
+		name         string
+		version      string
+		expectedResp *pluginpb.GetReleaseDeletionImpactResponse
+	}{
+		{
+			name:    "orgs with fallback",
+			version: "0.0.2",
+			expectedResp: &pluginpb.GetReleaseDeletionImpactResponse{
+				Orgs: []*pluginpb.GetReleaseDeletionImpactResponse_AffectedOrg{
+					{
+						OrgID:           utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440001"),
+						HasFallback:     true,
+						FallbackVersion: "0.0.1",
+					},
+					{
+						OrgID:           utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440002"),
+						HasFallback:     true,
+						FallbackVersion: "0.0.1",
+					},
+				},
+			},
+		},
+		{
+			name:    "yanked releases are not fallbacks",
+			version: "0.0.1",
+			expectedResp: &pluginpb.GetReleaseDeletionImpactResponse{
+				Orgs: []*pluginpb.GetReleaseDeletionImpactResponse_AffectedOrg{},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, err := s.GetReleaseDeletionImpact(context.Background(), &pluginpb.GetReleaseDeletionImpactRequest{
+				ID:      "test-plugin",
+				Version: test.version,
+			})
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedResp, resp)
+		})
+	}
+
+	db.MustExec(`DELETE FROM data_retention_plugin_releases WHERE plugin_id=$1 AND version=$2`, "test-plugin", "0.0.1")
+	db.MustExec(`DELETE FROM plugin_releases WHERE id=$1 AND version=$2`, "test-plugin", "0.0.1")
+	resp, err := s.GetReleaseDeletionImpact(context.Background(), &pluginpb.GetReleaseDeletionImpactRequest{
+		ID:      "test-plugin",
+		Version: "0.0.2",
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(resp.Orgs))
+	for _, o := range resp.Orgs {
+		assert.False(t, o.HasFallback)
+		assert.Equal(t, "", o.FallbackVersion)
+	}
+}
+
+func TestServer_GetOrgsUsingPlugin(t *testing.T) {
+	mustLoadTestData(db)
+
+	sCtx := authcontext.New()
+	sCtx.Claims = svcutils.GenerateJWTForService("vzmgr", "withpixie.ai")
+	serviceCtx := authcontext.NewContext(context.Background(), sCtx)
+
+	tests := []struct {
+		name         string
+		ctx          context.Context
+		pluginID     string
+		version      string
+		expectedResp *pluginpb.GetOrgsUsingPluginResponse
+		expectedCode codes.Code
+	}{
+		{
+			name:     "all versions",
+			ctx:      serviceCtx,
+			pluginID: "test-plugin",
+			expectedResp: &pluginpb.GetOrgsUsingPluginResponse{
+				Orgs: []*pluginpb.GetOrgsUsingPluginResponse_OrgUsage{
+					{
+						OrgID:   utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
+						Version: "0.0.3",
+					},
+					{
+						OrgID:   utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440001"),
+						Version: "0.0.2",
+					},
+				},
+			},
+		},
+		{
+			name:     "single version",
+			ctx:      serviceCtx,
+			pluginID: "test-plugin",
+			version:  "0.0.2",
+			expectedResp: &pluginpb.GetOrgsUsingPluginResponse{
+				Orgs: []*pluginpb.GetOrgsUsingPluginResponse_OrgUsage{
+					{
+						OrgID:   utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440001"),
+						Version: "0.0.2",
+					},
+				},
+			},
+		},
+		{
+			name:     "unused plugin",
+			ctx:      serviceCtx,
+			pluginID: "another-plugin",
+			expectedResp: &pluginpb.GetOrgsUsingPluginResponse{
+				Orgs: []*pluginpb.GetOrgsUsingPluginResponse_OrgUsage{},
+			},
+		},
+		{
+			name:         "missing plugin ID",
+			ctx:          serviceCtx,
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "not a service",
+			ctx:          context.Background(),
+			pluginID:     "test-plugin",
+			expectedCode: codes.PermissionDenied,
+		},
+	}
+
+	s := controllers.New(db, "test")
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, err := s.GetOrgsUsingPlugin(test.ctx, &pluginpb.GetOrgsUsingPluginRequest{
+				PluginID: test.pluginID,
+				Version:  test.version,
+			})
+			assert.Equal(t, test.expectedCode, status.Code(err))
+			assert.Equal(t, test.expectedResp, resp)
+		})
+	}
+}
+
+func TestServer_TypedConfigurations(t *testing.T) {
+	mustLoadTestData(db)
+
+	releaseConfigs := &types.Struct{
+		Fields: map[string]*types.Value{
+			"endpoints": {Kind: &types.Value_StringValue{StringValue: "A list of endpoints to export to"}},
+		},
+	}
+
+	s := controllers.New(db, "test")
+	_, err := s.CreatePluginRelease(context.Background(), &pluginpb.CreatePluginReleaseRequest{
+		Name:    "test_plugin",
+		ID:      "test-plugin",
+		Version: "0.0.4",
+		RetentionConfig: &pluginpb.RetentionReleaseConfig{
+			Configurations:      map[string]string{"license_key4": "This is what we use to authenticate 4"},
+			TypedConfigurations: releaseConfigs,
+		},
+	})
+	require.NoError(t, err)
+
+	configResp, err := s.GetRetentionPluginConfig(context.Background(), &pluginpb.GetRetentionPluginConfigRequest{
+		ID:      "test-plugin",
+		Version: "0.0.4",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, releaseConfigs, configResp.TypedConfigurations)
+
+	orgConfigs := &types.Struct{
+		Fields: map[string]*types.Value{
+			"endpoints": {Kind: &types.Value_ListValue{ListValue: &types.ListValue{
+				Values: []*types.Value{
+					{Kind: &types.Value_StringValue{StringValue: "http://endpoint1"}},
+					{Kind: &types.Value_StringValue{StringValue: "http://endpoint2"}},
+				},
+			}}},
+			"batch": {Kind: &types.Value_StructValue{StructValue: &types.Struct{
+				Fields: map[string]*types.Value{
+					"size":    {Kind: &types.Value_NumberValue{NumberValue: 100}},
+					"enabled": {Kind: &types.Value_BoolValue{BoolValue: true}},
+				},
+			}}},
+		},
+	}
+
+	orgID := utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000")
+	_, err = s.UpdateOrgRetentionPluginConfig(context.Background(), &pluginpb.UpdateOrgRetentionPluginConfigRequest{
+		OrgID:               orgID,
+		PluginID:            "test-plugin",
+		Configurations:      map[string]string{"license_key4": "abcd"},
+		TypedConfigurations: orgConfigs,
+		Version:             &types.StringValue{Value: "0.0.4"},
+	})
+	require.NoError(t, err)
+
+	resp, err := s.GetOrgRetentionPluginConfig(context.Background(), &pluginpb.GetOrgRetentionPluginConfigRequest{
+		OrgID:    orgID,
+		PluginID: "test-plugin",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"license_key4": "abcd"}, resp.Configurations)
+	assert.Equal(t, orgConfigs, resp.TypedConfigurations)
+
+	// Updating only the string configurations leaves the typed configurations as-is.
+	_, err = s.UpdateOrgRetentionPluginConfig(context.Background(), &pluginpb.UpdateOrgRetentionPluginConfigRequest{
+		OrgID:          orgID,
+		PluginID:       "test-plugin",
+		Configurations: map[string]string{"license_key4": "efgh"},
+	})
+	require.NoError(t, err)
+
+	resp, err = s.GetOrgRetentionPluginConfig(context.Background(), &pluginpb.GetOrgRetentionPluginConfigRequest{
+		OrgID:    orgID,
+		PluginID: "test-plugin",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"license_key4": "efgh"}, resp.Configurations)
+	assert.Equal(t, orgConfigs, resp.TypedConfigurations)
+
+	// Orgs without typed configurations continue to work with string configurations.
+	resp, err = s.GetOrgRetentionPluginConfig(context.Background(), &pluginpb.GetOrgRetentionPluginConfigRequest{
+		OrgID:    utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440001"),
+		PluginID: "test-plugin",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"license_key3": "hello"}, resp.Configurations)
+	assert.Nil(t, resp.TypedConfigurations)
+}
+
+func TestServer_GetConfigJSONSchema(t *testing.T) {
+	mustLoadTestData(db)
+
+	typedConfigs := &types.Struct{
+		Fields: map[string]*types.Value{
+			"endpoints": {Kind: &types.Value_StructValue{StructValue: &types.Struct{
+				Fields: map[string]*types.Value{
+					"type": {Kind: &types.Value_StringValue{StringValue: "array"}},
+					"items": {Kind: &types.Value_StructValue{StructValue: &types.Struct{
+						Fields: map[string]*types.Value{
+							"type": {Kind: &types.Value_StringValue{StringValue: "string"}},
+						},
+					}}},
+				},
+			}}},
+			"extra": {Kind: &types.Value_StringValue{StringValue: "Any extra settings"}},
+		},
+	}
+
+	s := controllers.New(db, "test")
+	_, err := s.CreatePluginRelease(context.Background(), &pluginpb.CreatePluginReleaseRequest{
+		Name:    "test_plugin",
+		ID:      "test-plugin",
+		Version: "0.0.4",
+		RetentionConfig: &pluginpb.RetentionReleaseConfig{
+			Configurations:      map[string]string{"license_key4": "This is what we use to authenticate 4"},
+			TypedConfigurations: typedConfigs,
+		},
+	})
+	require.NoError(t, err)
+
+	resp, err := s.GetConfigJSONSchema(context.Background(), &pluginpb.GetConfigJSONSchemaRequest{
+		ID:      "test-plugin",
+		Version: "0.0.4",
+	})
+	require.NoError(t, err)
+	assert.Contains(t, resp.Schema, `"$schema":"https://json-schema.org/draft/2020-12/schema"`)
+
+	// The generated schema only uses keywords which have the same meaning in draft-07, which the library supports.
+	sl := gojsonschema.NewSchemaLoader()
+	sl.Draft = gojsonschema.Draft7
+	sl.AutoDetect = false
+	schema, err := sl.Compile(gojsonschema.NewStringLoader(resp.Schema))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name          string
+		config        string
+		expectedValid bool
+	}{
+		{
+			name:          "compliant",
+			config:        `{"license_key4": "abcd", "endpoints": ["http://endpoint1"], "extra": {"a": 1}}`,
+			expectedValid: true,
+		},
+		{
+			name:          "wrong type",
+			config:        `{"license_key4": "abcd", "endpoints": "http://endpoint1"}`,
+			expectedValid: false,
+		},
+		{
+			name:          "non-string config",
+			config:        `{"license_key4": 1234}`,
+			expectedValid: false,
+		},
+		{
+			name:          "unknown key",
+			config:        `{"license_key": "abcd"}`,
+			expectedValid: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := schema.Validate(gojsonschema.NewStringLoader(test.config))
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedValid, result.Valid())
+		})
+	}
+
+	_, err = s.GetConfigJSONSchema(context.Background(), &pluginpb.GetConfigJSONSchemaRequest{
+		ID:      "test-plugin",
+		Version: "1.0.0",
+	})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestServer_GetPluginConfigDiff(t *testing.T) {
+	mustLoadTestData(db)
+
+	s := controllers.New(db, "test")
+	_, err := s.CreatePluginRelease(context.Background(), &pluginpb.CreatePluginReleaseRequest{
+		Name:    "test_plugin",
+		ID:      "test-plugin",
+		Version: "0.0.4",
+		RetentionConfig: &pluginpb.RetentionReleaseConfig{
+			Configurations: map[string]string{
+				"license_key3": "This is what we use to authenticate 3",
+				"region":       "The region to export to",
+			},
+		},
+	})
+	require.NoError(t, err)
+	_, err = s.CreatePluginRelease(context.Background(), &pluginpb.CreatePluginReleaseRequest{
+		Name:    "test_plugin",
+		ID:      "test-plugin",
+		Version: "0.0.5",
+		RetentionConfig: &pluginpb.RetentionReleaseConfig{
+			Configurations: map[string]string{
+				"license_key3": "This is what we use to authenticate 3",
+				"region":       "The region, such as us-east-1, to export to",
+				"endpoint":     "The endpoint to export to",
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		fromVersion  string
+		toVersion    string
+		expectedCode codes.Code
+		expectedResp *pluginpb.GetPluginConfigDiffResponse
+	}{
+		{
+			name:         "all keys differ",
+			fromVersion:  "0.0.2",
+			toVersion:    "0.0.3",
+			expectedCode: codes.OK,
+			expectedResp: &pluginpb.GetPluginConfigDiffResponse{
+				Added:   []string{"license_key3"},
+				Removed: []string{"license_key2"},
+			},
+		},
+		{
+			name:         "added, changed and unchanged keys",
+			fromVersion:  "0.0.4",
+			toVersion:    "0.0.5",
+			expectedCode: codes.OK,
+			expectedResp: &pluginpb.GetPluginConfigDiffResponse{
+				Added:     []string{"endpoint"},
+				Changed:   []string{"region"},
+				Unchanged: []string{"license_key3"},
+			},
+		},
+		{
+			name:         "same version",
+			fromVersion:  "0.0.3",
+			toVersion:    "0.0.3",
+			expectedCode: codes.OK,
+			expectedResp: &pluginpb.GetPluginConfigDiffResponse{
+				Unchanged: []string{"license_key3"},
+			},
+		},
+		{
+			name:         "missing from version",
+			fromVersion:  "1.0.0",
+			toVersion:    "0.0.3",
+			expectedCode: codes.NotFound,
+		},
+		{
+			name:         "missing to version",
+			fromVersion:  "0.0.3",
+			toVersion:    "1.0.0",
+			expectedCode: codes.NotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, err := s.GetPluginConfigDiff(context.Background(), &pluginpb.GetPluginConfigDiffRequest{
+				PluginID:    "test-plugin",
+				FromVersion: test.fromVersion,
+				ToVersion:   test.toVersion,
+			})
+			assert.Equal(t, test.expectedCode, status.Code(err))
+			assert.Equal(t, test.expectedResp, resp)
+		})
+	}
+}
+
+// decryptionFailureCount gets the number of config decryption failures recorded for the plugin.
+func decryptionFailureCount(t *testing.T, pluginID string) float64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+	for _, f := range families {
+		if f.GetName() != "plugin_config_decryption_failures" {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "plugin_id" && l.GetValue() == pluginID {
+					return m.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	return 0
+}
+
+func TestServer_ConfigDecryptionFailureMetric(t *testing.T) {
+	mustLoadTestData(db)
+
+	before := decryptionFailureCount(t, "test-plugin")
+
+	s := controllers.New(db, "wrong-key")
+	_, err := s.GetOrgRetentionPluginConfig(context.Background(), &pluginpb.GetOrgRetentionPluginConfigRequest{
+		OrgID:    utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
+		PluginID: "test-plugin",
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.Internal, status.Code(err))
+	assert.Equal(t, before+1, decryptionFailureCount(t, "test-plugin"))
+
+	// Successful decryption is not counted.
+	s = controllers.New(db, "test")
+	_, err = s.GetOrgRetentionPluginConfig(context.Background(), &pluginpb.GetOrgRetentionPluginConfigRequest{
+		OrgID:    utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
+		PluginID: "test-plugin",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, before+1, decryptionFailureCount(t, "test-plugin"))
+
+	// Failures in queries over several plugins can't be attributed to a plugin.
+	beforeUnknown := decryptionFailureCount(t, "unknown")
+	beforeEmpty := decryptionFailureCount(t, "")
+	s = controllers.New(db, "wrong-key")
+	_, err = s.ListConfiguredPlugins(context.Background(), &pluginpb.ListConfiguredPluginsRequest{
+		OrgID: utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
+	})
+	assert.Equal(t, codes.Internal, status.Code(err))
+	assert.Equal(t, beforeUnknown+1, decryptionFailureCount(t, "unknown"))
+	assert.Equal(t, beforeEmpty, decryptionFailureCount(t, ""))
+}
+
+func TestServer_SetOrgDefaultExportURL(t *testing.T) {
+	mustLoadTestData(db)
+	// Org 223e4567-e89b-12d3-a456-426655440001 runs a release which doesn't allow custom export URLs.
+	db.MustExec(`UPDATE data_retention_plugin_releases SET allow_custom_export_url=false WHERE plugin_id=$1 AND version=$2`, "test-plugin", "0.0.2")
+
+	s := controllers.New(db, "test")
+	effectiveURL := func(orgID string) string {
+		resp, err := s.GetOrgRetentionPluginConfig(context.Background(), &pluginpb.GetOrgRetentionPluginConfigRequest{
+			OrgID:    utils.ProtoFromUUIDStrOrNil(orgID),
+			PluginID: "test-plugin",
+		})
+		require.NoError(t, err)
+		return resp.EffectiveExportURL
+	}
+	setDefaultURL := func(orgID string, url string) {
+		_, err := s.SetOrgDefaultExportURL(context.Background(), &pluginpb.SetOrgDefaultExportURLRequest{
+			OrgID:            utils.ProtoFromUUIDStrOrNil(orgID),
+			DefaultExportURL: url,
+		})
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, "http://test-export-url3", effectiveURL("223e4567-e89b-12d3-a456-426655440000"))
+
+	setDefaultURL("223e4567-e89b-12d3-a456-426655440000", "https://collector.example.com")
+	assert.Equal(t, "https://collector.example.com", effectiveURL("223e4567-e89b-12d3-a456-426655440000"))
+
+	// The org's custom export URL for the plugin takes precedence.
+	_, err := s.UpdateOrgRetentionPluginConfig(context.Background(), &pluginpb.UpdateOrgRetentionPluginConfigRequest{
+		OrgID:           utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
+		PluginID:        "test-plugin",
+		CustomExportURL: &types.StringValue{Value: "https://plugin-collector.example.com"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "https://plugin-collector.example.com", effectiveURL("223e4567-e89b-12d3-a456-426655440000"))
+
+	// Plugins which don't allow custom export URLs keep their default.
+	setDefaultURL("223e4567-e89b-12d3-a456-426655440001", "https://collector.example.com")
+	assert.Equal(t, "http://test-export-url2", effectiveURL("223e4567-e89b-12d3-a456-426655440001"))
+
+	// An empty URL clears the org's default.
+	db.MustExec(`UPDATE data_retention_plugin_releases SET allow_custom_export_url=true WHERE plugin_id=$1 AND version=$2`, "test-plugin", "0.0.2")
+	assert.Equal(t, "https://collector.example.com", effectiveURL("223e4567-e89b-12d3-a456-426655440001"))
+	setDefaultURL("223e4567-e89b-12d3-a456-426655440001", "")
+	assert.Equal(t, "http://test-export-url2", effectiveURL("223e4567-e89b-12d3-a456-426655440001"))
+
+	_, err = s.SetOrgDefaultExportURL(context.Background(), &pluginpb.SetOrgDefaultExportURLRequest{
+		OrgID:            utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
+		DefaultExportURL: "collector",
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServer_GetOrgRetentionPluginConfigRedaction(t *testing.T) {
+	mustLoadTestData(db)
+
+	serviceContext := func(serviceID string) context.Context {
+		sCtx := authcontext.New()
+		sCtx.Claims = svcutils.GenerateJWTForService(serviceID, "withpixie.ai")
+		return authcontext.NewContext(context.Background(), sCtx)
+	}
+
+	tests := []struct {
+		name         string
+		ctx          context.Context
+		expectedResp *pluginpb.GetOrgRetentionPluginConfigResponse
+	}{
+		{
+			name: "authorized service",
+			ctx:  serviceContext("vzmgr"),
+			expectedResp: &pluginpb.GetOrgRetentionPluginConfigResponse{
+				Configurations:     map[string]string{"license_key2": "12345"},
+				EffectiveExportURL: "http://test-export-url3",
+			},
+		},
+		{
+			name: "unauthorized service",
+			ctx:  serviceContext("api"),
+			expectedResp: &pluginpb.GetOrgRetentionPluginConfigResponse{
+				Configurations:     map[string]string{"license_key2": "********"},
+				EffectiveExportURL: "http://test-export-url3",
+			},
+		},
+		{
+			name: "no identity",
+			ctx:  context.Background(),
+			expectedResp: &pluginpb.GetOrgRetentionPluginConfigResponse{
+				Configurations:     map[string]string{"license_key2": "********"},
+				EffectiveExportURL: "http://test-export-url3",
+			},
+		},
+	}
+
+	s := controllers.New(db, "test", controllers.WithDecryptedConfigServices("vzmgr"))
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, err := s.GetOrgRetentionPluginConfig(test.ctx, &pluginpb.GetOrgRetentionPluginConfigRequest{
+				OrgID:    utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
+				PluginID: "test-plugin",
+			})
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedResp, resp)
+		})
+	}
+}
+
+func TestServer_OrgConfigReadsRedaction(t *testing.T) {
+	mustLoadTestData(db)
+
+	sCtx := authcontext.New()
+	sCtx.Claims = svcutils.GenerateJWTForService("api", "withpixie.ai")
+	ctx := authcontext.NewContext(context.Background(), sCtx)
+	orgID := utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000")
+	db.MustExec(`INSERT INTO org_data_retention_plugin_config_history(org_id, plugin_id, version, configurations) VALUES ($1, $2, $3, PGP_SYM_ENCRYPT($4, $5))`,
+		"223e4567-e89b-12d3-a456-426655440000", "test-plugin", "0.0.2", `{"old_key": "secret"}`, "test")
+
+	s := controllers.New(db, "test", controllers.WithDecryptedConfigServices("vzmgr"))
+
+	t.Run("config at version", func(t *testing.T) {
+		resp, err := s.GetOrgRetentionPluginConfigAtVersion(ctx, &pluginpb.GetOrgRetentionPluginConfigAtVersionRequest{
+			OrgID:    orgID,
+			PluginID: "test-plugin",
+			Version:  "0.0.2",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"old_key": "********"}, resp.Configurations)
+	})
+
+	t.Run("config key across orgs", func(t *testing.T) {
+		resp, err := s.GetConfigKeyAcrossOrgs(ctx, &pluginpb.GetConfigKeyAcrossOrgsRequest{
+			PluginID: "test-plugin",
+			Key:      "license_key2",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"223e4567-e89b-12d3-a456-426655440000": "********"}, resp.Values)
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		resp, err := s.UpdateOrgRetentionPluginConfig(ctx, &pluginpb.UpdateOrgRetentionPluginConfigRequest{
+			OrgID:          orgID,
+			PluginID:       "test-plugin",
+			Configurations: map[string]string{"license_key2": "67890"},
+			DryRun:         true,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"license_key2": "********"}, resp.Configurations)
+	})
+}
+
+func TestServer_UpdateRetentionConfigsExpectedVersion(t *testing.T) {
+	tests := []struct {
+		name            string
+		expectedVersion *types.StringValue
+		expectedCode    codes.Code
+		expectedConfig  string
+	}{
+		{
+			name:            "matching version",
+			expectedVersion: &types.StringValue{Value: "0.0.3"},
+			expectedCode:    codes.OK,
+			expectedConfig:  "updated",
+		},
+		{
+			name:            "stale version",
+			expectedVersion: &types.StringValue{Value: "0.0.2"},
+			expectedCode:    codes.FailedPrecondition,
+			expectedConfig:  "12345",
+		},
+		{
+			name:            "expected not enabled",
+			expectedVersion: &types.StringValue{Value: ""},
+			expectedCode:    codes.FailedPrecondition,
+			expectedConfig:  "12345",
+		},
+		{
+			name:            "no expected version",
+			expectedVersion: nil,
+			expectedCode:    codes.OK,
+			expectedConfig:  "updated",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mustLoadTestData(db)
+
+			orgID := utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000")
+			s := controllers.New(db, "test")
+			_, err := s.UpdateOrgRetentionPluginConfig(context.Background(), &pluginpb.UpdateOrgRetentionPluginConfigRequest{
+				OrgID:           orgID,
+				PluginID:        "test-plugin",
+				Configurations:  map[string]string{"license_key2": "updated"},
+				ExpectedVersion: test.expectedVersion,
+			})
+			assert.Equal(t, test.expectedCode, status.Code(err))
+
+			resp, err := s.GetOrgRetentionPluginConfig(context.Background(), &pluginpb.GetOrgRetentionPluginConfigRequest{
+				OrgID:    orgID,
+				PluginID: "test-plugin",
+			})
+			require.NoError(t, err)
+			assert.Equal(t, map[string]string{"license_key2": test.expectedConfig}, resp.Configurations)
+		})
+	}
+}
+
+func TestServer_GetPluginPresetScriptHistory(t *testing.T) {
+	mustLoadTestData(db)
+
+	s := controllers.New(db, "test")
+	_, err := s.CreatePluginRelease(context.Background(), &pluginpb.CreatePluginReleaseRequest{
+		Name:    "test_plugin",
+		ID:      "test-plugin",
+		Version: "0.0.10",
+		RetentionConfig: &pluginpb.RetentionReleaseConfig{
+			PresetScripts: []*pluginpb.GetRetentionPluginConfigResponse_PresetScript{
+				&pluginpb.GetRetentionPluginConfigResponse_PresetScript{
+					Name:              "dns data",
+					Description:       "This is a newer script to get dns data",
+					DefaultFrequencyS: 10,
+					Script:            "script",
+				},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	resp, err := s.GetPluginPresetScriptHistory(context.Background(), &pluginpb.GetPluginPresetScriptHistoryRequest{
+		PluginID: "test-plugin",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &pluginpb.GetPluginPresetScriptHistoryResponse{
+		Releases: []*pluginpb.GetPluginPresetScriptHistoryResponse_ReleasePresetScripts{
+			{
+				Version: "0.0.1",
+				PresetScripts: []*pluginpb.GetPluginPresetScriptHistoryResponse_PresetScript{
+					{Name: "http data", Description: "This is a script to get http data"},
+					{Name: "http data 2", Description: "This is a script to get http data 2"},
+				},
+			},
+			{
+				Version: "0.0.2",
+				PresetScripts: []*pluginpb.GetPluginPresetScriptHistoryResponse_PresetScript{
+					{Name: "dns data", Description: "This is a script to get dns data"},
+					{Name: "dns data 2", Description: "This is a script to get dns data 2"},
+				},
+			},
+			{
+				Version: "0.0.10",
+				PresetScripts: []*pluginpb.GetPluginPresetScriptHistoryResponse_PresetScript{
+					{Name: "dns data", Description: "This is a newer script to get dns data"},
+				},
+			},
+		},
+	}, resp)
+}
+
+func TestServer_ExportFormats(t *testing.T) {
+	mustLoadTestData(db)
+
+	s := controllers.New(db, "test")
+	_, err := s.CreatePluginRelease(context.Background(), &pluginpb.CreatePluginReleaseRequest{
+		Name:    "test_plugin",
+		ID:      "test-plugin",
+		Version: "0.0.4",
+		RetentionConfig: &pluginpb.RetentionReleaseConfig{
+			ExportFormats: []string{"json", "csv"},
+		},
+	})
+	require.NoError(t, err)
+	_, err = s.CreatePluginRelease(context.Background(), &pluginpb.CreatePluginReleaseRequest{
+		Name:    "another_plugin",
+		ID:      "another-plugin",
+		Version: "0.0.3",
+		RetentionConfig: &pluginpb.RetentionReleaseConfig{
+			ExportFormats: []string{"protobuf"},
+		},
+	})
+	require.NoError(t, err)
+
+	configResp, err := s.GetRetentionPluginConfig(context.Background(), &pluginpb.GetRetentionPluginConfigRequest{
+		ID:      "test-plugin",
+		Version: "0.0.4",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"json", "csv"}, configResp.ExportFormats)
+
+	tests := []struct {
+		name        string
+		format      string
+		expectedIDs []string
+	}{
+		{
+			name:        "json",
+			format:      "json",
+			expectedIDs: []string{"test-plugin"},
+		},
+		{
+			name:        "protobuf",
+			format:      "protobuf",
+			expectedIDs: []string{"another-plugin"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, err := s.GetPluginsForExportFormat(context.Background(), &pluginpb.GetPluginsForExportFormatRequest{
+				Format: test.format,
+			})
+			require.NoError(t, err)
+			ids := []string{}
+			for _, p := range resp.Plugins {
+				ids = append(ids, p.ID)
+			}
+			assert.Equal(t, test.expectedIDs, ids)
+		})
+	}
+
+	_, err = s.GetPluginsForExportFormat(context.Background(), &pluginpb.GetPluginsForExportFormatRequest{Format: "xml"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = s.CreatePluginRelease(context.Background(), &pluginpb.CreatePluginReleaseRequest{
+		Name:    "test_plugin",
+		ID:      "test-plugin",
+		Version: "0.0.5",
+		RetentionConfig: &pluginpb.RetentionReleaseConfig{
+			ExportFormats: []string{"json", "xml"},
+		},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServer_AuditConfigEncryptionConsistency(t *testing.T) {
+	mustLoadTestData(db)
+
+	insertOrgRelease := `INSERT INTO org_data_retention_plugins(org_id, plugin_id, version, configurations) VALUES ($1, $2, $3, PGP_SYM_ENCRYPT($4, $5))`
+	db.MustExec(insertOrgRelease, "223e4567-e89b-12d3-a456-426655440002", "test-plugin", "0.0.2", []byte(`{"license_key3":"old"}`), "old")
+	db.MustExec(insertOrgRelease, "223e4567-e89b-12d3-a456-426655440003", "test-plugin", "0.0.2", []byte(`{"license_key3":"foreign"}`), "foreign")
+
+	s := controllers.New(db, "test", controllers.WithPreviousDBKeys("old"))
+	mismatches, err := s.AuditConfigEncryptionConsistency(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []*controllers.EncryptionMismatch{
+		{
+			OrgID:    uuid.FromStringOrNil("223e4567-e89b-12d3-a456-426655440003"),
+			PluginID: "test-plugin",
+		},
+	}, mismatches)
+
+	// Without the previous key, rows encrypted with it are reported as well.
+	s = controllers.New(db, "test")
+	mismatches, err = s.AuditConfigEncryptionConsistency(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(mismatches))
+}
+
+func TestServer_UpdateRetentionConfigsFieldViolations(t *testing.T) {
+	tests := []struct {
+		name          string
+		request       *pluginpb.UpdateOrgRetentionPluginConfigRequest
+		expectedField string
+	}{
+		{
+			name: "missing org",
+			request: &pluginpb.UpdateOrgRetentionPluginConfigRequest{
+				PluginID: "test-plugin",
+			},
+			expectedField: "org_id",
+		},
+		{
+			name: "enabling without version",
+			request: &pluginpb.UpdateOrgRetentionPluginConfigRequest{
+				OrgID:    utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440002"),
+				PluginID: "test-plugin",
+				Enabled:  &types.BoolValue{Value: true},
+			},
+			expectedField: "version",
+		},
+		{
+			name: "nonexistent version",
+			request: &pluginpb.UpdateOrgRetentionPluginConfigRequest{
+				OrgID:    utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
+				PluginID: "test-plugin",
+				Version:  &types.StringValue{Value: "1.0.0"},
+			},
+			expectedField: "version",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mustLoadTestData(db)
+
+			s := controllers.New(db, "test")
+			_, err := s.UpdateOrgRetentionPluginConfig(context.Background(), test.request)
+			require.Error(t, err)
+
+			st := status.Convert(err)
+			assert.Equal(t, codes.InvalidArgument, st.Code())
+			require.Len(t, st.Details(), 1)
+			badRequest, ok := st.Details()[0].(*errdetails.BadRequest)
+			require.True(t, ok)
+			require.Len(t, badRequest.FieldViolations, 1)
+			assert.Equal(t, test.expectedField, badRequest.FieldViolations[0].Field)
+			// The top-level message is still set for callers which don't read the details.
+			assert.Equal(t, st.Message(), badRequest.FieldViolations[0].Description)
+		})
+	}
+}
+
+func TestServer_UpdateRetentionConfigsRequiredConfigurations(t *testing.T) {
+	mustLoadTestData(db)
+
+	s := controllers.New(db, "test")
+	_, err := s.CreatePluginRelease(context.Background(), &pluginpb.CreatePluginReleaseRequest{
+		Name:    "test_plugin",
+		ID:      "test-plugin",
+		Version: "0.0.4",
+		RetentionConfig: &pluginpb.RetentionReleaseConfig{
+			Configurations: map[string]string{
+				"license_key": "This is what we use to authenticate",
+				"region":      "The region to send data to",
+				"tier":        "The optional tier",
+			},
+			RequiredConfigurations: []string{"region", "license_key"},
+		},
+	})
+	require.NoError(t, err)
+
+	configResp, err := s.GetRetentionPluginConfig(context.Background(), &pluginpb.GetRetentionPluginConfigRequest{
+		ID:      "test-plugin",
+		Version: "0.0.4",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"region", "license_key"}, configResp.RequiredConfigurations)
+
+	// Enabling without the required keys fails, naming each missing key.
+	_, err = s.UpdateOrgRetentionPluginConfig(context.Background(), &pluginpb.UpdateOrgRetentionPluginConfigRequest{
+		OrgID:          utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440002"),
+		PluginID:       "test-plugin",
+		Enabled:        &types.BoolValue{Value: true},
+		Version:        &types.StringValue{Value: "0.0.4"},
+		Configurations: map[string]string{"region": "", "tier": "gold"},
+	})
+	st := status.Convert(err)
+	assert.Equal(t, codes.InvalidArgument, st.Code())
+	assert.Equal(t, "Missing required configurations: license_key, region", st.Message())
+	require.Len(t, st.Details(), 1)
+	badRequest, ok := st.Details()[0].(*errdetails.BadRequest)
+	require.True(t, ok)
+	require.Len(t, badRequest.FieldViolations, 2)
+	assert.Equal(t, "configurations.license_key", badRequest.FieldViolations[0].Field)
+	assert.Equal(t, "configurations.region", badRequest.FieldViolations[1].Field)
+
+	_, err = s.UpdateOrgRetentionPluginConfig(context.Background(), &pluginpb.UpdateOrgRetentionPluginConfigRequest{
+		OrgID:          utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440002"),
+		PluginID:       "test-plugin",
+		Enabled:        &types.BoolValue{Value: true},
+		Version:        &types.StringValue{Value: "0.0.4"},
+		Configurations: map[string]string{"region": "us", "license_key": "abcd"},
+	})
+	require.NoError(t, err)
+
+	// Disabling skips the check.
+	db.MustExec(`UPDATE org_data_retention_plugins SET version=$1 WHERE org_id=$2 AND plugin_id=$3`, "0.0.4", "223e4567-e89b-12d3-a456-426655440001", "test-plugin")
+	_, err = s.UpdateOrgRetentionPluginConfig(context.Background(), &pluginpb.UpdateOrgRetentionPluginConfigRequest{
+		OrgID:    utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440001"),
+		PluginID: "test-plugin",
+		Enabled:  &types.BoolValue{Value: false},
+	})
+	require.NoError(t, err)
+
+	// Required keys must be configurations of the release.
+	_, err = s.CreatePluginRelease(context.Background(), &pluginpb.CreatePluginReleaseRequest{
+		Name:    "test_plugin",
+		ID:      "test-plugin",
+		Version: "0.0.5",
+		RetentionConfig: &pluginpb.RetentionReleaseConfig{
+			Configurations:         map[string]string{"license_key": "This is what we use to authenticate"},
+			RequiredConfigurations: []string{"region"},
+		},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServer_UpdateOrgRetentionPluginConfigSecretConfigurations(t *testing.T) {
+	mustLoadTestData(db)
+
+	s := controllers.New(db, "test")
+	_, err := s.CreatePluginRelease(context.Background(), &pluginpb.CreatePluginReleaseRequest{
+		Name:    "test_plugin",
+		ID:      "test-plugin",
+		Version: "0.0.4",
+		RetentionConfig: &pluginpb.RetentionReleaseConfig{
+			Configurations: map[string]string{
+				"license_key": "This is what we use to authenticate",
+				"region":      "The region to send data to",
+			},
+			SecretConfigurations: []string{"license_key"},
+		},
+	})
+	require.NoError(t, err)
+
+	configResp, err := s.GetRetentionPluginConfig(context.Background(), &pluginpb.GetRetentionPluginConfigRequest{
+		ID:      "test-plugin",
+		Version: "0.0.4",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"license_key"}, configResp.SecretConfigurations)
+
+	orgID := "223e4567-e89b-12d3-a456-426655440002"
+	_, err = s.UpdateOrgRetentionPluginConfig(context.Background(), &pluginpb.UpdateOrgRetentionPluginConfigRequest{
+		OrgID:          utils.ProtoFromUUIDStrOrNil(orgID),
+		PluginID:       "test-plugin",
+		Enabled:        &types.BoolValue{Value: true},
+		Version:        &types.StringValue{Value: "0.0.4"},
+		Configurations: map[string]string{"region": "us-west", "license_key": "abcd"},
+	})
+	require.NoError(t, err)
+
+	// Only the secret keys are encrypted.
+	var secretConfigs, plaintextConfigs string
+	query := `SELECT PGP_SYM_DECRYPT(configurations, 'test'), plaintext_configurations FROM org_data_retention_plugins WHERE org_id=$1 AND plugin_id=$2`
+	err = db.QueryRowx(query, orgID, "test-plugin").Scan(&secretConfigs, &plaintextConfigs)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"license_key":"abcd"}`, secretConfigs)
+	assert.JSONEq(t, `{"region":"us-west"}`, plaintextConfigs)
+
+	resp, err := s.GetOrgRetentionPluginConfig(context.Background(), &pluginpb.GetOrgRetentionPluginConfigRequest{
+		OrgID:    utils.ProtoFromUUIDStrOrNil(orgID),
+		PluginID: "test-plugin",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"region": "us-west", "license_key": "abcd"}, resp.Configurations)
+
+	// Secret keys must be configurations of the release.
+	_, err = s.CreatePluginRelease(context.Background(), &pluginpb.CreatePluginReleaseRequest{
+		Name:    "test_plugin",
+		ID:      "test-plugin",
+		Version: "0.0.5",
+		RetentionConfig: &pluginpb.RetentionReleaseConfig{
+			Configurations:       map[string]string{"license_key": "This is what we use to authenticate"},
+			SecretConfigurations: []string{"region"},
+		},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServer_UpdateOrgRetentionPluginConfigCustomExportURL(t *testing.T) {
+	tests := []struct {
+		name            string
+		orgID           string
+		pluginID        string
+		version         string
+		customExportURL string
+		expectedCode    codes.Code
+		expectedURL     string
+	}{
 		{
-			name: "updating version and config",
-			request: &pluginpb.UpdateOrgRetentionPluginConfigRequest{
-				OrgID:    utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
-				PluginID: "test-plugin",
-				Version:  &types.StringValue{Value: "0.0.2"},
-				Configurations: map[string]string{
-					"abcd": "hello",
+			name:            "custom URL on plugin allowing custom URLs",
+			orgID:           "223e4567-e89b-12d3-a456-426655440000",
+			pluginID:        "test-plugin",
+			customExportURL: "https://my-export-url",
+			expectedCode:    codes.OK,
+			expectedURL:     "https://my-export-url",
+		},
+		{
+			name:            "custom URL on plugin forbidding custom URLs",
+			orgID:           "223e4567-e89b-12d3-a456-426655440000",
+			pluginID:        "another-plugin",
+			version:         "0.0.1",
+			customExportURL: "https://my-export-url",
+			expectedCode:    codes.PermissionDenied,
+		},
+		{
+			name:            "default URL on plugin forbidding custom URLs",
+			orgID:           "223e4567-e89b-12d3-a456-426655440000",
+			pluginID:        "another-plugin",
+			version:         "0.0.1",
+			customExportURL: "http://another-export-url",
+			expectedCode:    codes.OK,
+			expectedURL:     "http://another-export-url",
+		},
+		{
+			name:            "clearing URL on plugin forbidding custom URLs",
+			orgID:           "223e4567-e89b-12d3-a456-426655440000",
+			pluginID:        "another-plugin",
+			version:         "0.0.1",
+			customExportURL: "",
+			expectedCode:    codes.OK,
+			expectedURL:     "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mustLoadTestData(db)
+
+			s := controllers.New(db, "test")
+			req := &pluginpb.UpdateOrgRetentionPluginConfigRequest{
+				OrgID:           utils.ProtoFromUUIDStrOrNil(test.orgID),
+				PluginID:        test.pluginID,
+				CustomExportURL: &types.StringValue{Value: test.customExportURL},
+			}
+			if test.version != "" {
+				req.Enabled = &types.BoolValue{Value: true}
+				req.Version = &types.StringValue{Value: test.version}
+			}
+			_, err := s.UpdateOrgRetentionPluginConfig(context.Background(), req)
+			assert.Equal(t, test.expectedCode, status.Code(err))
+			if test.expectedCode != codes.OK {
+				return
+			}
+
+			resp, err := s.GetOrgRetentionPluginConfig(context.Background(), &pluginpb.GetOrgRetentionPluginConfigRequest{
+				OrgID:    utils.ProtoFromUUIDStrOrNil(test.orgID),
+				PluginID: test.pluginID,
+			})
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedURL, resp.CustomExportURL)
+		})
+	}
+}
+
+func TestServer_UpdateOrgRetentionPluginConfigSchema(t *testing.T) {
+	configSchema := `{
+		"type": "object",
+		"properties": {
+			"license_key4": {"type": "string", "pattern": "^[0-9]+$"},
+			"endpoints": {"type": "array"}
+		},
+		"required": ["license_key4"]
+	}`
+
+	tests := []struct {
+		name               string
+		version            string
+		configs            map[string]string
+		typedConfigs       *types.Struct
+		expectedCode       codes.Code
+		expectedViolations []string
+	}{
+		{
+			name:         "matching configs",
+			version:      "0.0.4",
+			configs:      map[string]string{"license_key4": "1234"},
+			expectedCode: codes.OK,
+		},
+		{
+			name:               "pattern mismatch",
+			version:            "0.0.4",
+			configs:            map[string]string{"license_key4": "abcd"},
+			expectedCode:       codes.InvalidArgument,
+			expectedViolations: []string{"configurations.license_key4"},
+		},
+		{
+			name:               "missing required config",
+			version:            "0.0.4",
+			configs:            map[string]string{"license_key": "1234"},
+			expectedCode:       codes.InvalidArgument,
+			expectedViolations: []string{"configurations.license_key4"},
+		},
+		{
+			name:    "typed config of wrong type",
+			version: "0.0.4",
+			configs: map[string]string{"license_key4": "1234"},
+			typedConfigs: &types.Struct{Fields: map[string]*types.Value{
+				"endpoints": {Kind: &types.Value_StringValue{StringValue: "http://endpoint"}},
+			}},
+			expectedCode:       codes.InvalidArgument,
+			expectedViolations: []string{"typed_configurations.endpoints"},
+		},
+		{
+			name:         "release without schema",
+			version:      "0.0.3",
+			configs:      map[string]string{"license_key4": "abcd"},
+			expectedCode: codes.OK,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mustLoadTestData(db)
+
+			s := controllers.New(db, "test")
+			_, err := s.CreatePluginRelease(context.Background(), &pluginpb.CreatePluginReleaseRequest{
+				Name:    "test_plugin",
+				ID:      "test-plugin",
+				Version: "0.0.4",
+				RetentionConfig: &pluginpb.RetentionReleaseConfig{
+					Configurations: map[string]string{"license_key4": "This is what we use to authenticate 4"},
+					ConfigSchema:   configSchema,
 				},
+			})
+			require.NoError(t, err)
+
+			_, err = s.UpdateOrgRetentionPluginConfig(context.Background(), &pluginpb.UpdateOrgRetentionPluginConfigRequest{
+				OrgID:               utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
+				PluginID:            "test-plugin",
+				Version:             &types.StringValue{Value: test.version},
+				Configurations:      test.configs,
+				TypedConfigurations: test.typedConfigs,
+			})
+			st := status.Convert(err)
+			assert.Equal(t, test.expectedCode, st.Code())
+			if test.expectedCode == codes.OK {
+				return
+			}
+
+			require.Len(t, st.Details(), 1)
+			badRequest, ok := st.Details()[0].(*errdetails.BadRequest)
+			require.True(t, ok)
+			fields := make([]string, len(badRequest.FieldViolations))
+			for i, v := range badRequest.FieldViolations {
+				fields[i] = v.Field
+				assert.NotEmpty(t, v.Description)
+			}
+			assert.Equal(t, test.expectedViolations, fields)
+		})
+	}
+}
+
+func TestServer_CreatePluginReleaseInvalidConfigSchema(t *testing.T) {
+	mustLoadTestData(db)
+
+	s := controllers.New(db, "test")
+	_, err := s.CreatePluginRelease(context.Background(), &pluginpb.CreatePluginReleaseRequest{
+		Name:    "test_plugin",
+		ID:      "test-plugin",
+		Version: "0.0.4",
+		RetentionConfig: &pluginpb.RetentionReleaseConfig{
+			ConfigSchema: `{"type": "not-a-type"}`,
+		},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServer_CreatePluginReleaseDuplicatePresetScripts(t *testing.T) {
+	mustLoadTestData(db)
+
+	s := controllers.New(db, "test")
+	_, err := s.CreatePluginRelease(context.Background(), &pluginpb.CreatePluginReleaseRequest{
+		Name:    "test_plugin",
+		ID:      "test-plugin",
+		Version: "0.0.4",
+		RetentionConfig: &pluginpb.RetentionReleaseConfig{
+			PresetScripts: []*pluginpb.GetRetentionPluginConfigResponse_PresetScript{
+				{Name: "http data", Script: "px.display()"},
+				{Name: "dns data", Script: "px.display()"},
+				{Name: "http data", Script: "px.display(http)"},
 			},
-			expectedOrgConfigs: []orgConfig{
-				orgConfig{
-					OrgID:    "223e4567-e89b-12d3-a456-426655440000",
-					PluginID: "test-plugin",
-					Version:  "0.0.2",
-					Configurations: map[string]string{
-						"abcd": "hello",
-					},
-				},
-				orgConfig{
-					OrgID:    "223e4567-e89b-12d3-a456-426655440001",
-					PluginID: "test-plugin",
-					Version:  "0.0.2",
-					Configurations: map[string]string{
-						"license_key3": "hello",
-					},
-				},
+		},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), "http data")
+	assert.NotContains(t, status.Convert(err).Message(), "dns data")
+
+	// The release should not have been created.
+	_, err = s.GetRetentionPluginConfig(context.Background(), &pluginpb.GetRetentionPluginConfigRequest{
+		ID:      "test-plugin",
+		Version: "0.0.4",
+	})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestServer_MigrateOrgToLatestVersion(t *testing.T) {
+	tests := []struct {
+		name             string
+		orgID            string
+		yankedVersion    string
+		betaVersion      string
+		expectedResponse *pluginpb.MigrateOrgToLatestVersionResponse
+		expectedCode     codes.Code
+	}{
+		{
+			name:  "older version",
+			orgID: "223e4567-e89b-12d3-a456-426655440001",
+			expectedResponse: &pluginpb.MigrateOrgToLatestVersionResponse{
+				OldVersion: "0.0.2",
+				NewVersion: "0.0.3",
+			},
+		},
+		{
+			name:  "already latest",
+			orgID: "223e4567-e89b-12d3-a456-426655440000",
+			expectedResponse: &pluginpb.MigrateOrgToLatestVersionResponse{
+				OldVersion: "0.0.3",
+				NewVersion: "0.0.3",
+			},
+		},
+		{
+			name:          "latest is yanked",
+			orgID:         "223e4567-e89b-12d3-a456-426655440001",
+			yankedVersion: "0.0.3",
+			expectedResponse: &pluginpb.MigrateOrgToLatestVersionResponse{
+				OldVersion: "0.0.2",
+				NewVersion: "0.0.2",
 			},
 		},
+		{
+			name:        "latest is beta",
+			orgID:       "223e4567-e89b-12d3-a456-426655440001",
+			betaVersion: "0.0.3",
+			expectedResponse: &pluginpb.MigrateOrgToLatestVersionResponse{
+				OldVersion: "0.0.2",
+				NewVersion: "0.0.2",
+			},
+		},
+		{
+			name:         "not enabled",
+			orgID:        "223e4567-e89b-12d3-a456-426655440002",
+			expectedCode: codes.NotFound,
+		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
 			mustLoadTestData(db)
+			if test.yankedVersion != "" {
+				db.MustExec(`UPDATE plugin_releases SET yanked='true' WHERE id=$1 AND version=$2`, "test-plugin", test.yankedVersion)
+			}
+			if test.betaVersion != "" {
+				db.MustExec(`UPDATE plugin_releases SET release_channel=$1 WHERE id=$2 AND version=$3`, "beta", "test-plugin", test.betaVersion)
+			}
 
 			s := controllers.New(db, "test")
-			resp, err := s.UpdateOrgRetentionPluginConfig(context.Background(), test.request)
+			resp, err := s.MigrateOrgToLatestVersion(context.Background(), &pluginpb.MigrateOrgToLatestVersionRequest{
+				OrgID:    utils.ProtoFromUUIDStrOrNil(test.orgID),
+				PluginID: "test-plugin",
+			})
+			assert.Equal(t, test.expectedCode, status.Code(err))
+			if test.expectedResponse == nil {
+				return
+			}
+			assert.Equal(t, test.expectedResponse, resp)
 
+			// The org's configs are kept.
+			var version string
+			err = db.QueryRow(`SELECT version FROM org_data_retention_plugins WHERE org_id=$1 AND plugin_id=$2`, test.orgID, "test-plugin").Scan(&version)
 			require.NoError(t, err)
-			require.NotNil(t, resp)
-
-			assert.Equal(t, &pluginpb.UpdateOrgRetentionPluginConfigResponse{}, resp)
+			assert.Equal(t, test.expectedResponse.NewVersion, version)
+			configResp, err := s.GetOrgRetentionPluginConfig(context.Background(), &pluginpb.GetOrgRetentionPluginConfigRequest{
+				OrgID:    utils.ProtoFromUUIDStrOrNil(test.orgID),
+				PluginID: "test-plugin",
+			})
+			require.NoError(t, err)
+			assert.NotEmpty(t, configResp.Configurations)
+		})
+	}
+}
 
-			query := `SELECT org_id, plugin_id, version, PGP_SYM_DECRYPT(configurations, $1::text) as configurations FROM org_data_retention_plugins`
-			rows, err := db.Queryx(query, "test")
-			require.Nil(t, err)
+func TestServer_MigrateOrgToLatestVersionChecksRelease(t *testing.T) {
+	tests := []struct {
+		name                   string
+		orgVersion             string
+		configurations         map[string]string
+		requiredConfigurations []string
+		keyRenames             map[string]string
+		expectedCode           codes.Code
+		expectedConfigs        map[string]string
+	}{
+		{
+			name:            "creates preset scripts",
+			orgVersion:      "0.0.2",
+			configurations:  map[string]string{"license_key3": "The license key"},
+			expectedConfigs: map[string]string{"license_key3": "hello"},
+		},
+		{
+			name:                   "missing required configs",
+			orgVersion:             "0.0.2",
+			configurations:         map[string]string{"license_key3": "The license key", "license_key4": "The new license key"},
+			requiredConfigurations: []string{"license_key4"},
+			expectedCode:           codes.InvalidArgument,
+		},
+		{
+			name:           "set config is removed",
+			orgVersion:     "0.0.3",
+			configurations: map[string]string{"license_key4": "The renamed license key"},
+			expectedCode:   codes.FailedPrecondition,
+		},
+		{
+			name:                   "renamed config",
+			orgVersion:             "0.0.3",
+			configurations:         map[string]string{"license_key4": "The renamed license key"},
+			requiredConfigurations: []string{"license_key4"},
+			keyRenames:             map[string]string{"license_key3": "license_key4"},
+			expectedConfigs:        map[string]string{"license_key4": "hello"},
+		},
+		{
+			name:           "empty rename",
+			orgVersion:     "0.0.2",
+			configurations: map[string]string{"license_key3": "The license key"},
+			keyRenames:     map[string]string{"license_key3": ""},
+			expectedCode:   codes.InvalidArgument,
+		},
+	}
 
-			defer rows.Close()
-			plugins := []orgConfig{}
-			for rows.Next() {
-				var p orgConfig
-				err = rows.StructScan(&p)
-				require.Nil(t, err)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mustLoadTestData(db)
+			orgID := "223e4567-e89b-12d3-a456-426655440001"
+			db.MustExec(`UPDATE org_data_retention_plugins SET version=$1 WHERE org_id=$2 AND plugin_id=$3`, test.orgVersion, orgID, "test-plugin")
+			db.MustExec(`INSERT INTO plugin_releases(name, id, description, logo, version, data_retention_enabled) VALUES ($1, $2, $3, $4, $5, $6)`,
+				"test_plugin", "test-plugin", "This is the latest test plugin", "logo4", "0.0.4", "true")
+			var requiredConfigurations pq.StringArray
+			if test.requiredConfigurations != nil {
+				requiredConfigurations = pq.StringArray(test.requiredConfigurations)
+			}
+			db.MustExec(`INSERT INTO data_retention_plugin_releases(plugin_id, version, configurations, preset_scripts, required_configurations) VALUES ($1, $2, $3, $4, $5)`,
+				"test-plugin", "0.0.4", controllers.Configurations(test.configurations), controllers.PresetScripts([]*controllers.PresetScript{
+					{
+						Name:              "cpu data",
+						Description:       "This is a script to get cpu data",
+						DefaultFrequencyS: 10,
+						Script:            "cpu script",
+					},
+				}), requiredConfigurations)
 
-				var cm map[string]string
-				err = json.Unmarshal(p.ConfigurationBytes, &cm)
-				require.Nil(t, err)
-				p.Configurations = cm
-				p.ConfigurationBytes = nil
+			s := controllers.New(db, "test")
+			resp, err := s.MigrateOrgToLatestVersion(context.Background(), &pluginpb.MigrateOrgToLatestVersionRequest{
+				OrgID:      utils.ProtoFromUUIDStrOrNil(orgID),
+				PluginID:   "test-plugin",
+				KeyRenames: test.keyRenames,
+			})
+			assert.Equal(t, test.expectedCode, status.Code(err))
 
-				plugins = append(plugins, p)
+			var version string
+			err = db.QueryRow(`SELECT version FROM org_data_retention_plugins WHERE org_id=$1 AND plugin_id=$2`, orgID, "test-plugin").Scan(&version)
+			require.NoError(t, err)
+			var presetCount int
+			err = db.QueryRow(`SELECT COUNT(*) FROM plugin_retention_scripts WHERE org_id=$1 AND script_name=$2 AND plugin_version=$3`, orgID, "cpu data", "0.0.4").Scan(&presetCount)
+			require.NoError(t, err)
+			if test.expectedCode != codes.OK {
+				// A rejected migration leaves the org on its version.
+				assert.Equal(t, test.orgVersion, version)
+				assert.Equal(t, 0, presetCount)
+				return
 			}
+			assert.Equal(t, "0.0.4", resp.NewVersion)
+			assert.Equal(t, "0.0.4", version)
+			assert.Equal(t, 1, presetCount)
 
-			assert.ElementsMatch(t, test.expectedOrgConfigs, plugins)
+			configResp, err := s.GetOrgRetentionPluginConfig(context.Background(), &pluginpb.GetOrgRetentionPluginConfigRequest{
+				OrgID:    utils.ProtoFromUUIDStrOrNil(orgID),
+				PluginID: "test-plugin",
+			})
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedConfigs, configResp.Configurations)
+		})
+	}
+}
+
+func TestServer_UpdateRetentionConfigsMinFrequency(t *testing.T) {
+	mustLoadTestData(db)
+
+	s := controllers.New(db, "test")
+	_, err := s.UpdateOrgRetentionPluginConfig(context.Background(), &pluginpb.UpdateOrgRetentionPluginConfigRequest{
+		OrgID:         utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440002"),
+		PluginID:      "test-plugin",
+		Enabled:       &types.BoolValue{Value: true},
+		Version:       &types.StringValue{Value: "0.0.2"},
+		MinFrequencyS: &types.Int64Value{Value: 15},
+	})
+	require.NoError(t, err)
+
+	var minFrequencyS int64
+	err = db.QueryRow(`SELECT min_frequency_s FROM org_data_retention_plugins WHERE org_id=$1 AND plugin_id=$2`, "223e4567-e89b-12d3-a456-426655440002", "test-plugin").Scan(&minFrequencyS)
+	require.NoError(t, err)
+	assert.Equal(t, int64(15), minFrequencyS)
+
+	type script struct {
+		Name       string `db:"script_name"`
+		FrequencyS int64  `db:"frequency_s"`
+		IsPreset   bool   `db:"is_preset"`
+	}
+	var scripts []script
+	err = db.Select(&scripts, `SELECT script_name, frequency_s, is_preset FROM plugin_retention_scripts WHERE org_id=$1 ORDER BY script_name`, "223e4567-e89b-12d3-a456-426655440002")
+	require.NoError(t, err)
+	// The script with a default frequency below the minimum is clamped, while the one above it is unchanged.
+	assert.Equal(t, []script{
+		{Name: "dns data", FrequencyS: 15, IsPreset: true},
+		{Name: "dns data 2", FrequencyS: 20, IsPreset: true},
+	}, scripts)
+
+	_, err = s.UpdateOrgRetentionPluginConfig(context.Background(), &pluginpb.UpdateOrgRetentionPluginConfigRequest{
+		OrgID:         utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440003"),
+		PluginID:      "test-plugin",
+		Enabled:       &types.BoolValue{Value: true},
+		Version:       &types.StringValue{Value: "0.0.2"},
+		MinFrequencyS: &types.Int64Value{Value: -1},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServer_UpdateOrgRetentionPluginConfigDependencies(t *testing.T) {
+	mustLoadTestData(db)
+	orgID := "223e4567-e89b-12d3-a456-426655440003"
+
+	s := controllers.New(db, "test")
+	_, err := s.CreatePluginRelease(context.Background(), &pluginpb.CreatePluginReleaseRequest{
+		Name:    "dependent_plugin",
+		ID:      "dependent-plugin",
+		Version: "0.0.1",
+		RetentionConfig: &pluginpb.RetentionReleaseConfig{
+			Dependencies: []string{"test-plugin"},
+		},
+	})
+	require.NoError(t, err)
+
+	cfg, err := s.GetRetentionPluginConfig(context.Background(), &pluginpb.GetRetentionPluginConfigRequest{
+		ID:      "dependent-plugin",
+		Version: "0.0.1",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"test-plugin"}, cfg.Dependencies)
+
+	enable := func(pluginID, version string, enabled bool) error {
+		_, err := s.UpdateOrgRetentionPluginConfig(context.Background(), &pluginpb.UpdateOrgRetentionPluginConfigRequest{
+			OrgID:    utils.ProtoFromUUIDStrOrNil(orgID),
+			PluginID: pluginID,
+			Version:  &types.StringValue{Value: version},
+			Enabled:  &types.BoolValue{Value: enabled},
 		})
+		return err
 	}
+
+	// The dependency isn't enabled yet.
+	err = enable("dependent-plugin", "0.0.1", true)
+	require.Error(t, err)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), "test-plugin")
+
+	require.NoError(t, enable("test-plugin", "0.0.3", true))
+	require.NoError(t, enable("dependent-plugin", "0.0.1", true))
+
+	// The dependency can't be disabled while the dependent plugin is enabled.
+	err = enable("test-plugin", "0.0.3", false)
+	require.Error(t, err)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), "dependent-plugin")
+
+	require.NoError(t, enable("dependent-plugin", "0.0.1", false))
+	require.NoError(t, enable("test-plugin", "0.0.3", false))
+
+	_, err = s.CreatePluginRelease(context.Background(), &pluginpb.CreatePluginReleaseRequest{
+		Name:    "dependent_plugin",
+		ID:      "dependent-plugin",
+		Version: "0.0.2",
+		RetentionConfig: &pluginpb.RetentionReleaseConfig{
+			Dependencies: []string{"dependent-plugin"},
+		},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
 }
@@ -0,0 +1,148 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/gofrs/uuid"
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"px.dev/pixie/src/api/proto/uuidpb"
+	"px.dev/pixie/src/utils"
+)
+
+// tracer creates the spans for the plugin service. Spans are only exported if the service sets a global
+// TracerProvider.
+var tracer = otel.Tracer("px.dev/pixie/src/cloud/plugin/controllers")
+
+// startSpan starts a span for an operation on an org's plugin. The org and plugin are left out of the span's attributes
+// if they are unset.
+func startSpan(ctx context.Context, name string, orgID uuid.UUID, pluginID string) (context.Context, trace.Span) {
+	var attrs []attribute.KeyValue
+	if orgID != uuid.Nil {
+		attrs = append(attrs, attribute.String("org_id", orgID.String()))
+	}
+	if pluginID != "" {
+		attrs = append(attrs, attribute.String("plugin_id", pluginID))
+	}
+	return tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan ends the span, marking it as failed if err is set. A query which finds no rows is not a failure.
+func endSpan(span trace.Span, err error) {
+	if err != nil && err != sql.ErrNoRows {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+	}
+	span.End()
+}
+
+// requestIDs returns the org and plugin which an RPC request is for. Either is empty if the request does not specify
+// it.
+func requestIDs(req interface{}) (orgID string, pluginID string) {
+	if r, ok := req.(interface{ GetOrgID() *uuidpb.UUID }); ok && !utils.IsNilUUIDProto(r.GetOrgID()) {
+		orgID = utils.ProtoToUUIDStr(r.GetOrgID())
+	}
+	if r, ok := req.(interface{ GetPluginID() string }); ok && r.GetPluginID() != "" {
+		pluginID = r.GetPluginID()
+	} else if r, ok := req.(interface{ GetID() string }); ok && r.GetID() != "" {
+		// Requests for a plugin release identify the plugin by ID.
+		pluginID = r.GetID()
+	}
+	return orgID, pluginID
+}
+
+// requestSpanAttributes returns attributes for the org and plugin which an RPC request is for, if the request
+// specifies them.
+func requestSpanAttributes(req interface{}) []attribute.KeyValue {
+	var attrs []attribute.KeyValue
+	orgID, pluginID := requestIDs(req)
+	if orgID != "" {
+		attrs = append(attrs, attribute.String("org_id", orgID))
+	}
+	if pluginID != "" {
+		attrs = append(attrs, attribute.String("plugin_id", pluginID))
+	}
+	return attrs
+}
+
+// metadataCarrier adapts gRPC metadata to a propagation.TextMapCarrier, to extract the caller's trace context.
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	values := metadata.MD(c).Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func (c metadataCarrier) Set(key string, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// startRPCSpan starts a server span for an RPC, as a child of the caller's span if the caller propagated one.
+func startRPCSpan(ctx context.Context, method string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		ctx = otel.GetTextMapPropagator().Extract(ctx, metadataCarrier(md))
+	}
+	return tracer.Start(ctx, method, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attrs...))
+}
+
+// UnaryServerInterceptor returns a gRPC interceptor which creates a span for each unary RPC the server handles, and
+// logs the RPCs which fail.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, span := startRPCSpan(ctx, info.FullMethod, requestSpanAttributes(req)...)
+		resp, err := handler(ctx, req)
+		endSpan(span, err)
+		logRPCError(info.FullMethod, req, err)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor returns a gRPC interceptor which creates a span for each streaming RPC the server handles,
+// and logs the RPCs which fail.
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, span := startRPCSpan(stream.Context(), info.FullMethod)
+		wrapped := grpc_middleware.WrapServerStream(stream)
+		wrapped.WrappedContext = ctx
+		err := handler(srv, wrapped)
+		endSpan(span, err)
+		logRPCError(info.FullMethod, nil, err)
+		return err
+	}
+}
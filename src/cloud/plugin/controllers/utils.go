@@ -19,18 +19,53 @@
 package controllers
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
 	"database/sql/driver"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"image"
+	// Register decoders for the raster formats which logos may be encoded as.
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
 
+	"github.com/blang/semver"
+	"github.com/gofrs/uuid"
+	"github.com/gogo/protobuf/jsonpb"
+	"github.com/gogo/protobuf/types"
+	"github.com/robfig/cron/v3"
+	"github.com/xeipuuv/gojsonschema"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"gopkg.in/yaml.v2"
+
+	"px.dev/pixie/src/cloud/plugin/pluginpb"
 )
 
 // Configurations type to use in sqlx for the map of configurations.
 type Configurations map[string]string
 
-// Value Returns a golang database/sql driver value for Configurations.
+// Value Returns a golang database/sql driver value for Configurations. A nil Configurations is stored as NULL.
 func (p Configurations) Value() (driver.Value, error) {
+	if p == nil {
+		return nil, nil
+	}
 	res, err := json.Marshal(p)
 	if err != nil {
 		return res, err
@@ -38,9 +73,15 @@ func (p Configurations) Value() (driver.Value, error) {
 	return driver.Value(res), err
 }
 
-// Scan Scans the sqlx database type ([]bytes) into the Configurations type.
+// Scan Scans the sqlx database type ([]bytes) into the Configurations type. NULL is scanned as an empty Configurations.
 func (p *Configurations) Scan(src interface{}) error {
 	switch jsonText := src.(type) {
+	case nil:
+	case string:
+		err := json.Unmarshal([]byte(jsonText), p)
+		if err != nil {
+			return status.Error(codes.Internal, "could not unmarshal configurations")
+		}
 	case []byte:
 		err := json.Unmarshal(jsonText, p)
 		if err != nil {
@@ -50,26 +91,492 @@ func (p *Configurations) Scan(src interface{}) error {
 		return status.Error(codes.Internal, "could not unmarshal configurations")
 	}
 
+	if *p == nil {
+		*p = Configurations{}
+	}
+	return nil
+}
+
+// typedConfigsToJSON serializes structured configurations to JSON, for storage in the database. Returns nil if there
+// are no configurations.
+func typedConfigsToJSON(configs *types.Struct) ([]byte, error) {
+	if configs == nil || len(configs.Fields) == 0 {
+		return nil, nil
+	}
+	m := jsonpb.Marshaler{}
+	str, err := m.MarshalToString(configs)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(str), nil
+}
+
+// typedConfigsFromJSON deserializes structured configurations stored in the database. Returns nil if there are no
+// configurations.
+func typedConfigsFromJSON(configJSON []byte) (*types.Struct, error) {
+	if len(configJSON) == 0 {
+		return nil, nil
+	}
+	configs := &types.Struct{}
+	err := jsonpb.Unmarshal(bytes.NewReader(configJSON), configs)
+	if err != nil {
+		return nil, err
+	}
+	return configs, nil
+}
+
+// knownExportFormats are the formats in which a plugin provider may accept exported data.
+var knownExportFormats = map[string]bool{
+	"json":     true,
+	"protobuf": true,
+	"csv":      true,
+}
+
+// validateExportFormats checks that each of the formats is a known export format.
+func validateExportFormats(formats []string) error {
+	for _, f := range formats {
+		if !knownExportFormats[f] {
+			return fmt.Errorf("unknown export format %q", f)
+		}
+	}
 	return nil
 }
 
+// knownPGPCipherAlgos are the cipher algorithms which pgcrypto can encrypt configs with.
+var knownPGPCipherAlgos = map[string]bool{
+	"bf":     true,
+	"aes128": true,
+	"aes192": true,
+	"aes256": true,
+	"3des":   true,
+	"cast5":  true,
+}
+
+// ValidatePGPOptions checks that pgcrypto supports the cipher and compression algorithms. An empty cipher algorithm
+// or a compression algorithm of 0 is pgcrypto's default.
+func ValidatePGPOptions(cipherAlgo string, compressAlgo int) error {
+	if cipherAlgo != "" && !knownPGPCipherAlgos[cipherAlgo] {
+		return fmt.Errorf("unknown cipher algorithm %q", cipherAlgo)
+	}
+	// The compression algorithms are 0 (none), 1 (zip) and 2 (zlib).
+	if compressAlgo < 0 || compressAlgo > 2 {
+		return fmt.Errorf("unknown compression algorithm %d", compressAlgo)
+	}
+	return nil
+}
+
+// pgpEncryptOptions returns the options for PGP_SYM_ENCRYPT which select the cipher and compression algorithms.
+func pgpEncryptOptions(cipherAlgo string, compressAlgo int) string {
+	var opts []string
+	if cipherAlgo != "" {
+		opts = append(opts, fmt.Sprintf("cipher-algo=%s", cipherAlgo))
+	}
+	if compressAlgo != 0 {
+		opts = append(opts, fmt.Sprintf("compress-algo=%d", compressAlgo))
+	}
+	return strings.Join(opts, ", ")
+}
+
+const (
+	releaseChannelStable = "stable"
+	releaseChannelBeta   = "beta"
+)
+
+// defaultPluginNamespace is the catalog which plugin releases belong to if no namespace is specified.
+const defaultPluginNamespace = "default"
+
+// knownReleaseChannels are the channels to which a plugin release may be published.
+var knownReleaseChannels = map[string]bool{
+	releaseChannelStable: true,
+	releaseChannelBeta:   true,
+}
+
+// validateRequiredConfigs checks that each of the required keys is one of the configurations.
+func validateRequiredConfigs(required []string, configs map[string]string) error {
+	for _, k := range required {
+		if _, ok := configs[k]; !ok {
+			return fmt.Errorf("required configuration %q is not a configuration", k)
+		}
+	}
+	return nil
+}
+
+// validateSecretConfigs checks that each of the secret keys is one of the configurations.
+func validateSecretConfigs(secret []string, configs map[string]string) error {
+	for _, k := range secret {
+		if _, ok := configs[k]; !ok {
+			return fmt.Errorf("secret configuration %q is not a configuration", k)
+		}
+	}
+	return nil
+}
+
+// splitSecretConfigs splits an org's JSON configurations into the values for the secret keys, which are stored
+// encrypted, and the remaining plaintext values. If secretKeys is nil, every configuration is secret and the
+// plaintext configurations are nil.
+func splitSecretConfigs(configurations []byte, secretKeys []string) ([]byte, []byte, error) {
+	if secretKeys == nil || configurations == nil {
+		return configurations, nil, nil
+	}
+	var configs map[string]string
+	if err := json.Unmarshal(configurations, &configs); err != nil {
+		return nil, nil, err
+	}
+	isSecret := make(map[string]bool, len(secretKeys))
+	for _, k := range secretKeys {
+		isSecret[k] = true
+	}
+	secret := make(map[string]string)
+	plaintext := make(map[string]string)
+	for k, v := range configs {
+		if isSecret[k] {
+			secret[k] = v
+		} else {
+			plaintext[k] = v
+		}
+	}
+	secretJSON, err := json.Marshal(secret)
+	if err != nil {
+		return nil, nil, err
+	}
+	plaintextJSON, err := json.Marshal(plaintext)
+	if err != nil {
+		return nil, nil, err
+	}
+	return secretJSON, plaintextJSON, nil
+}
+
+// duplicatePresetScriptNames returns the names which are used by more than one of the preset scripts, in sorted order.
+func duplicatePresetScriptNames(scripts []*pluginpb.GetRetentionPluginConfigResponse_PresetScript) []string {
+	counts := make(map[string]int)
+	for _, p := range scripts {
+		counts[p.Name]++
+	}
+	var duplicates []string
+	for name, count := range counts {
+		if count > 1 {
+			duplicates = append(duplicates, name)
+		}
+	}
+	sort.Strings(duplicates)
+	return duplicates
+}
+
+// missingRequiredConfigs returns the required keys which are unset or empty in the configs, in sorted order.
+func missingRequiredConfigs(required []string, configs map[string]string) []string {
+	var missing []string
+	for _, k := range required {
+		if configs[k] == "" {
+			missing = append(missing, k)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// renameConfigKeys returns a copy of the configs with each key in renames moved to its new name. Returns an
+// InvalidArgument error if a rename has an empty name, or if two keys would be moved to the same name.
+func renameConfigKeys(configs map[string]string, renames map[string]string) (map[string]string, error) {
+	for from, to := range renames {
+		if from == "" || to == "" {
+			return nil, invalidFieldError("key_renames", "Key renames must not have empty names")
+		}
+	}
+	renamed := make(map[string]string, len(configs))
+	for k, v := range configs {
+		if to, ok := renames[k]; ok {
+			k = to
+		}
+		if _, ok := renamed[k]; ok {
+			return nil, invalidFieldError("key_renames", fmt.Sprintf("Multiple configurations would be renamed to %s", k))
+		}
+		renamed[k] = v
+	}
+	return renamed, nil
+}
+
+// diffConfigurations compares the configuration keys of two releases. Keys which are in both releases are changed if
+// their descriptions differ. Each list is sorted.
+func diffConfigurations(from Configurations, to Configurations) (added []string, removed []string, changed []string, unchanged []string) {
+	for k, desc := range to {
+		fromDesc, ok := from[k]
+		switch {
+		case !ok:
+			added = append(added, k)
+		case fromDesc != desc:
+			changed = append(changed, k)
+		default:
+			unchanged = append(unchanged, k)
+		}
+	}
+	for k := range from {
+		if _, ok := to[k]; !ok {
+			removed = append(removed, k)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(changed)
+	sort.Strings(unchanged)
+	return added, removed, changed, unchanged
+}
+
+// redactedConfigValue replaces the values of org configs returned to callers which may not read decrypted configs.
+const redactedConfigValue = "********"
+
+// redactConfigs returns a copy of the configs with each value redacted.
+func redactConfigs(configs map[string]string) map[string]string {
+	if configs == nil {
+		return nil
+	}
+	redacted := make(map[string]string, len(configs))
+	for k := range configs {
+		redacted[k] = redactedConfigValue
+	}
+	return redacted
+}
+
+// redactTypedConfigs returns a copy of the typed configs with each value redacted.
+func redactTypedConfigs(configs *types.Struct) *types.Struct {
+	if configs == nil {
+		return nil
+	}
+	redacted := &types.Struct{Fields: make(map[string]*types.Value, len(configs.Fields))}
+	for k := range configs.Fields {
+		redacted.Fields[k] = &types.Value{Kind: &types.Value_StringValue{StringValue: redactedConfigValue}}
+	}
+	return redacted
+}
+
+// jsonSchemaDraft is the JSON Schema dialect of the schemas generated by configJSONSchema.
+const jsonSchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// configJSONSchema generates a JSON Schema for an object containing a release's configurations and typed
+// configurations. Each configuration is a string described by its value in configs. Each typed configuration is
+// described by its value in typedConfigJSON, which is either a description or a JSON Schema for the field.
+func configJSONSchema(title string, configs Configurations, typedConfigJSON []byte) ([]byte, error) {
+	properties := make(map[string]interface{})
+	for k, desc := range configs {
+		properties[k] = map[string]interface{}{
+			"type":        "string",
+			"description": desc,
+		}
+	}
+
+	if len(typedConfigJSON) > 0 {
+		var typedConfigs map[string]interface{}
+		err := json.Unmarshal(typedConfigJSON, &typedConfigs)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range typedConfigs {
+			switch field := v.(type) {
+			case string:
+				properties[k] = map[string]interface{}{
+					"description": field,
+				}
+			case map[string]interface{}:
+				properties[k] = field
+			default:
+				properties[k] = map[string]interface{}{}
+			}
+		}
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"$schema":              jsonSchemaDraft,
+		"title":                title,
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	})
+}
+
+// compileConfigSchema compiles a JSON Schema provided by a plugin author for a release's configurations.
+func compileConfigSchema(schema string) (*gojsonschema.Schema, error) {
+	return gojsonschema.NewSchemaLoader().Compile(gojsonschema.NewStringLoader(schema))
+}
+
+// configSchemaViolations validates an org's configurations and typed configurations against a release's config schema,
+// as a single JSON object. Returns a violation for each way in which the configs do not satisfy the schema, sorted by
+// field. Fields are identified as "configurations.<key>" or "typed_configurations.<key>".
+func configSchemaViolations(schema []byte, configJSON []byte, typedConfigJSON []byte) ([]*errdetails.BadRequest_FieldViolation, error) {
+	compiled, err := compileConfigSchema(string(schema))
+	if err != nil {
+		return nil, err
+	}
+
+	doc := make(map[string]interface{})
+	var typedConfigs map[string]interface{}
+	if len(typedConfigJSON) > 0 {
+		err = json.Unmarshal(typedConfigJSON, &typedConfigs)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range typedConfigs {
+			doc[k] = v
+		}
+	}
+	if len(configJSON) > 0 {
+		var configs map[string]string
+		err = json.Unmarshal(configJSON, &configs)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range configs {
+			doc[k] = v
+		}
+	}
+
+	result, err := compiled.Validate(gojsonschema.NewGoLoader(doc))
+	if err != nil {
+		return nil, err
+	}
+
+	var violations []*errdetails.BadRequest_FieldViolation
+	for _, e := range result.Errors() {
+		key := strings.SplitN(e.Field(), ".", 2)[0]
+		if key == gojsonschema.STRING_CONTEXT_ROOT {
+			// Errors about missing or unexpected keys are reported against the object, rather than the key itself.
+			key, _ = e.Details()["property"].(string)
+		}
+		field := "configurations"
+		if _, ok := typedConfigs[key]; ok {
+			field = "typed_configurations." + key
+		} else if key != "" {
+			field = "configurations." + key
+		}
+		violations = append(violations, &errdetails.BadRequest_FieldViolation{Field: field, Description: e.Description()})
+	}
+	sort.SliceStable(violations, func(i, j int) bool {
+		return violations[i].Field < violations[j].Field
+	})
+	return violations, nil
+}
+
+// configViolations validates an org's configurations against a release: the release's required configurations must be
+// set, and the configs must satisfy the release's config schema, if any. Returns a violation for each invalid field,
+// sorted by field.
+func configViolations(rp RetentionPlugin, configs map[string]string, configJSON []byte, typedConfigJSON []byte) ([]*errdetails.BadRequest_FieldViolation, error) {
+	var violations []*errdetails.BadRequest_FieldViolation
+	for _, k := range missingRequiredConfigs(rp.RequiredConfigurations, configs) {
+		violations = append(violations, &errdetails.BadRequest_FieldViolation{Field: "configurations." + k, Description: "Missing required configuration"})
+	}
+	if rp.ConfigSchema != nil {
+		schemaViolations, err := configSchemaViolations([]byte(*rp.ConfigSchema), configJSON, typedConfigJSON)
+		if err != nil {
+			return nil, err
+		}
+		violations = append(violations, schemaViolations...)
+	}
+	sort.SliceStable(violations, func(i, j int) bool {
+		return violations[i].Field < violations[j].Field
+	})
+	return violations, nil
+}
+
+// pluginPageToken is the position after which the next page of plugins starts.
+type pluginPageToken struct {
+	Name string `json:"name"`
+	ID   string `json:"id"`
+	// UpdatedAt is only set if the plugins are sorted by when they were updated.
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// encodePluginPageToken encodes the position of the last plugin in a page as an opaque token.
+func encodePluginPageToken(name string, id string, updatedAt *time.Time) string {
+	tokenJSON, _ := json.Marshal(&pluginPageToken{Name: name, ID: id, UpdatedAt: updatedAt})
+	return base64.URLEncoding.EncodeToString(tokenJSON)
+}
+
+// decodePluginPageToken decodes a token produced by encodePluginPageToken.
+func decodePluginPageToken(token string) (*pluginPageToken, error) {
+	tokenJSON, err := base64.URLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, err
+	}
+	var t pluginPageToken
+	err = json.Unmarshal(tokenJSON, &t)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// dueScriptPageToken is the position after which the next page of due scripts starts.
+type dueScriptPageToken struct {
+	// NextRunAt is nil if the last script in the page has never been run.
+	NextRunAt *time.Time `json:"next_run_at,omitempty"`
+	ScriptID  string     `json:"script_id"`
+}
+
+// encodeDueScriptPageToken encodes the position of the last script in a page as an opaque token.
+func encodeDueScriptPageToken(nextRunAt *time.Time, scriptID string) string {
+	tokenJSON, _ := json.Marshal(&dueScriptPageToken{NextRunAt: nextRunAt, ScriptID: scriptID})
+	return base64.URLEncoding.EncodeToString(tokenJSON)
+}
+
+// decodeDueScriptPageToken decodes a token produced by encodeDueScriptPageToken.
+func decodeDueScriptPageToken(token string) (*dueScriptPageToken, error) {
+	tokenJSON, err := base64.URLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, err
+	}
+	var t dueScriptPageToken
+	err = json.Unmarshal(tokenJSON, &t)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := uuid.FromString(t.ScriptID); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
 // PresetScripts represents an array of PresetScripts.
 type PresetScripts []*PresetScript
 
 // PresetScript type to use in sqlx for preset scripts.
 type PresetScript struct {
-	Name              string `json:"name"`
-	Description       string `json:"description"`
-	DefaultFrequencyS int64  `json:"default_frequency_s"`
-	Script            string `json:"script"`
+	Name              string `json:"name" yaml:"name"`
+	Description       string `json:"description" yaml:"description"`
+	DefaultFrequencyS int64  `json:"default_frequency_s" yaml:"default_frequency_s"`
+	Script            string `json:"script" yaml:"script"`
 }
 
-// Value Returns a golang database/sql driver value for PresetScripts.
+// presetScriptsCompressionThreshold is the size of the JSON for PresetScripts, in bytes, above which it is gzipped
+// before it is stored. Smaller PresetScripts are stored as plain JSON, since compressing them saves little.
+const presetScriptsCompressionThreshold = 4096
+
+// gzipMagic is the header which every gzip stream starts with. JSON can never start with it.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// Value Returns a golang database/sql driver value for PresetScripts. A nil or empty PresetScripts is stored as NULL,
+// and large PresetScripts are stored as gzipped JSON.
 func (p PresetScripts) Value() (driver.Value, error) {
-	return json.Marshal(p)
+	if len(p) == 0 {
+		return nil, nil
+	}
+	res, err := json.Marshal(p)
+	if err != nil || len(res) < presetScriptsCompressionThreshold {
+		return res, err
+	}
+
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err = w.Write(res)
+	if err != nil {
+		return nil, err
+	}
+	err = w.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
 }
 
-// Scan Scans the sqlx database type ([]bytes) into the PresetScripts type.
+// Scan Scans the sqlx database type ([]bytes) into the PresetScripts type. NULL is scanned as an empty PresetScripts.
+// Both gzipped and plain JSON are accepted.
 func (p *PresetScripts) Scan(src interface{}) error {
 	var data []byte
 	switch v := src.(type) {
@@ -77,8 +584,425 @@ func (p *PresetScripts) Scan(src interface{}) error {
 		data = []byte(v)
 	case []byte:
 		data = v
+	}
+	if bytes.HasPrefix(data, gzipMagic) {
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		data, err = io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+	}
+	if len(data) > 0 {
+		err := json.Unmarshal(data, p)
+		if err != nil {
+			return err
+		}
+	}
+	if *p == nil {
+		*p = PresetScripts{}
+	}
+	return nil
+}
+
+// ParsePresetScriptsYAML parses a YAML stream of preset scripts, where each document in the stream describes a single
+// preset script. Errors identify the index of the failing document.
+func ParsePresetScriptsYAML(r io.Reader) (PresetScripts, error) {
+	decoder := yaml.NewDecoder(r)
+	decoder.SetStrict(true)
+
+	scripts := PresetScripts{}
+	names := make(map[string]int)
+	for i := 0; ; i++ {
+		var script *PresetScript
+		err := decoder.Decode(&script)
+		if errors.Is(err, io.EOF) {
+			return scripts, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %w", i, err)
+		}
+		if script == nil {
+			return nil, fmt.Errorf("document %d: empty document", i)
+		}
+		if script.Name == "" {
+			return nil, fmt.Errorf("document %d: missing name", i)
+		}
+		if script.Script == "" {
+			return nil, fmt.Errorf("document %d: missing script", i)
+		}
+		if script.DefaultFrequencyS <= 0 {
+			return nil, fmt.Errorf("document %d: default_frequency_s must be positive", i)
+		}
+		if prev, ok := names[script.Name]; ok {
+			return nil, fmt.Errorf("document %d: name %q is already used by document %d", i, script.Name, prev)
+		}
+		names[script.Name] = i
+		scripts = append(scripts, script)
+	}
+}
+
+// contextError returns an error for a failed DB call. If the call failed because the request context was canceled or
+// timed out, the context error is returned instead of the given error.
+func contextError(ctx context.Context, err error) error {
+	switch ctx.Err() {
+	case context.Canceled:
+		return status.Error(codes.Canceled, ctx.Err().Error())
+	case context.DeadlineExceeded:
+		return status.Error(codes.DeadlineExceeded, ctx.Err().Error())
 	default:
+		return err
+	}
+}
+
+// sanitizeFileName converts the given name into a name which is safe to use as a file name, by replacing
+// any characters other than letters, digits, '-', '_' and '.'.
+func sanitizeFileName(name string) string {
+	sanitized := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		default:
+			return '_'
+		}
+	}, strings.TrimSpace(name))
+	sanitized = strings.Trim(sanitized, "._")
+	if sanitized == "" {
+		return "script"
+	}
+	return sanitized
+}
+
+// uniqueFileName returns a file name with the given base and extension which has not already been used. If
+// the name is taken, a numeric suffix is appended. The returned name is marked as used.
+func uniqueFileName(base string, ext string, used map[string]bool) string {
+	name := base + ext
+	for i := 1; used[name]; i++ {
+		name = fmt.Sprintf("%s_%d%s", base, i, ext)
+	}
+	used[name] = true
+	return name
+}
+
+// gitOpsHashKeyLabel is the label which the GitOps hash key is derived from the database key with.
+const gitOpsHashKeyLabel = "plugin-service/gitops-config-hash"
+
+// deriveKey derives a key for another purpose from the given key, as an HMAC-SHA256 of the purpose's label, so that
+// the key itself is only used for a single purpose.
+func deriveKey(key string, label string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(label))
+	return string(mac.Sum(nil))
+}
+
+// redactedConfigString serializes the configurations deterministically, with keys sorted and each value replaced by
+// an HMAC of the value. The HMAC is keyed so that the hashes are stable, but cannot be used to guess short values.
+func redactedConfigString(pluginID string, version string, configs map[string]string, hashKey string) string {
+	keys := make([]string, 0, len(configs))
+	for k := range configs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "plugin_id: %q\n", pluginID)
+	fmt.Fprintf(&sb, "version: %q\n", version)
+	sb.WriteString("configurations:\n")
+	for _, k := range keys {
+		mac := hmac.New(sha256.New, []byte(hashKey))
+		mac.Write([]byte(configs[k]))
+		fmt.Fprintf(&sb, "  %q: \"hmac-sha256:%s\"\n", k, hex.EncodeToString(mac.Sum(nil)))
+	}
+	return sb.String()
+}
+
+var placeholderRegex = regexp.MustCompile(`\$\{(\w+)\}`)
+
+// fillConfigPlaceholders returns a copy of the configurations with each ${name} placeholder replaced by the
+// corresponding value. Returns an error if a placeholder has no value.
+func fillConfigPlaceholders(configs map[string]string, values map[string]string) (map[string]string, error) {
+	filled := make(map[string]string, len(configs))
+	missingSet := make(map[string]bool)
+	for k, v := range configs {
+		filled[k] = placeholderRegex.ReplaceAllStringFunc(v, func(p string) string {
+			name := placeholderRegex.FindStringSubmatch(p)[1]
+			value, ok := values[name]
+			if !ok {
+				missingSet[name] = true
+				return p
+			}
+			return value
+		})
+	}
+	if len(missingSet) > 0 {
+		missing := make([]string, 0, len(missingSet))
+		for name := range missingSet {
+			missing = append(missing, name)
+		}
+		sort.Strings(missing)
+		return nil, fmt.Errorf("missing values for placeholders: %s", strings.Join(missing, ", "))
+	}
+	return filled, nil
+}
+
+// scriptTemplateData is the data which retention script contents are rendered with.
+type scriptTemplateData struct {
+	// Config is the org's configuration for the script's plugin.
+	Config map[string]string
+}
+
+// renderScriptContents renders the placeholders in a script's contents, such as {{ .Config.license_key }}, with the
+// org's configs. Returns an error if a placeholder references a config which the org has not set.
+func renderScriptContents(contents string, configs map[string]string) (string, error) {
+	if !strings.Contains(contents, "{{") {
+		return contents, nil
+	}
+	tmpl, err := template.New("script").Option("missingkey=error").Parse(contents)
+	if err != nil {
+		return "", err
+	}
+	if configs == nil {
+		configs = map[string]string{}
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, &scriptTemplateData{Config: configs})
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// effectiveExportURL returns the URL which an org's data for a plugin is exported to. A custom export URL set for the
+// plugin takes precedence over the org's default export URL, which is only used if the plugin allows custom export
+// URLs. Otherwise, the plugin's default export URL is used.
+func effectiveExportURL(customURL string, orgDefaultURL string, pluginDefaultURL string, allowCustomURL bool) string {
+	if customURL != "" {
+		return customURL
+	}
+	if orgDefaultURL != "" && (allowCustomURL || orgDefaultURL == pluginDefaultURL) {
+		return orgDefaultURL
+	}
+	return pluginDefaultURL
+}
+
+// isHTTPSURL returns whether the string is an absolute https URL.
+func isHTTPSURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && u.Scheme == "https" && u.Host != ""
+}
+
+// isAbsoluteURL returns whether the string is an absolute URL, with a scheme and host.
+func isAbsoluteURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && u.Scheme != "" && u.Host != ""
+}
+
+// isLogoURL returns whether the logo is an absolute https URL.
+func isLogoURL(logo string) bool {
+	return isHTTPSURL(logo)
+}
+
+// parseLogoDataURI parses a logo which is a data URI, of the form data:[<mediatype>][;base64],<data>, and returns its
+// media type and decoded data. The media type must be an image type.
+func parseLogoDataURI(logo string) (string, []byte, error) {
+	if !strings.HasPrefix(logo, "data:") {
+		return "", nil, errors.New("logo must be an https URL or a data URI")
+	}
+	comma := strings.Index(logo, ",")
+	if comma < 0 {
+		return "", nil, errors.New("data URI is missing data")
+	}
+	mediaType := strings.TrimPrefix(logo[:comma], "data:")
+	base64Encoded := strings.HasSuffix(mediaType, ";base64")
+	mediaType = strings.TrimSuffix(mediaType, ";base64")
+	if !strings.HasPrefix(mediaType, "image/") {
+		return "", nil, fmt.Errorf("data URI has non-image media type %q", mediaType)
+	}
+
+	if base64Encoded {
+		data, err := base64.StdEncoding.DecodeString(logo[comma+1:])
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to decode base64 data: %w", err)
+		}
+		return mediaType, data, nil
+	}
+	data, err := url.PathUnescape(logo[comma+1:])
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to decode data: %w", err)
+	}
+	return mediaType, []byte(data), nil
+}
+
+// validateLogo checks that the logo is in a format the catalog UI can render: an https URL, or a data URI with an image
+// media type.
+func validateLogo(logo string) error {
+	if isLogoURL(logo) {
 		return nil
 	}
-	return json.Unmarshal(data, p)
+	if u, err := url.Parse(logo); err == nil && u.Scheme != "" && u.Scheme != "data" {
+		return errors.New("logo URL must be an https URL")
+	}
+	_, _, err := parseLogoDataURI(logo)
+	return err
+}
+
+// decodeLogo checks that the logo can be rendered and is within the size limit. A logo is a data URI containing an SVG
+// or a PNG, JPEG or GIF image. Logos hosted at an https URL are fetched by the UI, so are not decoded.
+func decodeLogo(logo string, maxLength int) error {
+	if len(logo) > maxLength {
+		return fmt.Errorf("logo is %d bytes, which exceeds the limit of %d bytes", len(logo), maxLength)
+	}
+
+	if isLogoURL(logo) {
+		return nil
+	}
+	mediaType, data, err := parseLogoDataURI(logo)
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(mediaType, "image/svg+xml") {
+		return decodeSVG(data)
+	}
+	_, _, err = image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to decode image: %w", err)
+	}
+	return nil
+}
+
+// decodeSVG checks that the data is well-formed XML with an svg root element.
+func decodeSVG(data []byte) error {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	foundRoot := false
+	for {
+		tok, err := decoder.Token()
+		if err != nil {
+			if errors.Is(err, io.EOF) && foundRoot {
+				return nil
+			}
+			if errors.Is(err, io.EOF) {
+				return errors.New("logo is not an SVG")
+			}
+			return fmt.Errorf("failed to parse SVG: %w", err)
+		}
+		if el, ok := tok.(xml.StartElement); ok && !foundRoot {
+			if el.Name.Local != "svg" {
+				return errors.New("logo is not an SVG")
+			}
+			foundRoot = true
+		}
+	}
+}
+
+// compareVersions compares two plugin versions by semver, returning -1, 0 or 1. Versions which are not valid semver
+// sort before valid versions, and are otherwise compared as strings.
+func compareVersions(a string, b string) int {
+	va, errA := semver.ParseTolerant(a)
+	vb, errB := semver.ParseTolerant(b)
+	switch {
+	case errA == nil && errB == nil:
+		return va.Compare(vb)
+	case errA == nil:
+		return 1
+	case errB == nil:
+		return -1
+	default:
+		return strings.Compare(a, b)
+	}
+}
+
+// latestVersion returns the latest of the given plugin versions.
+func latestVersion(versions []string) string {
+	latest := ""
+	for i, v := range versions {
+		if i == 0 || compareVersions(v, latest) > 0 {
+			latest = v
+		}
+	}
+	return latest
+}
+
+// parseCronSchedule parses a standard 5-field cron expression, or a descriptor such as "@daily". Schedules are in UTC,
+// unless the expression specifies a time zone with a "CRON_TZ=" prefix.
+func parseCronSchedule(expr string) (cron.Schedule, error) {
+	return cron.ParseStandard(expr)
+}
+
+// cronSampleRuns is the number of upcoming runs of a cron schedule which are checked to find the shortest interval
+// between runs.
+const cronSampleRuns = 100
+
+// minCronIntervalS returns the shortest interval, in seconds, between the upcoming runs of the schedule after from.
+func minCronIntervalS(schedule cron.Schedule, from time.Time) int64 {
+	var minInterval time.Duration
+	prev := schedule.Next(from)
+	for i := 0; i < cronSampleRuns && !prev.IsZero(); i++ {
+		next := schedule.Next(prev)
+		if next.IsZero() {
+			break
+		}
+		if interval := next.Sub(prev); minInterval == 0 || interval < minInterval {
+			minInterval = interval
+		}
+		prev = next
+	}
+	return int64(minInterval / time.Second)
+}
+
+// nextRunAt returns when a script last run at lastRunAt should next be run: at the next time in its cron schedule if it
+// has one, or frequencyS seconds later otherwise. Returns nil if the script has never been run, since it is immediately
+// due.
+func nextRunAt(lastRunAt *time.Time, frequencyS *int64, cronSchedule *string) (*time.Time, error) {
+	if lastRunAt == nil {
+		return nil, nil
+	}
+	if cronSchedule != nil {
+		schedule, err := parseCronSchedule(*cronSchedule)
+		if err != nil {
+			return nil, err
+		}
+		next := schedule.Next(lastRunAt.UTC())
+		return &next, nil
+	}
+	var interval int64
+	if frequencyS != nil {
+		interval = *frequencyS
+	}
+	next := lastRunAt.Add(time.Duration(interval) * time.Second)
+	return &next, nil
+}
+
+// clampFrequency raises the frequency to the minimum frequency. Frequencies already above the minimum are unchanged.
+func clampFrequency(frequencyS int64, minFrequencyS int64) int64 {
+	if frequencyS < minFrequencyS {
+		return minFrequencyS
+	}
+	return frequencyS
+}
+
+// invalidFieldError returns an InvalidArgument error with the given message, and a BadRequest detail identifying the
+// request field which failed validation. Fields within the configurations are identified as "configurations.<key>".
+func invalidFieldError(field string, msg string) error {
+	return invalidFieldsError([]string{field}, msg)
+}
+
+// invalidFieldsError is like invalidFieldError, for when several request fields failed validation for the same reason.
+func invalidFieldsError(fields []string, msg string) error {
+	violations := make([]*errdetails.BadRequest_FieldViolation, len(fields))
+	for i, field := range fields {
+		violations[i] = &errdetails.BadRequest_FieldViolation{Field: field, Description: msg}
+	}
+	return fieldViolationsError(violations, msg)
+}
+
+// fieldViolationsError is like invalidFieldsError, for when each request field failed validation for its own reason.
+func fieldViolationsError(violations []*errdetails.BadRequest_FieldViolation, msg string) error {
+	st := status.New(codes.InvalidArgument, msg)
+	detailed, err := st.WithDetails(&errdetails.BadRequest{FieldViolations: violations})
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
 }
@@ -0,0 +1,337 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"px.dev/pixie/src/cloud/plugin/controllers"
+)
+
+func TestConfigurations_Value(t *testing.T) {
+	tests := []struct {
+		name     string
+		configs  controllers.Configurations
+		expected interface{}
+	}{
+		{
+			name:     "nil",
+			configs:  nil,
+			expected: nil,
+		},
+		{
+			name:     "empty",
+			configs:  controllers.Configurations{},
+			expected: []byte(`{}`),
+		},
+		{
+			name:     "non-empty",
+			configs:  controllers.Configurations{"license_key": "abcd"},
+			expected: []byte(`{"license_key":"abcd"}`),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			val, err := test.configs.Value()
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, val)
+		})
+	}
+}
+
+func TestConfigurations_Scan(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      interface{}
+		expected controllers.Configurations
+	}{
+		{
+			name:     "NULL",
+			src:      nil,
+			expected: controllers.Configurations{},
+		},
+		{
+			name:     "JSON null",
+			src:      []byte(`null`),
+			expected: controllers.Configurations{},
+		},
+		{
+			name:     "empty",
+			src:      []byte(`{}`),
+			expected: controllers.Configurations{},
+		},
+		{
+			name:     "non-empty",
+			src:      `{"license_key":"abcd"}`,
+			expected: controllers.Configurations{"license_key": "abcd"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var configs controllers.Configurations
+			err := configs.Scan(test.src)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, configs)
+		})
+	}
+
+	var configs controllers.Configurations
+	assert.Error(t, configs.Scan([]byte(`not json`)))
+}
+
+func TestPresetScripts_Value(t *testing.T) {
+	tests := []struct {
+		name     string
+		scripts  controllers.PresetScripts
+		expected interface{}
+	}{
+		{
+			name:     "nil",
+			scripts:  nil,
+			expected: nil,
+		},
+		{
+			name:     "empty",
+			scripts:  controllers.PresetScripts{},
+			expected: nil,
+		},
+		{
+			name: "non-empty",
+			scripts: controllers.PresetScripts{
+				&controllers.PresetScript{Name: "http data", DefaultFrequencyS: 10, Script: "script"},
+			},
+			expected: []byte(`[{"name":"http data","description":"","default_frequency_s":10,"script":"script"}]`),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			val, err := test.scripts.Value()
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, val)
+		})
+	}
+}
+
+func TestPresetScripts_Scan(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      interface{}
+		expected controllers.PresetScripts
+	}{
+		{
+			name:     "NULL",
+			src:      nil,
+			expected: controllers.PresetScripts{},
+		},
+		{
+			name:     "JSON null",
+			src:      []byte(`null`),
+			expected: controllers.PresetScripts{},
+		},
+		{
+			name:     "empty",
+			src:      []byte(`[]`),
+			expected: controllers.PresetScripts{},
+		},
+		{
+			name: "non-empty",
+			src:  `[{"name":"http data","default_frequency_s":10,"script":"script"}]`,
+			expected: controllers.PresetScripts{
+				&controllers.PresetScript{Name: "http data", DefaultFrequencyS: 10, Script: "script"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var scripts controllers.PresetScripts
+			err := scripts.Scan(test.src)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, scripts)
+		})
+	}
+}
+
+func TestPresetScripts_Compression(t *testing.T) {
+	scripts := controllers.PresetScripts{}
+	for i := 0; i < 50; i++ {
+		scripts = append(scripts, &controllers.PresetScript{
+			Name:              fmt.Sprintf("script %d", i),
+			DefaultFrequencyS: 10,
+			Script:            strings.Repeat("df = px.DataFrame(table='http_events')\n", 10),
+		})
+	}
+	plain, err := json.Marshal(scripts)
+	require.NoError(t, err)
+
+	val, err := scripts.Value()
+	require.NoError(t, err)
+	compressed, ok := val.([]byte)
+	require.True(t, ok)
+	// Large scripts are stored gzipped.
+	assert.Equal(t, []byte{0x1f, 0x8b}, compressed[:2])
+	assert.Less(t, len(compressed), len(plain))
+
+	var decompressed controllers.PresetScripts
+	require.NoError(t, decompressed.Scan(compressed))
+	assert.Equal(t, scripts, decompressed)
+
+	// Scripts which were stored before compression was added are still read.
+	var uncompressed controllers.PresetScripts
+	require.NoError(t, uncompressed.Scan(plain))
+	assert.Equal(t, scripts, uncompressed)
+}
+
+func TestParsePresetScriptsYAML(t *testing.T) {
+	tests := []struct {
+		name          string
+		doc           string
+		expected      controllers.PresetScripts
+		expectedError string
+	}{
+		{
+			name: "multiple documents",
+			doc: `name: http data
+description: This is a script to get http data
+default_frequency_s: 10
+script: http script
+---
+name: dns data
+default_frequency_s: 20
+script: |
+  dns script
+`,
+			expected: controllers.PresetScripts{
+				&controllers.PresetScript{
+					Name:              "http data",
+					Description:       "This is a script to get http data",
+					DefaultFrequencyS: 10,
+					Script:            "http script",
+				},
+				&controllers.PresetScript{Name: "dns data", DefaultFrequencyS: 20, Script: "dns script\n"},
+			},
+		},
+		{
+			name:     "empty",
+			doc:      "",
+			expected: controllers.PresetScripts{},
+		},
+		{
+			name: "unknown field",
+			doc: `name: http data
+default_frequency_s: 10
+script: http script
+---
+name: dns data
+frequency: 20
+script: dns script
+`,
+			expectedError: "document 1:",
+		},
+		{
+			name: "missing script",
+			doc: `name: http data
+default_frequency_s: 10
+`,
+			expectedError: "document 0: missing script",
+		},
+		{
+			name: "invalid frequency",
+			doc: `name: http data
+default_frequency_s: 0
+script: http script
+`,
+			expectedError: "document 0: default_frequency_s must be positive",
+		},
+		{
+			name: "duplicate name",
+			doc: `name: http data
+default_frequency_s: 10
+script: http script
+---
+name: http data
+default_frequency_s: 20
+script: http script 2
+`,
+			expectedError: `document 1: name "http data" is already used by document 0`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			scripts, err := controllers.ParsePresetScriptsYAML(strings.NewReader(test.doc))
+			if test.expectedError != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, scripts)
+		})
+	}
+}
+
+func TestValidatePGPOptions(t *testing.T) {
+	tests := []struct {
+		name          string
+		cipherAlgo    string
+		compressAlgo  int
+		expectedError bool
+	}{
+		{
+			name: "defaults",
+		},
+		{
+			name:         "supported algorithms",
+			cipherAlgo:   "aes256",
+			compressAlgo: 2,
+		},
+		{
+			name:          "unknown cipher",
+			cipherAlgo:    "rot13",
+			expectedError: true,
+		},
+		{
+			name:          "unknown compression",
+			cipherAlgo:    "aes128",
+			compressAlgo:  3,
+			expectedError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := controllers.ValidatePGPOptions(test.cipherAlgo, test.compressAlgo)
+			if test.expectedError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -21,10 +21,13 @@ package main
 import (
 	"net/http"
 	_ "net/http/pprof"
+	"time"
 
 	bindata "github.com/golang-migrate/migrate/source/go_bindata"
 	log "github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
+	"google.golang.org/grpc"
 
 	"px.dev/pixie/src/cloud/plugin/controllers"
 	"px.dev/pixie/src/cloud/plugin/pluginpb"
@@ -33,10 +36,25 @@ import (
 	"px.dev/pixie/src/shared/services"
 	"px.dev/pixie/src/shared/services/env"
 	"px.dev/pixie/src/shared/services/healthz"
+	"px.dev/pixie/src/shared/services/metrics"
 	"px.dev/pixie/src/shared/services/pg"
 	"px.dev/pixie/src/shared/services/server"
 )
 
+// migrationsTable is the table golang-migrate records the plugin service's applied migrations in.
+const migrationsTable = "plugin_service_migrations"
+
+func init() {
+	pflag.StringSlice("decrypted_config_services", nil, "The IDs of the services which may read decrypted org plugin configs. If unset, all callers may read decrypted configs.")
+	pflag.Duration("plugins_cache_ttl", 5*time.Second, "How long to cache the plugin catalog for. If 0, the catalog is not cached.")
+	pflag.Int("max_concurrent_decryptions", 0, "The maximum number of queries which decrypt org plugin configs that may run at once. If 0, decryptions are unbounded.")
+	pflag.String("pgp_cipher_algo", "", "The cipher algorithm which plugin configs are encrypted with, such as aes256. If unset, pgcrypto's default is used.")
+	pflag.Int("pgp_compress_algo", 0, "The compression algorithm which plugin configs are encrypted with: 0 (none), 1 (zip) or 2 (zlib).")
+	pflag.Int("org_config_writes_per_minute", 120, "How many plugin config writes each org may make per minute. If 0, writes are not limited.")
+	pflag.Int("org_config_write_burst", 60, "How many plugin config writes each org may make at once.")
+	pflag.String("gitops_hash_key", "", "The key which config values are hashed with in GitOps configs. If unset, a key is derived from the database key.")
+}
+
 func main() {
 	services.SetupService("plugin-service", 50600)
 	services.PostFlagSetupAndParse()
@@ -47,22 +65,47 @@ func main() {
 	// This handles all the pprof endpoints.
 	mux.Handle("/debug/", http.DefaultServeMux)
 	healthz.RegisterDefaultChecks(mux)
+	metrics.MustRegisterMetricsHandler(mux)
 
 	db := pg.MustConnectDefaultPostgresDB()
-	err := pgmigrate.PerformMigrationsUsingBindata(db, "plugin_service_migrations",
+	err := pgmigrate.PerformMigrationsUsingBindata(db, migrationsTable,
 		bindata.Resource(schema.AssetNames(), schema.Asset))
 	if err != nil {
 		log.WithError(err).Fatal("Failed to apply migrations")
 	}
+	err = schema.CheckMigrations(db, migrationsTable)
+	if err != nil {
+		log.WithError(err).Fatal("Database schema does not match migrations")
+	}
 
 	dbKey := viper.GetString("database_key")
 	if dbKey == "" {
 		log.Fatal("Database encryption key is required")
 	}
+	cipherAlgo := viper.GetString("pgp_cipher_algo")
+	compressAlgo := viper.GetInt("pgp_compress_algo")
+	err = controllers.ValidatePGPOptions(cipherAlgo, compressAlgo)
+	if err != nil {
+		log.WithError(err).Fatal("Invalid PGP options")
+	}
 
-	s := server.NewPLServer(env.New(viper.GetString("domain_name")), mux)
+	s := server.NewPLServer(env.New(viper.GetString("domain_name")), mux,
+		grpc.ChainUnaryInterceptor(controllers.UnaryServerInterceptor()),
+		grpc.ChainStreamInterceptor(controllers.StreamServerInterceptor()))
 
-	c := controllers.New(db, dbKey)
+	opts := []controllers.Option{
+		controllers.WithPluginsCacheTTL(viper.GetDuration("plugins_cache_ttl")),
+		controllers.WithMaxConcurrentDecryptions(viper.GetInt("max_concurrent_decryptions")),
+		controllers.WithPGPOptions(cipherAlgo, compressAlgo),
+		controllers.WithOrgConfigWriteRateLimit(viper.GetInt("org_config_writes_per_minute"), viper.GetInt("org_config_write_burst")),
+	}
+	if hashKey := viper.GetString("gitops_hash_key"); hashKey != "" {
+		opts = append(opts, controllers.WithGitOpsHashKey(hashKey))
+	}
+	if serviceIDs := viper.GetStringSlice("decrypted_config_services"); len(serviceIDs) > 0 {
+		opts = append(opts, controllers.WithDecryptedConfigServices(serviceIDs...))
+	}
+	c := controllers.New(db, dbKey, opts...)
 
 	pluginpb.RegisterPluginServiceServer(s.GRPCServer(), c)
 
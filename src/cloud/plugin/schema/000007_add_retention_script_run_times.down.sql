@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_plugin_retention_scripts_next_run_at;
+
+ALTER TABLE plugin_retention_scripts
+  DROP COLUMN IF EXISTS next_run_at,
+  DROP COLUMN IF EXISTS last_run_at;
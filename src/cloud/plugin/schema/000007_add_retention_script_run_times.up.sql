@@ -0,0 +1,10 @@
+ALTER TABLE plugin_retention_scripts
+  -- last_run_at is the last time the script was run. NULL if the script has never been run.
+  ADD COLUMN IF NOT EXISTS last_run_at TIMESTAMP,
+  -- next_run_at is the next time the script should be run, based on its frequency. NULL if the script has never
+  -- been run, in which case it is immediately due.
+  ADD COLUMN IF NOT EXISTS next_run_at TIMESTAMP GENERATED ALWAYS AS (
+    last_run_at + COALESCE(frequency_s, 0) * interval '1 second'
+  ) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_plugin_retention_scripts_next_run_at ON plugin_retention_scripts(next_run_at);
@@ -0,0 +1,2 @@
+-- yanked is whether the release has been pulled. Orgs may remain on a yanked release, but it should not be newly enabled.
+ALTER TABLE plugin_releases ADD COLUMN IF NOT EXISTS yanked boolean NOT NULL DEFAULT false;
@@ -0,0 +1,3 @@
+ALTER TABLE plugin_retention_scripts
+  DROP COLUMN IF EXISTS last_error,
+  DROP COLUMN IF EXISTS last_run_status;
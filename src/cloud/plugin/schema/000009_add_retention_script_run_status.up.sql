@@ -0,0 +1,5 @@
+ALTER TABLE plugin_retention_scripts
+  -- last_run_status is the status of the last run of the script, such as RUN_STATUS_SUCCESS or RUN_STATUS_FAILURE.
+  ADD COLUMN IF NOT EXISTS last_run_status varchar(1024),
+  -- last_error is the error returned by the last run of the script, if it failed.
+  ADD COLUMN IF NOT EXISTS last_error varchar;
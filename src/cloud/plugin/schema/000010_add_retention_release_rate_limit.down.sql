@@ -0,0 +1 @@
+ALTER TABLE data_retention_plugin_releases DROP COLUMN IF EXISTS rate_limit_per_minute;
@@ -0,0 +1,3 @@
+-- rate_limit_per_minute is the maximum number of requests per minute the plugin provider accepts for an org. NULL if the
+-- plugin does not declare a rate limit.
+ALTER TABLE data_retention_plugin_releases ADD COLUMN IF NOT EXISTS rate_limit_per_minute int;
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS plugin_config_templates (
+  -- template_id is the ID of the template.
+  template_id UUID NOT NULL,
+  -- name is a human-readable name for the template.
+  name varchar(1024) NOT NULL,
+  -- plugin_id is the ID of the plugin that the template configures.
+  plugin_id varchar(1024) NOT NULL,
+  -- version is the version of the plugin that the template configures.
+  version varchar(1024) NOT NULL,
+  -- configurations contains the configuration values to apply to an org. Values may contain ${name} placeholders which
+  -- are filled in per org. The value is an encrypted JSON.
+  configurations bytea,
+
+  PRIMARY KEY (template_id),
+  FOREIGN KEY (plugin_id, version) REFERENCES plugin_releases(id, version)
+);
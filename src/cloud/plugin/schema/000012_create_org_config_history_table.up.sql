@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS org_data_retention_plugin_config_history (
+  -- org_id is the org who configured the plugin.
+  org_id UUID NOT NULL,
+  -- plugin_id is the ID of the plugin which the org configured.
+  plugin_id varchar(1024) NOT NULL,
+  -- version is the plugin release which the org had enabled with this config.
+  version varchar(1024) NOT NULL,
+  -- configurations contains the last config the org had set while running this version. The value is an encrypted JSON.
+  configurations bytea,
+  -- updated_at is when the org last set this config.
+  updated_at TIMESTAMP DEFAULT NOW(),
+
+  PRIMARY KEY (org_id, plugin_id, version),
+  FOREIGN KEY (plugin_id, version) REFERENCES plugin_releases(id, version)
+);
+
+INSERT INTO org_data_retention_plugin_config_history (org_id, plugin_id, version, configurations)
+  SELECT org_id, plugin_id, version, configurations FROM org_data_retention_plugins
+  ON CONFLICT DO NOTHING;
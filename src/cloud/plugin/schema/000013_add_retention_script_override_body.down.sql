@@ -0,0 +1 @@
+ALTER TABLE plugin_retention_scripts DROP COLUMN IF EXISTS override_body;
@@ -0,0 +1,3 @@
+-- override_body is an org-specific replacement for the contents of a preset script. NULL if the org uses the preset's
+-- contents unchanged.
+ALTER TABLE plugin_retention_scripts ADD COLUMN IF NOT EXISTS override_body varchar;
@@ -0,0 +1,2 @@
+ALTER TABLE org_data_retention_plugins DROP COLUMN IF EXISTS typed_configurations;
+ALTER TABLE data_retention_plugin_releases DROP COLUMN IF EXISTS typed_configurations;
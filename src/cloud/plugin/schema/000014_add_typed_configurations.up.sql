@@ -0,0 +1,6 @@
+-- typed_configurations is the set of structured configurations that the user needs to specify in order to configure the
+-- data retention plugin, for configurations whose values are not strings.
+ALTER TABLE data_retention_plugin_releases ADD COLUMN IF NOT EXISTS typed_configurations jsonb;
+-- typed_configurations contains the user-configured structured values for the plugin. Like configurations, the value is
+-- an encrypted JSON, since it may contain secrets.
+ALTER TABLE org_data_retention_plugins ADD COLUMN IF NOT EXISTS typed_configurations bytea;
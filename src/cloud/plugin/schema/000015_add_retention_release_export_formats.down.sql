@@ -0,0 +1 @@
+ALTER TABLE data_retention_plugin_releases DROP COLUMN IF EXISTS export_formats;
@@ -0,0 +1,2 @@
+-- export_formats are the formats in which the plugin provider accepts exported data, such as json, protobuf or csv.
+ALTER TABLE data_retention_plugin_releases ADD COLUMN IF NOT EXISTS export_formats text[];
@@ -0,0 +1 @@
+ALTER TABLE org_data_retention_plugins DROP COLUMN IF EXISTS min_frequency_s;
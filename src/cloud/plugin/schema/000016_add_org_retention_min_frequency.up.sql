@@ -0,0 +1,2 @@
+-- min_frequency_s is the minimum frequency, in seconds, which the org's preset scripts for the plugin should run at.
+ALTER TABLE org_data_retention_plugins ADD COLUMN IF NOT EXISTS min_frequency_s bigint;
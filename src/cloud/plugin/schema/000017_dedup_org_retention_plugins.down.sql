@@ -0,0 +1,2 @@
+-- The up migration is empty.
+SELECT 1;
@@ -0,0 +1,3 @@
+-- This migration is intentionally empty. It removed duplicate org plugin rows, but the primary key on
+-- (org_id, plugin_id) means there can be none. It is kept so that the migration numbering is unchanged.
+SELECT 1;
@@ -0,0 +1 @@
+ALTER TABLE plugin_releases DROP COLUMN IF EXISTS maintenance;
@@ -0,0 +1,3 @@
+-- maintenance is whether the plugin's backend is under maintenance. While set, the plugin's retention scripts are paused
+-- across all orgs, without changing whether the scripts are enabled.
+ALTER TABLE plugin_releases ADD COLUMN IF NOT EXISTS maintenance boolean NOT NULL DEFAULT false;
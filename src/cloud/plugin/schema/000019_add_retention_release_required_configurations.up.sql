@@ -0,0 +1,2 @@
+-- required_configurations are the keys in configurations which an org must set to enable the plugin.
+ALTER TABLE data_retention_plugin_releases ADD COLUMN IF NOT EXISTS required_configurations text[];
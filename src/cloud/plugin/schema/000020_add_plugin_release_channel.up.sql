@@ -0,0 +1,3 @@
+-- release_channel is the channel the release is published to. Only stable releases are considered when computing a
+-- plugin's latest version, unless beta releases are explicitly requested.
+ALTER TABLE plugin_releases ADD COLUMN IF NOT EXISTS release_channel varchar(32) NOT NULL DEFAULT 'stable';
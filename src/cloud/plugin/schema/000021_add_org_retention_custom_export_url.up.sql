@@ -0,0 +1,3 @@
+-- custom_export_url is the URL which the org's data is exported to in place of the plugin's default export URL. NULL if the
+-- org uses the default.
+ALTER TABLE org_data_retention_plugins ADD COLUMN IF NOT EXISTS custom_export_url varchar(65536);
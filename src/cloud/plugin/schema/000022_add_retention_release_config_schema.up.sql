@@ -0,0 +1,3 @@
+-- config_schema is a JSON Schema provided by the plugin author, which orgs' configurations for the release must
+-- satisfy. NULL if the release has no schema, in which case any configurations are accepted.
+ALTER TABLE data_retention_plugin_releases ADD COLUMN IF NOT EXISTS config_schema jsonb;
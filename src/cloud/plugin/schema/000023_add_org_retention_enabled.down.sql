@@ -0,0 +1,2 @@
+DELETE FROM org_data_retention_plugins WHERE enabled='false';
+ALTER TABLE org_data_retention_plugins DROP COLUMN IF EXISTS enabled;
@@ -0,0 +1,3 @@
+-- enabled is false if the org has disabled the plugin. The org's configs are kept, so that they are restored if the org
+-- enables the plugin again.
+ALTER TABLE org_data_retention_plugins ADD COLUMN IF NOT EXISTS enabled boolean NOT NULL DEFAULT true;
@@ -0,0 +1,3 @@
+-- health_check_url is an endpoint provided by the plugin author, which verifies that an org's configurations can
+-- connect to the plugin provider. NULL if the release has no health check.
+ALTER TABLE data_retention_plugin_releases ADD COLUMN IF NOT EXISTS health_check_url text;
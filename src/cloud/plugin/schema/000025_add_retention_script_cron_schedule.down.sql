@@ -0,0 +1,12 @@
+DROP INDEX IF EXISTS idx_plugin_retention_scripts_next_run_at;
+
+ALTER TABLE plugin_retention_scripts
+  DROP COLUMN IF EXISTS cron_schedule,
+  DROP COLUMN IF EXISTS next_run_at;
+
+ALTER TABLE plugin_retention_scripts
+  ADD COLUMN next_run_at TIMESTAMP GENERATED ALWAYS AS (
+    last_run_at + COALESCE(frequency_s, 0) * interval '1 second'
+  ) STORED;
+
+CREATE INDEX idx_plugin_retention_scripts_next_run_at ON plugin_retention_scripts(next_run_at);
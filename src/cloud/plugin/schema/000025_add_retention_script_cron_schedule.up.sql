@@ -0,0 +1,7 @@
+-- cron_schedule is a cron expression for when the script should be run. NULL if the script runs every frequency_s
+-- seconds instead.
+ALTER TABLE plugin_retention_scripts ADD COLUMN IF NOT EXISTS cron_schedule varchar(1024);
+
+-- next_run_at can't be computed from a cron schedule in SQL, so it is no longer generated from last_run_at and
+-- frequency_s. Instead, it is set by the service whenever a script is run or its schedule changes.
+ALTER TABLE plugin_retention_scripts ALTER COLUMN next_run_at DROP EXPRESSION IF EXISTS;
@@ -0,0 +1 @@
+DROP FUNCTION IF EXISTS pgp_sym_decrypts(bytea, text);
@@ -0,0 +1,10 @@
+-- pgp_sym_decrypts returns whether data can be decrypted with the given key. Unlike PGP_SYM_DECRYPT, a failed decryption
+-- returns false rather than aborting the statement, so that many values can be checked in a single query.
+CREATE OR REPLACE FUNCTION pgp_sym_decrypts(data bytea, key text) RETURNS boolean AS $$
+BEGIN
+  PERFORM PGP_SYM_DECRYPT(data, key);
+  RETURN true;
+EXCEPTION WHEN external_routine_invocation_exception THEN
+  RETURN false;
+END;
+$$ LANGUAGE plpgsql STABLE;
@@ -0,0 +1,2 @@
+-- dependencies are the IDs of other plugins which an org must have enabled before enabling this release.
+ALTER TABLE data_retention_plugin_releases ADD COLUMN IF NOT EXISTS dependencies text[];
@@ -0,0 +1,2 @@
+-- tags are the categories the plugin release belongs to, such as observability or security.
+ALTER TABLE plugin_releases ADD COLUMN IF NOT EXISTS tags text[];
@@ -0,0 +1,2 @@
+-- min_cli_version is the minimum semVer version of the CLI which the plugin release works with, if any.
+ALTER TABLE data_retention_plugin_releases ADD COLUMN IF NOT EXISTS min_cli_version varchar(1024);
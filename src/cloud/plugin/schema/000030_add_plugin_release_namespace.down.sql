@@ -0,0 +1,2 @@
+ALTER TABLE data_retention_plugin_releases DROP COLUMN IF EXISTS namespace;
+ALTER TABLE plugin_releases DROP COLUMN IF EXISTS namespace;
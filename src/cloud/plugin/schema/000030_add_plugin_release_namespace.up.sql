@@ -0,0 +1,4 @@
+-- namespace is the catalog the plugin release belongs to, so that environments sharing a database, such as staging and
+-- prod, can have separate catalogs.
+ALTER TABLE plugin_releases ADD COLUMN IF NOT EXISTS namespace varchar(1024) NOT NULL DEFAULT 'default';
+ALTER TABLE data_retention_plugin_releases ADD COLUMN IF NOT EXISTS namespace varchar(1024) NOT NULL DEFAULT 'default';
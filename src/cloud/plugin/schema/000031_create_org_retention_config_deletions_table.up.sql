@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS org_retention_config_deletions (
+  -- org_id is the org whose retention config was deleted.
+  org_id UUID NOT NULL,
+  -- plugin_id is the plugin whose config was deleted, or NULL if all of the org's retention config was deleted.
+  plugin_id varchar(1024),
+  -- deleted_plugin_configs is the number of the org's plugin configs which were deleted.
+  deleted_plugin_configs bigint NOT NULL,
+  -- deleted_scripts is the number of the org's retention scripts which were deleted.
+  deleted_scripts bigint NOT NULL,
+  -- deleted_at is when the config was deleted.
+  deleted_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS org_retention_config_deletions_org_id_idx ON org_retention_config_deletions (org_id);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS plugin_latest_releases_state;
+DROP TABLE IF EXISTS plugin_latest_releases;
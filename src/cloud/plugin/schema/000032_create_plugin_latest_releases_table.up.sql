@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS plugin_latest_releases (
+  -- id is the ID of the plugin.
+  id varchar(1024) NOT NULL,
+  -- include_beta is whether beta releases were considered when finding the latest release.
+  include_beta boolean NOT NULL,
+  -- version is the semVer version of the plugin's latest release.
+  version varchar(1024) NOT NULL,
+
+  PRIMARY KEY (id, include_beta)
+);
+
+CREATE TABLE IF NOT EXISTS plugin_latest_releases_state (
+  -- id is always true, so that the table has at most one row.
+  id boolean PRIMARY KEY DEFAULT true CHECK (id),
+  -- release_count is the number of plugin releases which plugin_latest_releases was computed from. If it differs from
+  -- the current number of plugin releases, plugin_latest_releases is stale.
+  release_count bigint NOT NULL,
+  -- refreshed_at is when plugin_latest_releases was last rebuilt from scratch.
+  refreshed_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS org_retention_settings (
+  -- org_id is the org which the settings apply to.
+  org_id UUID NOT NULL,
+  -- default_export_url is the URL which the org's data is exported to for every plugin which allows custom export URLs,
+  -- in place of the plugin's default export URL. NULL if the org uses each plugin's default.
+  default_export_url varchar(65536),
+
+  PRIMARY KEY (org_id)
+);
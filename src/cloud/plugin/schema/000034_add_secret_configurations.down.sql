@@ -0,0 +1,20 @@
+-- The plaintext configurations are encrypted back into configurations before their columns are dropped, so that no
+-- values are lost. This requires the database key, which must be set for the session running the migration, such as
+-- with PGOPTIONS='-c plugin_service.database_key=<key>'. The migration fails without changing any data if it is not set.
+UPDATE org_data_retention_plugins SET
+  configurations = PGP_SYM_ENCRYPT(
+    merge_configurations(PGP_SYM_DECRYPT(configurations, current_setting('plugin_service.database_key')), plaintext_configurations),
+    current_setting('plugin_service.database_key')),
+  plaintext_configurations = NULL
+  WHERE plaintext_configurations IS NOT NULL;
+UPDATE org_data_retention_plugin_config_history SET
+  configurations = PGP_SYM_ENCRYPT(
+    merge_configurations(PGP_SYM_DECRYPT(configurations, current_setting('plugin_service.database_key')), plaintext_configurations),
+    current_setting('plugin_service.database_key')),
+  plaintext_configurations = NULL
+  WHERE plaintext_configurations IS NOT NULL;
+
+DROP FUNCTION IF EXISTS merge_configurations(text, json);
+ALTER TABLE org_data_retention_plugin_config_history DROP COLUMN IF EXISTS plaintext_configurations;
+ALTER TABLE org_data_retention_plugins DROP COLUMN IF EXISTS plaintext_configurations;
+ALTER TABLE data_retention_plugin_releases DROP COLUMN IF EXISTS secret_configurations;
@@ -0,0 +1,15 @@
+-- secret_configurations are the keys of the release's configurations whose values are secret. NULL if every
+-- configuration is secret.
+ALTER TABLE data_retention_plugin_releases ADD COLUMN IF NOT EXISTS secret_configurations text[];
+-- plaintext_configurations contains the org's values for configurations which the release does not mark as secret.
+-- These are stored unencrypted, so that they can be read without decrypting. NULL if every configuration is encrypted.
+ALTER TABLE org_data_retention_plugins ADD COLUMN IF NOT EXISTS plaintext_configurations json;
+ALTER TABLE org_data_retention_plugin_config_history ADD COLUMN IF NOT EXISTS plaintext_configurations json;
+
+-- merge_configurations merges an org's decrypted secret configurations with its plaintext configurations, as JSON.
+CREATE OR REPLACE FUNCTION merge_configurations(secret text, plaintext json) RETURNS text AS $$
+  SELECT CASE
+    WHEN plaintext IS NULL THEN secret
+    ELSE (COALESCE(secret::jsonb, '{}'::jsonb) || plaintext::jsonb)::text
+  END
+$$ LANGUAGE SQL IMMUTABLE;
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS retention_script_runs (
+  -- script_id is the ID of the retention script which was run.
+  script_id UUID NOT NULL,
+  -- run_at is when the script was run.
+  run_at TIMESTAMP NOT NULL,
+  -- status is the status of the run, such as RUN_STATUS_SUCCESS or RUN_STATUS_FAILURE.
+  status varchar(1024) NOT NULL,
+  -- duration_ms is how long the run took, in milliseconds. NULL if the duration was not reported.
+  duration_ms bigint,
+  -- error is the error returned by the run. NULL if the run did not fail.
+  error varchar,
+
+  FOREIGN KEY (script_id) REFERENCES plugin_retention_scripts(script_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS retention_script_runs_script_id_run_at_idx ON retention_script_runs (script_id, run_at DESC);
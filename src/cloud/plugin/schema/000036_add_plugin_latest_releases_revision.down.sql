@@ -0,0 +1,7 @@
+DROP TRIGGER IF EXISTS plugin_releases_revision_truncate ON plugin_releases;
+DROP TRIGGER IF EXISTS plugin_releases_revision ON plugin_releases;
+DROP FUNCTION IF EXISTS bump_plugin_releases_revision();
+-- The stored releases are stale until they are next refreshed.
+ALTER TABLE plugin_latest_releases_state ADD COLUMN IF NOT EXISTS release_count bigint NOT NULL DEFAULT -1;
+ALTER TABLE plugin_latest_releases_state DROP COLUMN IF EXISTS refreshed_revision;
+ALTER TABLE plugin_latest_releases_state DROP COLUMN IF EXISTS revision;
@@ -0,0 +1,22 @@
+-- revision is incremented by every statement which may change the latest releases. refreshed_revision is the revision
+-- which plugin_latest_releases was computed at. If they differ, plugin_latest_releases is stale. Existing stored
+-- releases are stale until they are next refreshed, since the releases may have changed without changing their count.
+ALTER TABLE plugin_latest_releases_state ADD COLUMN IF NOT EXISTS revision bigint NOT NULL DEFAULT 0;
+ALTER TABLE plugin_latest_releases_state ADD COLUMN IF NOT EXISTS refreshed_revision bigint NOT NULL DEFAULT -1;
+ALTER TABLE plugin_latest_releases_state DROP COLUMN IF EXISTS release_count;
+
+CREATE OR REPLACE FUNCTION bump_plugin_releases_revision() RETURNS trigger AS $$
+BEGIN
+  UPDATE plugin_latest_releases_state SET revision = revision + 1;
+  RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+-- Any change to the set of releases, their versions or their channels may change the latest releases, including
+-- changes made outside of the plugin service.
+DROP TRIGGER IF EXISTS plugin_releases_revision ON plugin_releases;
+CREATE TRIGGER plugin_releases_revision AFTER INSERT OR DELETE OR UPDATE OF id, version, release_channel ON plugin_releases
+  FOR EACH STATEMENT EXECUTE PROCEDURE bump_plugin_releases_revision();
+DROP TRIGGER IF EXISTS plugin_releases_revision_truncate ON plugin_releases;
+CREATE TRIGGER plugin_releases_revision_truncate AFTER TRUNCATE ON plugin_releases
+  FOR EACH STATEMENT EXECUTE PROCEDURE bump_plugin_releases_revision();
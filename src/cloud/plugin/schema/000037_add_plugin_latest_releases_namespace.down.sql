@@ -0,0 +1,10 @@
+DROP TRIGGER IF EXISTS plugin_releases_revision ON plugin_releases;
+CREATE TRIGGER plugin_releases_revision AFTER INSERT OR DELETE OR UPDATE OF id, version, release_channel ON plugin_releases
+  FOR EACH STATEMENT EXECUTE PROCEDURE bump_plugin_releases_revision();
+
+-- The stored releases are stale until they are next refreshed.
+UPDATE plugin_latest_releases_state SET refreshed_revision = revision - 1;
+DELETE FROM plugin_latest_releases WHERE namespace != 'default';
+ALTER TABLE plugin_latest_releases DROP CONSTRAINT IF EXISTS plugin_latest_releases_pkey;
+ALTER TABLE plugin_latest_releases DROP COLUMN IF EXISTS namespace;
+ALTER TABLE plugin_latest_releases ADD CONSTRAINT plugin_latest_releases_pkey PRIMARY KEY (id, include_beta);
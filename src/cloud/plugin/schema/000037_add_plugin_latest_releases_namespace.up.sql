@@ -0,0 +1,12 @@
+-- namespace is the catalog the latest release was found in. A plugin may have releases in several namespaces, such as a
+-- new version being tested in staging, so each namespace has its own latest release.
+ALTER TABLE plugin_latest_releases ADD COLUMN IF NOT EXISTS namespace varchar(1024) NOT NULL DEFAULT 'default';
+ALTER TABLE plugin_latest_releases DROP CONSTRAINT IF EXISTS plugin_latest_releases_pkey;
+ALTER TABLE plugin_latest_releases ADD CONSTRAINT plugin_latest_releases_pkey PRIMARY KEY (namespace, id, include_beta);
+-- Existing stored releases were found across all namespaces, so they are stale until they are next refreshed.
+UPDATE plugin_latest_releases_state SET refreshed_revision = revision - 1;
+
+-- Moving a release to another namespace may change the latest releases of both namespaces.
+DROP TRIGGER IF EXISTS plugin_releases_revision ON plugin_releases;
+CREATE TRIGGER plugin_releases_revision AFTER INSERT OR DELETE OR UPDATE OF id, version, release_channel, namespace ON plugin_releases
+  FOR EACH STATEMENT EXECUTE PROCEDURE bump_plugin_releases_revision();
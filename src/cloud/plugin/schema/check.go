@@ -0,0 +1,76 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package schema
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// latestMigrationVersion returns the version of the newest embedded migration.
+func latestMigrationVersion() (int64, error) {
+	var latest int64
+	for _, name := range AssetNames() {
+		prefix := strings.SplitN(name, "_", 2)[0]
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("migration %s does not have a version", name)
+		}
+		if version > latest {
+			latest = version
+		}
+	}
+	return latest, nil
+}
+
+// CheckMigrations checks that the migration version recorded in the golang-migrate migrations table is the newest
+// embedded migration, so that drift between the database schema and the migrations can be caught at startup. Returns an
+// error describing the gap if the database is behind or ahead of the migrations, or if the last migration is dirty.
+func CheckMigrations(db *sqlx.DB, migrationsTable string) error {
+	latest, err := latestMigrationVersion()
+	if err != nil {
+		return err
+	}
+
+	var version int64
+	var dirty bool
+	query := fmt.Sprintf(`SELECT version, dirty FROM %s LIMIT 1`, pq.QuoteIdentifier(migrationsTable))
+	err = db.QueryRowx(query).Scan(&version, &dirty)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("no migrations have been applied, expected migration %d", latest)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read migration version: %w", err)
+	}
+
+	switch {
+	case dirty:
+		return fmt.Errorf("migration %d is dirty, it failed part way through and must be fixed manually", version)
+	case version < latest:
+		return fmt.Errorf("database is at migration %d, but the latest migration is %d: %d migration(s) have not been applied", version, latest, latest-version)
+	case version > latest:
+		return fmt.Errorf("database is at migration %d, which is newer than the latest migration %d", version, latest)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package schema
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ReapplyUpMigrations re-applies each up migration against a database which already has all migrations applied, to
+// check that the migrations are idempotent. Each migration is run in its own transaction, which is always rolled back
+// so that the database is left unchanged. Returns the error from each migration which could not be re-applied, keyed
+// by the migration's asset name.
+func ReapplyUpMigrations(db *sqlx.DB) (map[string]error, error) {
+	names := []string{}
+	for _, name := range AssetNames() {
+		if strings.HasSuffix(name, ".up.sql") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	failures := make(map[string]error)
+	for _, name := range names {
+		contents, err := Asset(name)
+		if err != nil {
+			return nil, err
+		}
+
+		tx, err := db.Beginx()
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.Exec(string(contents))
+		if err != nil {
+			failures[name] = err
+		}
+		err = tx.Rollback()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return failures, nil
+}
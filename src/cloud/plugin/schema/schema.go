@@ -18,4 +18,121 @@
 
 package schema
 
-//go:generate go-bindata -modtime=1 -ignore=\.go -ignore=\.sh -ignore=\.bazel -pkg=schema -o=bindata.gen.go ./...
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+//go:embed *.sql
+var migrations embed.FS
+
+// Migrations returns the SQL migrations for the plugin service.
+func Migrations() fs.FS {
+	return migrations
+}
+
+// AssetNames returns the names of the migrations, in sorted order. Along with Asset, this allows the migrations to be
+// used wherever go-bindata assets were expected, such as with the go_bindata migration source.
+func AssetNames() []string {
+	entries, err := migrations.ReadDir(".")
+	if err != nil {
+		return nil
+	}
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.Name()
+	}
+	return names
+}
+
+// Asset loads and returns the contents of the migration with the given name.
+func Asset(name string) ([]byte, error) {
+	contents, err := migrations.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("Asset %s not found", name)
+	}
+	return contents, nil
+}
+
+// RestoreAsset writes the migration with the given name under dir.
+func RestoreAsset(dir, name string) error {
+	contents, err := Asset(name)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(dir, os.FileMode(0755))
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, name), contents, os.FileMode(0644))
+}
+
+type restoreOptions struct {
+	collectErrors bool
+}
+
+// RestoreOption configures how RestoreAssets handles failures.
+type RestoreOption func(*restoreOptions)
+
+// WithCollectedErrors makes RestoreAssets attempt every migration, rather than stopping at the first failure. If any
+// migrations could not be restored, a *RestoreError listing them is returned.
+func WithCollectedErrors() RestoreOption {
+	return func(o *restoreOptions) {
+		o.collectErrors = true
+	}
+}
+
+// RestoreError describes each migration which RestoreAssets could not restore.
+type RestoreError struct {
+	// Failures maps the path of each migration which could not be restored to the error restoring it.
+	Failures map[string]error
+}
+
+func (e *RestoreError) Error() string {
+	paths := make([]string, 0, len(e.Failures))
+	for path := range e.Failures {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	msgs := make([]string, len(paths))
+	for i, path := range paths {
+		msgs[i] = fmt.Sprintf("%s: %v", path, e.Failures[path])
+	}
+	return fmt.Sprintf("failed to restore %d migration(s): %s", len(paths), strings.Join(msgs, "; "))
+}
+
+// RestoreAssets writes the migration with the given name under dir, or every migration if name is empty or ".". By
+// default, restoring stops at the first failure.
+func RestoreAssets(dir, name string, opts ...RestoreOption) error {
+	o := &restoreOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	names := []string{name}
+	if name == "" || name == "." {
+		names = AssetNames()
+	}
+
+	failures := make(map[string]error)
+	for _, n := range names {
+		err := RestoreAsset(dir, n)
+		if err == nil {
+			continue
+		}
+		if !o.collectErrors {
+			return err
+		}
+		failures[filepath.Join(dir, n)] = err
+	}
+	if len(failures) > 0 {
+		return &RestoreError{Failures: failures}
+	}
+	return nil
+}
@@ -0,0 +1,269 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package schema_test
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	bindata "github.com/golang-migrate/migrate/source/go_bindata"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"px.dev/pixie/src/cloud/plugin/schema"
+	"px.dev/pixie/src/shared/services/pgtest"
+)
+
+var db *sqlx.DB
+
+func TestMain(m *testing.M) {
+	err := testMain(m)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Got error: %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func testMain(m *testing.M) error {
+	s := bindata.Resource(schema.AssetNames(), schema.Asset)
+	testDB, teardown, err := pgtest.SetupTestDB(s)
+	if err != nil {
+		return fmt.Errorf("failed to start test database: %w", err)
+	}
+
+	defer teardown()
+	db = testDB
+
+	if c := m.Run(); c != 0 {
+		return fmt.Errorf("some tests failed with code: %d", c)
+	}
+	return nil
+}
+
+// nonIdempotentMigrations documents the migrations which are known to fail when re-applied, and the error they fail
+// with. New migrations should be guarded (for example, with IF NOT EXISTS) rather than added here.
+var nonIdempotentMigrations = map[string]string{
+	"000001_create_plugin_releases_table.up.sql":    `relation "plugin_releases" already exists`,
+	"000002_create_retention_releases_table.up.sql": `relation "data_retention_plugin_releases" already exists`,
+	"000003_create_org_retention_table.up.sql":      `relation "org_data_retention_plugins" already exists`,
+	"000004_create_retention_scripts_table.up.sql":  `relation "plugin_retention_scripts" already exists`,
+}
+
+func TestReapplyUpMigrations(t *testing.T) {
+	failures, err := schema.ReapplyUpMigrations(db)
+	require.NoError(t, err)
+
+	for _, name := range schema.AssetNames() {
+		if !strings.HasSuffix(name, ".up.sql") {
+			continue
+		}
+		expectedErr, known := nonIdempotentMigrations[name]
+		failure, failed := failures[name]
+		if !known {
+			assert.False(t, failed, "migration %s is not idempotent: %v", name, failure)
+			continue
+		}
+		if assert.True(t, failed, "migration %s is documented as non-idempotent, but was re-applied cleanly", name) {
+			assert.Contains(t, failure.Error(), expectedErr, "migration %s failed with an unexpected error", name)
+		}
+	}
+}
+
+func TestAssets(t *testing.T) {
+	files, err := filepath.Glob("*.sql")
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+	assert.Equal(t, files, schema.AssetNames())
+
+	for _, name := range files {
+		expected, err := os.ReadFile(name)
+		require.NoError(t, err)
+		contents, err := schema.Asset(name)
+		require.NoError(t, err)
+		assert.Equal(t, expected, contents, "migration %s does not match", name)
+	}
+
+	_, err = schema.Asset("missing.sql")
+	assert.Error(t, err)
+}
+
+// lastBindataMigration is the version of the last migration in the go-bindata file which the embedded migrations
+// replaced.
+const lastBindataMigration = 21
+
+// bindataSHA256 is the SHA-256 of the go-bindata assets for the migrations up to lastBindataMigration, hashed as in
+// TestAssetsMatchBindata, leaving out changedSinceBindata.
+const bindataSHA256 = "6c90b7c2a37b276a855c1535e820c645883d1560333f1ea7a47459465be10125"
+
+// changedSinceBindata are the migrations which intentionally differ from the go-bindata assets, and why.
+var changedSinceBindata = map[string]string{
+	"000006_add_pgcrypto.up.sql":                     "the asset was stale and lacked the file's trailing newline",
+	"000007_add_retention_script_run_times.up.sql":   "guarded so that it can be re-applied",
+	"000008_add_plugin_release_yanked.up.sql":        "guarded so that it can be re-applied",
+	"000009_add_retention_script_run_status.up.sql":  "guarded so that it can be re-applied",
+	"000010_add_retention_release_rate_limit.up.sql": "guarded so that it can be re-applied",
+	"000017_dedup_org_retention_plugins.up.sql":      "emptied, since the primary key prevents duplicate rows",
+	"000017_dedup_org_retention_plugins.down.sql":    "emptied, since the primary key prevents duplicate rows",
+}
+
+// TestAssetsMatchBindata checks that the migrations which were served from go-bindata are served unchanged, since
+// databases have already applied them.
+func TestAssetsMatchBindata(t *testing.T) {
+	h := sha256.New()
+	count := 0
+	for _, name := range schema.AssetNames() {
+		version, err := strconv.Atoi(strings.SplitN(name, "_", 2)[0])
+		require.NoError(t, err)
+		if version > lastBindataMigration {
+			continue
+		}
+		count++
+		if _, changed := changedSinceBindata[name]; changed {
+			continue
+		}
+		contents, err := schema.Asset(name)
+		require.NoError(t, err)
+		fmt.Fprintf(h, "%s\n%d\n", name, len(contents))
+		h.Write(contents)
+	}
+	assert.Equal(t, 2*lastBindataMigration, count)
+	assert.Equal(t, bindataSHA256, fmt.Sprintf("%x", h.Sum(nil)))
+}
+
+func TestCheckMigrations(t *testing.T) {
+	var version int64
+	require.NoError(t, db.QueryRow(`SELECT version FROM schema_migrations`).Scan(&version))
+	defer db.MustExec(`UPDATE schema_migrations SET version=$1, dirty=false`, version)
+
+	tests := []struct {
+		name          string
+		version       int64
+		dirty         bool
+		expectedError string
+	}{
+		{
+			name:    "up to date",
+			version: version,
+		},
+		{
+			name:          "behind",
+			version:       version - 2,
+			expectedError: "2 migration(s) have not been applied",
+		},
+		{
+			name:          "ahead",
+			version:       version + 1,
+			expectedError: "newer than the latest migration",
+		},
+		{
+			name:          "dirty",
+			version:       version,
+			dirty:         true,
+			expectedError: "is dirty",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db.MustExec(`UPDATE schema_migrations SET version=$1, dirty=$2`, test.version, test.dirty)
+
+			err := schema.CheckMigrations(db, "schema_migrations")
+			if test.expectedError == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.expectedError)
+		})
+	}
+
+	err := schema.CheckMigrations(db, "missing_migrations")
+	assert.Error(t, err)
+}
+
+func TestRestoreAssets(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, schema.RestoreAssets(dir, ""))
+	for _, name := range schema.AssetNames() {
+		expected, err := schema.Asset(name)
+		require.NoError(t, err)
+		contents, err := os.ReadFile(filepath.Join(dir, name))
+		require.NoError(t, err)
+		assert.Equal(t, expected, contents)
+	}
+
+	dir = t.TempDir()
+	require.NoError(t, schema.RestoreAssets(dir, "000001_create_plugin_releases_table.up.sql"))
+	files, err := filepath.Glob(filepath.Join(dir, "*"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "000001_create_plugin_releases_table.up.sql")}, files)
+}
+
+func TestRestoreAssets_CollectedErrors(t *testing.T) {
+	names := schema.AssetNames()
+	failing := []string{names[0], names[len(names)-1]}
+
+	// Directories in place of the migration files cause them to fail to be written.
+	newDir := func(t *testing.T) string {
+		dir := t.TempDir()
+		for _, name := range failing {
+			require.NoError(t, os.Mkdir(filepath.Join(dir, name), 0755))
+		}
+		return dir
+	}
+
+	t.Run("stops at first failure", func(t *testing.T) {
+		dir := newDir(t)
+		err := schema.RestoreAssets(dir, "")
+		require.Error(t, err)
+		_, ok := err.(*schema.RestoreError)
+		assert.False(t, ok)
+
+		_, err = os.Stat(filepath.Join(dir, names[1]))
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("collects every failure", func(t *testing.T) {
+		dir := newDir(t)
+		err := schema.RestoreAssets(dir, "", schema.WithCollectedErrors())
+		require.Error(t, err)
+		restoreErr, ok := err.(*schema.RestoreError)
+		require.True(t, ok)
+		assert.Len(t, restoreErr.Failures, 2)
+		for _, name := range failing {
+			assert.Contains(t, restoreErr.Failures, filepath.Join(dir, name))
+			assert.Contains(t, err.Error(), filepath.Join(dir, name))
+		}
+
+		for _, name := range names[1 : len(names)-1] {
+			expected, err := schema.Asset(name)
+			require.NoError(t, err)
+			contents, err := os.ReadFile(filepath.Join(dir, name))
+			require.NoError(t, err)
+			assert.Equal(t, expected, contents)
+		}
+	})
+}
@@ -36,6 +36,8 @@ export interface GQLQuery {
   deploymentKey: GQLDeploymentKey;
   apiKeys: Array<GQLAPIKeyMetadata>;
   apiKey: GQLAPIKey;
+  plugins: Array<GQLPlugin>;
+  orgRetentionPluginConfig: Array<GQLPluginConfig>;
 }
 
 export interface GQLMutation {
@@ -281,6 +283,25 @@ export interface GQLScriptContents {
   contents: string;
 }
 
+export enum GQLPluginKind {
+  PK_UNKNOWN = 'PK_UNKNOWN',
+  PK_RETENTION = 'PK_RETENTION'
+}
+
+export interface GQLPlugin {
+  id: string;
+  name: string;
+  description: string;
+  logo: string;
+  latestVersion: string;
+  retentionSupported: boolean;
+}
+
+export interface GQLPluginConfig {
+  name: string;
+  value: string;
+}
+
 export enum GQLArtifactType {
   AT_UNKNOWN = 'AT_UNKNOWN',
   AT_LINUX_AMD64 = 'AT_LINUX_AMD64',
@@ -346,6 +367,8 @@ export interface GQLResolver {
   LiveViewContents?: GQLLiveViewContentsTypeResolver;
   ScriptMetadata?: GQLScriptMetadataTypeResolver;
   ScriptContents?: GQLScriptContentsTypeResolver;
+  Plugin?: GQLPluginTypeResolver;
+  PluginConfig?: GQLPluginConfigTypeResolver;
   CLIArtifact?: GQLCLIArtifactTypeResolver;
 }
 export interface GQLQueryTypeResolver<TParent = any> {
@@ -372,6 +395,8 @@ export interface GQLQueryTypeResolver<TParent = any> {
   deploymentKey?: QueryToDeploymentKeyResolver<TParent>;
   apiKeys?: QueryToApiKeysResolver<TParent>;
   apiKey?: QueryToApiKeyResolver<TParent>;
+  plugins?: QueryToPluginsResolver<TParent>;
+  orgRetentionPluginConfig?: QueryToOrgRetentionPluginConfigResolver<TParent>;
 }
 
 export interface QueryToNoopResolver<TParent = any, TResult = any> {
@@ -508,6 +533,20 @@ export interface QueryToApiKeyResolver<TParent = any, TResult = any> {
   (parent: TParent, args: QueryToApiKeyArgs, context: any, info: GraphQLResolveInfo): TResult;
 }
 
+export interface QueryToPluginsArgs {
+  kind?: GQLPluginKind;
+}
+export interface QueryToPluginsResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: QueryToPluginsArgs, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface QueryToOrgRetentionPluginConfigArgs {
+  id: string;
+}
+export interface QueryToOrgRetentionPluginConfigResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: QueryToOrgRetentionPluginConfigArgs, context: any, info: GraphQLResolveInfo): TResult;
+}
+
 export interface GQLMutationTypeResolver<TParent = any> {
   noop?: MutationToNoopResolver<TParent>;
   CreateCluster?: MutationToCreateClusterResolver<TParent>;
@@ -1205,6 +1244,52 @@ export interface ScriptContentsToContentsResolver<TParent = any, TResult = any>
   (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
 }
 
+export interface GQLPluginTypeResolver<TParent = any> {
+  id?: PluginToIdResolver<TParent>;
+  name?: PluginToNameResolver<TParent>;
+  description?: PluginToDescriptionResolver<TParent>;
+  logo?: PluginToLogoResolver<TParent>;
+  latestVersion?: PluginToLatestVersionResolver<TParent>;
+  retentionSupported?: PluginToRetentionSupportedResolver<TParent>;
+}
+
+export interface PluginToIdResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface PluginToNameResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface PluginToDescriptionResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface PluginToLogoResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface PluginToLatestVersionResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface PluginToRetentionSupportedResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface GQLPluginConfigTypeResolver<TParent = any> {
+  name?: PluginConfigToNameResolver<TParent>;
+  value?: PluginConfigToValueResolver<TParent>;
+}
+
+export interface PluginConfigToNameResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
+export interface PluginConfigToValueResolver<TParent = any, TResult = any> {
+  (parent: TParent, args: {}, context: any, info: GraphQLResolveInfo): TResult;
+}
+
 export interface GQLCLIArtifactTypeResolver<TParent = any> {
   url?: CLIArtifactToUrlResolver<TParent>;
   sha256?: CLIArtifactToSha256Resolver<TParent>;